@@ -0,0 +1,419 @@
+package admission
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// Admission keeps the admission hooks of every namespace and runs them on
+// the hosts and services written to it.
+type Admission interface {
+	PostHook(ctx context.Context, h Hook) error
+	GetHook(ctx context.Context, id string) (Hook, error)
+	PutHook(ctx context.Context, id string, h Hook) error
+	DeleteHook(ctx context.Context, id string) error
+	ListHooks(ctx context.Context) ([]Hook, error)
+	Admit(ctx context.Context, r Request) (Review, error)
+}
+
+// Resources and operations hooks are called for.
+const (
+	ResourceHost    = "host"
+	ResourceService = "service"
+
+	OpCreate = "create"
+	OpUpdate = "update"
+)
+
+type HookType string
+
+// Mutating hooks may patch the object; they run first, one after the
+// other in ID order, each seeing the patches of the previous ones.
+// Validating hooks then see the final object and can only allow or reject
+// it.
+const (
+	Mutating   HookType = "mutating"
+	Validating HookType = "validating"
+)
+
+type FailurePolicy string
+
+// The failure policy decides what happens when a hook cannot be called,
+// times out or answers with something other than a review: Fail rejects
+// the write and Ignore carries on as if the hook had allowed it.
+const (
+	Fail   FailurePolicy = "fail"
+	Ignore FailurePolicy = "ignore"
+)
+
+// Hook is an external HTTP endpoint that reviews the host and service
+// writes of its namespace. Empty Resources and Operations match every
+// write. Timeout defaults to 5s and FailurePolicy to Fail.
+type Hook struct {
+	ID            string           `json:"id"`
+	Namespace     string           `json:"namespace"`
+	URL           string           `json:"url"`
+	Type          HookType         `json:"type"`
+	Resources     []string         `json:"resources,omitempty"`
+	Operations    []string         `json:"operations,omitempty"`
+	Timeout       service.Duration `json:"timeout"`
+	FailurePolicy FailurePolicy    `json:"failurepolicy"`
+	CreatedAt     time.Time        `json:"createtime"`
+	UpdatedAt     time.Time        `json:"updatetime"`
+	Remark        string           `json:"remark"`
+}
+
+func (h Hook) match(r Request) bool {
+	if len(h.Resources) > 0 && !contains(h.Resources, r.Resource) {
+		return false
+	}
+	if len(h.Operations) > 0 && !contains(h.Operations, r.Operation) {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Request is what a hook is sent: the object being written and, on update,
+// the object as stored.
+type Request struct {
+	UID       string          `json:"uid"`
+	Namespace string          `json:"namespace"`
+	Resource  string          `json:"resource"`
+	Operation string          `json:"operation"`
+	ObjectID  string          `json:"objectid"`
+	Object    json.RawMessage `json:"object"`
+	OldObject json.RawMessage `json:"oldobject,omitempty"`
+}
+
+// Response is what a hook answers. A hook that rejects the write should
+// give a Reason; a mutating hook that allows it may return a JSON patch to
+// apply to the object.
+type Response struct {
+	Allowed bool      `json:"allowed"`
+	Reason  string    `json:"reason,omitempty"`
+	Patch   []PatchOp `json:"patch,omitempty"`
+}
+
+// Review is the outcome of Admit: the object as the hooks left it and what
+// each hook did.
+type Review struct {
+	Object json.RawMessage `json:"object"`
+	Hooks  []HookResult    `json:"hooks"`
+}
+
+// HookResult is the answer of one hook. Error is set if the hook failed,
+// in which case Allowed follows its failure policy.
+type HookResult struct {
+	HookID  string `json:"hookid"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	Patched bool   `json:"patched,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// DeniedError is returned by Admit when a hook rejects the write, or fails
+// and its failure policy is Fail.
+type DeniedError struct {
+	HookID string
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("denied by admission hook %s: %s", e.HookID, e.Reason)
+}
+
+const (
+	defaultTimeout = 5 * time.Second
+	maxTimeout     = 30 * time.Second
+	// maxResponse bounds the size of a hook response.
+	maxResponse = 1 << 20
+)
+
+var (
+	ErrInconsistentIDs = errors.New("inconsistent IDs")
+	ErrAlreadyExists   = errors.New("already exists")
+	ErrNotFound        = errors.New("not found")
+	ErrInvalidHook     = errors.New("invalid admission hook")
+	ErrInvalidURL      = errors.New("invalid admission hook URL")
+	ErrInvalidRequest  = errors.New("invalid admission request")
+)
+
+// key identifies a hook across namespaces.
+type key struct {
+	namespace string
+	id        string
+}
+
+type inmemAdmission struct {
+	mtx    sync.RWMutex
+	hooks  map[key]Hook
+	client *http.Client
+}
+
+// NewInmemAdmission returns an Admission that keeps its hooks in memory.
+func NewInmemAdmission() Admission {
+	return &inmemAdmission{
+		hooks:  map[key]Hook{},
+		client: &http.Client{},
+	}
+}
+
+func (s *inmemAdmission) PostHook(ctx context.Context, h Hook) error {
+	h.Namespace = namespace.FromContext(ctx)
+	h.setDefaults()
+	if err := h.validate(); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: h.Namespace, id: h.ID}
+	if _, ok := s.hooks[k]; ok {
+		return ErrAlreadyExists
+	}
+
+	currentTime := time.Now()
+	h.CreatedAt = currentTime
+	h.UpdatedAt = currentTime
+
+	s.hooks[k] = h
+	return nil
+}
+
+func (s *inmemAdmission) GetHook(ctx context.Context, id string) (Hook, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	h, ok := s.hooks[key{namespace: namespace.FromContext(ctx), id: id}]
+	if !ok {
+		return Hook{}, ErrNotFound
+	}
+	return h, nil
+}
+
+func (s *inmemAdmission) PutHook(ctx context.Context, id string, h Hook) error {
+	if id != h.ID {
+		return ErrInconsistentIDs
+	}
+	h.Namespace = namespace.FromContext(ctx)
+	h.setDefaults()
+	if err := h.validate(); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: h.Namespace, id: id}
+	h.UpdatedAt = time.Now()
+	h.CreatedAt = h.UpdatedAt
+	if last, ok := s.hooks[k]; ok {
+		h.CreatedAt = last.CreatedAt
+	}
+
+	s.hooks[k] = h
+	return nil
+}
+
+func (s *inmemAdmission) DeleteHook(ctx context.Context, id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: namespace.FromContext(ctx), id: id}
+	if _, ok := s.hooks[k]; !ok {
+		return ErrNotFound
+	}
+	delete(s.hooks, k)
+	return nil
+}
+
+func (s *inmemAdmission) ListHooks(ctx context.Context) ([]Hook, error) {
+	ns := namespace.FromContext(ctx)
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []Hook{}
+	for _, h := range s.hooks {
+		if h.Namespace == ns {
+			list = append(list, h)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// Admit runs r through the hooks of its namespace that match it, mutating
+// hooks first. It stops at the first hook that rejects the write and
+// returns a *DeniedError. The lock is not held while hooks are called.
+func (s *inmemAdmission) Admit(ctx context.Context, r Request) (Review, error) {
+	if r.Resource != ResourceHost && r.Resource != ResourceService {
+		return Review{}, ErrInvalidRequest
+	}
+	if r.Operation != OpCreate && r.Operation != OpUpdate {
+		return Review{}, ErrInvalidRequest
+	}
+	if r.Namespace == "" {
+		r.Namespace = namespace.FromContext(ctx)
+	}
+	if r.UID == "" {
+		r.UID = newID()
+	}
+
+	var hooks []Hook
+	s.mtx.RLock()
+	for _, h := range s.hooks {
+		if h.Namespace == r.Namespace && h.match(r) {
+			hooks = append(hooks, h)
+		}
+	}
+	s.mtx.RUnlock()
+	sort.Slice(hooks, func(i, j int) bool {
+		if hooks[i].Type != hooks[j].Type {
+			return hooks[i].Type == Mutating
+		}
+		return hooks[i].ID < hooks[j].ID
+	})
+
+	review := Review{Object: r.Object, Hooks: []HookResult{}}
+	for _, h := range hooks {
+		r.Object = review.Object
+		res := HookResult{HookID: h.ID}
+		resp, err := s.call(ctx, h, r)
+		var object json.RawMessage
+		if err == nil && resp.Allowed && len(resp.Patch) > 0 {
+			if h.Type != Mutating {
+				err = errors.New("validating hook returned a patch")
+			} else if object, err = applyPatch(r.Object, resp.Patch); err == nil {
+				err = checkID(r.Object, object)
+			}
+		}
+
+		if err != nil {
+			res.Error = err.Error()
+			res.Allowed = h.FailurePolicy == Ignore
+			review.Hooks = append(review.Hooks, res)
+			if !res.Allowed {
+				return review, &DeniedError{HookID: h.ID, Reason: "hook failed: " + err.Error()}
+			}
+			continue
+		}
+		res.Allowed, res.Reason = resp.Allowed, resp.Reason
+		review.Hooks = append(review.Hooks, res)
+		if !resp.Allowed {
+			reason := resp.Reason
+			if reason == "" {
+				reason = "rejected"
+			}
+			return review, &DeniedError{HookID: h.ID, Reason: reason}
+		}
+		if object != nil {
+			review.Object = object
+			review.Hooks[len(review.Hooks)-1].Patched = true
+		}
+	}
+	return review, nil
+}
+
+// call sends r to hook h and decodes its response.
+func (s *inmemAdmission) call(ctx context.Context, h Hook, r Request) (Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(h.Timeout))
+	defer cancel()
+
+	body, err := json.Marshal(r)
+	if err != nil {
+		return Response{}, err
+	}
+	req, err := http.NewRequest("POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return Response{}, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return Response{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Response{}, fmt.Errorf("hook returned status %d", resp.StatusCode)
+	}
+	var out Response
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(&out); err != nil {
+		return Response{}, err
+	}
+	return out, nil
+}
+
+// checkID verifies that a patch left the id of the object alone.
+func checkID(before, after json.RawMessage) error {
+	var a, b struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(before, &a)
+	json.Unmarshal(after, &b)
+	if a.ID != b.ID {
+		return errors.New("patch changes the object id")
+	}
+	return nil
+}
+
+func (h *Hook) setDefaults() {
+	if h.Timeout == 0 {
+		h.Timeout = service.Duration(defaultTimeout)
+	}
+	if h.FailurePolicy == "" {
+		h.FailurePolicy = Fail
+	}
+}
+
+func (h Hook) validate() error {
+	if h.ID == "" {
+		return ErrInvalidHook
+	}
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	if h.Type != Mutating && h.Type != Validating {
+		return ErrInvalidHook
+	}
+	if h.FailurePolicy != Fail && h.FailurePolicy != Ignore {
+		return ErrInvalidHook
+	}
+	if h.Timeout <= 0 || time.Duration(h.Timeout) > maxTimeout {
+		return ErrInvalidHook
+	}
+	for _, r := range h.Resources {
+		if r != ResourceHost && r != ResourceService {
+			return ErrInvalidHook
+		}
+	}
+	for _, op := range h.Operations {
+		if op != OpCreate && op != OpUpdate {
+			return ErrInvalidHook
+		}
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
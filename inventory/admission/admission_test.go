@@ -0,0 +1,111 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// hookServer answers every review with resp, or with status if it is not
+// 200.
+func hookServer(t *testing.T, status int, resp Response) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestAdmit(t *testing.T) {
+	ctx := context.Background()
+	allow := Response{Allowed: true}
+	label := Response{Allowed: true, Patch: []PatchOp{{Op: "add", Path: "/labels", Value: json.RawMessage(`{"team":"infra"}`)}}}
+	for _, tc := range []struct {
+		name   string
+		hooks  []Hook
+		resps  []Response
+		status int // of the second hook's server
+		object string
+		denied string // ID of the denying hook, or ""
+	}{
+		{
+			name:   "mutating hook patches before validating hook",
+			hooks:  []Hook{{ID: "a", Type: Validating}, {ID: "b", Type: Mutating}},
+			resps:  []Response{allow, label},
+			object: `{"id":"1","labels":{"team":"infra"}}`,
+		},
+		{
+			name:   "validating hook rejects",
+			hooks:  []Hook{{ID: "a", Type: Mutating}, {ID: "b", Type: Validating}},
+			resps:  []Response{allow, {Reason: "no"}},
+			denied: "b",
+		},
+		{
+			name:   "validating hook may not patch",
+			hooks:  []Hook{{ID: "a", Type: Mutating}, {ID: "b", Type: Validating}},
+			resps:  []Response{allow, label},
+			denied: "b",
+		},
+		{
+			name:   "patch of the id",
+			hooks:  []Hook{{ID: "a", Type: Mutating}, {ID: "b", Type: Mutating}},
+			resps:  []Response{allow, {Allowed: true, Patch: []PatchOp{{Op: "replace", Path: "/id", Value: json.RawMessage(`"2"`)}}}},
+			denied: "b",
+		},
+		{
+			name:   "failing hook with fail policy",
+			hooks:  []Hook{{ID: "a", Type: Mutating}, {ID: "b", Type: Validating}},
+			resps:  []Response{allow, allow},
+			status: http.StatusInternalServerError,
+			denied: "b",
+		},
+		{
+			name:   "failing hook with ignore policy",
+			hooks:  []Hook{{ID: "a", Type: Mutating}, {ID: "b", Type: Validating, FailurePolicy: Ignore}},
+			resps:  []Response{label, allow},
+			status: http.StatusInternalServerError,
+			object: `{"id":"1","labels":{"team":"infra"}}`,
+		},
+		{
+			name:   "hook for another resource",
+			hooks:  []Hook{{ID: "a", Type: Mutating}, {ID: "b", Type: Validating, Resources: []string{ResourceService}}},
+			resps:  []Response{allow, {Reason: "no"}},
+			object: `{"id":"1"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewInmemAdmission()
+			for i, h := range tc.hooks {
+				status := http.StatusOK
+				if i == 1 && tc.status != 0 {
+					status = tc.status
+				}
+				h.URL = hookServer(t, status, tc.resps[i])
+				if err := s.PostHook(ctx, h); err != nil {
+					t.Fatal(err)
+				}
+			}
+			review, err := s.Admit(ctx, Request{Resource: ResourceHost, Operation: OpCreate, ObjectID: "1", Object: json.RawMessage(`{"id":"1"}`)})
+			if tc.denied != "" {
+				denied, ok := err.(*DeniedError)
+				if !ok || denied.HookID != tc.denied {
+					t.Fatalf("got %v, want a denial by %s", err, tc.denied)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(review.Object) != tc.object {
+				t.Fatalf("object %s, want %s", review.Object, tc.object)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package admission
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	PostHookEndpoint   endpoint.Endpoint
+	GetHookEndpoint    endpoint.Endpoint
+	PutHookEndpoint    endpoint.Endpoint
+	DeleteHookEndpoint endpoint.Endpoint
+	ListHooksEndpoint  endpoint.Endpoint
+	AdmitEndpoint      endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Admission) Endpoints {
+	return Endpoints{
+		PostHookEndpoint:   MakePostHookEndpoint(s),
+		GetHookEndpoint:    MakeGetHookEndpoint(s),
+		PutHookEndpoint:    MakePutHookEndpoint(s),
+		DeleteHookEndpoint: MakeDeleteHookEndpoint(s),
+		ListHooksEndpoint:  MakeListHooksEndpoint(s),
+		AdmitEndpoint:      MakeAdmitEndpoint(s),
+	}
+}
+
+func MakePostHookEndpoint(s Admission) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(postHookRequest)
+		e := s.PostHook(ctx, req.Hook)
+		return postHookResponse{Err: e}, nil
+	}
+}
+
+func MakeGetHookEndpoint(s Admission) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getHookRequest)
+		h, e := s.GetHook(ctx, req.ID)
+		return getHookResponse{Hook: h, Err: e}, nil
+	}
+}
+
+func MakePutHookEndpoint(s Admission) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putHookRequest)
+		e := s.PutHook(ctx, req.ID, req.Hook)
+		return putHookResponse{Err: e}, nil
+	}
+}
+
+func MakeDeleteHookEndpoint(s Admission) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteHookRequest)
+		e := s.DeleteHook(ctx, req.ID)
+		return deleteHookResponse{Err: e}, nil
+	}
+}
+
+func MakeListHooksEndpoint(s Admission) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		list, e := s.ListHooks(ctx)
+		return listHooksResponse{Hooks: list, Err: e}, nil
+	}
+}
+
+// MakeAdmitEndpoint reviews a request without writing anything. A
+// rejection is part of the response rather than an error.
+func MakeAdmitEndpoint(s Admission) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(admitRequest)
+		review, e := s.Admit(ctx, req.Request)
+		resp := admitResponse{Review: review, Allowed: e == nil}
+		if d, ok := e.(*DeniedError); ok {
+			resp.Reason = d.Error()
+		} else {
+			resp.Err = e
+		}
+		return resp, nil
+	}
+}
+
+type postHookRequest struct {
+	Hook Hook
+}
+
+type postHookResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r postHookResponse) error() error { return r.Err }
+
+type getHookRequest struct {
+	ID string
+}
+
+type getHookResponse struct {
+	Hook Hook  `json:"hook"`
+	Err  error `json:"err,omitempty"`
+}
+
+func (r getHookResponse) error() error { return r.Err }
+
+type putHookRequest struct {
+	ID   string
+	Hook Hook
+}
+
+type putHookResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r putHookResponse) error() error { return r.Err }
+
+type deleteHookRequest struct {
+	ID string
+}
+
+type deleteHookResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r deleteHookResponse) error() error { return r.Err }
+
+type listHooksRequest struct{}
+
+type listHooksResponse struct {
+	Hooks []Hook `json:"hooks"`
+	Err   error  `json:"err,omitempty"`
+}
+
+func (r listHooksResponse) error() error { return r.Err }
+
+type admitRequest struct {
+	Request Request
+}
+
+type admitResponse struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+	Review  Review `json:"review"`
+	Err     error  `json:"err,omitempty"`
+}
+
+func (r admitResponse) error() error { return r.Err }
@@ -0,0 +1,170 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// HostMiddleware runs host creates and updates, including those of
+// batches, through the admission hooks before they reach next. A patched
+// host replaces the one written.
+func HostMiddleware(a Admission) host.Middleware {
+	return func(next host.Host) host.Host {
+		return &hostMiddleware{
+			Host:      next,
+			admission: a,
+		}
+	}
+}
+
+type hostMiddleware struct {
+	host.Host
+	admission Admission
+}
+
+func (mw hostMiddleware) PostHostInfo(ctx context.Context, h host.HostInfo) error {
+	if err := mw.admit(ctx, h.ID, &h); err != nil {
+		return err
+	}
+	return mw.Host.PostHostInfo(ctx, h)
+}
+
+func (mw hostMiddleware) PutHostInfo(ctx context.Context, id string, h host.HostInfo) error {
+	if err := mw.admit(ctx, id, &h); err != nil {
+		return err
+	}
+	return mw.Host.PutHostInfo(ctx, id, h)
+}
+
+func (mw hostMiddleware) BatchHostInfo(ctx context.Context, b host.Batch) ([]host.BatchResult, error) {
+	return host.ForwardBatch(ctx, b, func(op *host.HostOp) error {
+		if op.Op != host.OpCreate && op.Op != host.OpUpdate {
+			return nil
+		}
+		id := op.ID
+		if id == "" {
+			id = op.HostInfo.ID
+		}
+		return mw.admit(ctx, id, &op.HostInfo)
+	}, mw.Host.BatchHostInfo)
+}
+
+// admit reviews the write of h as host id, an update if the host exists.
+func (mw hostMiddleware) admit(ctx context.Context, id string, h *host.HostInfo) error {
+	r := Request{
+		Namespace: namespace.FromContext(ctx),
+		Resource:  ResourceHost,
+		Operation: OpCreate,
+		ObjectID:  id,
+	}
+	if last, err := mw.Host.GetHostInfo(ctx, id); err == nil {
+		r.Operation = OpUpdate
+		r.OldObject, _ = json.Marshal(last)
+	}
+	patched, err := admit(ctx, mw.admission, r, h)
+	if err != nil {
+		if e, ok := err.(*DeniedError); ok {
+			return &host.DeniedError{By: "admission hook " + e.HookID, Reason: e.Reason}
+		}
+		return err
+	}
+	if patched != nil {
+		*h = host.HostInfo{}
+		return json.Unmarshal(patched, h)
+	}
+	return nil
+}
+
+// ServiceMiddleware runs service creates and updates, including those of
+// batches, through the admission hooks before they reach next. A patched
+// service replaces the one written.
+func ServiceMiddleware(a Admission) service.MiddlewareService {
+	return func(next service.Service) service.Service {
+		return &serviceMiddleware{
+			Service:   next,
+			admission: a,
+		}
+	}
+}
+
+type serviceMiddleware struct {
+	service.Service
+	admission Admission
+}
+
+func (mw serviceMiddleware) PostServiceInfo(ctx context.Context, s service.ServiceInfo) error {
+	if err := mw.admit(ctx, s.ID, &s); err != nil {
+		return err
+	}
+	return mw.Service.PostServiceInfo(ctx, s)
+}
+
+func (mw serviceMiddleware) PutServiceInfo(ctx context.Context, id string, s service.ServiceInfo) error {
+	if err := mw.admit(ctx, id, &s); err != nil {
+		return err
+	}
+	return mw.Service.PutServiceInfo(ctx, id, s)
+}
+
+func (mw serviceMiddleware) BatchServiceInfo(ctx context.Context, b service.Batch) ([]service.BatchResult, error) {
+	return service.ForwardBatch(ctx, b, func(op *service.ServiceOp) error {
+		if op.Op != service.OpCreate && op.Op != service.OpUpdate {
+			return nil
+		}
+		id := op.ID
+		if id == "" {
+			id = op.ServiceInfo.ID
+		}
+		return mw.admit(ctx, id, &op.ServiceInfo)
+	}, mw.Service.BatchServiceInfo)
+}
+
+// admit reviews the write of s as service id, an update if the service
+// exists.
+func (mw serviceMiddleware) admit(ctx context.Context, id string, s *service.ServiceInfo) error {
+	r := Request{
+		Namespace: namespace.FromContext(ctx),
+		Resource:  ResourceService,
+		Operation: OpCreate,
+		ObjectID:  id,
+	}
+	if last, err := mw.Service.GetServiceInfo(ctx, id); err == nil {
+		r.Operation = OpUpdate
+		r.OldObject, _ = json.Marshal(last)
+	}
+	patched, err := admit(ctx, mw.admission, r, s)
+	if err != nil {
+		if e, ok := err.(*DeniedError); ok {
+			return &service.DeniedError{By: "admission hook " + e.HookID, Reason: e.Reason}
+		}
+		return err
+	}
+	if patched != nil {
+		*s = service.ServiceInfo{}
+		return json.Unmarshal(patched, s)
+	}
+	return nil
+}
+
+// admit sends object through a as r.Object and returns the object as
+// patched by the hooks, or nil if none patched it.
+func admit(ctx context.Context, a Admission, r Request, object interface{}) (json.RawMessage, error) {
+	var err error
+	if r.Object, err = json.Marshal(object); err != nil {
+		return nil, err
+	}
+	review, err := a.Admit(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range review.Hooks {
+		if h.Patched {
+			return review.Object, nil
+		}
+	}
+	return nil, nil
+}
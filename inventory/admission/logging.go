@@ -0,0 +1,77 @@
+package admission
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Middleware func(Admission) Admission
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Admission) Admission {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Admission
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) PostHook(ctx context.Context, h Hook) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostHook", "namespace", namespace.FromContext(ctx), "id", h.ID, "url", h.URL, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostHook(ctx, h)
+}
+
+func (mw loggingMiddleware) GetHook(ctx context.Context, id string) (h Hook, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetHook", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetHook(ctx, id)
+}
+
+func (mw loggingMiddleware) PutHook(ctx context.Context, id string, h Hook) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutHook", "namespace", namespace.FromContext(ctx), "id", id, "url", h.URL, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutHook(ctx, id, h)
+}
+
+func (mw loggingMiddleware) DeleteHook(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteHook", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteHook(ctx, id)
+}
+
+func (mw loggingMiddleware) ListHooks(ctx context.Context) (list []Hook, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListHooks", "namespace", namespace.FromContext(ctx), "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListHooks(ctx)
+}
+
+// Admit logs every hook that failed, including those whose failure was
+// ignored.
+func (mw loggingMiddleware) Admit(ctx context.Context, r Request) (review Review, err error) {
+	defer func(begin time.Time) {
+		keyvals := []interface{}{"method", "Admit", "namespace", namespace.FromContext(ctx), "resource", r.Resource, "operation", r.Operation, "objectid", r.ObjectID, "hooks", len(review.Hooks)}
+		for _, h := range review.Hooks {
+			if h.Error != "" {
+				keyvals = append(keyvals, "hook", h.HookID, "hookerr", h.Error)
+			}
+		}
+		keyvals = append(keyvals, "took", time.Since(begin), "err", err)
+		mw.logger.Log(keyvals...)
+	}(time.Now())
+	return mw.next.Admit(ctx, r)
+}
@@ -0,0 +1,238 @@
+package admission
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// PatchOp is one operation of a JSON patch (RFC 6902).
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+var (
+	errPatchOp     = errors.New("unknown patch operation")
+	errPatchPath   = errors.New("invalid patch path")
+	errPatchTarget = errors.New("patch path does not exist")
+	errPatchTest   = errors.New("patch test failed")
+)
+
+// applyPatch applies patch to the JSON document doc and returns the result.
+// Operations are applied in order and the first that fails aborts the
+// patch.
+func applyPatch(doc json.RawMessage, patch []PatchOp) (json.RawMessage, error) {
+	var v interface{}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return nil, err
+	}
+	for _, op := range patch {
+		var err error
+		if v, err = applyOp(v, op); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(v)
+}
+
+func applyOp(doc interface{}, op PatchOp) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		var value interface{}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			if len(path) == 0 {
+				return value, nil
+			}
+			if doc, err = remove(doc, path); err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, errPatchTest
+			}
+			return doc, nil
+		}
+	case "remove":
+		return remove(doc, path)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if doc, err = remove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			// Round-trip the value so the copy shares nothing with its
+			// source.
+			b, _ := json.Marshal(value)
+			json.Unmarshal(b, &value)
+		}
+		return add(doc, path, value)
+	default:
+		return nil, errPatchOp
+	}
+}
+
+// parsePointer splits a JSON pointer (RFC 6901) into its unescaped
+// reference tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, errPatchPath
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(t, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, t := range path {
+		switch c := doc.(type) {
+		case map[string]interface{}:
+			v, ok := c[t]
+			if !ok {
+				return nil, errPatchTarget
+			}
+			doc = v
+		case []interface{}:
+			i, err := index(t, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, errPatchTarget
+		}
+	}
+	return doc, nil
+}
+
+// add sets the value at path, inserting into arrays, and returns the
+// updated document.
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[last] = value
+		return doc, nil
+	case []interface{}:
+		i := len(c)
+		if last != "-" {
+			if i, err = index(last, len(c)); err != nil {
+				return nil, err
+			}
+		}
+		c = append(c, nil)
+		copy(c[i+1:], c[i:])
+		c[i] = value
+		return set(doc, path[:len(path)-1], c)
+	default:
+		return nil, errPatchTarget
+	}
+}
+
+// remove deletes the value at path and returns the updated document.
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errPatchPath
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := c[last]; !ok {
+			return nil, errPatchTarget
+		}
+		delete(c, last)
+		return doc, nil
+	case []interface{}:
+		i, err := index(last, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		c = append(c[:i], c[i+1:]...)
+		return set(doc, path[:len(path)-1], c)
+	default:
+		return nil, errPatchTarget
+	}
+}
+
+// set replaces the value at path, which must exist, and returns the updated
+// document. Arrays change length on insert and delete, so their parent has
+// to be updated.
+func set(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	switch c := parent.(type) {
+	case map[string]interface{}:
+		c[last] = value
+	case []interface{}:
+		i, err := index(last, len(c)-1)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = value
+	}
+	return doc, nil
+}
+
+// index parses an array index no greater than max.
+func index(t string, max int) (int, error) {
+	if t == "" || (len(t) > 1 && t[0] == '0') {
+		return 0, errPatchPath
+	}
+	i, err := strconv.Atoi(t)
+	if err != nil || i < 0 {
+		return 0, errPatchPath
+	}
+	if i > max {
+		return 0, errPatchTarget
+	}
+	return i, nil
+}
@@ -0,0 +1,52 @@
+package admission
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplyPatch(t *testing.T) {
+	doc := `{"id":"1","labels":{"env":"prod"},"tags":["a","b"]}`
+	for _, tc := range []struct {
+		name  string
+		patch string
+		want  string // the patched document, compact with sorted keys
+		err   error
+	}{
+		{"add member", `[{"op":"add","path":"/labels/team","value":"infra"}]`, `{"id":"1","labels":{"env":"prod","team":"infra"},"tags":["a","b"]}`, nil},
+		{"add replaces member", `[{"op":"add","path":"/labels/env","value":"dev"}]`, `{"id":"1","labels":{"env":"dev"},"tags":["a","b"]}`, nil},
+		{"insert into array", `[{"op":"add","path":"/tags/1","value":"x"}]`, `{"id":"1","labels":{"env":"prod"},"tags":["a","x","b"]}`, nil},
+		{"append to array", `[{"op":"add","path":"/tags/-","value":"x"}]`, `{"id":"1","labels":{"env":"prod"},"tags":["a","b","x"]}`, nil},
+		{"add past the end", `[{"op":"add","path":"/tags/3","value":"x"}]`, "", errPatchTarget},
+		{"add to missing parent", `[{"op":"add","path":"/owner/name","value":"x"}]`, "", errPatchTarget},
+		{"remove member", `[{"op":"remove","path":"/labels/env"}]`, `{"id":"1","labels":{},"tags":["a","b"]}`, nil},
+		{"remove array element", `[{"op":"remove","path":"/tags/0"}]`, `{"id":"1","labels":{"env":"prod"},"tags":["b"]}`, nil},
+		{"remove missing", `[{"op":"remove","path":"/labels/team"}]`, "", errPatchTarget},
+		{"replace array element", `[{"op":"replace","path":"/tags/1","value":"c"}]`, `{"id":"1","labels":{"env":"prod"},"tags":["a","c"]}`, nil},
+		{"replace missing", `[{"op":"replace","path":"/remark","value":"x"}]`, "", errPatchTarget},
+		{"move", `[{"op":"move","from":"/labels/env","path":"/env"}]`, `{"env":"prod","id":"1","labels":{},"tags":["a","b"]}`, nil},
+		{"copy", `[{"op":"copy","from":"/tags","path":"/labels/tags"}]`, `{"id":"1","labels":{"env":"prod","tags":["a","b"]},"tags":["a","b"]}`, nil},
+		{"copy then change the copy", `[{"op":"copy","from":"/tags","path":"/old"},{"op":"add","path":"/old/-","value":"c"}]`, `{"id":"1","labels":{"env":"prod"},"old":["a","b","c"],"tags":["a","b"]}`, nil},
+		{"test passes", `[{"op":"test","path":"/labels","value":{"env":"prod"}},{"op":"add","path":"/remark","value":"ok"}]`, `{"id":"1","labels":{"env":"prod"},"remark":"ok","tags":["a","b"]}`, nil},
+		{"test fails", `[{"op":"add","path":"/remark","value":"x"},{"op":"test","path":"/labels/env","value":"dev"}]`, "", errPatchTest},
+		{"escaped tokens", `[{"op":"add","path":"/labels/a~1b~0c","value":"x"}]`, `{"id":"1","labels":{"a/b~c":"x","env":"prod"},"tags":["a","b"]}`, nil},
+		{"whole document", `[{"op":"replace","path":"","value":{"id":"1"}}]`, `{"id":"1"}`, nil},
+		{"path without slash", `[{"op":"add","path":"labels","value":"x"}]`, "", errPatchPath},
+		{"index with leading zero", `[{"op":"remove","path":"/tags/01"}]`, "", errPatchPath},
+		{"unknown operation", `[{"op":"merge","path":"/labels"}]`, "", errPatchOp},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var patch []PatchOp
+			if err := json.Unmarshal([]byte(tc.patch), &patch); err != nil {
+				t.Fatal(err)
+			}
+			got, err := applyPatch(json.RawMessage(doc), patch)
+			if err != tc.err {
+				t.Fatalf("got %v, want %v", err, tc.err)
+			}
+			if err == nil && string(got) != tc.want {
+				t.Fatalf("got %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package admission
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+)
+
+func MakeHTTPHandler(s Admission, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext),
+	}
+
+	for _, prefix := range []string{"/admission/v1", "/admission/v1/namespaces/{ns}"} {
+		r.Methods("POST").Path(prefix + "/hooks/").Handler(httptransport.NewServer(
+			e.PostHookEndpoint,
+			decodePostHookRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/hooks/").Handler(httptransport.NewServer(
+			e.ListHooksEndpoint,
+			decodeListHooksRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/hooks/{id}").Handler(httptransport.NewServer(
+			e.GetHookEndpoint,
+			decodeGetHookRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("PUT").Path(prefix + "/hooks/{id}").Handler(httptransport.NewServer(
+			e.PutHookEndpoint,
+			decodePutHookRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("DELETE").Path(prefix + "/hooks/{id}").Handler(httptransport.NewServer(
+			e.DeleteHookEndpoint,
+			decodeDeleteHookRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("POST").Path(prefix + "/reviews").Handler(httptransport.NewServer(
+			e.AdmitEndpoint,
+			decodeAdmitRequest,
+			encodeResponse,
+			options...,
+		))
+	}
+	return r
+}
+
+func decodePostHookRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req postHookRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Hook); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeGetHookRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getHookRequest{ID: id}, nil
+}
+
+func decodePutHookRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var h Hook
+	if err := json.NewDecoder(r.Body).Decode(&h); err != nil {
+		return nil, err
+	}
+	return putHookRequest{
+		ID:   id,
+		Hook: h,
+	}, nil
+}
+
+func decodeDeleteHookRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return deleteHookRequest{ID: id}, nil
+}
+
+func decodeListHooksRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return listHooksRequest{}, nil
+}
+
+// decodeAdmitRequest reads a Request. The namespace is always the one of
+// the route.
+func decodeAdmitRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req admitRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Request); e != nil {
+		return nil, e
+	}
+	req.Request.Namespace = ""
+	return req, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	switch err {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrAlreadyExists, ErrInconsistentIDs, ErrInvalidHook, ErrInvalidURL, ErrInvalidRequest:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,164 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// An archive is written as gzip-compressed JSON: an envelope naming the
+// format and its version, and carrying the SHA-256 of its data, which is
+// checked before anything is decoded from it.
+const (
+	format  = "inventory-backup"
+	version = 1
+)
+
+// Archive is the content of every host and service store at one point in
+// time.
+type Archive struct {
+	Version   int           `json:"version"`
+	CreatedAt time.Time     `json:"createtime"`
+	Hosts     host.State    `json:"hosts"`
+	Services  service.State `json:"services"`
+}
+
+// Manifest describes an archive.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createtime"`
+	Checksum  string    `json:"checksum"`
+	Hosts     int       `json:"hosts"`
+	Services  int       `json:"services"`
+	Instances int       `json:"instances"`
+}
+
+var (
+	ErrInvalidArchive     = errors.New("not an inventory backup")
+	ErrUnsupportedVersion = errors.New("unsupported backup version")
+	ErrChecksumMismatch   = errors.New("backup checksum mismatch")
+)
+
+// InconsistentError is returned for an archive whose data does not load,
+// such as one with two hosts of the same IP.
+type InconsistentError struct {
+	Reason string
+}
+
+func (e *InconsistentError) Error() string {
+	return "inconsistent backup: " + e.Reason
+}
+
+type envelope struct {
+	Format    string          `json:"format"`
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"createtime"`
+	Checksum  string          `json:"checksum"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type data struct {
+	Hosts    host.State    `json:"hosts"`
+	Services service.State `json:"services"`
+}
+
+// Write writes a to w and returns its manifest.
+func Write(w io.Writer, a Archive) (Manifest, error) {
+	b, err := json.Marshal(data{Hosts: a.Hosts, Services: a.Services})
+	if err != nil {
+		return Manifest{}, err
+	}
+	sum := sha256.Sum256(b)
+	e := envelope{
+		Format:    format,
+		Version:   version,
+		CreatedAt: a.CreatedAt,
+		Checksum:  "sha256:" + hex.EncodeToString(sum[:]),
+		Data:      b,
+	}
+	zw := gzip.NewWriter(w)
+	if err := json.NewEncoder(zw).Encode(e); err != nil {
+		return Manifest{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return Manifest{}, err
+	}
+	return manifest(a, e.Checksum), nil
+}
+
+// Read reads an archive from r, refusing one that is not an archive, of
+// a version it does not know, or whose checksum does not match.
+func Read(r io.Reader) (Archive, Manifest, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return Archive{}, Manifest{}, ErrInvalidArchive
+	}
+	defer zr.Close()
+	var e envelope
+	if err := json.NewDecoder(zr).Decode(&e); err != nil {
+		return Archive{}, Manifest{}, ErrInvalidArchive
+	}
+	if e.Format != format {
+		return Archive{}, Manifest{}, ErrInvalidArchive
+	}
+	if e.Version != version {
+		return Archive{}, Manifest{}, ErrUnsupportedVersion
+	}
+	sum := sha256.Sum256(e.Data)
+	if e.Checksum != "sha256:"+hex.EncodeToString(sum[:]) {
+		return Archive{}, Manifest{}, ErrChecksumMismatch
+	}
+	var d data
+	if err := json.Unmarshal(e.Data, &d); err != nil {
+		return Archive{}, Manifest{}, ErrInvalidArchive
+	}
+	a := Archive{Version: e.Version, CreatedAt: e.CreatedAt, Hosts: d.Hosts, Services: d.Services}
+	return a, manifest(a, e.Checksum), nil
+}
+
+func manifest(a Archive, checksum string) Manifest {
+	return Manifest{
+		Version:   version,
+		CreatedAt: a.CreatedAt,
+		Checksum:  checksum,
+		Hosts:     len(a.Hosts.Hosts),
+		Services:  len(a.Services.Services),
+		Instances: len(a.Services.Instances),
+	}
+}
+
+// Check loads a into scratch in-memory stores, to find out whether it
+// would restore, and checks that every service is on a host of the
+// archive.
+func Check(a Archive) error {
+	ctx := context.Background()
+	if err := host.NewInmemHost().(host.Snapshotter).LoadState(ctx, a.Hosts); err != nil {
+		return &InconsistentError{Reason: "hosts: " + err.Error()}
+	}
+	if err := service.NewInmemService().(service.Snapshotter).LoadState(ctx, a.Services); err != nil {
+		return &InconsistentError{Reason: "services: " + err.Error()}
+	}
+	hosts := map[[2]string]bool{}
+	for _, h := range a.Hosts.Hosts {
+		hosts[[2]string{h.Namespace, h.ID}] = true
+	}
+	for _, s := range a.Services.Services {
+		ns := s.HostNamespace
+		if ns == "" {
+			ns = s.Namespace
+		}
+		if s.HostID != "" && !hosts[[2]string{ns, s.HostID}] {
+			return &InconsistentError{Reason: fmt.Sprintf("service %s/%s is on unknown host %s/%s", s.Namespace, s.ID, ns, s.HostID)}
+		}
+	}
+	return nil
+}
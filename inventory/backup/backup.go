@@ -0,0 +1,275 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// Backup exports the whole inventory as an archive and restores archives
+// into the host and service stores, whatever their backend.
+type Backup interface {
+	Export(ctx context.Context) (Archive, error)
+	Verify(ctx context.Context, a Archive) error
+	Restore(ctx context.Context, a Archive) error
+}
+
+// ErrBusy is returned when writes did not stop within the timeout of an
+// export or a restore.
+var ErrBusy = errors.New("inventory is busy, try again")
+
+// ErrNotLeader is returned when an archive is restored into a cluster node
+// other than the leader.
+var ErrNotLeader = errors.New("archives are restored on the cluster leader")
+
+// WriteLock holds off host and service writes while an archive is taken
+// or restored, so that the archive is a point in time: no service is in
+// it without its host. Writes pass through HostMiddleware and
+// ServiceMiddleware, placed right above the stores.
+type WriteLock struct {
+	mtx sync.RWMutex
+}
+
+// lock waits for the writes in progress to finish and holds off new ones.
+// Writes are not made to wait behind it, as a write held by a transaction
+// may need another write to finish.
+func (l *WriteLock) lock(ctx context.Context, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for !l.mtx.TryLock() {
+		if time.Now().After(deadline) {
+			return ErrBusy
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// batch runs a batch of writes through run, which passes the Hold it is
+// given on to the store. The writes are held off an archive as any other,
+// and a batch the store holds, for a transaction, keeps them held off
+// until it is committed or rolled back: the store stays locked until
+// then, so an archive taken meanwhile would wait on the store while the
+// transaction waits on the archive.
+func (l *WriteLock) batch(hold func(commit, rollback func()), run func(hold func(commit, rollback func()))) {
+	l.mtx.RLock()
+	held := false
+	defer func() {
+		if !held {
+			l.mtx.RUnlock()
+		}
+	}()
+	if hold == nil {
+		run(nil)
+		return
+	}
+	run(func(commit, rollback func()) {
+		held = true
+		hold(func() {
+			commit()
+			l.mtx.RUnlock()
+		}, func() {
+			rollback()
+			l.mtx.RUnlock()
+		})
+	})
+}
+
+type store struct {
+	hosts    host.Snapshotter
+	services service.Snapshotter
+	writes   *WriteLock
+	timeout  time.Duration
+}
+
+// NewBackup returns a Backup of hosts and services, whose writes go
+// through writes.
+func NewBackup(hosts host.Snapshotter, services service.Snapshotter, writes *WriteLock) Backup {
+	return &store{
+		hosts:    hosts,
+		services: services,
+		writes:   writes,
+		timeout:  10 * time.Second,
+	}
+}
+
+func (s *store) Export(ctx context.Context) (Archive, error) {
+	if err := s.writes.lock(ctx, s.timeout); err != nil {
+		return Archive{}, err
+	}
+	defer s.writes.mtx.Unlock()
+	a := Archive{Version: version, CreatedAt: time.Now().UTC()}
+	var err error
+	if a.Hosts, err = s.hosts.DumpState(ctx); err != nil {
+		return Archive{}, err
+	}
+	if a.Services, err = s.services.DumpState(ctx); err != nil {
+		return Archive{}, err
+	}
+	return a, nil
+}
+
+func (s *store) Verify(ctx context.Context, a Archive) error {
+	return Check(a)
+}
+
+// Restore replaces every host and service with those of a. If the
+// services do not load, the hosts are put back as they were.
+func (s *store) Restore(ctx context.Context, a Archive) error {
+	if err := Check(a); err != nil {
+		return err
+	}
+	if err := s.writes.lock(ctx, s.timeout); err != nil {
+		return err
+	}
+	defer s.writes.mtx.Unlock()
+	last, err := s.hosts.DumpState(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.hosts.LoadState(ctx, a.Hosts); err != nil {
+		return err
+	}
+	if err := s.services.LoadState(ctx, a.Services); err != nil {
+		s.hosts.LoadState(ctx, last)
+		return err
+	}
+	return nil
+}
+
+// HostMiddleware passes host writes through l.
+func HostMiddleware(l *WriteLock) host.Middleware {
+	return func(next host.Host) host.Host {
+		return &hostMiddleware{
+			Host:   next,
+			writes: l,
+		}
+	}
+}
+
+type hostMiddleware struct {
+	host.Host
+	writes *WriteLock
+}
+
+func (mw hostMiddleware) PostHostInfo(ctx context.Context, h host.HostInfo) error {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Host.PostHostInfo(ctx, h)
+}
+
+func (mw hostMiddleware) PutHostInfo(ctx context.Context, id string, h host.HostInfo) error {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Host.PutHostInfo(ctx, id, h)
+}
+
+func (mw hostMiddleware) DeleteHostInfo(ctx context.Context, id string) error {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Host.DeleteHostInfo(ctx, id)
+}
+
+func (mw hostMiddleware) UndeleteHostInfo(ctx context.Context, id string) (host.HostInfo, error) {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Host.UndeleteHostInfo(ctx, id)
+}
+
+func (mw hostMiddleware) PurgeHostInfo(ctx context.Context, id string) (host.HostInfo, error) {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Host.PurgeHostInfo(ctx, id)
+}
+
+func (mw hostMiddleware) BatchHostInfo(ctx context.Context, b host.Batch) (results []host.BatchResult, err error) {
+	mw.writes.batch(b.Hold, func(hold func(commit, rollback func())) {
+		b.Hold = hold
+		results, err = mw.Host.BatchHostInfo(ctx, b)
+	})
+	return results, err
+}
+
+// ServiceMiddleware passes service, health and instance writes through l.
+func ServiceMiddleware(l *WriteLock) service.MiddlewareService {
+	return func(next service.Service) service.Service {
+		return &serviceMiddleware{
+			Service: next,
+			writes:  l,
+		}
+	}
+}
+
+type serviceMiddleware struct {
+	service.Service
+	writes *WriteLock
+}
+
+func (mw serviceMiddleware) PostServiceInfo(ctx context.Context, s service.ServiceInfo) error {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Service.PostServiceInfo(ctx, s)
+}
+
+func (mw serviceMiddleware) PutServiceInfo(ctx context.Context, id string, s service.ServiceInfo) error {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Service.PutServiceInfo(ctx, id, s)
+}
+
+func (mw serviceMiddleware) DeleteServiceInfo(ctx context.Context, id string) error {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Service.DeleteServiceInfo(ctx, id)
+}
+
+func (mw serviceMiddleware) UndeleteServiceInfo(ctx context.Context, id string) (service.ServiceInfo, error) {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Service.UndeleteServiceInfo(ctx, id)
+}
+
+func (mw serviceMiddleware) PurgeServiceInfo(ctx context.Context, id string) (service.ServiceInfo, error) {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Service.PurgeServiceInfo(ctx, id)
+}
+
+func (mw serviceMiddleware) PutServiceHealth(ctx context.Context, id string, r service.CheckResult) error {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Service.PutServiceHealth(ctx, id, r)
+}
+
+func (mw serviceMiddleware) PostServiceInstance(ctx context.Context, serviceID string, in service.Instance) error {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Service.PostServiceInstance(ctx, serviceID, in)
+}
+
+func (mw serviceMiddleware) PutServiceInstance(ctx context.Context, serviceID, instanceID string, in service.Instance) error {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Service.PutServiceInstance(ctx, serviceID, instanceID, in)
+}
+
+func (mw serviceMiddleware) DeleteServiceInstance(ctx context.Context, serviceID, instanceID string) error {
+	mw.writes.mtx.RLock()
+	defer mw.writes.mtx.RUnlock()
+	return mw.Service.DeleteServiceInstance(ctx, serviceID, instanceID)
+}
+
+func (mw serviceMiddleware) BatchServiceInfo(ctx context.Context, b service.Batch) (results []service.BatchResult, err error) {
+	mw.writes.batch(b.Hold, func(hold func(commit, rollback func())) {
+		b.Hold = hold
+		results, err = mw.Service.BatchServiceInfo(ctx, b)
+	})
+	return results, err
+}
@@ -0,0 +1,86 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+	"github.com/xinyu/infra/inventory/sqlite"
+)
+
+func TestExportHeldBatch(t *testing.T) {
+	ctx := context.Background()
+	var writes WriteLock
+	hostStore, serviceStore := host.NewInmemHost(), service.NewInmemService()
+	hosts := HostMiddleware(&writes)(hostStore)
+	b := NewBackup(hostStore.(host.Snapshotter), serviceStore.(service.Snapshotter), &writes).(*store)
+	b.timeout = 50 * time.Millisecond
+
+	var commit func()
+	_, err := hosts.BatchHostInfo(ctx, host.Batch{
+		Ops:  []host.HostOp{{Op: host.OpCreate, HostInfo: host.HostInfo{ID: "1001"}}},
+		Hold: func(c, r func()) { commit = c },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Export(ctx); err != ErrBusy {
+		t.Fatalf("got %v exporting during a transaction, want %v", err, ErrBusy)
+	}
+	commit()
+	a, err := b.Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Hosts.Hosts) != 1 {
+		t.Fatalf("exported %+v, want the committed host", a.Hosts)
+	}
+}
+
+func TestRestoreSQLite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	hostStore, serviceStore := host.NewInmemHost(), service.NewInmemService()
+	if err := hostStore.PostHostInfo(ctx, host.HostInfo{ID: "1001", Name: "web1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := serviceStore.PostServiceInfo(ctx, service.ServiceInfo{ID: "web", HostID: "1001"}); err != nil {
+		t.Fatal(err)
+	}
+	a, err := NewBackup(hostStore.(host.Snapshotter), serviceStore.(service.Snapshotter), &WriteLock{}).Export(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := Write(&buf, a); err != nil {
+		t.Fatal(err)
+	}
+	in := filepath.Join(dir, "inventory.bak")
+	if err := os.WriteFile(in, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "inventory.db")
+	if err := RunCommand([]string{"restore", "-sqlite", path, "-i", in}, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	db, err := sqlite.Open(path, host.NewInmemHost(), service.NewInmemService(), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if h, err := db.Hosts().GetHostInfo(ctx, "1001"); err != nil || h.Name != "web1" {
+		t.Fatalf("got host %+v, %v, want web1", h, err)
+	}
+	if _, err := db.Services().GetServiceInfo(ctx, "web"); err != nil {
+		t.Fatal(err)
+	}
+}
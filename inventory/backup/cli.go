@@ -0,0 +1,164 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+	"github.com/xinyu/infra/inventory/sqlite"
+)
+
+var commands = map[string]func(args []string, stdout io.Writer) error{
+	"backup":  backupCommand,
+	"restore": restoreCommand,
+	"verify":  verifyCommand,
+}
+
+// IsCommand reports whether name is one of the commands of the package:
+// backup, restore and verify.
+func IsCommand(name string) bool {
+	_, ok := commands[name]
+	return ok
+}
+
+// RunCommand runs the command args[0] with the arguments that follow,
+// printing the manifest of the archive it dealt with to stdout.
+func RunCommand(args []string, stdout io.Writer) error {
+	run, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	return run(args[1:], stdout)
+}
+
+// backupCommand downloads an archive from a server and checks it.
+func backupCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	addr := fs.String("addr", "http://localhost:8080", "Base URL of the server to back up")
+	out := fs.String("o", "inventory.bak", "File to write the archive to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	resp, err := http.Get(strings.TrimRight(*addr, "/") + "/backup/v1/archive")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, resp.Body); err != nil {
+		return err
+	}
+	_, m, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	return printManifest(stdout, m)
+}
+
+// restoreCommand checks an archive and restores it into a server, which
+// may have another backend than the server it was taken from, or into a
+// SQLite database that a server is then started on.
+func restoreCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	addr := fs.String("addr", "http://localhost:8080", "Base URL of the server to restore into")
+	in := fs.String("i", "inventory.bak", "File to read the archive from")
+	db := fs.String("sqlite", "", "SQLite database to restore the archive into instead of a server; it must not be in use")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	b, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	a, m, err := Read(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	if *db != "" {
+		if err := restoreSQLite(*db, a); err != nil {
+			return err
+		}
+		return printManifest(stdout, m)
+	}
+	resp, err := http.Post(strings.TrimRight(*addr, "/")+"/backup/v1/restore", "application/gzip", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	var r manifestResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return err
+	}
+	return printManifest(stdout, r.Manifest)
+}
+
+// restoreSQLite replaces the hosts and services of the database at path
+// with those of a, creating the database if need be.
+func restoreSQLite(path string, a Archive) error {
+	db, err := sqlite.Open(path, host.NewInmemHost(), service.NewInmemService(), log.NewNopLogger())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var writes WriteLock
+	return NewBackup(db.Hosts().(host.Snapshotter), db.Services().(service.Snapshotter), &writes).Restore(context.Background(), a)
+}
+
+// verifyCommand checks an archive without a server: its checksum, and
+// that its data loads.
+func verifyCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	in := fs.String("i", "inventory.bak", "File to read the archive from")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	a, m, err := Read(f)
+	if err != nil {
+		return err
+	}
+	if err := Check(a); err != nil {
+		return err
+	}
+	return printManifest(stdout, m)
+}
+
+func printManifest(w io.Writer, m Manifest) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+func responseError(resp *http.Response) error {
+	var e struct {
+		Error string `json:"error"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&e) != nil || e.Error == "" {
+		return errors.New(resp.Status)
+	}
+	return fmt.Errorf("%s: %s", resp.Status, e.Error)
+}
@@ -0,0 +1,63 @@
+package backup
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	ExportEndpoint  endpoint.Endpoint
+	VerifyEndpoint  endpoint.Endpoint
+	RestoreEndpoint endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Backup) Endpoints {
+	return Endpoints{
+		ExportEndpoint:  MakeExportEndpoint(s),
+		VerifyEndpoint:  MakeVerifyEndpoint(s),
+		RestoreEndpoint: MakeRestoreEndpoint(s),
+	}
+}
+
+func MakeExportEndpoint(s Backup) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		a, e := s.Export(ctx)
+		return exportResponse{Archive: a, Err: e}, nil
+	}
+}
+
+func MakeVerifyEndpoint(s Backup) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(archiveRequest)
+		e := s.Verify(ctx, req.Archive)
+		return manifestResponse{Manifest: req.Manifest, Err: e}, nil
+	}
+}
+
+func MakeRestoreEndpoint(s Backup) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(archiveRequest)
+		e := s.Restore(ctx, req.Archive)
+		return manifestResponse{Manifest: req.Manifest, Err: e}, nil
+	}
+}
+
+type exportResponse struct {
+	Archive Archive
+	Err     error
+}
+
+func (r exportResponse) error() error { return r.Err }
+
+type archiveRequest struct {
+	Archive  Archive
+	Manifest Manifest
+}
+
+type manifestResponse struct {
+	Manifest Manifest `json:"manifest"`
+	Err      error    `json:"err,omitempty"`
+}
+
+func (r manifestResponse) error() error { return r.Err }
@@ -0,0 +1,29 @@
+package backup
+
+import (
+	"context"
+)
+
+// LeaderMiddleware refuses to restore unless leading reports true. In a
+// cluster, a restore replaces the replicated stores at once, which only
+// the leader does.
+func LeaderMiddleware(leading func() bool) Middleware {
+	return func(next Backup) Backup {
+		return &leaderMiddleware{
+			Backup:  next,
+			leading: leading,
+		}
+	}
+}
+
+type leaderMiddleware struct {
+	Backup
+	leading func() bool
+}
+
+func (mw leaderMiddleware) Restore(ctx context.Context, a Archive) error {
+	if !mw.leading() {
+		return ErrNotLeader
+	}
+	return mw.Backup.Restore(ctx, a)
+}
@@ -0,0 +1,45 @@
+package backup
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+type Middleware func(Backup) Backup
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Backup) Backup {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Backup
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) Export(ctx context.Context) (a Archive, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Export", "hosts", len(a.Hosts.Hosts), "services", len(a.Services.Services), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Export(ctx)
+}
+
+func (mw loggingMiddleware) Verify(ctx context.Context, a Archive) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Verify", "createtime", a.CreatedAt, "hosts", len(a.Hosts.Hosts), "services", len(a.Services.Services), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Verify(ctx, a)
+}
+
+func (mw loggingMiddleware) Restore(ctx context.Context, a Archive) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Restore", "createtime", a.CreatedAt, "hosts", len(a.Hosts.Hosts), "services", len(a.Services.Services), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Restore(ctx, a)
+}
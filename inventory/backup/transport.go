@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+)
+
+// MakeHTTPHandler serves archives of the whole inventory, every namespace
+// included. Archives go over the wire in the format Write writes.
+func MakeHTTPHandler(s Backup, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+	}
+
+	r.Methods("GET").Path("/backup/v1/archive").Handler(httptransport.NewServer(
+		e.ExportEndpoint,
+		decodeExportRequest,
+		encodeExportResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/backup/v1/verify").Handler(httptransport.NewServer(
+		e.VerifyEndpoint,
+		decodeArchiveRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/backup/v1/restore").Handler(httptransport.NewServer(
+		e.RestoreEndpoint,
+		decodeArchiveRequest,
+		encodeResponse,
+		options...,
+	))
+	return r
+}
+
+func decodeExportRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return struct{}{}, nil
+}
+
+func decodeArchiveRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	a, m, err := Read(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return archiveRequest{Archive: a, Manifest: m}, nil
+}
+
+// encodeExportResponse writes the archive as a file to download.
+func encodeExportResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(exportResponse)
+	if resp.Err != nil {
+		encodeError(ctx, resp.Err, w)
+		return nil
+	}
+	name := "inventory-" + resp.Archive.CreatedAt.Format("20060102T150405Z") + ".bak"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	_, err := Write(w, resp.Archive)
+	return err
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	if _, ok := err.(*InconsistentError); ok {
+		return http.StatusUnprocessableEntity
+	}
+	switch err {
+	case ErrInvalidArchive, ErrUnsupportedVersion, ErrChecksumMismatch:
+		return http.StatusBadRequest
+	case ErrBusy, ErrNotLeader:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,615 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb/v2"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// Cluster is the administration of a raft cluster of inventory nodes.
+type Cluster interface {
+	Status(ctx context.Context) (Status, error)
+	ListMembers(ctx context.Context) ([]Member, error)
+	AddMember(ctx context.Context, m Member) error
+	RemoveMember(ctx context.Context, id string) error
+	Snapshot(ctx context.Context) error
+	Forward(ctx context.Context, c Command) (*Result, error)
+}
+
+// Member is a node of the cluster. RaftAddr is where its peers reach it
+// for raft, HTTPAddr the base URL of its API, where followers forward
+// writes once it leads.
+type Member struct {
+	ID       string `json:"id"`
+	RaftAddr string `json:"raftaddr"`
+	HTTPAddr string `json:"httpaddr"`
+	Voter    bool   `json:"voter"`
+	Leader   bool   `json:"leader"`
+}
+
+// Status is the raft state of a node, as it sees the cluster.
+type Status struct {
+	ID           string `json:"id"`
+	State        string `json:"state"`
+	Leader       string `json:"leader"`
+	Term         uint64 `json:"term"`
+	LastIndex    uint64 `json:"lastindex"`
+	CommitIndex  uint64 `json:"commitindex"`
+	AppliedIndex uint64 `json:"appliedindex"`
+	Linearizable bool   `json:"linearizable"`
+	Members      int    `json:"members"`
+}
+
+var (
+	ErrNotLeader       = errors.New("not the cluster leader")
+	ErrNoLeader        = errors.New("cluster has no leader")
+	ErrUnknownMethod   = errors.New("unknown method")
+	ErrHoldUnsupported = errors.New("transactions are not supported by the replicated store")
+	ErrUnknownMember   = errors.New("unknown member")
+	ErrInvalidMember   = errors.New("member needs id, raftaddr and httpaddr")
+	ErrUnauthorized    = errors.New("forwarded call not from a member of the cluster")
+	ErrNotForwardable  = errors.New("call cannot be forwarded")
+)
+
+// Config configures a Node.
+type Config struct {
+	// ID names the node in the cluster. It must not change across
+	// restarts.
+	ID string
+	// RaftAddr is the host:port the node listens on for raft and that its
+	// peers dial.
+	RaftAddr string
+	// HTTPAddr is the base URL of the node's API, e.g. http://10.0.0.1:8080.
+	HTTPAddr string
+	// Dir holds the raft log and snapshots.
+	Dir string
+	// Bootstrap starts a new cluster with this node as its only member.
+	// It is ignored if Dir already holds raft state.
+	Bootstrap bool
+	// Linearizable makes reads go through the leader, which confirms its
+	// leadership and waits until it has applied every committed write.
+	// Otherwise reads are served from the local, possibly stale, state.
+	Linearizable bool
+	// SnapshotThreshold is the number of log entries after which the log
+	// is compacted into a snapshot. Zero keeps the raft default.
+	SnapshotThreshold uint64
+	// Timeout bounds applying a write and forwarding a call to the
+	// leader. Zero means 10s.
+	Timeout time.Duration
+	// HostUnique are the unique constraints of the replicated host store.
+	// Every node must be given the same.
+	HostUnique []host.Unique
+	// Secret is shared by the members: the leader only runs the calls
+	// forwarded by a member that sends it. Every node must be given the
+	// same.
+	Secret string
+}
+
+// Node is a member of a raft cluster that replicates a host and a service
+// store. Writes are applied through the raft log on the leader; followers
+// forward them to it. Other stores are not replicated: each node keeps its
+// own.
+type Node struct {
+	cfg    Config
+	raft   *raft.Raft
+	fsm    *fsm
+	store  *raftboltdb.BoltStore
+	client *http.Client
+	logger log.Logger
+
+	mtx      sync.Mutex
+	leading  bool
+	watchers map[chan bool]bool
+}
+
+// NewNode starts the node of cfg. Its stores are empty until it has
+// caught up with the cluster, or restored its own snapshot and log.
+func NewNode(cfg Config, logger log.Logger) (*Node, error) {
+	if cfg.ID == "" || cfg.RaftAddr == "" || cfg.HTTPAddr == "" || cfg.Dir == "" || cfg.Secret == "" {
+		return nil, errors.New("cluster: id, raft address, http address, dir and secret are required")
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(cfg.ID)
+	conf.Logger = hclog.New(&hclog.LoggerOptions{
+		Name:        "raft",
+		Output:      logWriter{logger},
+		DisableTime: true,
+	})
+	if cfg.SnapshotThreshold > 0 {
+		conf.SnapshotThreshold = cfg.SnapshotThreshold
+	}
+
+	store, err := raftboltdb.NewBoltStore(filepath.Join(cfg.Dir, "raft.db"))
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := raft.NewFileSnapshotStoreWithLogger(cfg.Dir, 2, conf.Logger)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	addr, err := net.ResolveTCPAddr("tcp", cfg.RaftAddr)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransportWithLogger(cfg.RaftAddr, addr, 3, cfg.Timeout, conf.Logger)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	n := &Node{
+		cfg:      cfg,
+		fsm:      newFSM(cfg.HostUnique),
+		store:    store,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		logger:   logger,
+		watchers: map[chan bool]bool{},
+	}
+	if cfg.Bootstrap {
+		existing, err := raft.HasExistingState(store, store, snapshots)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		if !existing {
+			err := raft.BootstrapCluster(conf, store, store, snapshots, transport, raft.Configuration{
+				Servers: []raft.Server{{ID: conf.LocalID, Address: transport.LocalAddr()}},
+			})
+			if err != nil {
+				store.Close()
+				return nil, err
+			}
+		}
+	}
+	if n.raft, err = raft.NewRaft(conf, n.fsm, store, store, snapshots, transport); err != nil {
+		store.Close()
+		return nil, err
+	}
+	go n.announce()
+	return n, nil
+}
+
+// announce tells the watchers of RunWhileLeader when the node gains or
+// loses leadership, and records the HTTP address of the node whenever it
+// becomes leader, so that followers know where to forward to.
+func (n *Node) announce() {
+	for leader := range n.raft.LeaderCh() {
+		n.mtx.Lock()
+		n.leading = leader
+		for w := range n.watchers {
+			// Only the latest state matters to a watcher.
+			select {
+			case <-w:
+			default:
+			}
+			w <- leader
+		}
+		n.mtx.Unlock()
+		if !leader || n.fsm.httpAddr(n.cfg.ID) == n.cfg.HTTPAddr {
+			continue
+		}
+		if _, err := n.apply(n.memberCommand("setMember", n.cfg.ID, n.cfg.HTTPAddr)); err != nil {
+			n.logger.Log("during", "announce", "err", err)
+		}
+	}
+}
+
+// Leader reports whether the node leads the cluster.
+func (n *Node) Leader() bool {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.leading
+}
+
+// RunWhileLeader calls run whenever the node becomes leader, with a
+// context that is cancelled when it loses leadership, so that background
+// work on the replicated stores is done by one node at a time. It returns
+// once ctx is cancelled and run has returned.
+func (n *Node) RunWhileLeader(ctx context.Context, run func(ctx context.Context)) {
+	w := make(chan bool, 1)
+	n.mtx.Lock()
+	n.watchers[w] = true
+	w <- n.leading
+	n.mtx.Unlock()
+	defer func() {
+		n.mtx.Lock()
+		delete(n.watchers, w)
+		n.mtx.Unlock()
+	}()
+
+	// stop cancels run and waits for it to return, if it is running.
+	var stop func()
+	defer func() {
+		if stop != nil {
+			stop()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case leader := <-w:
+			switch {
+			case !leader && stop != nil:
+				stop()
+				stop = nil
+			case leader && stop == nil:
+				lctx, cancel := context.WithCancel(ctx)
+				done := make(chan struct{})
+				go func() {
+					defer close(done)
+					run(lctx)
+				}()
+				stop = func() {
+					cancel()
+					<-done
+				}
+			}
+		}
+	}
+}
+
+// Join asks the cluster at addr, the base URL of any of its members, to
+// add the node as a voter. It retries until ctx is done.
+func (n *Node) Join(ctx context.Context, addr string) error {
+	body, _ := json.Marshal(Member{ID: n.cfg.ID, RaftAddr: n.cfg.RaftAddr, HTTPAddr: n.cfg.HTTPAddr, Voter: true})
+	for {
+		err := n.post(ctx, strings.TrimRight(addr, "/")+"/cluster/v1/members/", body, nil)
+		if err == nil {
+			return nil
+		}
+		n.logger.Log("during", "join", "addr", addr, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+}
+
+// Close leaves the cluster running without the node.
+func (n *Node) Close() error {
+	err := n.raft.Shutdown().Error()
+	if cerr := n.store.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (n *Node) Status(ctx context.Context) (Status, error) {
+	_, leader := n.raft.LeaderWithID()
+	st := Status{
+		ID:           n.cfg.ID,
+		State:        strings.ToLower(n.raft.State().String()),
+		Leader:       string(leader),
+		Term:         n.raft.CurrentTerm(),
+		LastIndex:    n.raft.LastIndex(),
+		CommitIndex:  n.raft.CommitIndex(),
+		AppliedIndex: n.raft.AppliedIndex(),
+		Linearizable: n.cfg.Linearizable,
+	}
+	f := n.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return Status{}, err
+	}
+	st.Members = len(f.Configuration().Servers)
+	return st, nil
+}
+
+func (n *Node) ListMembers(ctx context.Context) ([]Member, error) {
+	f := n.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return nil, err
+	}
+	_, leader := n.raft.LeaderWithID()
+	list := []Member{}
+	for _, s := range f.Configuration().Servers {
+		list = append(list, Member{
+			ID:       string(s.ID),
+			RaftAddr: string(s.Address),
+			HTTPAddr: n.fsm.httpAddr(string(s.ID)),
+			Voter:    s.Suffrage == raft.Voter,
+			Leader:   s.ID == leader,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// AddMember adds m to the cluster, as a voter or a nonvoter that only
+// replicates. On a follower the request is passed on to the leader.
+func (n *Node) AddMember(ctx context.Context, m Member) error {
+	if m.ID == "" || m.RaftAddr == "" || m.HTTPAddr == "" {
+		return ErrInvalidMember
+	}
+	if n.raft.State() != raft.Leader {
+		leader, err := n.leaderAddr()
+		if err != nil {
+			return err
+		}
+		body, _ := json.Marshal(m)
+		return n.post(ctx, leader+"/cluster/v1/members/", body, nil)
+	}
+	var f raft.IndexFuture
+	if m.Voter {
+		f = n.raft.AddVoter(raft.ServerID(m.ID), raft.ServerAddress(m.RaftAddr), 0, n.cfg.Timeout)
+	} else {
+		f = n.raft.AddNonvoter(raft.ServerID(m.ID), raft.ServerAddress(m.RaftAddr), 0, n.cfg.Timeout)
+	}
+	if err := f.Error(); err != nil {
+		return err
+	}
+	_, err := n.apply(n.memberCommand("setMember", m.ID, m.HTTPAddr))
+	return err
+}
+
+// RemoveMember removes member id from the cluster. On a follower the
+// request is passed on to the leader.
+func (n *Node) RemoveMember(ctx context.Context, id string) error {
+	if n.raft.State() != raft.Leader {
+		leader, err := n.leaderAddr()
+		if err != nil {
+			return err
+		}
+		return n.do(ctx, "DELETE", leader+"/cluster/v1/members/"+id, nil, nil)
+	}
+	f := n.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return err
+	}
+	found := false
+	for _, s := range f.Configuration().Servers {
+		found = found || s.ID == raft.ServerID(id)
+	}
+	if !found {
+		return ErrUnknownMember
+	}
+	if err := n.raft.RemoveServer(raft.ServerID(id), 0, n.cfg.Timeout).Error(); err != nil {
+		return err
+	}
+	if id == n.cfg.ID {
+		// The node is no longer leader and cannot apply anything more.
+		return nil
+	}
+	_, err := n.apply(n.memberCommand("removeMember", id, ""))
+	return err
+}
+
+// Snapshot snapshots the state of the node and compacts its log.
+func (n *Node) Snapshot(ctx context.Context) error {
+	return n.raft.Snapshot().Error()
+}
+
+// Forward runs c, sent by a follower, on the leader. The follower must be
+// a member of the cluster and send its secret: a forwarded call went
+// through the middlewares of the follower, and is not checked again. A
+// state is not loaded through a follower, as a forwarded call could
+// replace the whole store.
+func (n *Node) Forward(ctx context.Context, c Command) (*Result, error) {
+	if err := n.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	if loads[c.Method] {
+		return nil, ErrNotForwardable
+	}
+	if n.raft.State() != raft.Leader {
+		return nil, ErrNotLeader
+	}
+	if c.write() {
+		return n.apply(c)
+	}
+	if err := n.barrier(); err != nil {
+		return nil, err
+	}
+	return n.fsm.run(c), nil
+}
+
+// call runs method on the replicated stores with the namespace and time
+// of ctx. Writes go through the leader; reads are served locally unless
+// the node is linearizable.
+func (n *Node) call(ctx context.Context, method, id, instanceID string, args interface{}) (*Result, error) {
+	c := Command{
+		Method:     method,
+		Namespace:  namespace.FromContext(ctx),
+		All:        namespace.IsAll(ctx),
+		Time:       host.TimeFromContext(ctx),
+		Actor:      host.ActorFromContext(ctx),
+		Managed:    host.ManagedFromContext(ctx),
+		ID:         id,
+		InstanceID: instanceID,
+	}
+	if args != nil {
+		var err error
+		if c.Args, err = json.Marshal(args); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case c.write() && n.raft.State() == raft.Leader:
+		return n.apply(c)
+	case loads[c.Method]:
+		return nil, ErrNotLeader
+	case !c.write() && !n.cfg.Linearizable:
+		return n.fsm.run(c), nil
+	case !c.write() && n.raft.State() == raft.Leader:
+		if err := n.barrier(); err != nil {
+			return nil, err
+		}
+		return n.fsm.run(c), nil
+	}
+	leader, err := n.leaderAddr()
+	if err != nil {
+		return nil, err
+	}
+	body, _ := json.Marshal(c)
+	var r forwardResponse
+	if err := n.post(ctx, leader+"/cluster/v1/forward", body, &r); err != nil {
+		return nil, err
+	}
+	return r.Result, nil
+}
+
+// apply appends c to the raft log and waits for the leader to apply it.
+func (n *Node) apply(c Command) (*Result, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	f := n.raft.Apply(b, n.cfg.Timeout)
+	if err := f.Error(); err != nil {
+		if err == raft.ErrNotLeader {
+			return nil, ErrNotLeader
+		}
+		return nil, err
+	}
+	return f.Response().(*Result), nil
+}
+
+// barrier confirms that the node still leads and waits until it has
+// applied every write committed before the call, so that a read that
+// follows sees them.
+func (n *Node) barrier() error {
+	index := n.raft.CommitIndex()
+	if err := n.raft.VerifyLeader().Error(); err != nil {
+		if err == raft.ErrNotLeader || err == raft.ErrLeadershipLost {
+			return ErrNotLeader
+		}
+		return err
+	}
+	deadline := time.Now().Add(n.cfg.Timeout)
+	for n.raft.AppliedIndex() < index {
+		if time.Now().After(deadline) {
+			return raft.ErrEnqueueTimeout
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+func (n *Node) memberCommand(method, id, httpAddr string) Command {
+	c := Command{Method: method, ID: id, Time: time.Now()}
+	if method == "setMember" {
+		c.Args, _ = json.Marshal(httpAddr)
+	}
+	return c
+}
+
+// leaderAddr returns the HTTP address of the leader.
+func (n *Node) leaderAddr() (string, error) {
+	_, id := n.raft.LeaderWithID()
+	if id == "" {
+		return "", ErrNoLeader
+	}
+	addr := n.fsm.httpAddr(string(id))
+	if addr == "" {
+		return "", ErrNoLeader
+	}
+	return strings.TrimRight(addr, "/"), nil
+}
+
+func (n *Node) post(ctx context.Context, url string, body []byte, out interface{}) error {
+	return n.do(ctx, "POST", url, body, out)
+}
+
+// authenticate checks that the peer of ctx is a member of the cluster that
+// sent the secret of the node.
+func (n *Node) authenticate(ctx context.Context) error {
+	p, _ := ctx.Value(peerKey{}).(peer)
+	if subtle.ConstantTimeCompare([]byte(p.secret), []byte(n.cfg.Secret)) != 1 {
+		return ErrUnauthorized
+	}
+	f := n.raft.GetConfiguration()
+	if err := f.Error(); err != nil {
+		return err
+	}
+	for _, s := range f.Configuration().Servers {
+		if string(s.ID) == p.id {
+			return nil
+		}
+	}
+	return ErrUnauthorized
+}
+
+type peerKey struct{}
+
+// peer is the member that sent a request, as it names itself.
+type peer struct {
+	id     string
+	secret string
+}
+
+// peerHTTPToContext moves the member ID and secret sent by another member
+// into the context.
+func peerHTTPToContext(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, peerKey{}, peer{id: r.Header.Get("X-Cluster-Member"), secret: r.Header.Get("X-Cluster-Secret")})
+}
+
+// do calls another member and decodes its response into out.
+func (n *Node) do(ctx context.Context, method, url string, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-Cluster-Member", n.cfg.ID)
+	req.Header.Set("X-Cluster-Secret", n.cfg.Secret)
+	resp, err := n.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&e)
+		for _, err := range clusterErrors {
+			if err.Error() == e.Error {
+				return err
+			}
+		}
+		return fmt.Errorf("%s %s: %s: %s", method, url, resp.Status, e.Error)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// logWriter logs each line raft writes.
+type logWriter struct {
+	logger log.Logger
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.logger.Log("msg", strings.TrimSpace(string(p)))
+	return len(p), nil
+}
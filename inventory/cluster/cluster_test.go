@@ -0,0 +1,232 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// testNode is a node with its API served on a local port.
+type testNode struct {
+	*Node
+	server *http.Server
+}
+
+func startNode(t *testing.T, id string, bootstrap bool) *testNode {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The raft transport listens on a port of its own; take a free one.
+	r, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raftAddr := r.Addr().String()
+	r.Close()
+
+	n, err := NewNode(Config{
+		ID:        id,
+		RaftAddr:  raftAddr,
+		HTTPAddr:  "http://" + l.Addr().String(),
+		Dir:       t.TempDir(),
+		Bootstrap: bootstrap,
+		Timeout:   5 * time.Second,
+		Secret:    "s3cret",
+	}, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tn := &testNode{Node: n, server: &http.Server{Handler: MakeHTTPHandler(n, log.NewNopLogger())}}
+	go tn.server.Serve(l)
+	t.Cleanup(func() {
+		tn.server.Close()
+		n.Close()
+	})
+	return tn
+}
+
+// eventually polls cond until it holds or timeout passes.
+func eventually(t *testing.T, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func leaderOf(nodes []*testNode) *testNode {
+	for _, n := range nodes {
+		if n.Leader() {
+			return n
+		}
+	}
+	return nil
+}
+
+func TestCluster(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a three-node cluster")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	n1 := startNode(t, "n1", true)
+	eventually(t, 10*time.Second, "n1 to lead", n1.Leader)
+	n2, n3 := startNode(t, "n2", false), startNode(t, "n3", false)
+	nodes := []*testNode{n1, n2, n3}
+	for _, n := range nodes[1:] {
+		jctx, jcancel := context.WithTimeout(ctx, 10*time.Second)
+		err := n.Join(jctx, n1.cfg.HTTPAddr)
+		jcancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	members, err := n3.ListMembers(ctx)
+	if err != nil || len(members) != 3 {
+		t.Fatalf("got members %+v, %v, want three", members, err)
+	}
+
+	// Loops run while their node leads, on one node at a time.
+	var mtx sync.Mutex
+	running := map[string]int{}
+	for _, n := range nodes {
+		n := n
+		go n.RunWhileLeader(ctx, func(ctx context.Context) {
+			mtx.Lock()
+			running[n.cfg.ID]++
+			mtx.Unlock()
+			<-ctx.Done()
+			mtx.Lock()
+			running[n.cfg.ID]--
+			mtx.Unlock()
+		})
+	}
+	runningOn := func() []string {
+		mtx.Lock()
+		defer mtx.Unlock()
+		var ids []string
+		for id, count := range running {
+			for i := 0; i < count; i++ {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	eventually(t, 5*time.Second, "a loop on n1", func() bool {
+		ids := runningOn()
+		return len(ids) == 1 && ids[0] == "n1"
+	})
+
+	// Writes to a follower are forwarded to the leader and replicated to
+	// every node.
+	if err := n2.Hosts().PostHostInfo(ctx, host.HostInfo{ID: "1001", Name: "web1", IP: "10.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := n3.Services().PostServiceInfo(ctx, service.ServiceInfo{ID: "web", HostID: "1001", Ports: []service.ServicePort{{Port: 80}}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range nodes {
+		eventually(t, 5*time.Second, "the host and service on "+n.cfg.ID, func() bool {
+			h, herr := n.Hosts().GetHostInfo(ctx, "1001")
+			_, serr := n.Services().GetServiceInfo(ctx, "web")
+			return herr == nil && h.Name == "web1" && serr == nil
+		})
+	}
+	// Errors of the stores come back from the leader as they were.
+	if err := n3.Hosts().PostHostInfo(ctx, host.HostInfo{ID: "1002", IP: "10.0.0.1"}); err != host.ErrDuplicateIP {
+		t.Fatalf("got %v, want %v", err, host.ErrDuplicateIP)
+	}
+	err = n2.Services().PostServiceInfo(ctx, service.ServiceInfo{ID: "api", HostID: "1001", Ports: []service.ServicePort{{Port: 80}}})
+	if _, ok := err.(*service.PortConflictError); !ok {
+		t.Fatalf("got %v, want a port conflict", err)
+	}
+
+	// The leader only runs the calls forwarded by a member that sends the
+	// secret, and no member may forward a state to load.
+	purge, _ := json.Marshal(Command{Method: "PurgeHostInfo", Namespace: "default", ID: "1001"})
+	for _, tc := range []struct{ member, secret string }{
+		{"", ""},
+		{"n2", "wrong"},
+		{"n9", "s3cret"},
+	} {
+		req, _ := http.NewRequest("POST", n1.cfg.HTTPAddr+"/cluster/v1/forward", bytes.NewReader(purge))
+		req.Header.Set("X-Cluster-Member", tc.member)
+		req.Header.Set("X-Cluster-Secret", tc.secret)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("got %s forwarding as %q with %q, want 403", resp.Status, tc.member, tc.secret)
+		}
+	}
+	load, _ := json.Marshal(Command{Method: "LoadHostState", Args: json.RawMessage(`{"hosts":[]}`)})
+	if err := n2.post(ctx, n1.cfg.HTTPAddr+"/cluster/v1/forward", load, nil); err != ErrNotForwardable {
+		t.Fatalf("got %v forwarding a load, want %v", err, ErrNotForwardable)
+	}
+	if err := n2.Hosts().(host.Snapshotter).LoadState(ctx, host.State{}); err != ErrNotLeader {
+		t.Fatalf("got %v loading a state on a follower, want %v", err, ErrNotLeader)
+	}
+	if _, err := n1.Hosts().GetHostInfo(ctx, "1001"); err != nil {
+		t.Fatal(err)
+	}
+
+	// When leadership moves, the loop stops on the old leader and starts
+	// on the new one.
+	if err := n1.raft.LeadershipTransfer().Error(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, 10*time.Second, "a new leader", func() bool {
+		l := leaderOf(nodes)
+		return l != nil && l != n1
+	})
+	eventually(t, 5*time.Second, "the loop to move", func() bool {
+		ids := runningOn()
+		l := leaderOf(nodes)
+		return len(ids) == 1 && l != nil && ids[0] == l.cfg.ID
+	})
+	leader := leaderOf(nodes)
+	if err := n1.Hosts().PutHostInfo(ctx, "1001", host.HostInfo{ID: "1001", Name: "web1", IP: "10.0.0.1", Rack: "r01"}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, 5*time.Second, "the update on "+leader.cfg.ID, func() bool {
+		h, err := leader.Hosts().GetHostInfo(ctx, "1001")
+		return err == nil && h.Rack == "r01"
+	})
+
+	// A member is removed through a follower, which passes the request on
+	// to the leader.
+	var followers []*testNode
+	for _, n := range nodes {
+		if n != leader {
+			followers = append(followers, n)
+		}
+	}
+	if err := followers[0].RemoveMember(ctx, followers[1].cfg.ID); err != nil {
+		t.Fatal(err)
+	}
+	members, err = leader.ListMembers(ctx)
+	if err != nil || len(members) != 2 {
+		t.Fatalf("got members %+v, %v, want two", members, err)
+	}
+	if err := followers[0].RemoveMember(ctx, "n9"); err != ErrUnknownMember {
+		t.Fatalf("got %v, want %v", err, ErrUnknownMember)
+	}
+}
@@ -0,0 +1,123 @@
+package cluster
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	StatusEndpoint       endpoint.Endpoint
+	ListMembersEndpoint  endpoint.Endpoint
+	AddMemberEndpoint    endpoint.Endpoint
+	RemoveMemberEndpoint endpoint.Endpoint
+	SnapshotEndpoint     endpoint.Endpoint
+	ForwardEndpoint      endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Cluster) Endpoints {
+	return Endpoints{
+		StatusEndpoint:       MakeStatusEndpoint(s),
+		ListMembersEndpoint:  MakeListMembersEndpoint(s),
+		AddMemberEndpoint:    MakeAddMemberEndpoint(s),
+		RemoveMemberEndpoint: MakeRemoveMemberEndpoint(s),
+		SnapshotEndpoint:     MakeSnapshotEndpoint(s),
+		ForwardEndpoint:      MakeForwardEndpoint(s),
+	}
+}
+
+func MakeStatusEndpoint(s Cluster) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		st, e := s.Status(ctx)
+		return statusResponse{Status: st, Err: e}, nil
+	}
+}
+
+func MakeListMembersEndpoint(s Cluster) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		list, e := s.ListMembers(ctx)
+		return listMembersResponse{Members: list, Err: e}, nil
+	}
+}
+
+func MakeAddMemberEndpoint(s Cluster) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(addMemberRequest)
+		e := s.AddMember(ctx, req.Member)
+		return addMemberResponse{Err: e}, nil
+	}
+}
+
+func MakeRemoveMemberEndpoint(s Cluster) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(removeMemberRequest)
+		e := s.RemoveMember(ctx, req.ID)
+		return removeMemberResponse{Err: e}, nil
+	}
+}
+
+func MakeSnapshotEndpoint(s Cluster) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		e := s.Snapshot(ctx)
+		return snapshotResponse{Err: e}, nil
+	}
+}
+
+func MakeForwardEndpoint(s Cluster) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(forwardRequest)
+		r, e := s.Forward(ctx, req.Command)
+		return forwardResponse{Result: r, Err: e}, nil
+	}
+}
+
+type statusResponse struct {
+	Status Status `json:"status"`
+	Err    error  `json:"err,omitempty"`
+}
+
+func (r statusResponse) error() error { return r.Err }
+
+type listMembersResponse struct {
+	Members []Member `json:"members,omitempty"`
+	Err     error    `json:"err,omitempty"`
+}
+
+func (r listMembersResponse) error() error { return r.Err }
+
+type addMemberRequest struct {
+	Member Member
+}
+
+type addMemberResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r addMemberResponse) error() error { return r.Err }
+
+type removeMemberRequest struct {
+	ID string
+}
+
+type removeMemberResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r removeMemberResponse) error() error { return r.Err }
+
+type snapshotResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r snapshotResponse) error() error { return r.Err }
+
+type forwardRequest struct {
+	Command Command
+}
+
+type forwardResponse struct {
+	Result *Result `json:"result"`
+	Err    error   `json:"err,omitempty"`
+}
+
+func (r forwardResponse) error() error { return r.Err }
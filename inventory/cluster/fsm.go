@@ -0,0 +1,429 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// Command is a call to a method of the host or service store. Writes are
+// replicated through the raft log and applied by every node; reads are
+// run by the node that serves them.
+type Command struct {
+	Method     string          `json:"method"`
+	Namespace  string          `json:"namespace"`
+	All        bool            `json:"all,omitempty"`
+	Time       time.Time       `json:"time"`
+	Actor      string          `json:"actor,omitempty"`
+	Managed    bool            `json:"managed,omitempty"`
+	ID         string          `json:"id,omitempty"`
+	InstanceID string          `json:"instanceid,omitempty"`
+	Args       json.RawMessage `json:"args,omitempty"`
+}
+
+// writes are the methods that change the stores, and setMember, which
+// records the HTTP address of a member.
+var writes = map[string]bool{
+	"PostHostInfo":          true,
+	"PutHostInfo":           true,
+	"DeleteHostInfo":        true,
+	"UndeleteHostInfo":      true,
+	"PurgeHostInfo":         true,
+	"BatchHostInfo":         true,
+	"LoadHostState":         true,
+	"PostServiceInfo":       true,
+	"PutServiceInfo":        true,
+	"DeleteServiceInfo":     true,
+	"UndeleteServiceInfo":   true,
+	"PurgeServiceInfo":      true,
+	"PutServiceHealth":      true,
+	"PostServiceInstance":   true,
+	"PutServiceInstance":    true,
+	"DeleteServiceInstance": true,
+	"BatchServiceInfo":      true,
+	"LoadServiceState":      true,
+	"setMember":             true,
+	"removeMember":          true,
+}
+
+// loads are the writes that replace a whole store. They are only run on
+// the leader, by a restore made on it.
+var loads = map[string]bool{
+	"LoadHostState":    true,
+	"LoadServiceState": true,
+}
+
+func (c Command) write() bool {
+	return writes[c.Method]
+}
+
+// context returns the context the Command is run in: its namespace,
+// actor, whether it writes managed host fields and, so that every node
+// records the same times, the time it was issued.
+func (c Command) context() context.Context {
+	ctx := host.NewTimeContext(context.Background(), c.Time)
+	ctx = host.NewActorContext(ctx, c.Actor)
+	if c.Managed {
+		ctx = host.NewManagedContext(ctx)
+	}
+	if c.All {
+		return namespace.AllNamespaces(ctx)
+	}
+	return namespace.NewContext(ctx, c.Namespace)
+}
+
+// Result is the outcome of a Command.
+type Result struct {
+	Value json.RawMessage `json:"value,omitempty"`
+	Err   *wireError      `json:"err,omitempty"`
+}
+
+func newResult(v interface{}, err error) *Result {
+	r := &Result{Err: wireErrorOf(err)}
+	if v != nil {
+		r.Value, _ = json.Marshal(v)
+	}
+	return r
+}
+
+// batchResult is a host.BatchResult or service.BatchResult on the wire.
+type batchResult struct {
+	ID  string     `json:"id"`
+	Err *wireError `json:"err,omitempty"`
+}
+
+// wireError carries an error of the stores from the node that ran a
+// Command back to the one that issued it.
+type wireError struct {
+	Message string          `json:"message"`
+	Type    string          `json:"type,omitempty"`
+	Detail  json.RawMessage `json:"detail,omitempty"`
+}
+
+func wireErrorOf(err error) *wireError {
+	if err == nil {
+		return nil
+	}
+	w := &wireError{Message: err.Error()}
+	switch e := err.(type) {
+	case *host.PositionConflictError:
+		w.Type = "positionconflict"
+		w.Detail, _ = json.Marshal(e)
+	case *service.PortConflictError:
+		w.Type = "portconflict"
+		w.Detail, _ = json.Marshal(e)
+	}
+	return w
+}
+
+// errorOf turns w back into the error it was, looking its message up
+// among known, the errors of the store the Command was for.
+func errorOf(w *wireError, known []error) error {
+	if w == nil {
+		return nil
+	}
+	switch w.Type {
+	case "positionconflict":
+		e := &host.PositionConflictError{}
+		if json.Unmarshal(w.Detail, e) == nil {
+			return e
+		}
+	case "portconflict":
+		e := &service.PortConflictError{}
+		if json.Unmarshal(w.Detail, e) == nil {
+			return e
+		}
+	}
+	for _, err := range known {
+		if err.Error() == w.Message {
+			return err
+		}
+	}
+	for _, err := range clusterErrors {
+		if err.Error() == w.Message {
+			return err
+		}
+	}
+	return errors.New(w.Message)
+}
+
+var hostErrors = []error{
+	host.ErrInvalidOp, host.ErrBatchAborted, host.ErrConditionFailed, host.ErrVersionConflict,
+	host.ErrInconsistentIDs, host.ErrAlreadyExists, host.ErrNotFound, host.ErrNotFoundID,
+	host.ErrUnknownDataCenter, host.ErrUnknownRack, host.ErrRackDataCenter, host.ErrInvalidPosition,
+	host.ErrOutsideRack, host.ErrInvalidIP, host.ErrDuplicateIP, host.ErrNoFreeIP,
+	host.ErrInvalidInterface, host.ErrDuplicateMAC, host.ErrInvalidLookup, host.ErrUnknownNamespace,
+	host.ErrInvalidResources, host.ErrNotUnique, host.ErrDeleted,
+}
+
+var serviceErrors = []error{
+	service.ErrInvalidOp, service.ErrBatchAborted, service.ErrConditionFailed, service.ErrVersionConflict,
+	service.ErrInconsistentIDs, service.ErrAlreadyExists, service.ErrNotFound, service.ErrInvalidCheck,
+	service.ErrInvalidPort, service.ErrInvalidInstance, service.ErrInvalidRequests, service.ErrUnknownDependency,
+	service.ErrDependencyCycle, service.ErrHasDependents, service.ErrUnknownNamespace, service.ErrHostCordoned,
+	service.ErrHostInMaintenance, service.ErrHostReserved, service.ErrHostNotShared, service.ErrDeleted,
+}
+
+var clusterErrors = []error{
+	ErrNotLeader, ErrNoLeader, ErrUnknownMethod, ErrHoldUnsupported, ErrUnknownMember,
+	ErrUnauthorized, ErrNotForwardable,
+}
+
+// fsm is the replicated state machine: a host and a service store kept in
+// memory, and the HTTP addresses of the members.
+type fsm struct {
+	hosts    host.Host
+	services service.Service
+
+	mtx     sync.RWMutex
+	members map[string]string
+}
+
+func newFSM(unique []host.Unique) *fsm {
+	return &fsm{
+		hosts:    host.NewInmemHost(unique...),
+		services: service.NewInmemService(),
+		members:  map[string]string{},
+	}
+}
+
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	var c Command
+	if err := json.Unmarshal(l.Data, &c); err != nil {
+		return newResult(nil, err)
+	}
+	return f.run(c)
+}
+
+// run runs c against the stores.
+func (f *fsm) run(c Command) *Result {
+	ctx := c.context()
+	switch c.Method {
+	case "PostHostInfo":
+		var h host.HostInfo
+		if err := json.Unmarshal(c.Args, &h); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(nil, f.hosts.PostHostInfo(ctx, h))
+	case "GetHostInfo":
+		return newResult(f.hosts.GetHostInfo(ctx, c.ID))
+	case "PutHostInfo":
+		var h host.HostInfo
+		if err := json.Unmarshal(c.Args, &h); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(nil, f.hosts.PutHostInfo(ctx, c.ID, h))
+	case "DeleteHostInfo":
+		return newResult(nil, f.hosts.DeleteHostInfo(ctx, c.ID))
+	case "UndeleteHostInfo":
+		return newResult(f.hosts.UndeleteHostInfo(ctx, c.ID))
+	case "PurgeHostInfo":
+		return newResult(f.hosts.PurgeHostInfo(ctx, c.ID))
+	case "ListHostInfo":
+		var filter host.HostFilter
+		if err := json.Unmarshal(c.Args, &filter); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(f.hosts.ListHostInfo(ctx, filter))
+	case "LookupHostInfo":
+		var q host.Lookup
+		if err := json.Unmarshal(c.Args, &q); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(f.hosts.LookupHostInfo(ctx, q))
+	case "BatchHostInfo":
+		var b host.Batch
+		if err := json.Unmarshal(c.Args, &b); err != nil {
+			return newResult(nil, err)
+		}
+		results, err := f.hosts.BatchHostInfo(ctx, b)
+		wire := make([]batchResult, len(results))
+		for i, r := range results {
+			wire[i] = batchResult{ID: r.ID, Err: wireErrorOf(r.Err)}
+		}
+		return newResult(wire, err)
+	case "DumpHostState":
+		return newResult(f.hosts.(host.Snapshotter).DumpState(ctx))
+	case "LoadHostState":
+		var st host.State
+		if err := json.Unmarshal(c.Args, &st); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(nil, f.hosts.(host.Snapshotter).LoadState(ctx, st))
+
+	case "PostServiceInfo":
+		var s service.ServiceInfo
+		if err := json.Unmarshal(c.Args, &s); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(nil, f.services.PostServiceInfo(ctx, s))
+	case "GetServiceInfo":
+		return newResult(f.services.GetServiceInfo(ctx, c.ID))
+	case "PutServiceInfo":
+		var s service.ServiceInfo
+		if err := json.Unmarshal(c.Args, &s); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(nil, f.services.PutServiceInfo(ctx, c.ID, s))
+	case "DeleteServiceInfo":
+		return newResult(nil, f.services.DeleteServiceInfo(ctx, c.ID))
+	case "UndeleteServiceInfo":
+		return newResult(f.services.UndeleteServiceInfo(ctx, c.ID))
+	case "PurgeServiceInfo":
+		return newResult(f.services.PurgeServiceInfo(ctx, c.ID))
+	case "ListServiceInfo":
+		var filter service.ServiceFilter
+		if err := json.Unmarshal(c.Args, &filter); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(f.services.ListServiceInfo(ctx, filter))
+	case "GetServiceHealth":
+		return newResult(f.services.GetServiceHealth(ctx, c.ID))
+	case "PutServiceHealth":
+		var r service.CheckResult
+		if err := json.Unmarshal(c.Args, &r); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(nil, f.services.PutServiceHealth(ctx, c.ID, r))
+	case "GetHostPorts":
+		return newResult(f.services.GetHostPorts(ctx, c.ID))
+	case "PostServiceInstance":
+		var in service.Instance
+		if err := json.Unmarshal(c.Args, &in); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(nil, f.services.PostServiceInstance(ctx, c.ID, in))
+	case "PutServiceInstance":
+		var in service.Instance
+		if err := json.Unmarshal(c.Args, &in); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(nil, f.services.PutServiceInstance(ctx, c.ID, c.InstanceID, in))
+	case "DeleteServiceInstance":
+		return newResult(nil, f.services.DeleteServiceInstance(ctx, c.ID, c.InstanceID))
+	case "ListServiceInstances":
+		return newResult(f.services.ListServiceInstances(ctx, c.ID))
+	case "ListHostInstances":
+		return newResult(f.services.ListHostInstances(ctx, c.ID))
+	case "GetServiceDependents":
+		return newResult(f.services.GetServiceDependents(ctx, c.ID))
+	case "GetHostDependents":
+		return newResult(f.services.GetHostDependents(ctx, c.ID))
+	case "BatchServiceInfo":
+		var b service.Batch
+		if err := json.Unmarshal(c.Args, &b); err != nil {
+			return newResult(nil, err)
+		}
+		results, err := f.services.BatchServiceInfo(ctx, b)
+		wire := make([]batchResult, len(results))
+		for i, r := range results {
+			wire[i] = batchResult{ID: r.ID, Err: wireErrorOf(r.Err)}
+		}
+		return newResult(wire, err)
+	case "DumpServiceState":
+		return newResult(f.services.(service.Snapshotter).DumpState(ctx))
+	case "LoadServiceState":
+		var st service.State
+		if err := json.Unmarshal(c.Args, &st); err != nil {
+			return newResult(nil, err)
+		}
+		return newResult(nil, f.services.(service.Snapshotter).LoadState(ctx, st))
+
+	case "setMember":
+		var addr string
+		if err := json.Unmarshal(c.Args, &addr); err != nil {
+			return newResult(nil, err)
+		}
+		f.mtx.Lock()
+		f.members[c.ID] = addr
+		f.mtx.Unlock()
+		return newResult(nil, nil)
+	case "removeMember":
+		f.mtx.Lock()
+		delete(f.members, c.ID)
+		f.mtx.Unlock()
+		return newResult(nil, nil)
+	default:
+		return newResult(nil, ErrUnknownMethod)
+	}
+}
+
+// httpAddr returns the HTTP address of member id.
+func (f *fsm) httpAddr(id string) string {
+	f.mtx.RLock()
+	defer f.mtx.RUnlock()
+	return f.members[id]
+}
+
+// fsmState is what a snapshot holds.
+type fsmState struct {
+	Hosts    host.State        `json:"hosts"`
+	Services service.State     `json:"services"`
+	Members  map[string]string `json:"members"`
+}
+
+// Snapshot copies the stores while raft holds off Apply, and writes the
+// copy out later.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	ctx := context.Background()
+	var st fsmState
+	var err error
+	if st.Hosts, err = f.hosts.(host.Snapshotter).DumpState(ctx); err != nil {
+		return nil, err
+	}
+	if st.Services, err = f.services.(service.Snapshotter).DumpState(ctx); err != nil {
+		return nil, err
+	}
+	f.mtx.RLock()
+	st.Members = make(map[string]string, len(f.members))
+	for id, addr := range f.members {
+		st.Members[id] = addr
+	}
+	f.mtx.RUnlock()
+	return &fsmSnapshot{state: st}, nil
+}
+
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+	var st fsmState
+	if err := json.NewDecoder(rc).Decode(&st); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := f.hosts.(host.Snapshotter).LoadState(ctx, st.Hosts); err != nil {
+		return err
+	}
+	if err := f.services.(service.Snapshotter).LoadState(ctx, st.Services); err != nil {
+		return err
+	}
+	if st.Members == nil {
+		st.Members = map[string]string{}
+	}
+	f.mtx.Lock()
+	f.members = st.Members
+	f.mtx.Unlock()
+	return nil
+}
+
+type fsmSnapshot struct {
+	state fsmState
+}
+
+func (s *fsmSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := json.NewEncoder(sink).Encode(s.state); err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *fsmSnapshot) Release() {}
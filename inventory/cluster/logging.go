@@ -0,0 +1,66 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+type Middleware func(Cluster) Cluster
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Cluster) Cluster {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Cluster
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) Status(ctx context.Context) (st Status, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Status", "state", st.State, "leader", st.Leader, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Status(ctx)
+}
+
+func (mw loggingMiddleware) ListMembers(ctx context.Context) (list []Member, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListMembers", "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListMembers(ctx)
+}
+
+func (mw loggingMiddleware) AddMember(ctx context.Context, m Member) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "AddMember", "id", m.ID, "raftaddr", m.RaftAddr, "httpaddr", m.HTTPAddr, "voter", m.Voter, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.AddMember(ctx, m)
+}
+
+func (mw loggingMiddleware) RemoveMember(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "RemoveMember", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.RemoveMember(ctx, id)
+}
+
+func (mw loggingMiddleware) Snapshot(ctx context.Context) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Snapshot", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Snapshot(ctx)
+}
+
+func (mw loggingMiddleware) Forward(ctx context.Context, c Command) (r *Result, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Forward", "call", c.Method, "namespace", c.Namespace, "id", c.ID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Forward(ctx, c)
+}
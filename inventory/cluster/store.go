@@ -0,0 +1,216 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// Hosts returns the replicated host store of the node. It also implements
+// host.Snapshotter; loading a state replaces the hosts of the whole
+// cluster.
+func (n *Node) Hosts() host.Host {
+	return &raftHost{node: n}
+}
+
+// Services returns the replicated service store of the node. It also
+// implements service.Snapshotter.
+func (n *Node) Services() service.Service {
+	return &raftService{node: n}
+}
+
+// invoke calls method through the cluster and decodes its value into out,
+// and its error among known.
+func (n *Node) invoke(ctx context.Context, known []error, method, id, instanceID string, args, out interface{}) error {
+	r, err := n.call(ctx, method, id, instanceID, args)
+	if err != nil {
+		return err
+	}
+	if out != nil && len(r.Value) > 0 {
+		if err := json.Unmarshal(r.Value, out); err != nil {
+			return err
+		}
+	}
+	return errorOf(r.Err, known)
+}
+
+type raftHost struct {
+	node *Node
+}
+
+func (s *raftHost) call(ctx context.Context, method, id string, args, out interface{}) error {
+	return s.node.invoke(ctx, hostErrors, method, id, "", args, out)
+}
+
+func (s *raftHost) PostHostInfo(ctx context.Context, h host.HostInfo) error {
+	return s.call(ctx, "PostHostInfo", "", h, nil)
+}
+
+func (s *raftHost) GetHostInfo(ctx context.Context, id string) (h host.HostInfo, err error) {
+	err = s.call(ctx, "GetHostInfo", id, nil, &h)
+	return h, err
+}
+
+func (s *raftHost) PutHostInfo(ctx context.Context, id string, h host.HostInfo) error {
+	return s.call(ctx, "PutHostInfo", id, h, nil)
+}
+
+func (s *raftHost) DeleteHostInfo(ctx context.Context, id string) error {
+	return s.call(ctx, "DeleteHostInfo", id, nil, nil)
+}
+
+func (s *raftHost) UndeleteHostInfo(ctx context.Context, id string) (h host.HostInfo, err error) {
+	err = s.call(ctx, "UndeleteHostInfo", id, nil, &h)
+	return h, err
+}
+
+func (s *raftHost) PurgeHostInfo(ctx context.Context, id string) (h host.HostInfo, err error) {
+	err = s.call(ctx, "PurgeHostInfo", id, nil, &h)
+	return h, err
+}
+
+func (s *raftHost) ListHostInfo(ctx context.Context, f host.HostFilter) (list []host.HostInfo, err error) {
+	err = s.call(ctx, "ListHostInfo", "", f, &list)
+	return list, err
+}
+
+func (s *raftHost) LookupHostInfo(ctx context.Context, q host.Lookup) (h host.HostInfo, err error) {
+	err = s.call(ctx, "LookupHostInfo", "", q, &h)
+	return h, err
+}
+
+// BatchHostInfo applies b as one raft entry, so that it stays atomic on
+// every node. Batches held by a transaction cannot be replicated.
+func (s *raftHost) BatchHostInfo(ctx context.Context, b host.Batch) ([]host.BatchResult, error) {
+	if b.Hold != nil {
+		return nil, ErrHoldUnsupported
+	}
+	var wire []batchResult
+	err := s.call(ctx, "BatchHostInfo", "", b, &wire)
+	var results []host.BatchResult
+	for _, r := range wire {
+		results = append(results, host.BatchResult{ID: r.ID, Err: errorOf(r.Err, hostErrors)})
+	}
+	return results, err
+}
+
+func (s *raftHost) DumpState(ctx context.Context) (st host.State, err error) {
+	err = s.call(ctx, "DumpHostState", "", nil, &st)
+	return st, err
+}
+
+func (s *raftHost) LoadState(ctx context.Context, st host.State) error {
+	return s.call(ctx, "LoadHostState", "", st, nil)
+}
+
+type raftService struct {
+	node *Node
+}
+
+func (s *raftService) call(ctx context.Context, method, id, instanceID string, args, out interface{}) error {
+	return s.node.invoke(ctx, serviceErrors, method, id, instanceID, args, out)
+}
+
+func (s *raftService) PostServiceInfo(ctx context.Context, h service.ServiceInfo) error {
+	return s.call(ctx, "PostServiceInfo", "", "", h, nil)
+}
+
+func (s *raftService) GetServiceInfo(ctx context.Context, id string) (h service.ServiceInfo, err error) {
+	err = s.call(ctx, "GetServiceInfo", id, "", nil, &h)
+	return h, err
+}
+
+func (s *raftService) PutServiceInfo(ctx context.Context, id string, h service.ServiceInfo) error {
+	return s.call(ctx, "PutServiceInfo", id, "", h, nil)
+}
+
+func (s *raftService) DeleteServiceInfo(ctx context.Context, id string) error {
+	return s.call(ctx, "DeleteServiceInfo", id, "", nil, nil)
+}
+
+func (s *raftService) UndeleteServiceInfo(ctx context.Context, id string) (h service.ServiceInfo, err error) {
+	err = s.call(ctx, "UndeleteServiceInfo", id, "", nil, &h)
+	return h, err
+}
+
+func (s *raftService) PurgeServiceInfo(ctx context.Context, id string) (h service.ServiceInfo, err error) {
+	err = s.call(ctx, "PurgeServiceInfo", id, "", nil, &h)
+	return h, err
+}
+
+func (s *raftService) ListServiceInfo(ctx context.Context, f service.ServiceFilter) (list []service.ServiceInfo, err error) {
+	err = s.call(ctx, "ListServiceInfo", "", "", f, &list)
+	return list, err
+}
+
+func (s *raftService) GetServiceHealth(ctx context.Context, id string) (h service.ServiceHealth, err error) {
+	err = s.call(ctx, "GetServiceHealth", id, "", nil, &h)
+	return h, err
+}
+
+func (s *raftService) PutServiceHealth(ctx context.Context, id string, r service.CheckResult) error {
+	return s.call(ctx, "PutServiceHealth", id, "", r, nil)
+}
+
+func (s *raftService) GetHostPorts(ctx context.Context, hostID string) (p service.HostPorts, err error) {
+	err = s.call(ctx, "GetHostPorts", hostID, "", nil, &p)
+	return p, err
+}
+
+func (s *raftService) PostServiceInstance(ctx context.Context, serviceID string, in service.Instance) error {
+	return s.call(ctx, "PostServiceInstance", serviceID, "", in, nil)
+}
+
+func (s *raftService) PutServiceInstance(ctx context.Context, serviceID, instanceID string, in service.Instance) error {
+	return s.call(ctx, "PutServiceInstance", serviceID, instanceID, in, nil)
+}
+
+func (s *raftService) DeleteServiceInstance(ctx context.Context, serviceID, instanceID string) error {
+	return s.call(ctx, "DeleteServiceInstance", serviceID, instanceID, nil, nil)
+}
+
+func (s *raftService) ListServiceInstances(ctx context.Context, serviceID string) (list []service.Instance, err error) {
+	err = s.call(ctx, "ListServiceInstances", serviceID, "", nil, &list)
+	return list, err
+}
+
+func (s *raftService) ListHostInstances(ctx context.Context, hostID string) (list []service.Instance, err error) {
+	err = s.call(ctx, "ListHostInstances", hostID, "", nil, &list)
+	return list, err
+}
+
+func (s *raftService) GetServiceDependents(ctx context.Context, id string) (g service.DependencyGraph, err error) {
+	err = s.call(ctx, "GetServiceDependents", id, "", nil, &g)
+	return g, err
+}
+
+func (s *raftService) GetHostDependents(ctx context.Context, hostID string) (g service.DependencyGraph, err error) {
+	err = s.call(ctx, "GetHostDependents", hostID, "", nil, &g)
+	return g, err
+}
+
+// BatchServiceInfo applies b as one raft entry. Batches held by a
+// transaction cannot be replicated.
+func (s *raftService) BatchServiceInfo(ctx context.Context, b service.Batch) ([]service.BatchResult, error) {
+	if b.Hold != nil {
+		return nil, ErrHoldUnsupported
+	}
+	var wire []batchResult
+	err := s.call(ctx, "BatchServiceInfo", "", "", b, &wire)
+	var results []service.BatchResult
+	for _, r := range wire {
+		results = append(results, service.BatchResult{ID: r.ID, Err: errorOf(r.Err, serviceErrors)})
+	}
+	return results, err
+}
+
+func (s *raftService) DumpState(ctx context.Context) (st service.State, err error) {
+	err = s.call(ctx, "DumpServiceState", "", "", nil, &st)
+	return st, err
+}
+
+func (s *raftService) LoadState(ctx context.Context, st service.State) error {
+	return s.call(ctx, "LoadServiceState", "", "", st, nil)
+}
@@ -0,0 +1,136 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+)
+
+// MakeHTTPHandler serves the administration of the cluster. It is not
+// namespaced: the cluster replicates every namespace.
+func MakeHTTPHandler(s Cluster, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+	}
+
+	r.Methods("GET").Path("/cluster/v1/status").Handler(httptransport.NewServer(
+		e.StatusEndpoint,
+		decodeEmptyRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/cluster/v1/members/").Handler(httptransport.NewServer(
+		e.ListMembersEndpoint,
+		decodeEmptyRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/cluster/v1/members/").Handler(httptransport.NewServer(
+		e.AddMemberEndpoint,
+		decodeAddMemberRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/cluster/v1/members/{id}").Handler(httptransport.NewServer(
+		e.RemoveMemberEndpoint,
+		decodeRemoveMemberRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/cluster/v1/snapshot").Handler(httptransport.NewServer(
+		e.SnapshotEndpoint,
+		decodeEmptyRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/cluster/v1/forward").Handler(httptransport.NewServer(
+		e.ForwardEndpoint,
+		decodeForwardRequest,
+		encodeResponse,
+		append(options, httptransport.ServerBefore(peerHTTPToContext))...,
+	))
+	return r
+}
+
+func decodeEmptyRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return struct{}{}, nil
+}
+
+func decodeAddMemberRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req addMemberRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Member); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeRemoveMemberRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return removeMemberRequest{ID: id}, nil
+}
+
+func decodeForwardRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req forwardRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Command); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	switch err {
+	case ErrUnknownMember:
+		return http.StatusNotFound
+	case ErrInvalidMember:
+		return http.StatusBadRequest
+	case ErrNotLeader, ErrNoLeader:
+		return http.StatusServiceUnavailable
+	case ErrUnauthorized:
+		return http.StatusForbidden
+	case ErrNotForwardable:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
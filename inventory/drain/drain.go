@@ -0,0 +1,408 @@
+package drain
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+type Drain interface {
+	StartDrain(ctx context.Context, r Request) (Operation, error)
+	GetOperation(ctx context.Context, id string) (Operation, error)
+	ListOperations(ctx context.Context) ([]Operation, error)
+	CancelOperation(ctx context.Context, id string) (Operation, error)
+}
+
+// Request asks to drain a host of the request namespace.
+type Request struct {
+	HostID      string      `json:"hostid"`
+	Constraints Constraints `json:"constraints"`
+}
+
+// Constraints restrict the hosts services are moved to. SameDataCenter and
+// SameRack keep them in the datacenter or rack of the drained host, and a
+// target host must carry every label of Labels.
+type Constraints struct {
+	SameDataCenter bool              `json:"samedatacenter,omitempty"`
+	SameRack       bool              `json:"samerack,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
+
+type State string
+
+const (
+	StateRunning    State = "running"
+	StateCancelling State = "cancelling"
+	StateSucceeded  State = "succeeded"
+	StateFailed     State = "failed"
+	StateCancelled  State = "cancelled"
+)
+
+type MoveState string
+
+const (
+	MovePending MoveState = "pending"
+	MoveDone    MoveState = "moved"
+	MoveFailed  MoveState = "failed"
+	MoveSkipped MoveState = "skipped"
+)
+
+// Move relocates a service, or one instance of it when InstanceID is set,
+// from the drained host to To. Namespace is that of the service.
+type Move struct {
+	Namespace  string    `json:"namespace"`
+	ServiceID  string    `json:"serviceid"`
+	InstanceID string    `json:"instanceid,omitempty"`
+	To         string    `json:"to,omitempty"`
+	State      MoveState `json:"state"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Operation is a drain in progress or finished. Moves are carried out in
+// order; when an operation is cancelled the moves not yet started are
+// skipped.
+type Operation struct {
+	ID          string      `json:"id"`
+	Namespace   string      `json:"namespace"`
+	HostID      string      `json:"hostid"`
+	Constraints Constraints `json:"constraints"`
+	State       State       `json:"state"`
+	Moves       []Move      `json:"moves"`
+	CreatedAt   time.Time   `json:"createtime"`
+	UpdatedAt   time.Time   `json:"updatetime"`
+}
+
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrUnknownHost     = errors.New("unknown host")
+	ErrAlreadyDraining = errors.New("host is already being drained")
+	ErrNotRunning      = errors.New("operation is not running")
+	ErrNoTarget        = errors.New("no host satisfies the constraints")
+)
+
+type operation struct {
+	Operation
+	cancel context.CancelFunc
+}
+
+type inmemDrain struct {
+	hosts    host.Host
+	services service.Service
+	store    service.Service
+	mtx      sync.RWMutex
+	ops      map[string]*operation
+	seq      int
+}
+
+// NewInmemDrain returns a Drain that keeps its operations in memory and
+// moves services through hosts and services, so that the usual validation
+// applies to every move. The services and instances to move, and the load
+// of the hosts they may go to, are listed from store, the store behind
+// services.
+func NewInmemDrain(hosts host.Host, services, store service.Service) Drain {
+	return &inmemDrain{
+		hosts:    hosts,
+		services: services,
+		store:    store,
+		ops:      map[string]*operation{},
+	}
+}
+
+// StartDrain cordons the host, so that no new service is placed on it,
+// plans a move for each of its services and instances and carries them
+// out in the background.
+func (s *inmemDrain) StartDrain(ctx context.Context, r Request) (Operation, error) {
+	ns := namespace.FromContext(ctx)
+	h, err := s.hosts.GetHostInfo(ctx, r.HostID)
+	if err == host.ErrUnknownNamespace {
+		return Operation{}, err
+	}
+	if err != nil {
+		return Operation{}, ErrUnknownHost
+	}
+
+	// The operation is registered, without moves, before the host is
+	// cordoned, so that a concurrent drain of the host is refused.
+	s.mtx.Lock()
+	for _, op := range s.ops {
+		if op.Namespace == ns && op.HostID == r.HostID && op.running() {
+			s.mtx.Unlock()
+			return Operation{}, ErrAlreadyDraining
+		}
+	}
+	s.seq++
+	currentTime := time.Now()
+	runCtx, cancel := context.WithCancel(namespace.NewContext(context.Background(), ns))
+	op := &operation{
+		Operation: Operation{
+			ID:          "drain-" + strconv.Itoa(s.seq),
+			Namespace:   ns,
+			HostID:      r.HostID,
+			Constraints: r.Constraints,
+			State:       StateRunning,
+			Moves:       []Move{},
+			CreatedAt:   currentTime,
+			UpdatedAt:   currentTime,
+		},
+		cancel: cancel,
+	}
+	s.ops[op.ID] = op
+	s.mtx.Unlock()
+
+	moves, err := s.prepare(ctx, r.HostID)
+	if err != nil {
+		s.mtx.Lock()
+		delete(s.ops, op.ID)
+		s.mtx.Unlock()
+		cancel()
+		return Operation{}, err
+	}
+	var result Operation
+	s.update(op, func() {
+		op.Moves = moves
+		result = op.copy()
+	})
+
+	go s.run(runCtx, op, h)
+	return result, nil
+}
+
+// prepare cordons host hostID and plans its moves.
+func (s *inmemDrain) prepare(ctx context.Context, hostID string) ([]Move, error) {
+	if _, err := host.Cordon(ctx, s.hosts, hostID, true); err != nil {
+		return nil, err
+	}
+	return s.plan(ctx, hostID)
+}
+
+func (s *inmemDrain) GetOperation(ctx context.Context, id string) (Operation, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	op, ok := s.ops[id]
+	if !ok || op.Namespace != namespace.FromContext(ctx) {
+		return Operation{}, ErrNotFound
+	}
+	return op.copy(), nil
+}
+
+func (s *inmemDrain) ListOperations(ctx context.Context) ([]Operation, error) {
+	ns := namespace.FromContext(ctx)
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []Operation{}
+	for _, op := range s.ops {
+		if op.Namespace == ns {
+			list = append(list, op.copy())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+// CancelOperation stops a running drain after its current move: the
+// operation is cancelling until then, and cancelled once the moves left
+// are skipped. The host stays cordoned.
+func (s *inmemDrain) CancelOperation(ctx context.Context, id string) (Operation, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	op, ok := s.ops[id]
+	if !ok || op.Namespace != namespace.FromContext(ctx) {
+		return Operation{}, ErrNotFound
+	}
+	if !op.running() {
+		return Operation{}, ErrNotRunning
+	}
+	op.State = StateCancelling
+	op.UpdatedAt = time.Now()
+	op.cancel()
+	return op.copy(), nil
+}
+
+// running reports whether op still moves services.
+func (op *operation) running() bool {
+	return op.State == StateRunning || op.State == StateCancelling
+}
+
+func (op *operation) copy() Operation {
+	c := op.Operation
+	c.Moves = append([]Move(nil), op.Moves...)
+	return c
+}
+
+// plan lists a move for every service and instance on host hostID of the
+// namespace of ctx, whatever namespace they belong to.
+func (s *inmemDrain) plan(ctx context.Context, hostID string) ([]Move, error) {
+	ns := namespace.FromContext(ctx)
+	list, err := s.store.ListServiceInfo(namespace.AllNamespaces(ctx), service.ServiceFilter{HostID: hostID, HostNamespace: ns})
+	if err != nil {
+		return nil, err
+	}
+	instances, err := s.store.ListHostInstances(ctx, hostID)
+	if err != nil {
+		return nil, err
+	}
+	moves := []Move{}
+	for _, svc := range list {
+		moves = append(moves, Move{Namespace: svc.Namespace, ServiceID: svc.ID, State: MovePending})
+	}
+	for _, in := range instances {
+		moves = append(moves, Move{Namespace: in.Namespace, ServiceID: in.ServiceID, InstanceID: in.ID, State: MovePending})
+	}
+	return moves, nil
+}
+
+func (s *inmemDrain) run(ctx context.Context, op *operation, drained host.HostInfo) {
+	defer op.cancel()
+	failed := false
+	for i := range op.Moves {
+		if ctx.Err() != nil {
+			s.update(op, func() {
+				for j := i; j < len(op.Moves); j++ {
+					op.Moves[j].State = MoveSkipped
+				}
+				op.State = StateCancelled
+			})
+			return
+		}
+		m := op.Moves[i]
+		to, err := s.move(ctx, drained, op.Constraints, m)
+		s.update(op, func() {
+			op.Moves[i].To = to
+			op.Moves[i].State = MoveDone
+			if err != nil {
+				op.Moves[i].State = MoveFailed
+				op.Moves[i].Error = err.Error()
+				failed = true
+			}
+		})
+	}
+	s.update(op, func() {
+		op.State = StateSucceeded
+		if failed {
+			op.State = StateFailed
+		}
+	})
+}
+
+func (s *inmemDrain) update(op *operation, f func()) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	f()
+	op.UpdatedAt = time.Now()
+}
+
+// move places the service or instance of m on the least loaded candidate
+// host whose ports are free and that is not reserved for another owner,
+// and returns that host. A service that was moved off the drained host in
+// the meantime is left alone.
+func (s *inmemDrain) move(ctx context.Context, drained host.HostInfo, c Constraints, m Move) (string, error) {
+	candidates, err := s.candidates(ctx, drained, c)
+	if err != nil {
+		return "", err
+	}
+	sctx := namespace.NewContext(ctx, m.Namespace)
+	for _, to := range candidates {
+		if m.InstanceID == "" {
+			err = s.moveService(sctx, drained, m.ServiceID, to)
+		} else {
+			err = s.moveInstance(sctx, drained, m.ServiceID, m.InstanceID, to)
+		}
+		if _, ok := err.(*service.PortConflictError); ok || err == service.ErrHostReserved {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		return to, nil
+	}
+	return "", ErrNoTarget
+}
+
+func (s *inmemDrain) moveService(ctx context.Context, drained host.HostInfo, id, to string) error {
+	svc, err := s.services.GetServiceInfo(ctx, id)
+	if err != nil {
+		return err
+	}
+	if svc.HostID != drained.ID || svc.HostNamespace != drained.Namespace {
+		return nil
+	}
+	svc.HostID = to
+	results, err := s.services.BatchServiceInfo(ctx, service.Batch{Ops: []service.ServiceOp{{Op: service.OpUpdate, ServiceInfo: svc, IfVersion: svc.Version}}})
+	if err != nil && len(results) == 1 && results[0].Err != nil {
+		return results[0].Err
+	}
+	return err
+}
+
+func (s *inmemDrain) moveInstance(ctx context.Context, drained host.HostInfo, serviceID, id, to string) error {
+	list, err := s.services.ListServiceInstances(ctx, serviceID)
+	if err != nil {
+		return err
+	}
+	for _, in := range list {
+		if in.ID != id {
+			continue
+		}
+		if in.HostID != drained.ID || in.HostNamespace != drained.Namespace {
+			return nil
+		}
+		in.HostID = to
+		return s.services.PutServiceInstance(ctx, serviceID, id, in)
+	}
+	return service.ErrNotFound
+}
+
+// candidates returns the hosts of the drained host's namespace that
+// satisfy c and are neither cordoned nor in maintenance, least loaded
+// first. The load of a host is the number of services and instances
+// placed on it.
+func (s *inmemDrain) candidates(ctx context.Context, drained host.HostInfo, c Constraints) ([]string, error) {
+	f := host.HostFilter{}
+	if c.SameDataCenter {
+		f.DataCenter = drained.DataCenter
+	}
+	if c.SameRack {
+		f.Rack = drained.Rack
+	}
+	list, err := s.hosts.ListHostInfo(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	services, err := s.store.ListServiceInfo(namespace.AllNamespaces(ctx), service.ServiceFilter{HostNamespace: drained.Namespace})
+	if err != nil {
+		return nil, err
+	}
+	instances, err := s.store.ListHostInstances(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	load := map[string]int{}
+	for _, svc := range services {
+		load[svc.HostID]++
+	}
+	for _, in := range instances {
+		load[in.HostID]++
+	}
+
+	var ids []string
+	for _, h := range list {
+		if h.ID == drained.ID || h.Cordoned || h.Status == host.StatusMaintenance || !h.MatchLabels(c.Labels) {
+			continue
+		}
+		ids = append(ids, h.ID)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if load[ids[i]] != load[ids[j]] {
+			return load[ids[i]] < load[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return ids, nil
+}
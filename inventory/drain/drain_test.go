@@ -0,0 +1,254 @@
+package drain
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// fixture returns a host store with h1, the host to drain, and the hosts
+// it may be drained to, and a service store with s1 and s2 on h1 and an
+// instance of s3 on h1.
+func fixture(t *testing.T) (host.Host, service.Service) {
+	t.Helper()
+	ctx := context.Background()
+	hosts, services := host.NewInmemHost(), service.NewInmemService()
+	web := map[string]string{"pool": "web"}
+	for _, h := range []host.HostInfo{
+		{ID: "h1", DataCenter: "dc1", Rack: "r1", Labels: web},
+		{ID: "h2", DataCenter: "dc1", Rack: "r1", Labels: web},
+		{ID: "h3", DataCenter: "dc1", Rack: "r2", Labels: web},
+		{ID: "h4", DataCenter: "dc2", Rack: "r3", Labels: web},
+		{ID: "h5", DataCenter: "dc1", Rack: "r1"},
+		{ID: "h6", DataCenter: "dc1", Rack: "r1", Labels: web},
+		{ID: "h7", DataCenter: "dc1", Rack: "r1", Labels: web},
+	} {
+		if err := hosts.PostHostInfo(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := host.Cordon(ctx, hosts, "h6", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := hosts.PutHostInfo(host.NewManagedContext(ctx), "h7", host.HostInfo{ID: "h7", DataCenter: "dc1", Rack: "r1", Labels: web, Status: host.StatusMaintenance}); err != nil {
+		t.Fatal(err)
+	}
+	for _, svc := range []service.ServiceInfo{
+		{ID: "s1", HostID: "h1"},
+		{ID: "s2", HostID: "h1"},
+		{ID: "s3", HostID: "h4"},
+	} {
+		if err := services.PostServiceInfo(ctx, svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := services.PostServiceInstance(ctx, "s3", service.Instance{ID: "1", HostID: "h1"}); err != nil {
+		t.Fatal(err)
+	}
+	return hosts, services
+}
+
+// wait returns operation id of s once it no longer runs.
+func wait(t *testing.T, s Drain, id string) Operation {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		op, err := s.GetOperation(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op.State != StateRunning && op.State != StateCancelling {
+			return op
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("operation %s still %s", id, op.State)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCandidates(t *testing.T) {
+	hosts, services := fixture(t)
+	s := NewInmemDrain(hosts, services, services).(*inmemDrain)
+	ctx := context.Background()
+	drained, _ := hosts.GetHostInfo(ctx, "h1")
+	for _, tc := range []struct {
+		name string
+		c    Constraints
+		want []string
+	}{
+		// h4 runs s3; cordoned h6 and h7 in maintenance are left out.
+		{"none", Constraints{}, []string{"h2", "h3", "h5", "h4"}},
+		{"labels", Constraints{Labels: map[string]string{"pool": "web"}}, []string{"h2", "h3", "h4"}},
+		{"same datacenter", Constraints{SameDataCenter: true}, []string{"h2", "h3", "h5"}},
+		{"same rack", Constraints{SameRack: true, Labels: map[string]string{"pool": "web"}}, []string{"h2"}},
+		{"no match", Constraints{Labels: map[string]string{"pool": "db"}}, nil},
+	} {
+		got, err := s.candidates(ctx, drained, tc.c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDrain(t *testing.T) {
+	ctx := context.Background()
+	hosts, services := fixture(t)
+	s := NewInmemDrain(hosts, services, services)
+	op, err := s.StartDrain(ctx, Request{HostID: "h1", Constraints: Constraints{SameDataCenter: true, Labels: map[string]string{"pool": "web"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := hosts.GetHostInfo(ctx, "h1"); !h.Cordoned {
+		t.Fatal("drained host not cordoned")
+	}
+	op = wait(t, s, op.ID)
+	if op.State != StateSucceeded {
+		t.Fatalf("got %+v, want succeeded", op)
+	}
+	// The least loaded host first: s1 fills h2, so s2 goes to h3.
+	want := []Move{
+		{Namespace: "default", ServiceID: "s1", To: "h2", State: MoveDone},
+		{Namespace: "default", ServiceID: "s2", To: "h3", State: MoveDone},
+		{Namespace: "default", ServiceID: "s3", InstanceID: "1", To: "h2", State: MoveDone},
+	}
+	if !reflect.DeepEqual(op.Moves, want) {
+		t.Fatalf("got moves %+v, want %+v", op.Moves, want)
+	}
+	if list, _ := services.ListHostInstances(ctx, "h1"); len(list) != 0 {
+		t.Fatalf("got instances %+v left on h1", list)
+	}
+	if svc, _ := services.GetServiceInfo(ctx, "s2"); svc.HostID != "h3" {
+		t.Fatalf("got s2 on %s, want h3", svc.HostID)
+	}
+
+	if _, err := s.StartDrain(ctx, Request{HostID: "h9"}); err != ErrUnknownHost {
+		t.Fatalf("got %v draining a missing host, want %v", err, ErrUnknownHost)
+	}
+}
+
+func TestDrainNoTarget(t *testing.T) {
+	ctx := context.Background()
+	hosts, services := fixture(t)
+	s := NewInmemDrain(hosts, services, services)
+	op, err := s.StartDrain(ctx, Request{HostID: "h1", Constraints: Constraints{Labels: map[string]string{"pool": "db"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	op = wait(t, s, op.ID)
+	if op.State != StateFailed || op.Moves[0].State != MoveFailed || op.Moves[0].Error != ErrNoTarget.Error() {
+		t.Fatalf("got %+v, want failed moves for want of a target", op)
+	}
+}
+
+// blockingHosts holds cordoning until release is closed, or fails it with
+// err.
+type blockingHosts struct {
+	host.Host
+	entered chan struct{}
+	release chan struct{}
+	err     error
+}
+
+func (h *blockingHosts) BatchHostInfo(ctx context.Context, b host.Batch) ([]host.BatchResult, error) {
+	h.entered <- struct{}{}
+	<-h.release
+	if h.err != nil {
+		return nil, h.err
+	}
+	return h.Host.BatchHostInfo(ctx, b)
+}
+
+func TestAlreadyDraining(t *testing.T) {
+	ctx := context.Background()
+	hosts, services := fixture(t)
+	blocking := &blockingHosts{Host: hosts, entered: make(chan struct{}, 1), release: make(chan struct{}), err: errors.New("boom")}
+	s := NewInmemDrain(blocking, services, services)
+
+	errs := make(chan error)
+	go func() {
+		_, err := s.StartDrain(ctx, Request{HostID: "h1"})
+		errs <- err
+	}()
+	<-blocking.entered
+	// The first drain is cordoning the host: the second is refused.
+	if _, err := s.StartDrain(ctx, Request{HostID: "h1"}); err != ErrAlreadyDraining {
+		t.Fatalf("got %v, want %v", err, ErrAlreadyDraining)
+	}
+	close(blocking.release)
+	if err := <-errs; err != blocking.err {
+		t.Fatalf("got %v, want the cordon error", err)
+	}
+	if list, _ := s.ListOperations(ctx); len(list) != 0 {
+		t.Fatalf("got operations %+v after a failed start, want none", list)
+	}
+
+	// Once the first has failed, the host can be drained again.
+	blocking.err = nil
+	op, err := s.StartDrain(ctx, Request{HostID: "h1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op = wait(t, s, op.ID); op.State != StateSucceeded {
+		t.Fatalf("got %+v, want succeeded", op)
+	}
+}
+
+// blockingServices holds every service move until release gets a value.
+type blockingServices struct {
+	service.Service
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingServices) BatchServiceInfo(ctx context.Context, b service.Batch) ([]service.BatchResult, error) {
+	s.entered <- struct{}{}
+	<-s.release
+	return s.Service.BatchServiceInfo(ctx, b)
+}
+
+func TestCancel(t *testing.T) {
+	ctx := context.Background()
+	hosts, services := fixture(t)
+	blocking := &blockingServices{Service: services, entered: make(chan struct{}), release: make(chan struct{})}
+	s := NewInmemDrain(hosts, blocking, services)
+	op, err := s.StartDrain(ctx, Request{HostID: "h1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-blocking.entered
+	cancelled, err := s.CancelOperation(ctx, op.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.State != StateCancelling {
+		t.Fatalf("got %s during the first move, want %s", cancelled.State, StateCancelling)
+	}
+	if _, err := s.StartDrain(ctx, Request{HostID: "h1"}); err != ErrAlreadyDraining {
+		t.Fatalf("got %v while cancelling, want %v", err, ErrAlreadyDraining)
+	}
+	blocking.release <- struct{}{}
+
+	op = wait(t, s, op.ID)
+	if op.State != StateCancelled {
+		t.Fatalf("got %s, want %s", op.State, StateCancelled)
+	}
+	states := []MoveState{op.Moves[0].State, op.Moves[1].State, op.Moves[2].State}
+	if want := []MoveState{MoveDone, MoveSkipped, MoveSkipped}; !reflect.DeepEqual(states, want) {
+		t.Fatalf("got moves %v, want %v", states, want)
+	}
+	if _, err := s.CancelOperation(ctx, op.ID); err != ErrNotRunning {
+		t.Fatalf("got %v cancelling a cancelled drain, want %v", err, ErrNotRunning)
+	}
+	if h, _ := hosts.GetHostInfo(ctx, "h1"); !h.Cordoned {
+		t.Fatal("host uncordoned by the cancel")
+	}
+}
@@ -0,0 +1,82 @@
+package drain
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	StartDrainEndpoint      endpoint.Endpoint
+	GetOperationEndpoint    endpoint.Endpoint
+	ListOperationsEndpoint  endpoint.Endpoint
+	CancelOperationEndpoint endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Drain) Endpoints {
+	return Endpoints{
+		StartDrainEndpoint:      MakeStartDrainEndpoint(s),
+		GetOperationEndpoint:    MakeGetOperationEndpoint(s),
+		ListOperationsEndpoint:  MakeListOperationsEndpoint(s),
+		CancelOperationEndpoint: MakeCancelOperationEndpoint(s),
+	}
+}
+
+func MakeStartDrainEndpoint(s Drain) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(startDrainRequest)
+		op, e := s.StartDrain(ctx, req.Request)
+		return operationResponse{Operation: op, Err: e}, nil
+	}
+}
+
+func MakeGetOperationEndpoint(s Drain) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getOperationRequest)
+		op, e := s.GetOperation(ctx, req.ID)
+		return operationResponse{Operation: op, Err: e}, nil
+	}
+}
+
+func MakeListOperationsEndpoint(s Drain) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		list, e := s.ListOperations(ctx)
+		return listOperationsResponse{Operations: list, Err: e}, nil
+	}
+}
+
+func MakeCancelOperationEndpoint(s Drain) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(cancelOperationRequest)
+		op, e := s.CancelOperation(ctx, req.ID)
+		return operationResponse{Operation: op, Err: e}, nil
+	}
+}
+
+type startDrainRequest struct {
+	Request Request
+}
+
+type getOperationRequest struct {
+	ID string
+}
+
+type listOperationsRequest struct{}
+
+type cancelOperationRequest struct {
+	ID string
+}
+
+type operationResponse struct {
+	Operation Operation `json:"operation,omitempty"`
+	Err       error     `json:"err,omitempty"`
+}
+
+func (r operationResponse) error() error { return r.Err }
+
+type listOperationsResponse struct {
+	Operations []Operation `json:"operations,omitempty"`
+	Err        error       `json:"err,omitempty"`
+}
+
+func (r listOperationsResponse) error() error { return r.Err }
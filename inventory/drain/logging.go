@@ -0,0 +1,54 @@
+package drain
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Middleware func(Drain) Drain
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Drain) Drain {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Drain
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) StartDrain(ctx context.Context, r Request) (op Operation, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "StartDrain", "namespace", namespace.FromContext(ctx), "hostid", r.HostID, "id", op.ID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.StartDrain(ctx, r)
+}
+
+func (mw loggingMiddleware) GetOperation(ctx context.Context, id string) (op Operation, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetOperation", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetOperation(ctx, id)
+}
+
+func (mw loggingMiddleware) ListOperations(ctx context.Context) (list []Operation, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListOperations", "namespace", namespace.FromContext(ctx), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListOperations(ctx)
+}
+
+func (mw loggingMiddleware) CancelOperation(ctx context.Context, id string) (op Operation, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "CancelOperation", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.CancelOperation(ctx, id)
+}
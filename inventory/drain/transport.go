@@ -0,0 +1,124 @@
+package drain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+)
+
+func MakeHTTPHandler(s Drain, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext),
+	}
+
+	for _, prefix := range []string{"/drain/v1", "/drain/v1/namespaces/{ns}"} {
+		r.Methods("POST").Path(prefix + "/operations/").Handler(httptransport.NewServer(
+			e.StartDrainEndpoint,
+			decodeStartDrainRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/operations/").Handler(httptransport.NewServer(
+			e.ListOperationsEndpoint,
+			decodeListOperationsRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/operations/{id}").Handler(httptransport.NewServer(
+			e.GetOperationEndpoint,
+			decodeGetOperationRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("POST").Path(prefix + "/operations/{id}/cancel").Handler(httptransport.NewServer(
+			e.CancelOperationEndpoint,
+			decodeCancelOperationRequest,
+			encodeResponse,
+			options...,
+		))
+	}
+	return r
+}
+
+func decodeStartDrainRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req startDrainRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Request); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeGetOperationRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getOperationRequest{ID: id}, nil
+}
+
+func decodeListOperationsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return listOperationsRequest{}, nil
+}
+
+func decodeCancelOperationRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return cancelOperationRequest{ID: id}, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	switch err {
+	case ErrNotFound, ErrUnknownHost, host.ErrUnknownNamespace:
+		return http.StatusNotFound
+	case ErrAlreadyDraining, ErrNotRunning, host.ErrConditionFailed, host.ErrVersionConflict:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
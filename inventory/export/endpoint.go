@@ -0,0 +1,36 @@
+package export
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	ExportHostsEndpoint endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Exporter) Endpoints {
+	return Endpoints{
+		ExportHostsEndpoint: MakeExportHostsEndpoint(s),
+	}
+}
+
+func MakeExportHostsEndpoint(s Exporter) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(exportHostsRequest)
+		r, e := s.ExportHosts(ctx, req.Query)
+		return exportHostsResponse{Report: r, Err: e}, nil
+	}
+}
+
+type exportHostsRequest struct {
+	Query Query
+}
+
+type exportHostsResponse struct {
+	Report Report
+	Err    error
+}
+
+func (r exportHostsResponse) error() error { return r.Err }
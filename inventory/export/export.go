@@ -0,0 +1,268 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// Exporter reports hosts joined with the services placed on them, for
+// spreadsheets and the like.
+type Exporter interface {
+	ExportHosts(ctx context.Context, q Query) (Report, error)
+}
+
+// Export formats.
+const (
+	FormatCSV  = "csv"
+	FormatYAML = "yaml"
+	FormatXLSX = "xlsx"
+)
+
+// pageSize is the number of hosts a report reads at a time.
+const pageSize = 500
+
+// Query selects the rows and columns of a report. Hosts are selected by
+// datacenter, rack, status and labels; services by owner and health. With
+// a service filter set, hosts without a matching service are left out;
+// otherwise a host without services has a row of its own.
+type Query struct {
+	Format     string
+	Columns    []string
+	DataCenter string
+	Rack       string
+	Status     string
+	Labels     map[string]string
+	Owner      string
+	Health     service.HealthStatus
+}
+
+// DefaultColumns are the columns of a report that does not select any.
+var DefaultColumns = []string{
+	"datacenter", "rack", "id", "name", "ip", "status",
+	"service.id", "service.name", "service.owner", "service.health",
+}
+
+// Report is a table with a row per host and service on it. Rows calls fn
+// with each row in turn, reading the services of one host at a time, and
+// stops at the first error.
+type Report struct {
+	Format  string
+	Columns []string
+	Rows    func(fn func(row []string) error) error
+}
+
+var (
+	ErrUnknownFormat = errors.New("format must be csv, yaml or xlsx")
+	ErrUnknownStatus = errors.New("status must be available, maintenance or reserved")
+)
+
+// UnknownColumnError is returned for a column that is not one of the
+// columns of a report.
+type UnknownColumnError struct {
+	Column string
+}
+
+func (e *UnknownColumnError) Error() string {
+	return fmt.Sprintf("unknown column %q", e.Column)
+}
+
+// column reads a cell from a host and, for service columns, the service
+// on it, which is nil on the row of a host without services.
+type column struct {
+	numeric bool
+	service bool
+	value   func(h *host.HostInfo, s *service.ServiceInfo) string
+}
+
+func hostColumn(value func(h *host.HostInfo) string) column {
+	return column{value: func(h *host.HostInfo, _ *service.ServiceInfo) string { return value(h) }}
+}
+
+func hostNumber(value func(h *host.HostInfo) float64) column {
+	c := hostColumn(func(h *host.HostInfo) string { return number(value(h)) })
+	c.numeric = true
+	return c
+}
+
+func serviceColumn(value func(s *service.ServiceInfo) string) column {
+	return column{service: true, value: func(_ *host.HostInfo, s *service.ServiceInfo) string {
+		if s == nil {
+			return ""
+		}
+		return value(s)
+	}}
+}
+
+func serviceNumber(value func(s *service.ServiceInfo) float64) column {
+	c := serviceColumn(func(s *service.ServiceInfo) string { return number(value(s)) })
+	c.numeric = true
+	return c
+}
+
+var columns = map[string]column{
+	"id":              hostColumn(func(h *host.HostInfo) string { return h.ID }),
+	"namespace":       hostColumn(func(h *host.HostInfo) string { return h.Namespace }),
+	"name":            hostColumn(func(h *host.HostInfo) string { return h.Name }),
+	"ip":              hostColumn(func(h *host.HostInfo) string { return h.IP }),
+	"port":            hostColumn(func(h *host.HostInfo) string { return h.Port }),
+	"datacenter":      hostColumn(func(h *host.HostInfo) string { return h.DataCenter }),
+	"rack":            hostColumn(func(h *host.HostInfo) string { return h.Rack }),
+	"position":        hostNumber(func(h *host.HostInfo) float64 { return float64(h.Position) }),
+	"height":          hostNumber(func(h *host.HostInfo) float64 { return float64(h.Height) }),
+	"status":          hostColumn(func(h *host.HostInfo) string { return hostStatus(h.Status) }),
+	"cordoned":        hostColumn(func(h *host.HostInfo) string { return strconv.FormatBool(h.Cordoned) }),
+	"reservedby":      hostColumn(func(h *host.HostInfo) string { return h.ReservedBy }),
+	"capacity.cpu":    hostNumber(func(h *host.HostInfo) float64 { return h.Capacity.CPU }),
+	"capacity.memory": hostNumber(func(h *host.HostInfo) float64 { return float64(h.Capacity.Memory) }),
+	"capacity.disk":   hostNumber(func(h *host.HostInfo) float64 { return float64(h.Capacity.Disk) }),
+	"createtime":      hostColumn(func(h *host.HostInfo) string { return h.CreatedAt.Format(time.RFC3339) }),
+	"updatetime":      hostColumn(func(h *host.HostInfo) string { return h.UpdatedAt.Format(time.RFC3339) }),
+	"remark":          hostColumn(func(h *host.HostInfo) string { return h.Remark }),
+
+	"service.id":              serviceColumn(func(s *service.ServiceInfo) string { return s.ID }),
+	"service.namespace":       serviceColumn(func(s *service.ServiceInfo) string { return s.Namespace }),
+	"service.name":            serviceColumn(func(s *service.ServiceInfo) string { return s.Name }),
+	"service.owner":           serviceColumn(func(s *service.ServiceInfo) string { return s.Owner }),
+	"service.health":          serviceColumn(func(s *service.ServiceInfo) string { return string(s.Health) }),
+	"service.requests.cpu":    serviceNumber(func(s *service.ServiceInfo) float64 { return s.Requests.CPU }),
+	"service.requests.memory": serviceNumber(func(s *service.ServiceInfo) float64 { return float64(s.Requests.Memory) }),
+	"service.requests.disk":   serviceNumber(func(s *service.ServiceInfo) float64 { return float64(s.Requests.Disk) }),
+	"service.remark":          serviceColumn(func(s *service.ServiceInfo) string { return s.Remark }),
+}
+
+// lookupColumn returns the column called name, including the labels.<key>
+// and service.labels.<key> columns.
+func lookupColumn(name string) (column, bool) {
+	if c, ok := columns[name]; ok {
+		return c, true
+	}
+	if k := strings.TrimPrefix(name, "service.labels."); k != name && k != "" {
+		return serviceColumn(func(s *service.ServiceInfo) string { return s.Labels[k] }), true
+	}
+	if k := strings.TrimPrefix(name, "labels."); k != name && k != "" {
+		return hostColumn(func(h *host.HostInfo) string { return h.Labels[k] }), true
+	}
+	return column{}, false
+}
+
+// hostStatus names the status of a host, available when it has none.
+func hostStatus(status string) string {
+	if status == "" {
+		return "available"
+	}
+	return status
+}
+
+func number(f float64) string {
+	if f == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+type exporter struct {
+	hosts    host.Host
+	services service.Service
+}
+
+// NewExporter returns an Exporter that reads hosts from hosts and the
+// services on each of them from services, across namespaces, as services
+// may be placed on a host another namespace shares.
+func NewExporter(hosts host.Host, services service.Service) Exporter {
+	return &exporter{hosts: hosts, services: services}
+}
+
+func (s *exporter) ExportHosts(ctx context.Context, q Query) (Report, error) {
+	switch q.Format {
+	case FormatCSV, FormatYAML, FormatXLSX:
+	default:
+		return Report{}, ErrUnknownFormat
+	}
+	switch q.Status {
+	case "", "available", host.StatusMaintenance, host.StatusReserved:
+	default:
+		return Report{}, ErrUnknownStatus
+	}
+	names := q.Columns
+	if len(names) == 0 {
+		names = DefaultColumns
+	}
+	cols := make([]column, len(names))
+	withServices := q.Owner != "" || q.Health != ""
+	for i, name := range names {
+		c, ok := lookupColumn(name)
+		if !ok {
+			return Report{}, &UnknownColumnError{Column: name}
+		}
+		cols[i] = c
+		withServices = withServices || c.service
+	}
+
+	rows := func(fn func(row []string) error) error {
+		row := make([]string, len(cols))
+		emit := func(h *host.HostInfo, svc *service.ServiceInfo) error {
+			for i, c := range cols {
+				row[i] = c.value(h, svc)
+			}
+			return fn(row)
+		}
+		actx := namespace.AllNamespaces(ctx)
+		return s.eachHost(ctx, q, func(h *host.HostInfo) error {
+			if q.Status != "" && hostStatus(h.Status) != q.Status || !h.MatchLabels(q.Labels) {
+				return nil
+			}
+			if !withServices {
+				return emit(h, nil)
+			}
+			list, err := s.services.ListServiceInfo(actx, service.ServiceFilter{HostID: h.ID, HostNamespace: h.Namespace, Health: q.Health})
+			if err != nil {
+				return err
+			}
+			matched := 0
+			for j := range list {
+				if q.Owner != "" && list[j].Owner != q.Owner {
+					continue
+				}
+				matched++
+				if err := emit(h, &list[j]); err != nil {
+					return err
+				}
+			}
+			if matched == 0 && q.Owner == "" && q.Health == "" {
+				return emit(h, nil)
+			}
+			return nil
+		})
+	}
+	return Report{Format: q.Format, Columns: names, Rows: rows}, nil
+}
+
+// eachHost calls fn with the hosts in datacenter q.DataCenter and rack
+// q.Rack, sorted by datacenter, rack and ID, listing them a page at a
+// time so that a large inventory is never held in memory at once.
+func (s *exporter) eachHost(ctx context.Context, q Query, fn func(h *host.HostInfo) error) error {
+	var after *host.Cursor
+	for {
+		page, err := s.hosts.ListHostInfo(ctx, host.HostFilter{DataCenter: q.DataCenter, Rack: q.Rack, Limit: pageSize, After: after})
+		if err != nil {
+			return err
+		}
+		for i := range page {
+			if err := fn(&page[i]); err != nil {
+				return err
+			}
+		}
+		if len(page) < pageSize {
+			return nil
+		}
+		after = host.CursorOf(page[len(page)-1])
+	}
+}
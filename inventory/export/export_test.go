@@ -0,0 +1,59 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+func TestExportHostsPages(t *testing.T) {
+	// Statuses are written as the scheduler writes them.
+	ctx := host.NewManagedContext(context.Background())
+	hosts := host.NewInmemHost()
+	n := 2*pageSize + 1
+	for i := n - 1; i >= 0; i-- {
+		h := host.HostInfo{ID: fmt.Sprintf("h%04d", i), DataCenter: "dc1", Rack: fmt.Sprintf("r%d", i%3)}
+		if i%7 == 0 {
+			h.Status = host.StatusMaintenance
+		}
+		if err := hosts.PostHostInfo(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, err := NewExporter(hosts, service.NewInmemService()).ExportHosts(ctx, Query{Format: FormatCSV, Columns: []string{"rack", "id", "status"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]string
+	err = r.Rows(func(row []string) error {
+		rows = append(rows, append([]string(nil), row...))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != n {
+		t.Fatalf("got %d rows, want %d", len(rows), n)
+	}
+	for i := 1; i < len(rows); i++ {
+		a, b := rows[i-1], rows[i]
+		if a[0] > b[0] || a[0] == b[0] && a[1] >= b[1] {
+			t.Fatalf("row %d %v after %v: want rows sorted by rack and id", i, b, a)
+		}
+	}
+
+	r, err = NewExporter(hosts, service.NewInmemService()).ExportHosts(ctx, Query{Format: FormatCSV, Columns: []string{"id"}, Status: host.StatusMaintenance})
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	if err := r.Rows(func([]string) error { count++; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if want := (n + 6) / 7; count != want {
+		t.Fatalf("got %d hosts in maintenance, want %d", count, want)
+	}
+}
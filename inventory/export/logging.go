@@ -0,0 +1,50 @@
+package export
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Middleware func(Exporter) Exporter
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Exporter) Exporter {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Exporter
+	logger log.Logger
+}
+
+// ExportHosts logs the query, and once the report has been written, the
+// rows written and the error that stopped them, if any.
+func (mw loggingMiddleware) ExportHosts(ctx context.Context, q Query) (r Report, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ExportHosts", "namespace", namespace.FromContext(ctx), "format", q.Format, "columns", len(r.Columns), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	r, err = mw.next.ExportHosts(ctx, q)
+	if err != nil {
+		return r, err
+	}
+	rows := r.Rows
+	r.Rows = func(fn func(row []string) error) (err error) {
+		n := 0
+		defer func(begin time.Time) {
+			mw.logger.Log("method", "ExportHosts.Rows", "namespace", namespace.FromContext(ctx), "format", q.Format, "rows", n, "took", time.Since(begin), "err", err)
+		}(time.Now())
+		return rows(func(row []string) error {
+			n++
+			return fn(row)
+		})
+	}
+	return r, nil
+}
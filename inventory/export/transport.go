@@ -0,0 +1,147 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+	ErrBadLabel   = errors.New("label must be key=value")
+)
+
+func MakeHTTPHandler(s Exporter, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext),
+	}
+
+	for _, prefix := range []string{"/export/v1", "/export/v1/namespaces/{ns}"} {
+		r.Methods("GET").Path(prefix + "/hosts").Handler(httptransport.NewServer(
+			e.ExportHostsEndpoint,
+			decodeExportHostsRequest,
+			encodeExportHostsResponse,
+			options...,
+		))
+	}
+	return r
+}
+
+// decodeExportHostsRequest reads a query such as
+// ?format=csv&columns=id,name,service.id&datacenter=dc1&label=env=prod.
+// Columns and labels may be repeated; the format defaults to CSV.
+func decodeExportHostsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	query := Query{
+		Format:     q.Get("format"),
+		DataCenter: q.Get("datacenter"),
+		Rack:       q.Get("rack"),
+		Status:     q.Get("status"),
+		Owner:      q.Get("owner"),
+		Health:     service.HealthStatus(q.Get("health")),
+	}
+	if query.Format == "" {
+		query.Format = FormatCSV
+	}
+	for _, v := range q["columns"] {
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.TrimSpace(c); c != "" {
+				query.Columns = append(query.Columns, c)
+			}
+		}
+	}
+	for _, v := range q["label"] {
+		i := strings.Index(v, "=")
+		if i <= 0 {
+			return nil, ErrBadLabel
+		}
+		if query.Labels == nil {
+			query.Labels = map[string]string{}
+		}
+		query.Labels[v[:i]] = v[i+1:]
+	}
+	return exportHostsRequest{Query: query}, nil
+}
+
+// streamError is an error met once a report has started to be written,
+// when its status can no longer be changed.
+type streamError struct {
+	err error
+}
+
+func (e streamError) Error() string { return e.err.Error() }
+
+// encodeExportHostsResponse writes the report as a file to download.
+func encodeExportHostsResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(exportHostsResponse)
+	if resp.Err != nil {
+		encodeError(ctx, resp.Err, w)
+		return nil
+	}
+	w.Header().Set("Content-Type", ContentType(resp.Report.Format))
+	w.Header().Set("Content-Disposition", `attachment; filename="hosts.`+resp.Report.Format+`"`)
+	if err := Write(w, resp.Report); err != nil {
+		return streamError{err: err}
+	}
+	return nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+// encodeError writes err as JSON, except for an error in the middle of a
+// report, where the connection is dropped so that the client does not
+// take the truncated file for a whole one.
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	if _, ok := err.(streamError); ok {
+		panic(http.ErrAbortHandler)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	if _, ok := err.(*UnknownColumnError); ok {
+		return http.StatusBadRequest
+	}
+	switch err {
+	case ErrUnknownFormat, ErrUnknownStatus, ErrBadLabel:
+		return http.StatusBadRequest
+	case host.ErrUnknownNamespace:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
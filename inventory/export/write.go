@@ -0,0 +1,207 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+)
+
+// ContentType returns the media type of reports in format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatYAML:
+		return "application/yaml; charset=utf-8"
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "application/octet-stream"
+	}
+}
+
+// Write writes r to w in its format, row by row as Rows produces them.
+func Write(w io.Writer, r Report) error {
+	switch r.Format {
+	case FormatCSV:
+		return writeCSV(w, r)
+	case FormatYAML:
+		return writeYAML(w, r)
+	case FormatXLSX:
+		return writeXLSX(w, r)
+	default:
+		return ErrUnknownFormat
+	}
+}
+
+// flushEvery is how many rows are buffered before they are written out.
+const flushEvery = 256
+
+func writeCSV(w io.Writer, r Report) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(r.Columns); err != nil {
+		return err
+	}
+	n := 0
+	err := r.Rows(func(row []string) error {
+		if n++; n%flushEvery == 0 {
+			cw.Flush()
+		}
+		return cw.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// plainKey matches the keys that YAML reads as strings without quotes.
+var plainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_./-]*$`)
+
+// writeYAML writes a sequence of mappings, one per row. Strings are
+// written as JSON strings, which YAML reads as double-quoted scalars.
+func writeYAML(w io.Writer, r Report) error {
+	bw := bufio.NewWriter(w)
+	keys := make([]string, len(r.Columns))
+	numeric := make([]bool, len(r.Columns))
+	for i, name := range r.Columns {
+		keys[i] = name
+		if !plainKey.MatchString(name) {
+			keys[i] = quote(name)
+		}
+		c, _ := lookupColumn(name)
+		numeric[i] = c.numeric
+	}
+	n := 0
+	err := r.Rows(func(row []string) error {
+		n++
+		for i, v := range row {
+			switch {
+			case numeric[i] && v == "":
+				v = "null"
+			case !numeric[i]:
+				v = quote(v)
+			}
+			prefix := "  "
+			if i == 0 {
+				prefix = "- "
+			}
+			if _, err := fmt.Fprintf(bw, "%s%s: %s\n", prefix, keys[i], v); err != nil {
+				return err
+			}
+		}
+		if n%flushEvery == 0 {
+			return bw.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		bw.WriteString("[]\n")
+	}
+	return bw.Flush()
+}
+
+func quote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
+
+// xlsxParts are the parts of a workbook besides its one sheet.
+var xlsxParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Hosts" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+// writeXLSX writes a workbook of one sheet, with strings inline so that
+// rows can be written as they come instead of into a shared string table.
+func writeXLSX(w io.Writer, r Report) error {
+	zw := zip.NewWriter(w)
+	for _, p := range xlsxParts {
+		f, err := zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, p.body); err != nil {
+			return err
+		}
+	}
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	bw.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	numeric := make([]bool, len(r.Columns))
+	for i, name := range r.Columns {
+		c, _ := lookupColumn(name)
+		numeric[i] = c.numeric
+	}
+	n := 1
+	writeRow := func(row []string, header bool) error {
+		fmt.Fprintf(bw, `<row r="%d">`, n)
+		for i, v := range row {
+			if v == "" {
+				continue
+			}
+			ref := cellName(i) + fmt.Sprint(n)
+			if numeric[i] && !header {
+				fmt.Fprintf(bw, `<c r="%s"><v>%s</v></c>`, ref, v)
+				continue
+			}
+			fmt.Fprintf(bw, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err := xml.EscapeText(bw, []byte(v)); err != nil {
+				return err
+			}
+			bw.WriteString(`</t></is></c>`)
+		}
+		_, err := bw.WriteString(`</row>`)
+		n++
+		return err
+	}
+	if err := writeRow(r.Columns, true); err != nil {
+		return err
+	}
+	err = r.Rows(func(row []string) error {
+		if err := writeRow(row, false); err != nil {
+			return err
+		}
+		if n%flushEvery == 0 {
+			return bw.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	bw.WriteString(`</sheetData></worksheet>`)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// cellName returns the letters of column i of a sheet: A, ..., Z, AA, ...
+func cellName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,196 @@
+package host
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// Batch operation types. A check operation only evaluates its conditions.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+	OpCheck  = "check"
+)
+
+// HostOp is one operation of a batch. ID names the host to update, delete
+// or check and defaults to HostInfo.ID. The operation fails unless the
+// host exists if IfExists is true, or does not if it is false, and unless
+// its version equals a non-zero IfVersion.
+type HostOp struct {
+	Op        string   `json:"op"`
+	ID        string   `json:"id,omitempty"`
+	HostInfo  HostInfo `json:"hostinfo"`
+	IfExists  *bool    `json:"ifexists,omitempty"`
+	IfVersion uint64   `json:"ifversion,omitempty"`
+}
+
+func (op HostOp) id() string {
+	if op.ID != "" {
+		return op.ID
+	}
+	return op.HostInfo.ID
+}
+
+// Batch is a list of operations applied in order. Unless BestEffort is
+// set the batch is atomic: if any operation fails, none is applied.
+//
+// Hold lets a batch take part in a transaction spanning several stores.
+// When set, a store that applied the batch keeps it locked and passes Hold
+// a commit and a rollback function, one of which must be called to release
+// it. Middlewares with side effects wrap Hold to settle them.
+type Batch struct {
+	Ops        []HostOp                      `json:"ops"`
+	BestEffort bool                          `json:"besteffort,omitempty"`
+	Hold       func(commit, rollback func()) `json:"-"`
+}
+
+// BatchResult is the outcome of one operation of a batch. In an aborted
+// atomic batch, operations that did not fail themselves have a nil Err but
+// were not applied either.
+type BatchResult struct {
+	ID  string
+	Err error
+}
+
+var (
+	ErrInvalidOp       = errors.New("invalid batch operation")
+	ErrBatchAborted    = errors.New("batch aborted, no operation was applied")
+	ErrConditionFailed = errors.New("condition failed")
+	ErrVersionConflict = errors.New("version conflict")
+)
+
+// ForwardBatch runs check on every operation of b, in order, and forwards
+// the operations that pass to next. It lets middlewares validate a batch
+// one operation at a time; check may rewrite the operation it is given. In
+// an atomic batch a failed check aborts the batch without calling next.
+func ForwardBatch(ctx context.Context, b Batch, check func(op *HostOp) error, next func(context.Context, Batch) ([]BatchResult, error)) ([]BatchResult, error) {
+	results := make([]BatchResult, len(b.Ops))
+	forward := Batch{BestEffort: b.BestEffort, Hold: b.Hold}
+	var index []int
+	failed := false
+	for i := range b.Ops {
+		op := b.Ops[i]
+		results[i].ID = op.id()
+		if err := check(&op); err != nil {
+			results[i].Err = err
+			failed = true
+			continue
+		}
+		forward.Ops = append(forward.Ops, op)
+		index = append(index, i)
+	}
+	if failed && !b.BestEffort {
+		return results, ErrBatchAborted
+	}
+	if len(forward.Ops) == 0 {
+		return results, nil
+	}
+	sub, err := next(ctx, forward)
+	for j, r := range sub {
+		results[index[j]] = r
+	}
+	return results, err
+}
+
+func (s *inmemHost) BatchHostInfo(ctx context.Context, b Batch) ([]BatchResult, error) {
+	s.mtx.Lock()
+	held := false
+	defer func() {
+		if !held {
+			s.mtx.Unlock()
+		}
+	}()
+
+	var undo undo
+	if !b.BestEffort || b.Hold != nil {
+		undo = make(map[key]*HostInfo, len(b.Ops))
+	}
+	results := make([]BatchResult, len(b.Ops))
+	failed := false
+	for i, op := range b.Ops {
+		if undo != nil {
+			undo.save(s, key{namespace: namespace.FromContext(ctx), id: op.id()})
+		}
+		results[i] = BatchResult{ID: op.id(), Err: s.apply(ctx, op)}
+		if results[i].Err != nil {
+			failed = true
+		}
+	}
+	if failed && !b.BestEffort {
+		s.restore(undo)
+		return results, ErrBatchAborted
+	}
+	if b.Hold != nil {
+		held = true
+		b.Hold(s.mtx.Unlock, func() {
+			s.restore(undo)
+			s.mtx.Unlock()
+		})
+	}
+	return results, nil
+}
+
+func (s *inmemHost) apply(ctx context.Context, op HostOp) error {
+	if err := s.checkConditions(ctx, op); err != nil {
+		return err
+	}
+	switch op.Op {
+	case OpCheck:
+		return nil
+	case OpCreate:
+		return s.post(ctx, op.HostInfo)
+	case OpUpdate:
+		return s.put(ctx, op.id(), op.HostInfo)
+	case OpDelete:
+		return s.delete(ctx, op.id())
+	default:
+		return ErrInvalidOp
+	}
+}
+
+func (s *inmemHost) checkConditions(ctx context.Context, op HostOp) error {
+	h, ok := s.m[key{namespace: namespace.FromContext(ctx), id: op.id()}]
+	ok = ok && !h.Deleted()
+	if op.IfExists != nil && *op.IfExists != ok {
+		return ErrConditionFailed
+	}
+	if op.IfVersion != 0 && (!ok || h.Version != op.IfVersion) {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// undo holds the hosts a batch touches as they were before it, nil for
+// those it creates, so that a failed batch can be rolled back without
+// copying the store.
+type undo map[key]*HostInfo
+
+// save records host k of s unless the batch already touched it.
+func (u undo) save(s *inmemHost, k key) {
+	if _, ok := u[k]; ok {
+		return
+	}
+	if h, ok := s.m[k]; ok {
+		u[k] = &h
+		return
+	}
+	u[k] = nil
+}
+
+// restore puts back the hosts saved in u, and their index entries.
+// Addresses belong to a single host, so the order does not matter.
+func (s *inmemHost) restore(u undo) {
+	for k, last := range u {
+		if h, ok := s.m[k]; ok {
+			s.unindex(h)
+			delete(s.m, k)
+		}
+		if last != nil {
+			s.m[k] = *last
+			s.index(*last)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package host
+
+// Resources is an amount of compute resources: CPU in cores, memory in MiB
+// and disk in GiB. It is used both for the capacity of a host and for the
+// resource requests of a service.
+type Resources struct {
+	CPU    float64 `json:"cpu,omitempty"`
+	Memory int64   `json:"memory,omitempty"`
+	Disk   int64   `json:"disk,omitempty"`
+}
+
+func (r Resources) Add(o Resources) Resources {
+	return Resources{CPU: r.CPU + o.CPU, Memory: r.Memory + o.Memory, Disk: r.Disk + o.Disk}
+}
+
+func (r Resources) Sub(o Resources) Resources {
+	return Resources{CPU: r.CPU - o.CPU, Memory: r.Memory - o.Memory, Disk: r.Disk - o.Disk}
+}
+
+// Fits reports whether r covers every resource o asks for. Resources o
+// leaves at zero are not checked.
+func (r Resources) Fits(o Resources) bool {
+	return (o.CPU == 0 || o.CPU <= r.CPU) &&
+		(o.Memory == 0 || o.Memory <= r.Memory) &&
+		(o.Disk == 0 || o.Disk <= r.Disk)
+}
+
+// Validate rejects negative amounts.
+func (r Resources) Validate() error {
+	if r.CPU < 0 || r.Memory < 0 || r.Disk < 0 {
+		return ErrInvalidResources
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package host
+
+import "context"
+
+// Cordon cordons host id of s, so that no new service or instance is placed
+// on it, or uncordons it, and returns the host. Creates and updates keep
+// Cordoned as it is: it only changes through Cordon, called by the drain
+// and the cordon endpoints. A host written in the meantime is read again.
+func Cordon(ctx context.Context, s Host, id string, cordoned bool) (HostInfo, error) {
+	for {
+		h, err := s.GetHostInfo(ctx, id)
+		if err != nil || h.Cordoned == cordoned {
+			return h, err
+		}
+		h.Cordoned = cordoned
+		results, err := s.BatchHostInfo(NewManagedContext(ctx), Batch{Ops: []HostOp{{Op: OpUpdate, HostInfo: h, IfVersion: h.Version}}})
+		if err != nil && len(results) == 1 && results[0].Err != nil {
+			err = results[0].Err
+		}
+		if err == ErrVersionConflict {
+			continue
+		}
+		if err != nil {
+			return HostInfo{}, err
+		}
+		return s.GetHostInfo(ctx, id)
+	}
+}
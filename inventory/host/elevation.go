@@ -0,0 +1,49 @@
+package host
+
+import (
+	"fmt"
+)
+
+// Top is the highest rack unit occupied by h, or 0 if h has no position.
+// A height of 0 counts as one unit, as normalizePosition will store it.
+func (h HostInfo) Top() int {
+	if h.Position == 0 {
+		return 0
+	}
+	if h.Height == 0 {
+		return h.Position
+	}
+	return h.Position + h.Height - 1
+}
+
+// normalizePosition validates the rack placement of h. A host occupies
+// Height units starting at unit Position, counted from 1 at the bottom of
+// the rack; a positioned host without a height takes a single unit.
+func (h *HostInfo) normalizePosition() error {
+	if h.Position == 0 {
+		if h.Height < 0 {
+			return ErrInvalidPosition
+		}
+		return nil
+	}
+	if h.Position < 0 || h.Height < 0 || h.Rack == "" {
+		return ErrInvalidPosition
+	}
+	if h.Height == 0 {
+		h.Height = 1
+	}
+	return nil
+}
+
+// PositionConflictError is returned when a host is placed on rack units
+// already occupied by another host.
+type PositionConflictError struct {
+	Rack     string
+	HostID   string
+	Position int
+	Top      int
+}
+
+func (e *PositionConflictError) Error() string {
+	return fmt.Sprintf("rack %s units %d-%d already occupied by host %s", e.Rack, e.Position, e.Top, e.HostID)
+}
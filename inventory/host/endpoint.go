@@ -14,6 +14,12 @@ type Endpoints struct {
 	GetHostInfoEndpoint    endpoint.Endpoint
 	PutHostInfoEndpoint   endpoint.Endpoint
 	DeleteHostInfoEndpoint    endpoint.Endpoint
+	ListHostInfoEndpoint   endpoint.Endpoint
+	LookupHostInfoEndpoint   endpoint.Endpoint
+	BatchHostInfoEndpoint   endpoint.Endpoint
+	UndeleteHostInfoEndpoint endpoint.Endpoint
+	PurgeHostInfoEndpoint    endpoint.Endpoint
+	CordonHostInfoEndpoint   endpoint.Endpoint
 }
 
 func MakeServerEndpoints(h Host) Endpoints {
@@ -22,6 +28,12 @@ func MakeServerEndpoints(h Host) Endpoints {
 		GetHostInfoEndpoint:    MakeGetHostInfoEndpoint(h),
 		PutHostInfoEndpoint:    MakePutHostInfoEndpoint(h),
 		DeleteHostInfoEndpoint:    MakeDeleteHostInfoEndpoint(h),
+		ListHostInfoEndpoint:    MakeListHostInfoEndpoint(h),
+		LookupHostInfoEndpoint:    MakeLookupHostInfoEndpoint(h),
+		BatchHostInfoEndpoint:    MakeBatchHostInfoEndpoint(h),
+		UndeleteHostInfoEndpoint: MakeUndeleteHostInfoEndpoint(h),
+		PurgeHostInfoEndpoint:    MakePurgeHostInfoEndpoint(h),
+		CordonHostInfoEndpoint:   MakeCordonHostInfoEndpoint(h),
 	}
 }
 
@@ -35,13 +47,21 @@ func MakeClientEndpoints(instance string) (Endpoints, error) {
 	}
 	tgt.Path = ""
 
-	options := []httptransport.ClientOption{}
+	options := []httptransport.ClientOption{
+		httptransport.ClientBefore(ActorToHTTP),
+	}
 
 	return Endpoints{
 		PostHostInfoEndpoint:   httptransport.NewClient("POST", tgt, encodePostHostInfoRequest, decodePostHostInfoResponse, options...).Endpoint(),
 		GetHostInfoEndpoint:    httptransport.NewClient("GET", tgt, encodeGetHostInfoRequest, decodeGetHostInfoResponse, options...).Endpoint(),
 		PutHostInfoEndpoint:    httptransport.NewClient("PUT", tgt, encodePutHostInfoRequest, decodePutHostInfoResponse, options...).Endpoint(),
 		DeleteHostInfoEndpoint:    httptransport.NewClient("DELETE", tgt, encodeDeleteHostInfoRequest, decodeDeleteHostInfoResponse, options...).Endpoint(),
+		ListHostInfoEndpoint:    httptransport.NewClient("GET", tgt, encodeListHostInfoRequest, decodeListHostInfoResponse, options...).Endpoint(),
+		LookupHostInfoEndpoint:    httptransport.NewClient("GET", tgt, encodeLookupHostInfoRequest, decodeLookupHostInfoResponse, options...).Endpoint(),
+		BatchHostInfoEndpoint:    httptransport.NewClient("POST", tgt, encodeBatchHostInfoRequest, decodeBatchHostInfoResponse, options...).Endpoint(),
+		UndeleteHostInfoEndpoint: httptransport.NewClient("POST", tgt, encodeUndeleteHostInfoRequest, decodeUndeleteHostInfoResponse, options...).Endpoint(),
+		PurgeHostInfoEndpoint:    httptransport.NewClient("DELETE", tgt, encodePurgeHostInfoRequest, decodePurgeHostInfoResponse, options...).Endpoint(),
+		CordonHostInfoEndpoint:   httptransport.NewClient("POST", tgt, encodeCordonHostInfoRequest, decodeCordonHostInfoResponse, options...).Endpoint(),
 	}, nil
 }
 
@@ -85,6 +105,67 @@ func (e Endpoints) DeleteHostInfo(ctx context.Context, id string) error {
 	return resp.Err
 }
 
+func (e Endpoints) ListHostInfo(ctx context.Context, f HostFilter) ([]HostInfo, error) {
+	request := listHostInfoRequest{Filter: f}
+	response, err := e.ListHostInfoEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listHostInfoResponse)
+	return resp.HostInfos, resp.Err
+}
+
+func (e Endpoints) LookupHostInfo(ctx context.Context, q Lookup) (HostInfo, error) {
+	request := lookupHostInfoRequest{Lookup: q}
+	response, err := e.LookupHostInfoEndpoint(ctx, request)
+	if err != nil {
+		return HostInfo{}, err
+	}
+	resp := response.(lookupHostInfoResponse)
+	return resp.HostInfo, resp.Err
+}
+
+func (e Endpoints) BatchHostInfo(ctx context.Context, b Batch) ([]BatchResult, error) {
+	request := batchHostInfoRequest{Batch: b}
+	response, err := e.BatchHostInfoEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(batchHostInfoResponse)
+	return resp.Results, resp.Err
+}
+
+func (e Endpoints) UndeleteHostInfo(ctx context.Context, id string) (HostInfo, error) {
+	request := undeleteHostInfoRequest{ID: id}
+	response, err := e.UndeleteHostInfoEndpoint(ctx, request)
+	if err != nil {
+		return HostInfo{}, err
+	}
+	resp := response.(undeleteHostInfoResponse)
+	return resp.HostInfo, resp.Err
+}
+
+func (e Endpoints) PurgeHostInfo(ctx context.Context, id string) (HostInfo, error) {
+	request := purgeHostInfoRequest{ID: id}
+	response, err := e.PurgeHostInfoEndpoint(ctx, request)
+	if err != nil {
+		return HostInfo{}, err
+	}
+	resp := response.(purgeHostInfoResponse)
+	return resp.HostInfo, resp.Err
+}
+
+// CordonHostInfo cordons the host id, or uncordons it if cordoned is false.
+func (e Endpoints) CordonHostInfo(ctx context.Context, id string, cordoned bool) (HostInfo, error) {
+	request := cordonHostInfoRequest{ID: id, Cordoned: cordoned}
+	response, err := e.CordonHostInfoEndpoint(ctx, request)
+	if err != nil {
+		return HostInfo{}, err
+	}
+	resp := response.(cordonHostInfoResponse)
+	return resp.HostInfo, resp.Err
+}
+
 func MakePostHostInfoEndpoint(s Host) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(postHostInfoRequest)
@@ -117,6 +198,54 @@ func MakeDeleteHostInfoEndpoint(s Host) endpoint.Endpoint {
 	}
 }
 
+func MakeListHostInfoEndpoint(s Host) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listHostInfoRequest)
+		list, e := s.ListHostInfo(ctx, req.Filter)
+		return listHostInfoResponse{HostInfos: list, Err: e}, nil
+	}
+}
+
+func MakeLookupHostInfoEndpoint(s Host) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(lookupHostInfoRequest)
+		h, e := s.LookupHostInfo(ctx, req.Lookup)
+		return lookupHostInfoResponse{HostInfo: h, Err: e}, nil
+	}
+}
+
+func MakeBatchHostInfoEndpoint(s Host) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(batchHostInfoRequest)
+		results, e := s.BatchHostInfo(ctx, req.Batch)
+		return batchHostInfoResponse{Results: results, Err: e}, nil
+	}
+}
+
+func MakeUndeleteHostInfoEndpoint(s Host) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(undeleteHostInfoRequest)
+		h, e := s.UndeleteHostInfo(ctx, req.ID)
+		return undeleteHostInfoResponse{HostInfo: h, Err: e}, nil
+	}
+}
+
+func MakePurgeHostInfoEndpoint(s Host) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(purgeHostInfoRequest)
+		h, e := s.PurgeHostInfo(ctx, req.ID)
+		return purgeHostInfoResponse{HostInfo: h, Err: e}, nil
+	}
+}
+
+func MakeCordonHostInfoEndpoint(s Host) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(cordonHostInfoRequest)
+		h, e := Cordon(ctx, s, req.ID, req.Cordoned)
+		return cordonHostInfoResponse{HostInfo: h, Err: e}, nil
+	}
+}
+
 type postHostInfoRequest struct {
 	HostInfo HostInfo
 }
@@ -147,7 +276,7 @@ type putHostInfoResponse struct {
 	Err error `json:"err,omitempty"`
 }
 
-func (r putHostInfoResponse) error() error { return nil }
+func (r putHostInfoResponse) error() error { return r.Err }
 
 type deleteHostInfoRequest struct {
 	ID string
@@ -158,3 +287,70 @@ type deleteHostInfoResponse struct {
 }
 
 func (r deleteHostInfoResponse) error() error { return r.Err }
+
+type listHostInfoRequest struct {
+	Filter HostFilter
+}
+
+type listHostInfoResponse struct {
+	HostInfos []HostInfo `json:"hostinfos"`
+	Err       error      `json:"err,omitempty"`
+}
+
+func (r listHostInfoResponse) error() error { return r.Err }
+
+type lookupHostInfoRequest struct {
+	Lookup Lookup
+}
+
+type lookupHostInfoResponse struct {
+	HostInfo HostInfo `json:"hostinfo,omitempty"`
+	Err      error    `json:"err,omitempty"`
+}
+
+func (r lookupHostInfoResponse) error() error { return r.Err }
+
+type batchHostInfoRequest struct {
+	Batch Batch
+}
+
+type batchHostInfoResponse struct {
+	Results []BatchResult
+	Err     error
+}
+
+func (r batchHostInfoResponse) error() error { return r.Err }
+
+type undeleteHostInfoRequest struct {
+	ID string
+}
+
+type undeleteHostInfoResponse struct {
+	HostInfo HostInfo `json:"hostinfo,omitempty"`
+	Err      error    `json:"err,omitempty"`
+}
+
+func (r undeleteHostInfoResponse) error() error { return r.Err }
+
+type purgeHostInfoRequest struct {
+	ID string
+}
+
+type purgeHostInfoResponse struct {
+	HostInfo HostInfo `json:"hostinfo,omitempty"`
+	Err      error    `json:"err,omitempty"`
+}
+
+func (r purgeHostInfoResponse) error() error { return r.Err }
+
+type cordonHostInfoRequest struct {
+	ID       string
+	Cordoned bool
+}
+
+type cordonHostInfoResponse struct {
+	HostInfo HostInfo `json:"hostinfo,omitempty"`
+	Err      error    `json:"err,omitempty"`
+}
+
+func (r cordonHostInfoResponse) error() error { return r.Err }
@@ -3,8 +3,13 @@ package host
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/xinyu/infra/inventory/namespace"
 )
 
 type Host interface {
@@ -12,51 +17,274 @@ type Host interface {
 	GetHostInfo(ctx context.Context, id string) (HostInfo, error)
 	PutHostInfo(ctx context.Context, id string, h HostInfo) error
 	DeleteHostInfo(ctx context.Context, id string) error
+	ListHostInfo(ctx context.Context, f HostFilter) ([]HostInfo, error)
+	LookupHostInfo(ctx context.Context, q Lookup) (HostInfo, error)
+	BatchHostInfo(ctx context.Context, b Batch) ([]BatchResult, error)
+	UndeleteHostInfo(ctx context.Context, id string) (HostInfo, error)
+	PurgeHostInfo(ctx context.Context, id string) (HostInfo, error)
 }
 
 type HostInfo struct {
-	ID          string     `json:"id"`
-	Name        string     `json:"name"`
-	IP          string     `json:"ip"`
-	Port        string     `json:"port"`
-	Rack        string     `json:"rack"`
-	DataCenter  string     `json:"datacenter"`
-	CreatedAt   time.Time  `json:"createtime"`
-	UpdatedAt   time.Time  `json:"updatetime"`
-	Remark      string     `json:"remark"`
+	ID         string            `json:"id"`
+	Namespace  string            `json:"namespace"`
+	Name       string            `json:"name"`
+	IP         string            `json:"ip"`
+	Port       string            `json:"port"`
+	Rack       string            `json:"rack"`
+	DataCenter string            `json:"datacenter"`
+	Position   int               `json:"position,omitempty"`
+	Height     int               `json:"height,omitempty"`
+	Interfaces []Interface       `json:"interfaces,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Cordoned   bool              `json:"cordoned,omitempty"`
+	Status     string            `json:"status,omitempty"`
+	ReservedBy string            `json:"reservedby,omitempty"`
+	Capacity   Resources         `json:"capacity"`
+	Version    uint64            `json:"version"`
+	CreatedAt  time.Time         `json:"createtime"`
+	UpdatedAt  time.Time         `json:"updatetime"`
+	DeletedAt  *time.Time        `json:"deletetime,omitempty"`
+	DeletedBy  string            `json:"deletedby,omitempty"`
+	Remark     string            `json:"remark"`
+}
+
+// Host statuses. A host without a status is available.
+const (
+	StatusMaintenance = "maintenance"
+	StatusReserved    = "reserved"
+)
+
+type managedKey struct{}
+
+// NewManagedContext returns a context whose creates and updates write the
+// fields the inventory manages itself: Cordoned, set through Cordon, and
+// Status and ReservedBy, set by the scheduler as bookings start and end.
+// Other writes keep them as they are.
+func NewManagedContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, managedKey{}, true)
+}
+
+// ManagedFromContext reports whether ctx was returned by
+// NewManagedContext.
+func ManagedFromContext(ctx context.Context) bool {
+	managed, _ := ctx.Value(managedKey{}).(bool)
+	return managed
+}
+
+// keepManaged gives h the managed fields of last, the host it replaces,
+// unless ctx may write them.
+func keepManaged(ctx context.Context, h *HostInfo, last HostInfo) {
+	if ManagedFromContext(ctx) {
+		return
+	}
+	h.Cordoned, h.Status, h.ReservedBy = last.Cordoned, last.Status, last.ReservedBy
+}
+
+// MatchLabels reports whether h carries every label of selector.
+func (h HostInfo) MatchLabels(selector map[string]string) bool {
+	for k, v := range selector {
+		if h.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookup finds a host by the MAC of one of its interfaces or by any of its
+// IP addresses. Exactly one field is set.
+type Lookup struct {
+	MAC string
+	IP  string
+}
+
+// HostFilter selects hosts in ListHostInfo. Empty fields match every host.
+// IP matches any address of a host. Deleted hosts are only listed with
+// IncludeDeleted.
+//
+// A positive Limit lists a page of at most Limit hosts, sorted by
+// datacenter, rack, namespace and ID rather than by namespace and ID.
+// After, the cursor of the last host of a page, lists the next one.
+type HostFilter struct {
+	DataCenter     string
+	Rack           string
+	Name           string
+	IP             string
+	IncludeDeleted bool
+	Limit          int
+	After          *Cursor
+}
+
+// Cursor is the position of a host in the pages of ListHostInfo.
+type Cursor struct {
+	DataCenter string `json:"datacenter"`
+	Rack       string `json:"rack"`
+	Namespace  string `json:"namespace"`
+	ID         string `json:"id"`
+}
+
+// CursorOf returns the cursor of h, to list the hosts after it.
+func CursorOf(h HostInfo) *Cursor {
+	c := cursor(h)
+	return &c
+}
+
+func cursor(h HostInfo) Cursor {
+	return Cursor{DataCenter: h.DataCenter, Rack: h.Rack, Namespace: h.Namespace, ID: h.ID}
+}
+
+func (c Cursor) less(d Cursor) bool {
+	if c.DataCenter != d.DataCenter {
+		return c.DataCenter < d.DataCenter
+	}
+	if c.Rack != d.Rack {
+		return c.Rack < d.Rack
+	}
+	if c.Namespace != d.Namespace {
+		return c.Namespace < d.Namespace
+	}
+	return c.ID < d.ID
+}
+
+func (f HostFilter) match(h HostInfo) bool {
+	if h.Deleted() && !f.IncludeDeleted {
+		return false
+	}
+	if f.DataCenter != "" && f.DataCenter != h.DataCenter {
+		return false
+	}
+	if f.Rack != "" && f.Rack != h.Rack {
+		return false
+	}
+	if f.Name != "" && f.Name != h.Name {
+		return false
+	}
+	if f.IP != "" {
+		ip := f.IP
+		if parsed := net.ParseIP(ip); parsed != nil {
+			ip = parsed.String()
+		}
+		for _, addr := range h.Addresses() {
+			if addr == ip {
+				return true
+			}
+		}
+		return false
+	}
+	return true
 }
 
 var (
-	ErrInconsistentIDs = errors.New("inconsistent IDs")
-	ErrAlreadyExists   = errors.New("already exists")
-	ErrNotFound        = errors.New("not found")
-	ErrNotFoundID      = errors.New("not found host ID")
+	ErrInconsistentIDs   = errors.New("inconsistent IDs")
+	ErrAlreadyExists     = errors.New("already exists")
+	ErrNotFound          = errors.New("not found")
+	ErrNotFoundID        = errors.New("not found host ID")
+	ErrUnknownDataCenter = errors.New("unknown datacenter")
+	ErrUnknownRack       = errors.New("unknown rack")
+	ErrRackDataCenter    = errors.New("rack is not in the host's datacenter")
+	ErrInvalidPosition   = errors.New("invalid rack position")
+	ErrOutsideRack       = errors.New("position outside rack")
+	ErrInvalidIP         = errors.New("invalid IP address")
+	ErrDuplicateIP       = errors.New("IP address already in use")
+	ErrNoFreeIP          = errors.New("no free IP address in datacenter")
+	ErrInvalidInterface  = errors.New("invalid network interface")
+	ErrDuplicateMAC      = errors.New("MAC address already in use")
+	ErrInvalidLookup     = errors.New("lookup needs exactly one of mac or ip")
+	ErrUnknownNamespace  = errors.New("unknown namespace")
+	ErrInvalidResources  = errors.New("invalid resources")
+	ErrNotUnique         = errors.New("another host has the same values of a unique constraint")
+	ErrDeleted           = errors.New("deleted, undelete or purge it first")
 )
 
+// DeniedError is returned when an admission hook or a policy rejects a
+// write. By names what rejected it and Reason is the explanation given.
+type DeniedError struct {
+	By     string
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("denied by %s: %s", e.By, e.Reason)
+}
+
+// key identifies a host across namespaces. MACs, addresses and rack units
+// are physical and stay unique across namespaces.
+type key struct {
+	namespace string
+	id        string
+}
+
+func keyOf(h HostInfo) key {
+	return key{namespace: h.Namespace, id: h.ID}
+}
+
 type inmemHost struct {
-	mtx sync.RWMutex
-	m   map[string]HostInfo
+	mtx     sync.RWMutex
+	m       map[key]HostInfo
+	byMAC   map[string]key
+	byIP    map[string]key
+	indexes map[string]index
+	unique  []Unique
 }
 
-func NewInmemHost() Host {
+// NewInmemHost returns a store that keeps hosts in memory, indexed by
+// address, name, datacenter and rack, and enforces the unique constraints
+// on writes.
+func NewInmemHost(unique ...Unique) Host {
+	return newInmemHost(0, unique)
+}
+
+func newInmemHost(size int, unique []Unique) *inmemHost {
 	return &inmemHost{
-		m: map[string]HostInfo{},
+		m:       make(map[key]HostInfo, size),
+		byMAC:   map[string]key{},
+		byIP:    map[string]key{},
+		indexes: newIndexes(),
+		unique:  unique,
 	}
 }
 
 func (s *inmemHost) PostHostInfo(ctx context.Context, h HostInfo) error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
+	return s.post(ctx, h)
+}
 
-	if _, ok := s.m[h.ID]; ok {
+func (s *inmemHost) post(ctx context.Context, h HostInfo) error {
+	h.Namespace = namespace.FromContext(ctx)
+	if err := h.normalizePosition(); err != nil {
+		return err
+	}
+	if err := h.normalizeInterfaces(); err != nil {
+		return err
+	}
+	if err := h.Capacity.Validate(); err != nil {
+		return err
+	}
+	if last, ok := s.m[keyOf(h)]; ok {
+		if last.Deleted() {
+			return ErrDeleted
+		}
 		return ErrAlreadyExists
 	}
+	keepManaged(ctx, &h, HostInfo{})
+	if err := s.checkPosition(h); err != nil {
+		return err
+	}
+	if err := s.checkAddresses(h); err != nil {
+		return err
+	}
+	if err := s.checkUnique(h); err != nil {
+		return err
+	}
 
-	currentTime := time.Now()
+	currentTime := TimeFromContext(ctx)
 	h.CreatedAt = currentTime
 	h.UpdatedAt = currentTime
+	h.DeletedAt, h.DeletedBy = nil, ""
+	h.Version = 1
 
-	s.m[h.ID] = h
+	s.m[keyOf(h)] = h
+	s.index(h)
 
 	return nil
 }
@@ -64,38 +292,154 @@ func (s *inmemHost) PostHostInfo(ctx context.Context, h HostInfo) error {
 func (s *inmemHost) GetHostInfo(ctx context.Context, id string) (HostInfo, error) {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
-	h, ok := s.m[id]
-	if !ok {
+	h, ok := s.m[key{namespace: namespace.FromContext(ctx), id: id}]
+	if !ok || h.Deleted() {
 		return HostInfo{}, ErrNotFound
 	}
 	return h, nil
 }
 
 func (s *inmemHost) PutHostInfo(ctx context.Context, id string, h HostInfo) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.put(ctx, id, h)
+}
+
+func (s *inmemHost) put(ctx context.Context, id string, h HostInfo) error {
 	if id != h.ID {
 		return ErrInconsistentIDs
 	}
-	s.mtx.Lock()
-	defer s.mtx.Unlock()
+	h.Namespace = namespace.FromContext(ctx)
+	if err := h.normalizePosition(); err != nil {
+		return err
+	}
+	if err := h.normalizeInterfaces(); err != nil {
+		return err
+	}
+	if err := h.Capacity.Validate(); err != nil {
+		return err
+	}
+	hLast, ok := s.m[keyOf(h)]
+	if ok && hLast.Deleted() {
+		return ErrDeleted
+	}
+	keepManaged(ctx, &h, hLast)
+	if err := s.checkPosition(h); err != nil {
+		return err
+	}
+	if err := s.checkAddresses(h); err != nil {
+		return err
+	}
+	if err := s.checkUnique(h); err != nil {
+		return err
+	}
 
-	currentTime := time.Now()
+	currentTime := TimeFromContext(ctx)
 	h.UpdatedAt = currentTime
+	h.DeletedAt, h.DeletedBy = nil, ""
 
-	hLast, ok := s.m[id]
+	h.Version = 1
 	if ok {
 		h.CreatedAt = hLast.CreatedAt
+		h.Version = hLast.Version + 1
+		s.unindex(hLast)
 	}
 
-	s.m[id] = h
+	s.m[keyOf(h)] = h
+	s.index(h)
 	return nil
 }
 
 func (s *inmemHost) DeleteHostInfo(ctx context.Context, id string) error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
-	if _, ok := s.m[id]; !ok {
+	return s.delete(ctx, id)
+}
+
+// delete moves the host to the trash. It keeps its addresses, rack units
+// and unique values until it is purged, so that it can be undeleted.
+func (s *inmemHost) delete(ctx context.Context, id string) error {
+	k := key{namespace: namespace.FromContext(ctx), id: id}
+	h, ok := s.m[k]
+	if !ok || h.Deleted() {
 		return ErrNotFound
 	}
-	delete(s.m, id)
+	deletedAt := TimeFromContext(ctx)
+	h.DeletedAt, h.DeletedBy = &deletedAt, ActorFromContext(ctx)
+	h.Version++
+	s.m[k] = h
 	return nil
-}
\ No newline at end of file
+}
+
+func (s *inmemHost) ListHostInfo(ctx context.Context, f HostFilter) ([]HostInfo, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	ns, all := namespace.FromContext(ctx), namespace.IsAll(ctx)
+	list := []HostInfo{}
+	for _, h := range s.candidates(f) {
+		if (all || h.Namespace == ns) && f.match(h) && (f.After == nil || f.After.less(cursor(h))) {
+			list = append(list, h)
+		}
+	}
+	if f.Limit > 0 {
+		sort.Slice(list, func(i, j int) bool { return cursor(list[i]).less(cursor(list[j])) })
+		if len(list) > f.Limit {
+			list = list[:f.Limit]
+		}
+		return list, nil
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Namespace != list[j].Namespace {
+			return list[i].Namespace < list[j].Namespace
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+// LookupHostInfo only finds hosts of the namespace in ctx, although MACs
+// and addresses are unique across namespaces.
+func (s *inmemHost) LookupHostInfo(ctx context.Context, q Lookup) (HostInfo, error) {
+	var k key
+	var ok bool
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	switch {
+	case q.MAC != "" && q.IP == "":
+		mac, err := net.ParseMAC(q.MAC)
+		if err != nil {
+			return HostInfo{}, ErrInvalidLookup
+		}
+		k, ok = s.byMAC[mac.String()]
+	case q.IP != "" && q.MAC == "":
+		ip := net.ParseIP(q.IP)
+		if ip == nil {
+			return HostInfo{}, ErrInvalidLookup
+		}
+		k, ok = s.byIP[ip.String()]
+	default:
+		return HostInfo{}, ErrInvalidLookup
+	}
+	if !ok || s.m[k].Deleted() || (k.namespace != namespace.FromContext(ctx) && !namespace.IsAll(ctx)) {
+		return HostInfo{}, ErrNotFound
+	}
+	return s.m[k], nil
+}
+
+// checkPosition rejects h if the rack units it occupies overlap another
+// host in the same rack.
+func (s *inmemHost) checkPosition(h HostInfo) error {
+	if h.Position == 0 {
+		return nil
+	}
+	for k := range s.indexes[FieldRack][h.Rack] {
+		other := s.m[k]
+		if k == keyOf(h) || other.Position == 0 {
+			continue
+		}
+		if h.Position <= other.Top() && other.Position <= h.Top() {
+			return &PositionConflictError{Rack: h.Rack, HostID: other.ID, Position: other.Position, Top: other.Top()}
+		}
+	}
+	return nil
+}
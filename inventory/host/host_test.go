@@ -0,0 +1,196 @@
+package host
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestListHostInfoPages(t *testing.T) {
+	ctx := context.Background()
+	s := NewInmemHost()
+	for _, h := range []HostInfo{
+		{ID: "e", DataCenter: "dc2", Rack: "r01"},
+		{ID: "a", DataCenter: "dc1", Rack: "r02"},
+		{ID: "d", DataCenter: "dc1", Rack: "r01"},
+		{ID: "b", DataCenter: "dc1", Rack: "r01"},
+		{ID: "c", DataCenter: "dc1", Rack: "r02"},
+	} {
+		if err := s.PostHostInfo(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got [][]string
+	var after *Cursor
+	for {
+		page, err := s.ListHostInfo(ctx, HostFilter{Limit: 2, After: after})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		var ids []string
+		for _, h := range page {
+			ids = append(ids, h.ID)
+		}
+		got = append(got, ids)
+		after = CursorOf(page[len(page)-1])
+	}
+	want := [][]string{{"b", "d"}, {"a", "c"}, {"e"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got pages %v, want %v", got, want)
+	}
+
+	page, err := s.ListHostInfo(ctx, HostFilter{DataCenter: "dc1", Limit: 10, After: &Cursor{DataCenter: "dc1", Rack: "r01", Namespace: "default", ID: "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 3 || page[0].ID != "d" {
+		t.Fatalf("got %+v, want d, a and c", page)
+	}
+}
+
+func TestPositionConflict(t *testing.T) {
+	ctx := context.Background()
+	s := NewInmemHost()
+	for _, h := range []HostInfo{
+		{ID: "a", Rack: "r01", Position: 10, Height: 2},
+		{ID: "b", Rack: "r02", Position: 11},
+		{ID: "c", Rack: "r01"},
+	} {
+		if err := s.PostHostInfo(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		h    HostInfo
+		want *PositionConflictError
+	}{
+		{"overlapping units", HostInfo{ID: "b", Rack: "r01", Position: 11}, &PositionConflictError{Rack: "r01", HostID: "a", Position: 10, Top: 11}},
+		{"covering units", HostInfo{ID: "b", Rack: "r01", Position: 8, Height: 4}, &PositionConflictError{Rack: "r01", HostID: "a", Position: 10, Top: 11}},
+		{"next units", HostInfo{ID: "b", Rack: "r01", Position: 12}, nil},
+		{"same units in another rack", HostInfo{ID: "c", Rack: "r03", Position: 10}, nil},
+		{"own units", HostInfo{ID: "a", Rack: "r01", Position: 10, Height: 1}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h, err := s.GetHostInfo(ctx, tc.h.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.Rack, h.Position, h.Height = tc.h.Rack, tc.h.Position, tc.h.Height
+			err = s.PutHostInfo(ctx, h.ID, h)
+			if tc.want == nil {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if e, ok := err.(*PositionConflictError); !ok || *e != *tc.want {
+				t.Fatalf("got %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestManagedFields(t *testing.T) {
+	ctx := context.Background()
+	s := NewInmemHost()
+	if err := s.PostHostInfo(ctx, HostInfo{ID: "a", Status: StatusReserved, ReservedBy: "me"}); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := s.GetHostInfo(ctx, "a"); h.Status != "" || h.ReservedBy != "" {
+		t.Fatalf("created with status %q by %q, want none", h.Status, h.ReservedBy)
+	}
+
+	// As the scheduler does when a booking starts.
+	if err := s.PutHostInfo(NewManagedContext(ctx), "a", HostInfo{ID: "a", Status: StatusMaintenance}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutHostInfo(ctx, "a", HostInfo{ID: "a", Name: "web1"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.BatchHostInfo(ctx, Batch{Ops: []HostOp{{Op: OpUpdate, HostInfo: HostInfo{ID: "a", Name: "web2", Status: StatusReserved, ReservedBy: "me"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := s.GetHostInfo(ctx, "a"); h.Name != "web2" || h.Status != StatusMaintenance || h.ReservedBy != "" {
+		t.Fatalf("got %q with status %q by %q, want web2 still in maintenance", h.Name, h.Status, h.ReservedBy)
+	}
+
+	if err := s.PutHostInfo(NewManagedContext(ctx), "a", HostInfo{ID: "a", Name: "web2"}); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := s.GetHostInfo(ctx, "a"); h.Status != "" {
+		t.Fatalf("got status %q once the booking ended, want none", h.Status)
+	}
+}
+
+func TestCordon(t *testing.T) {
+	ctx := context.Background()
+	s := NewInmemHost()
+	if err := s.PostHostInfo(ctx, HostInfo{ID: "a", Cordoned: true}); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := s.GetHostInfo(ctx, "a"); h.Cordoned {
+		t.Fatal("created cordoned, want cordoned through Cordon only")
+	}
+	if h, err := Cordon(ctx, s, "a", true); err != nil || !h.Cordoned || h.Version != 2 {
+		t.Fatalf("got %+v, %v, want a cordoned at version 2", h, err)
+	}
+	if err := s.PutHostInfo(ctx, "a", HostInfo{ID: "a", Name: "web1"}); err != nil {
+		t.Fatal(err)
+	}
+	if h, _ := s.GetHostInfo(ctx, "a"); !h.Cordoned {
+		t.Fatal("uncordoned by an update without cordoned")
+	}
+	if h, err := Cordon(ctx, s, "a", false); err != nil || h.Cordoned || h.Name != "web1" {
+		t.Fatalf("got %+v, %v, want web1 uncordoned", h, err)
+	}
+	if _, err := Cordon(ctx, s, "b", true); err != ErrNotFound {
+		t.Fatalf("got %v cordoning a missing host, want %v", err, ErrNotFound)
+	}
+}
+
+func TestBatchRollback(t *testing.T) {
+	ctx := context.Background()
+	s := NewInmemHost()
+	if err := s.PostHostInfo(ctx, HostInfo{ID: "a", IP: "10.0.0.1", Rack: "r1"}); err != nil {
+		t.Fatal(err)
+	}
+	check := func(when string) {
+		t.Helper()
+		if h, err := s.LookupHostInfo(ctx, Lookup{IP: "10.0.0.1"}); err != nil || h.ID != "a" || h.Version != 1 {
+			t.Fatalf("%s: looked up %+v, %v, want a as posted", when, h, err)
+		}
+		for _, ip := range []string{"10.0.0.2", "10.0.0.3"} {
+			if _, err := s.LookupHostInfo(ctx, Lookup{IP: ip}); err != ErrNotFound {
+				t.Fatalf("%s: got %v looking up %s, want %v", when, err, ip, ErrNotFound)
+			}
+		}
+		if list, _ := s.ListHostInfo(ctx, HostFilter{Rack: "r2"}); len(list) != 0 {
+			t.Fatalf("%s: got %+v in r2, want none", when, list)
+		}
+		if _, err := s.GetHostInfo(ctx, "b"); err != ErrNotFound {
+			t.Fatalf("%s: got %v for b, want %v", when, err, ErrNotFound)
+		}
+	}
+	ops := []HostOp{
+		{Op: OpUpdate, HostInfo: HostInfo{ID: "a", IP: "10.0.0.2", Rack: "r2"}},
+		{Op: OpCreate, HostInfo: HostInfo{ID: "b", IP: "10.0.0.1", Rack: "r2"}},
+		{Op: OpUpdate, HostInfo: HostInfo{ID: "b", IP: "10.0.0.3", Rack: "r2"}},
+	}
+
+	if _, err := s.BatchHostInfo(ctx, Batch{Ops: append(ops, HostOp{Op: OpDelete, ID: "c"})}); err != ErrBatchAborted {
+		t.Fatalf("got %v, want %v", err, ErrBatchAborted)
+	}
+	check("aborted")
+
+	var rollback func()
+	if _, err := s.BatchHostInfo(ctx, Batch{Ops: ops, Hold: func(c, r func()) { rollback = r }}); err != nil {
+		t.Fatal(err)
+	}
+	rollback()
+	check("rolled back")
+}
@@ -0,0 +1,180 @@
+package host
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+// Fields of the secondary indexes of the in-memory store, by their JSON
+// names. Hosts are also indexed by IP address, see indexAddresses.
+const (
+	FieldName       = "name"
+	FieldDataCenter = "datacenter"
+	FieldRack       = "rack"
+)
+
+var indexedFields = []string{FieldName, FieldDataCenter, FieldRack}
+
+func (h HostInfo) field(name string) string {
+	switch name {
+	case FieldName:
+		return h.Name
+	case FieldDataCenter:
+		return h.DataCenter
+	case FieldRack:
+		return h.Rack
+	}
+	return ""
+}
+
+// Unique is a constraint that no two hosts of a namespace share the values
+// of all its fields, e.g. Unique{FieldDataCenter, FieldName} for host names
+// unique per datacenter. Hosts that leave one of the fields empty are not
+// constrained.
+type Unique []string
+
+var ErrInvalidUnique = errors.New("unique constraint must list name, datacenter or rack joined by +")
+
+// ParseUnique parses a comma-separated list of constraints whose fields
+// are joined by +, such as "datacenter+name,rack+name".
+func ParseUnique(s string) ([]Unique, error) {
+	var list []Unique
+	for _, c := range strings.Split(s, ",") {
+		if c = strings.TrimSpace(c); c == "" {
+			continue
+		}
+		var u Unique
+		for _, f := range strings.Split(c, "+") {
+			switch f = strings.TrimSpace(f); f {
+			case FieldName, FieldDataCenter, FieldRack:
+				u = append(u, f)
+			default:
+				return nil, ErrInvalidUnique
+			}
+		}
+		list = append(list, u)
+	}
+	return list, nil
+}
+
+func (u Unique) applies(h HostInfo) bool {
+	for _, f := range u {
+		if h.field(f) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// keySet is the set of hosts having one value of an indexed field.
+type keySet map[key]struct{}
+
+// index maps the values of a field to the hosts having them.
+type index map[string]keySet
+
+func (ix index) add(v string, k key) {
+	if v == "" {
+		return
+	}
+	if ix[v] == nil {
+		ix[v] = keySet{}
+	}
+	ix[v][k] = struct{}{}
+}
+
+func (ix index) remove(v string, k key) {
+	delete(ix[v], k)
+	if len(ix[v]) == 0 {
+		delete(ix, v)
+	}
+}
+
+func newIndexes() map[string]index {
+	m := make(map[string]index, len(indexedFields))
+	for _, f := range indexedFields {
+		m[f] = index{}
+	}
+	return m
+}
+
+// index records h in every index of s.
+func (s *inmemHost) index(h HostInfo) {
+	s.indexAddresses(h)
+	for _, f := range indexedFields {
+		s.indexes[f].add(h.field(f), keyOf(h))
+	}
+}
+
+func (s *inmemHost) unindex(h HostInfo) {
+	s.unindexAddresses(h)
+	for _, f := range indexedFields {
+		s.indexes[f].remove(h.field(f), keyOf(h))
+	}
+}
+
+// checkUnique rejects h if another host of its namespace has the same
+// values for every field of one of the unique constraints of s.
+func (s *inmemHost) checkUnique(h HostInfo) error {
+	for _, u := range s.unique {
+		if !u.applies(h) {
+			continue
+		}
+		for k := range s.indexes[u[0]][h.field(u[0])] {
+			if k.namespace != h.Namespace || k == keyOf(h) {
+				continue
+			}
+			other, same := s.m[k], true
+			for _, f := range u[1:] {
+				if other.field(f) != h.field(f) {
+					same = false
+					break
+				}
+			}
+			if same {
+				return ErrNotUnique
+			}
+		}
+	}
+	return nil
+}
+
+// candidates returns the hosts that may match f, read from the most
+// selective index f allows. The caller still matches them against f.
+func (s *inmemHost) candidates(f HostFilter) []HostInfo {
+	if f.IP != "" {
+		ip := f.IP
+		if parsed := net.ParseIP(ip); parsed != nil {
+			ip = parsed.String()
+		}
+		if k, ok := s.byIP[ip]; ok {
+			return []HostInfo{s.m[k]}
+		}
+		return nil
+	}
+	var best keySet
+	found := false
+	for _, c := range []struct{ field, value string }{
+		{FieldName, f.Name}, {FieldRack, f.Rack}, {FieldDataCenter, f.DataCenter},
+	} {
+		if c.value == "" {
+			continue
+		}
+		keys := s.indexes[c.field][c.value]
+		if !found || len(keys) < len(best) {
+			best, found = keys, true
+		}
+	}
+	if !found {
+		list := make([]HostInfo, 0, len(s.m))
+		for _, h := range s.m {
+			list = append(list, h)
+		}
+		return list
+	}
+	list := make([]HostInfo, 0, len(best))
+	for k := range best {
+		list = append(list, s.m[k])
+	}
+	return list
+}
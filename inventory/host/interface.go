@@ -0,0 +1,164 @@
+package host
+
+import (
+	"net"
+)
+
+// Interface roles. Other roles are accepted as free text.
+const (
+	RoleManagement = "management"
+	RoleData       = "data"
+	RoleStorage    = "storage"
+)
+
+const maxVLAN = 4094
+
+// Interface is a network interface of a host.
+type Interface struct {
+	Name string   `json:"name"`
+	MAC  string   `json:"mac"`
+	IPv4 []string `json:"ipv4,omitempty"`
+	IPv6 []string `json:"ipv6,omitempty"`
+	VLAN int      `json:"vlan,omitempty"`
+	Role string   `json:"role,omitempty"`
+}
+
+// Addresses returns every IP address of h: the primary IP followed by the
+// addresses of its interfaces, without duplicates.
+func (h HostInfo) Addresses() []string {
+	var addrs []string
+	seen := map[string]bool{}
+	add := func(ip string) {
+		if ip == "" {
+			return
+		}
+		if parsed := net.ParseIP(ip); parsed != nil {
+			ip = parsed.String()
+		}
+		if !seen[ip] {
+			seen[ip] = true
+			addrs = append(addrs, ip)
+		}
+	}
+	add(h.IP)
+	for _, ifc := range h.Interfaces {
+		for _, ip := range ifc.IPv4 {
+			add(ip)
+		}
+		for _, ip := range ifc.IPv6 {
+			add(ip)
+		}
+	}
+	return addrs
+}
+
+// normalizeInterfaces validates the primary IP and the interfaces of h and
+// rewrites MAC and IP addresses in canonical form. When h has no primary
+// IP, the first address of its management interface, or else of its first
+// interface, becomes the primary IP so that v1 clients keep seeing one.
+func (h *HostInfo) normalizeInterfaces() error {
+	if h.IP != "" {
+		parsed := net.ParseIP(h.IP)
+		if parsed == nil {
+			return ErrInvalidIP
+		}
+		h.IP = parsed.String()
+	}
+	names, macs := map[string]bool{}, map[string]bool{}
+	for i := range h.Interfaces {
+		ifc := &h.Interfaces[i]
+		if ifc.Name == "" || names[ifc.Name] || ifc.VLAN < 0 || ifc.VLAN > maxVLAN {
+			return ErrInvalidInterface
+		}
+		names[ifc.Name] = true
+		if ifc.MAC != "" {
+			mac, err := net.ParseMAC(ifc.MAC)
+			if err != nil {
+				return ErrInvalidInterface
+			}
+			ifc.MAC = mac.String()
+			if macs[ifc.MAC] {
+				return ErrDuplicateMAC
+			}
+			macs[ifc.MAC] = true
+		}
+		for j, ip := range ifc.IPv4 {
+			parsed := net.ParseIP(ip)
+			if parsed == nil || parsed.To4() == nil {
+				return ErrInvalidIP
+			}
+			ifc.IPv4[j] = parsed.String()
+		}
+		for j, ip := range ifc.IPv6 {
+			parsed := net.ParseIP(ip)
+			if parsed == nil || parsed.To4() != nil {
+				return ErrInvalidIP
+			}
+			ifc.IPv6[j] = parsed.String()
+		}
+	}
+
+	if h.IP == "" {
+		for _, ifc := range h.Interfaces {
+			if ifc.Role == RoleManagement {
+				h.IP = ifc.firstAddress()
+				break
+			}
+		}
+	}
+	if h.IP == "" && len(h.Interfaces) > 0 {
+		h.IP = h.Interfaces[0].firstAddress()
+	}
+	return nil
+}
+
+func (ifc Interface) firstAddress() string {
+	if len(ifc.IPv4) > 0 {
+		return ifc.IPv4[0]
+	}
+	if len(ifc.IPv6) > 0 {
+		return ifc.IPv6[0]
+	}
+	return ""
+}
+
+// indexAddresses records the MACs and IPs of h in the lookup indexes.
+func (s *inmemHost) indexAddresses(h HostInfo) {
+	for _, ip := range h.Addresses() {
+		s.byIP[ip] = keyOf(h)
+	}
+	for _, ifc := range h.Interfaces {
+		if ifc.MAC != "" {
+			s.byMAC[ifc.MAC] = keyOf(h)
+		}
+	}
+}
+
+func (s *inmemHost) unindexAddresses(h HostInfo) {
+	for _, ip := range h.Addresses() {
+		if s.byIP[ip] == keyOf(h) {
+			delete(s.byIP, ip)
+		}
+	}
+	for _, ifc := range h.Interfaces {
+		if s.byMAC[ifc.MAC] == keyOf(h) {
+			delete(s.byMAC, ifc.MAC)
+		}
+	}
+}
+
+// checkAddresses rejects h if one of its MACs or IPs belongs to another
+// host.
+func (s *inmemHost) checkAddresses(h HostInfo) error {
+	for _, ip := range h.Addresses() {
+		if k, ok := s.byIP[ip]; ok && k != keyOf(h) {
+			return ErrDuplicateIP
+		}
+	}
+	for _, ifc := range h.Interfaces {
+		if k, ok := s.byMAC[ifc.MAC]; ok && ifc.MAC != "" && k != keyOf(h) {
+			return ErrDuplicateMAC
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package host
+
+import (
+	"context"
+	"testing"
+)
+
+func TestInterfaces(t *testing.T) {
+	ctx := context.Background()
+	eth0 := Interface{Name: "eth0", MAC: "52:54:00:12:34:56", IPv4: []string{"10.1.0.20"}, Role: RoleData}
+	for _, tc := range []struct {
+		name string
+		h    HostInfo
+		want error
+	}{
+		{"valid", HostInfo{ID: "b", IP: "10.0.0.2", Interfaces: []Interface{eth0}}, nil},
+		{"invalid primary IP", HostInfo{ID: "b", IP: "garbage"}, ErrInvalidIP},
+		{"primary IP of another host", HostInfo{ID: "b", IP: "10.0.0.1"}, ErrDuplicateIP},
+		{"interface address of another host", HostInfo{ID: "b", Interfaces: []Interface{{Name: "eth0", IPv4: []string{"10.0.0.1"}}}}, ErrDuplicateIP},
+		{"IPv6 listed as IPv4", HostInfo{ID: "b", Interfaces: []Interface{{Name: "eth0", IPv4: []string{"fd00::1"}}}}, ErrInvalidIP},
+		{"MAC of another host", HostInfo{ID: "b", Interfaces: []Interface{{Name: "eth0", MAC: "52:54:00:00:00:01"}}}, ErrDuplicateMAC},
+		{"MAC twice on the host", HostInfo{ID: "b", Interfaces: []Interface{eth0, {Name: "eth1", MAC: "52-54-00-12-34-56"}}}, ErrDuplicateMAC},
+		{"name twice on the host", HostInfo{ID: "b", Interfaces: []Interface{eth0, {Name: "eth0"}}}, ErrInvalidInterface},
+		{"invalid VLAN", HostInfo{ID: "b", Interfaces: []Interface{{Name: "eth0", VLAN: 5000}}}, ErrInvalidInterface},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewInmemHost()
+			a := HostInfo{ID: "a", IP: "10.0.0.1", Interfaces: []Interface{{Name: "eth0", MAC: "52:54:00:00:00:01"}}}
+			if err := s.PostHostInfo(ctx, a); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.PostHostInfo(ctx, tc.h); err != tc.want {
+				t.Fatalf("post: got %v, want %v", err, tc.want)
+			}
+			results, _ := s.BatchHostInfo(ctx, Batch{BestEffort: true, Ops: []HostOp{{Op: OpUpdate, HostInfo: tc.h}}})
+			if results[0].Err != tc.want {
+				t.Fatalf("batch: got %v, want %v", results[0].Err, tc.want)
+			}
+		})
+	}
+}
+
+func TestPrimaryAddress(t *testing.T) {
+	ctx := context.Background()
+	s := NewInmemHost()
+	h := HostInfo{ID: "a", Interfaces: []Interface{
+		{Name: "eth0", IPv6: []string{"FD00::0001"}},
+		{Name: "ipmi", IPv4: []string{"10.2.0.20"}, Role: RoleManagement},
+	}}
+	if err := s.PostHostInfo(ctx, h); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.LookupHostInfo(ctx, Lookup{IP: "fd00::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.IP != "10.2.0.20" {
+		t.Fatalf("primary IP %q, want the management address", got.IP)
+	}
+}
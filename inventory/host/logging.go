@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
 )
 
 type Middleware func(Host) Host
@@ -25,29 +27,63 @@ type loggingMiddleware struct {
 
 func (mw loggingMiddleware) PostHostInfo(ctx context.Context, h HostInfo) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "PostHostInfo", "id", h.ID, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "PostHostInfo", "namespace", namespace.FromContext(ctx), "id", h.ID, "took", time.Since(begin), "err", err)
 	}(time.Now())
 	return mw.next.PostHostInfo(ctx, h)
 }
 
 func (mw loggingMiddleware) GetHostInfo(ctx context.Context, id string) (h HostInfo, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "GetHostInfo", "id", id, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "GetHostInfo", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
 	}(time.Now())
 	return mw.next.GetHostInfo(ctx, id)
 }
 
 func (mw loggingMiddleware) PutHostInfo(ctx context.Context, id string, h HostInfo) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "PutHostInfo", "id", id, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "PutHostInfo", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
 	}(time.Now())
 	return mw.next.PutHostInfo(ctx, id, h)
 }
 
 func (mw loggingMiddleware) DeleteHostInfo(ctx context.Context, id string) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "DeleteHostInfo", "id", id, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "DeleteHostInfo", "namespace", namespace.FromContext(ctx), "id", id, "actor", ActorFromContext(ctx), "took", time.Since(begin), "err", err)
 	}(time.Now())
 	return mw.next.DeleteHostInfo(ctx, id)
 }
 
+func (mw loggingMiddleware) ListHostInfo(ctx context.Context, f HostFilter) (list []HostInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListHostInfo", "namespace", namespace.FromContext(ctx), "datacenter", f.DataCenter, "rack", f.Rack, "name", f.Name, "ip", f.IP, "deleted", f.IncludeDeleted, "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListHostInfo(ctx, f)
+}
+
+func (mw loggingMiddleware) LookupHostInfo(ctx context.Context, q Lookup) (h HostInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "LookupHostInfo", "namespace", namespace.FromContext(ctx), "mac", q.MAC, "ip", q.IP, "id", h.ID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.LookupHostInfo(ctx, q)
+}
+
+func (mw loggingMiddleware) BatchHostInfo(ctx context.Context, b Batch) (results []BatchResult, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "BatchHostInfo", "namespace", namespace.FromContext(ctx), "ops", len(b.Ops), "besteffort", b.BestEffort, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.BatchHostInfo(ctx, b)
+}
+
+func (mw loggingMiddleware) UndeleteHostInfo(ctx context.Context, id string) (h HostInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "UndeleteHostInfo", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.UndeleteHostInfo(ctx, id)
+}
+
+func (mw loggingMiddleware) PurgeHostInfo(ctx context.Context, id string) (h HostInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PurgeHostInfo", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PurgeHostInfo(ctx, id)
+}
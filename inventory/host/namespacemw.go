@@ -0,0 +1,96 @@
+package host
+
+import (
+	"context"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// NamespaceMiddleware rejects requests scoped to a namespace that does not
+// exist.
+func NamespaceMiddleware(ns namespace.Namespace) Middleware {
+	return func(next Host) Host {
+		return &namespaceMiddleware{
+			next: next,
+			ns:   ns,
+		}
+	}
+}
+
+type namespaceMiddleware struct {
+	next Host
+	ns   namespace.Namespace
+}
+
+func (mw namespaceMiddleware) check(ctx context.Context) error {
+	if namespace.IsAll(ctx) {
+		return nil
+	}
+	if _, err := mw.ns.GetNamespaceInfo(ctx, namespace.FromContext(ctx)); err != nil {
+		return ErrUnknownNamespace
+	}
+	return nil
+}
+
+func (mw namespaceMiddleware) PostHostInfo(ctx context.Context, h HostInfo) error {
+	if err := mw.check(ctx); err != nil {
+		return err
+	}
+	return mw.next.PostHostInfo(ctx, h)
+}
+
+func (mw namespaceMiddleware) GetHostInfo(ctx context.Context, id string) (HostInfo, error) {
+	if err := mw.check(ctx); err != nil {
+		return HostInfo{}, err
+	}
+	return mw.next.GetHostInfo(ctx, id)
+}
+
+func (mw namespaceMiddleware) PutHostInfo(ctx context.Context, id string, h HostInfo) error {
+	if err := mw.check(ctx); err != nil {
+		return err
+	}
+	return mw.next.PutHostInfo(ctx, id, h)
+}
+
+func (mw namespaceMiddleware) DeleteHostInfo(ctx context.Context, id string) error {
+	if err := mw.check(ctx); err != nil {
+		return err
+	}
+	return mw.next.DeleteHostInfo(ctx, id)
+}
+
+func (mw namespaceMiddleware) ListHostInfo(ctx context.Context, f HostFilter) ([]HostInfo, error) {
+	if err := mw.check(ctx); err != nil {
+		return nil, err
+	}
+	return mw.next.ListHostInfo(ctx, f)
+}
+
+func (mw namespaceMiddleware) LookupHostInfo(ctx context.Context, q Lookup) (HostInfo, error) {
+	if err := mw.check(ctx); err != nil {
+		return HostInfo{}, err
+	}
+	return mw.next.LookupHostInfo(ctx, q)
+}
+
+func (mw namespaceMiddleware) BatchHostInfo(ctx context.Context, b Batch) ([]BatchResult, error) {
+	if err := mw.check(ctx); err != nil {
+		return nil, err
+	}
+	return mw.next.BatchHostInfo(ctx, b)
+}
+
+func (mw namespaceMiddleware) UndeleteHostInfo(ctx context.Context, id string) (HostInfo, error) {
+	if err := mw.check(ctx); err != nil {
+		return HostInfo{}, err
+	}
+	return mw.next.UndeleteHostInfo(ctx, id)
+}
+
+func (mw namespaceMiddleware) PurgeHostInfo(ctx context.Context, id string) (HostInfo, error) {
+	if err := mw.check(ctx); err != nil {
+		return HostInfo{}, err
+	}
+	return mw.next.PurgeHostInfo(ctx, id)
+}
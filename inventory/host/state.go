@@ -0,0 +1,95 @@
+package host
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// State is the whole content of a host store: every host of every
+// namespace.
+type State struct {
+	Hosts []HostInfo `json:"hosts"`
+}
+
+// Snapshotter is implemented by stores whose whole content can be read and
+// replaced at once, to replicate or back it up. LoadState replaces the
+// content of the store with st.
+type Snapshotter interface {
+	DumpState(ctx context.Context) (State, error)
+	LoadState(ctx context.Context, st State) error
+}
+
+// RecordReader is implemented by stores that can read one host as they
+// keep it, in the trash or not, so that a backend can write only the hosts
+// a write changed. GetHostRecord reports false for a host the store does
+// not have.
+type RecordReader interface {
+	GetHostRecord(ctx context.Context, id string) (HostInfo, bool)
+}
+
+func (s *inmemHost) GetHostRecord(ctx context.Context, id string) (HostInfo, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	h, ok := s.m[key{namespace: namespace.FromContext(ctx), id: id}]
+	return h, ok
+}
+
+func (s *inmemHost) DumpState(ctx context.Context) (State, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	st := State{Hosts: make([]HostInfo, 0, len(s.m))}
+	for _, h := range s.m {
+		st.Hosts = append(st.Hosts, h)
+	}
+	sort.Slice(st.Hosts, func(i, j int) bool {
+		if st.Hosts[i].Namespace != st.Hosts[j].Namespace {
+			return st.Hosts[i].Namespace < st.Hosts[j].Namespace
+		}
+		return st.Hosts[i].ID < st.Hosts[j].ID
+	})
+	return st, nil
+}
+
+// LoadState takes the hosts of st as they are, versions and times
+// included.
+func (s *inmemHost) LoadState(ctx context.Context, st State) error {
+	c := newInmemHost(len(st.Hosts), s.unique)
+	for _, h := range st.Hosts {
+		if _, ok := c.m[keyOf(h)]; ok {
+			return ErrAlreadyExists
+		}
+		if err := c.checkAddresses(h); err != nil {
+			return err
+		}
+		if err := c.checkUnique(h); err != nil {
+			return err
+		}
+		c.m[keyOf(h)] = h
+		c.index(h)
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.m, s.byMAC, s.byIP, s.indexes = c.m, c.byMAC, c.byIP, c.indexes
+	return nil
+}
+
+type timeKey struct{}
+
+// NewTimeContext returns a context whose writes are stamped with t rather
+// than the current time, so that replicas applying the same write record
+// the same times.
+func NewTimeContext(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, timeKey{}, t)
+}
+
+// TimeFromContext returns the time set by NewTimeContext, or the current
+// time.
+func TimeFromContext(ctx context.Context) time.Time {
+	if t, ok := ctx.Value(timeKey{}).(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
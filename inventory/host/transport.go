@@ -14,6 +14,8 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/transport"
 	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/namespace"
 )
 
 var (
@@ -26,33 +28,80 @@ func MakeHTTPHandler(s Host, logger log.Logger) http.Handler {
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext, ActorHTTPToContext),
 	}
 
-	r.Methods("POST").Path("/host/v1/hostinfo/").Handler(httptransport.NewServer(
-		e.PostHostInfoEndpoint,
-		decodePostHostInfoRequest,
-		encodeResponse,
-		options...,
-	))
-	r.Methods("GET").Path("/host/v1/hostinfo/{id}").Handler(httptransport.NewServer(
-		e.GetHostInfoEndpoint,
-		decodeGetHostInfoRequest,
-		encodeResponse,
-		options...,
-	))
-	r.Methods("PUT").Path("/host/v1/hostinfo/{id}").Handler(httptransport.NewServer(
-		e.PutHostInfoEndpoint,
-		decodePutHostInfoRequest,
-		encodeResponse,
-		options...,
-	))
-	r.Methods("DELETE").Path("/host/v1/hostinfo/{id}").Handler(httptransport.NewServer(
-		e.DeleteHostInfoEndpoint,
-		decodeDeleteHostInfoRequest,
-		encodeResponse,
-		options...,
-	))
+	// The unscoped routes serve the default namespace.
+	for _, prefix := range []string{"/host/v1", "/host/v1/namespaces/{ns}"} {
+		r.Methods("POST").Path(prefix + "/hostinfo/").Handler(httptransport.NewServer(
+			e.PostHostInfoEndpoint,
+			decodePostHostInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/hostinfo/{id}").Handler(httptransport.NewServer(
+			e.GetHostInfoEndpoint,
+			decodeGetHostInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("PUT").Path(prefix + "/hostinfo/{id}").Handler(httptransport.NewServer(
+			e.PutHostInfoEndpoint,
+			decodePutHostInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("DELETE").Path(prefix + "/hostinfo/{id}").Queries("purge", "true").Handler(httptransport.NewServer(
+			e.PurgeHostInfoEndpoint,
+			decodePurgeHostInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("DELETE").Path(prefix + "/hostinfo/{id}").Handler(httptransport.NewServer(
+			e.DeleteHostInfoEndpoint,
+			decodeDeleteHostInfoRequest,
+			encodeResponse,
+			options...,
+		))
+
+		r.Methods("POST").Path(prefix + "/hostinfo/{id}/undelete").Handler(httptransport.NewServer(
+			e.UndeleteHostInfoEndpoint,
+			decodeUndeleteHostInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("POST").Path(prefix + "/hostinfo/{id}/cordon").Handler(httptransport.NewServer(
+			e.CordonHostInfoEndpoint,
+			decodeCordonHostInfoRequest(true),
+			encodeResponse,
+			options...,
+		))
+		r.Methods("POST").Path(prefix + "/hostinfo/{id}/uncordon").Handler(httptransport.NewServer(
+			e.CordonHostInfoEndpoint,
+			decodeCordonHostInfoRequest(false),
+			encodeResponse,
+			options...,
+		))
 
+		r.Methods("GET").Path(prefix + "/hostinfo/").Handler(httptransport.NewServer(
+			e.ListHostInfoEndpoint,
+			decodeListHostInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/lookup").Handler(httptransport.NewServer(
+			e.LookupHostInfoEndpoint,
+			decodeLookupHostInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("POST").Path(prefix + "/batch").Handler(httptransport.NewServer(
+			e.BatchHostInfoEndpoint,
+			decodeBatchHostInfoRequest,
+			encodeBatchResponse,
+			options...,
+		))
+	}
 	return r
 }
 
@@ -98,34 +147,157 @@ func decodeDeleteHostInfoRequest(_ context.Context, r *http.Request) (request in
 	return deleteHostInfoRequest{ID: id}, nil
 }
 
+func decodeUndeleteHostInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return undeleteHostInfoRequest{ID: id}, nil
+}
+
+// decodeCordonHostInfoRequest decodes the request of the cordon route if
+// cordoned is true, or of the uncordon route.
+func decodeCordonHostInfoRequest(cordoned bool) httptransport.DecodeRequestFunc {
+	return func(_ context.Context, r *http.Request) (request interface{}, err error) {
+		vars := mux.Vars(r)
+		id, ok := vars["id"]
+		if !ok {
+			return nil, ErrBadRouting
+		}
+		return cordonHostInfoRequest{ID: id, Cordoned: cordoned}, nil
+	}
+}
+
+func decodePurgeHostInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return purgeHostInfoRequest{ID: id}, nil
+}
+
+func decodeListHostInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	return listHostInfoRequest{Filter: HostFilter{
+		DataCenter: q.Get("datacenter"),
+		Rack:       q.Get("rack"),
+		Name:       q.Get("name"),
+		IP:         q.Get("ip"),
+
+		IncludeDeleted: q.Get("includeDeleted") == "true",
+	}}, nil
+}
+
+func decodeLookupHostInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	return lookupHostInfoRequest{Lookup: Lookup{
+		MAC: q.Get("mac"),
+		IP:  q.Get("ip"),
+	}}, nil
+}
+
+func decodeBatchHostInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req batchHostInfoRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Batch); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
 func encodePostHostInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
-	req.URL.Path = "/host/v1/hostinfo/"
+	req.URL.Path = basePath(ctx) + "/hostinfo/"
 	return encodeRequest(ctx, req, request)
 }
 
 func encodeGetHostInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
 	r := request.(getHostInfoRequest)
 	hostID := url.QueryEscape(r.ID)
-	req.URL.Path = "/host/v1/hostinfo/" + hostID
+	req.URL.Path = basePath(ctx) + "/hostinfo/" + hostID
 	return encodeRequest(ctx, req, request)
 }
 
 func encodePutHostInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
-	// r.Methods("PUT").Path("/hostinfo/{id}")
 	r := request.(putHostInfoRequest)
 	hostID := url.QueryEscape(r.ID)
-	req.URL.Path = "/hostinfo/" + hostID
+	req.URL.Path = basePath(ctx) + "/hostinfo/" + hostID
 	return encodeRequest(ctx, req, request)
 }
 
 func encodeDeleteHostInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
-	// r.Methods("DELETE").Path("/hostinfo/{id}")
 	r := request.(deleteHostInfoRequest)
 	hostID := url.QueryEscape(r.ID)
-	req.URL.Path = "/hostinfo/" + hostID
+	req.URL.Path = basePath(ctx) + "/hostinfo/" + hostID
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeListHostInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(listHostInfoRequest)
+	q := url.Values{}
+	if r.Filter.DataCenter != "" {
+		q.Set("datacenter", r.Filter.DataCenter)
+	}
+	if r.Filter.Rack != "" {
+		q.Set("rack", r.Filter.Rack)
+	}
+	if r.Filter.Name != "" {
+		q.Set("name", r.Filter.Name)
+	}
+	if r.Filter.IP != "" {
+		q.Set("ip", r.Filter.IP)
+	}
+	if r.Filter.IncludeDeleted {
+		q.Set("includeDeleted", "true")
+	}
+	req.URL.Path = basePath(ctx) + "/hostinfo/"
+	req.URL.RawQuery = q.Encode()
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeLookupHostInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(lookupHostInfoRequest)
+	q := url.Values{}
+	if r.Lookup.MAC != "" {
+		q.Set("mac", r.Lookup.MAC)
+	}
+	if r.Lookup.IP != "" {
+		q.Set("ip", r.Lookup.IP)
+	}
+	req.URL.Path = basePath(ctx) + "/lookup"
+	req.URL.RawQuery = q.Encode()
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeUndeleteHostInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(undeleteHostInfoRequest)
+	req.URL.Path = basePath(ctx) + "/hostinfo/" + url.QueryEscape(r.ID) + "/undelete"
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeCordonHostInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(cordonHostInfoRequest)
+	action := "/cordon"
+	if !r.Cordoned {
+		action = "/uncordon"
+	}
+	req.URL.Path = basePath(ctx) + "/hostinfo/" + url.QueryEscape(r.ID) + action
 	return encodeRequest(ctx, req, request)
 }
 
+func encodePurgeHostInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(purgeHostInfoRequest)
+	req.URL.Path = basePath(ctx) + "/hostinfo/" + url.QueryEscape(r.ID)
+	req.URL.RawQuery = "purge=true"
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeBatchHostInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(batchHostInfoRequest)
+	req.URL.Path = basePath(ctx) + "/batch"
+	return encodeRequest(ctx, req, r.Batch)
+}
+
 func decodePostHostInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
 	var response postHostInfoResponse
 	err := json.NewDecoder(resp.Body).Decode(&response)
@@ -150,6 +322,55 @@ func decodeDeleteHostInfoResponse(_ context.Context, resp *http.Response) (inter
 	return response, err
 }
 
+func decodeListHostInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response listHostInfoResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeLookupHostInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response lookupHostInfoResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeUndeleteHostInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response undeleteHostInfoResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeCordonHostInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response cordonHostInfoResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodePurgeHostInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response purgeHostInfoResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeBatchHostInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var body batchBody
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	response := batchHostInfoResponse{}
+	for _, r := range body.Results {
+		result := BatchResult{ID: r.ID}
+		if r.Error != "" {
+			result.Err = errors.New(r.Error)
+		}
+		response.Results = append(response.Results, result)
+	}
+	if body.Error != "" {
+		response.Err = errors.New(body.Error)
+	}
+	return response, nil
+}
+
 type errorer interface {
 	error() error
 }
@@ -163,6 +384,14 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 	return json.NewEncoder(w).Encode(response)
 }
 
+// basePath returns the route prefix for the namespace in ctx.
+func basePath(ctx context.Context) string {
+	if ns := namespace.FromContext(ctx); ns != namespace.Default {
+		return "/host/v1/namespaces/" + url.PathEscape(ns)
+	}
+	return "/host/v1"
+}
+
 func encodeRequest(_ context.Context, req *http.Request, request interface{}) error {
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(request)
@@ -173,23 +402,75 @@ func encodeRequest(_ context.Context, req *http.Request, request interface{}) er
 	return nil
 }
 
+// batchBody is the wire form of a batch response. Every result carries
+// the HTTP status its operation would have had on its own.
+type batchBody struct {
+	Error   string            `json:"error,omitempty"`
+	Results []batchResultBody `json:"results"`
+}
+
+type batchResultBody struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// encodeBatchResponse writes the per-operation results of a batch, also
+// when an atomic batch was aborted.
+func encodeBatchResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	r := response.(batchHostInfoResponse)
+	if r.Err != nil && r.Results == nil {
+		encodeError(ctx, r.Err, w)
+		return nil
+	}
+	body := batchBody{Results: make([]batchResultBody, len(r.Results))}
+	for i, result := range r.Results {
+		body.Results[i].ID = result.ID
+		body.Results[i].Status = http.StatusOK
+		if result.Err != nil {
+			body.Results[i].Status = codeFrom(result.Err)
+			body.Results[i].Error = result.Err.Error()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if r.Err != nil {
+		body.Error = r.Err.Error()
+		w.WriteHeader(codeFrom(r.Err))
+	}
+	return json.NewEncoder(w).Encode(body)
+}
+
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	if err == nil {
 		panic("encodeError with nil error")
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(codeFrom(err))
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	body := map[string]interface{}{
 		"error": err.Error(),
-	})
+	}
+	if e, ok := err.(*PositionConflictError); ok {
+		body["hostid"] = e.HostID
+	}
+	json.NewEncoder(w).Encode(body)
 }
 
 func codeFrom(err error) int {
+	if _, ok := err.(*PositionConflictError); ok {
+		return http.StatusConflict
+	}
+	if _, ok := err.(*DeniedError); ok {
+		return http.StatusForbidden
+	}
 	switch err {
-	case ErrNotFound:
+	case ErrNotFound, ErrUnknownNamespace:
 		return http.StatusNotFound
-	case ErrAlreadyExists, ErrInconsistentIDs:
+	case ErrAlreadyExists, ErrInconsistentIDs, ErrUnknownDataCenter, ErrUnknownRack, ErrRackDataCenter,
+		ErrInvalidPosition, ErrOutsideRack, ErrInvalidIP, ErrInvalidInterface, ErrInvalidLookup, ErrInvalidOp,
+		ErrInvalidResources:
 		return http.StatusBadRequest
+	case ErrDuplicateIP, ErrDuplicateMAC, ErrNoFreeIP, ErrNotUnique, ErrDeleted, ErrBatchAborted, ErrConditionFailed, ErrVersionConflict:
+		return http.StatusConflict
 	default:
 		return http.StatusInternalServerError
 	}
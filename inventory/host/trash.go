@@ -0,0 +1,81 @@
+package host
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// Deleted reports whether h is in the trash: deleted but not yet purged.
+func (h HostInfo) Deleted() bool {
+	return h.DeletedAt != nil
+}
+
+// UndeleteHostInfo takes the host out of the trash and returns it as
+// restored.
+func (s *inmemHost) UndeleteHostInfo(ctx context.Context, id string) (HostInfo, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: namespace.FromContext(ctx), id: id}
+	h, ok := s.m[k]
+	if !ok || !h.Deleted() {
+		return HostInfo{}, ErrNotFound
+	}
+	h.DeletedAt, h.DeletedBy = nil, ""
+	h.UpdatedAt = TimeFromContext(ctx)
+	h.Version++
+	s.m[k] = h
+	return h, nil
+}
+
+// PurgeHostInfo removes the host for good, whether it is in the trash or
+// not, and returns it as it was.
+func (s *inmemHost) PurgeHostInfo(ctx context.Context, id string) (HostInfo, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: namespace.FromContext(ctx), id: id}
+	h, ok := s.m[k]
+	if !ok {
+		return HostInfo{}, ErrNotFound
+	}
+	s.unindex(h)
+	delete(s.m, k)
+	return h, nil
+}
+
+type actorKey struct{}
+
+// NewActorContext returns a context whose deletes are recorded as made by
+// actor.
+func NewActorContext(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by NewActorContext, or "".
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// ActorHTTPToContext moves the actor named by the X-Actor header into the
+// context, or else the address the request came from.
+func ActorHTTPToContext(ctx context.Context, r *http.Request) context.Context {
+	if actor := r.Header.Get("X-Actor"); actor != "" {
+		return NewActorContext(ctx, actor)
+	}
+	if addr, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return NewActorContext(ctx, addr)
+	}
+	return NewActorContext(ctx, r.RemoteAddr)
+}
+
+// ActorToHTTP names the actor of ctx, if any, in the X-Actor header of a
+// client request.
+func ActorToHTTP(ctx context.Context, r *http.Request) context.Context {
+	if actor := ActorFromContext(ctx); actor != "" {
+		r.Header.Set("X-Actor", actor)
+	}
+	return ctx
+}
@@ -0,0 +1,263 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ansibleHost is a host of an inventory, with the groups it is listed in
+// and its variables.
+type ansibleHost struct {
+	name   string
+	line   int
+	groups []string
+	vars   map[string]string
+}
+
+// parseAnsible reads the hosts of an Ansible INI inventory. Each group a
+// host belongs to, directly or through :children sections, becomes a
+// label group.<name> set to "true". Group and host variables become
+// labels too, host variables winning, except ansible_host, which gives
+// the IP if it is one, and ansible_port, the port. Other ansible_
+// variables are ignored. Numeric ranges such as web[01:03] are expanded.
+func parseAnsible(data []byte) ([]record, error) {
+	hosts := map[string]*ansibleHost{}
+	var order []string
+	children := map[string][]string{}
+	groupVars := map[string]map[string]string{}
+
+	section, kind := "ungrouped", ""
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		source := fmt.Sprintf("line %d", n)
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, &ParseError{Format: FormatAnsible, Source: source, Reason: "unterminated section"}
+			}
+			section, kind = line[1:len(line)-1], ""
+			if i := strings.Index(section, ":"); i >= 0 {
+				section, kind = section[:i], section[i+1:]
+			}
+			if kind != "" && kind != "vars" && kind != "children" {
+				return nil, &ParseError{Format: FormatAnsible, Source: source, Reason: "unknown section type " + kind}
+			}
+			continue
+		}
+
+		fields, err := splitFields(line)
+		if err != nil {
+			return nil, &ParseError{Format: FormatAnsible, Source: source, Reason: err.Error()}
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		switch kind {
+		case "children":
+			children[section] = append(children[section], fields[0])
+		case "vars":
+			k, v, ok := splitVar(line)
+			if !ok {
+				return nil, &ParseError{Format: FormatAnsible, Source: source, Reason: "variable is not key=value"}
+			}
+			if groupVars[section] == nil {
+				groupVars[section] = map[string]string{}
+			}
+			groupVars[section][k] = v
+		default:
+			names, err := expandRange(fields[0])
+			if err != nil {
+				return nil, &ParseError{Format: FormatAnsible, Source: source, Reason: err.Error()}
+			}
+			for _, name := range names {
+				h, ok := hosts[name]
+				if !ok {
+					h = &ansibleHost{name: name, line: n, vars: map[string]string{}}
+					hosts[name] = h
+					order = append(order, name)
+				}
+				h.groups = append(h.groups, section)
+				for _, f := range fields[1:] {
+					k, v, ok := splitVar(f)
+					if !ok {
+						return nil, &ParseError{Format: FormatAnsible, Source: source, Reason: fmt.Sprintf("host variable %q is not key=value", f)}
+					}
+					h.vars[k] = v
+				}
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, &ParseError{Format: FormatAnsible, Reason: err.Error()}
+	}
+
+	parents := map[string][]string{}
+	for parent, list := range children {
+		for _, child := range list {
+			parents[child] = append(parents[child], parent)
+		}
+	}
+
+	var records []record
+	for _, name := range order {
+		h := hosts[name]
+		groups := ancestors(h.groups, parents)
+		rec := record{Source: fmt.Sprintf("line %d", h.line)}
+		rec.Host.ID = name
+		rec.Host.Name = name
+		rec.Host.Labels = map[string]string{}
+
+		vars := map[string]string{}
+		for _, g := range append([]string{"all"}, groups...) {
+			for k, v := range groupVars[g] {
+				vars[k] = v
+			}
+		}
+		for k, v := range h.vars {
+			vars[k] = v
+		}
+		for _, g := range groups {
+			if g != "all" && g != "ungrouped" {
+				rec.Host.Labels["group."+g] = "true"
+			}
+		}
+		for k, v := range vars {
+			switch {
+			case k == "ansible_host":
+				if net.ParseIP(v) != nil {
+					rec.Host.IP = v
+				}
+			case k == "ansible_port":
+				rec.Host.Port = v
+			case strings.HasPrefix(k, "ansible_"):
+			default:
+				rec.Host.Labels[k] = v
+			}
+		}
+		if rec.Host.IP == "" && net.ParseIP(name) != nil {
+			rec.Host.IP = name
+		}
+		if len(rec.Host.Labels) == 0 {
+			rec.Host.Labels = nil
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// ancestors returns groups and every group they are children of, sorted.
+func ancestors(groups []string, parents map[string][]string) []string {
+	seen := map[string]bool{}
+	var visit func(g string)
+	visit = func(g string) {
+		if seen[g] {
+			return
+		}
+		seen[g] = true
+		for _, p := range parents[g] {
+			visit(p)
+		}
+	}
+	for _, g := range groups {
+		visit(g)
+	}
+	list := make([]string, 0, len(seen))
+	for g := range seen {
+		list = append(list, g)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// splitFields splits a line on blanks, keeping quoted values whole.
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var cur strings.Builder
+	var quote rune
+	for _, c := range line {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			cur.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			if cur.Len() == 0 {
+				return appendField(fields, &cur), nil
+			}
+			cur.WriteRune(c)
+		case c == ' ' || c == '\t':
+			fields = appendField(fields, &cur)
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	return appendField(fields, &cur), nil
+}
+
+func appendField(fields []string, cur *strings.Builder) []string {
+	if cur.Len() > 0 {
+		fields = append(fields, cur.String())
+		cur.Reset()
+	}
+	return fields
+}
+
+func splitVar(s string) (key, value string, ok bool) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(s[:i]), strings.Trim(strings.TrimSpace(s[i+1:]), `"'`), true
+}
+
+// expandRange expands the numeric ranges of name, such as web[01:03],
+// keeping the width of their bounds.
+func expandRange(name string) ([]string, error) {
+	i := strings.Index(name, "[")
+	if i < 0 {
+		return []string{name}, nil
+	}
+	j := strings.Index(name[i:], "]")
+	if j < 0 {
+		return nil, fmt.Errorf("unterminated range in %q", name)
+	}
+	j += i
+	bounds := strings.SplitN(name[i+1:j], ":", 2)
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("invalid range in %q", name)
+	}
+	lo, err1 := strconv.Atoi(bounds[0])
+	hi, err2 := strconv.Atoi(bounds[1])
+	if err1 != nil || err2 != nil || lo > hi {
+		return nil, fmt.Errorf("invalid range in %q", name)
+	}
+	width := 0
+	if len(bounds[0]) > 1 && bounds[0][0] == '0' {
+		width = len(bounds[0])
+	}
+	rest, err := expandRange(name[j+1:])
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for n := lo; n <= hi; n++ {
+		for _, r := range rest {
+			names = append(names, fmt.Sprintf("%s%0*d%s", name[:i], width, n, r))
+		}
+	}
+	return names, nil
+}
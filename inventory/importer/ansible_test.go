@@ -0,0 +1,93 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+func TestParseAnsible(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+		want []record
+		err  string
+	}{
+		{
+			name: "groups, children and variables",
+			data: `
+# comment
+bastion ansible_host=10.0.0.1 ansible_user=admin
+
+[web]
+web1 ansible_host=10.0.1.1 ansible_port=2222 role="front end"
+db1
+
+[db]
+db1 ansible_host=db1.example.com
+
+[prod:children]
+web
+db
+
+[prod:vars]
+env=prod
+role=server
+
+[all:vars]
+owner=infra
+`,
+			want: []record{
+				{Source: "line 3", Host: host.HostInfo{ID: "bastion", Name: "bastion", IP: "10.0.0.1", Labels: map[string]string{"owner": "infra"}}},
+				{Source: "line 6", Host: host.HostInfo{ID: "web1", Name: "web1", IP: "10.0.1.1", Port: "2222", Labels: map[string]string{
+					"group.web": "true", "group.prod": "true", "env": "prod", "role": "front end", "owner": "infra",
+				}}},
+				{Source: "line 7", Host: host.HostInfo{ID: "db1", Name: "db1", Labels: map[string]string{
+					"group.web": "true", "group.db": "true", "group.prod": "true", "env": "prod", "role": "server", "owner": "infra",
+				}}},
+			},
+		},
+		{
+			name: "ranges",
+			data: "[web]\nweb[01:03].dc[1:2]\n",
+			want: []record{
+				{Source: "line 2", Host: host.HostInfo{ID: "web01.dc1", Name: "web01.dc1", Labels: map[string]string{"group.web": "true"}}},
+				{Source: "line 2", Host: host.HostInfo{ID: "web01.dc2", Name: "web01.dc2", Labels: map[string]string{"group.web": "true"}}},
+				{Source: "line 2", Host: host.HostInfo{ID: "web02.dc1", Name: "web02.dc1", Labels: map[string]string{"group.web": "true"}}},
+				{Source: "line 2", Host: host.HostInfo{ID: "web02.dc2", Name: "web02.dc2", Labels: map[string]string{"group.web": "true"}}},
+				{Source: "line 2", Host: host.HostInfo{ID: "web03.dc1", Name: "web03.dc1", Labels: map[string]string{"group.web": "true"}}},
+				{Source: "line 2", Host: host.HostInfo{ID: "web03.dc2", Name: "web03.dc2", Labels: map[string]string{"group.web": "true"}}},
+			},
+		},
+		{
+			name: "address as name",
+			data: "10.0.0.9 # spare\n",
+			want: []record{{Source: "line 1", Host: host.HostInfo{ID: "10.0.0.9", Name: "10.0.0.9", IP: "10.0.0.9"}}},
+		},
+		{name: "unterminated section", data: "[web\nweb1\n", err: "invalid ansible file at line 1: unterminated section"},
+		{name: "unknown section type", data: "[web:hosts]\n", err: "invalid ansible file at line 1: unknown section type hosts"},
+		{name: "variable without value", data: "[web:vars]\nenv\n", err: "invalid ansible file at line 2: variable is not key=value"},
+		{name: "host variable without value", data: "web1 prod\n", err: `invalid ansible file at line 1: host variable "prod" is not key=value`},
+		{name: "unterminated quote", data: "web1 role='front\n", err: "invalid ansible file at line 1: unterminated quote"},
+		{name: "invalid range", data: "web[3:1]\n", err: "invalid range"},
+		{name: "unterminated range", data: "web[1:3\n", err: "unterminated range"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseAnsible([]byte(tc.data))
+			if tc.err != "" {
+				if _, ok := err.(*ParseError); !ok || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got %v, want %s", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
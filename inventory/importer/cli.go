@@ -0,0 +1,67 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// IsCommand reports whether name is the command of the package, import.
+func IsCommand(name string) bool {
+	return name == "import"
+}
+
+// RunCommand uploads the file named by args to a server to import its
+// hosts, and prints the result to stdout.
+func RunCommand(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	addr := fs.String("addr", "http://localhost:8080", "Base URL of the server to import into")
+	ns := fs.String("namespace", "", "Namespace to import into; empty for the default one")
+	format := fs.String("format", "", "Format of the file: csv, ansible or terraform")
+	mapping := fs.String("map", "", "CSV column mapping, as field:column pairs separated by commas")
+	preview := fs.Bool("preview", false, "Show what would be created, updated or skipped without writing")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: import [flags] file")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	u := strings.TrimRight(*addr, "/") + "/import/v1"
+	if *ns != "" {
+		u += "/namespaces/" + url.PathEscape(*ns)
+	}
+	q := url.Values{"format": {*format}, "preview": {fmt.Sprint(*preview)}}
+	if *mapping != "" {
+		q.Set("map", *mapping)
+	}
+	resp, err := http.Post(u+"/hosts?"+q.Encode(), "application/octet-stream", f)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var r struct {
+		Result Result `json:"result"`
+		Error  string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("%s: %v", resp.Status, err)
+	}
+	if r.Error != "" {
+		return fmt.Errorf("%s: %s", resp.Status, r.Error)
+	}
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r.Result)
+}
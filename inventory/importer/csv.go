@@ -0,0 +1,154 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// csvFields are the host fields a CSV column can be mapped to, besides
+// labels: label.<key> maps a column to label key.
+var csvFields = map[string]bool{
+	"id": true, "name": true, "ip": true, "port": true, "rack": true,
+	"datacenter": true, "position": true, "height": true, "remark": true,
+}
+
+// parseCSV reads hosts from a CSV file with a header row. mapping maps a
+// host field to the column it is read from. Columns named after a field,
+// or label.<key>, are read without a mapping; other columns are ignored.
+// A host without an id takes its name as id.
+func parseCSV(data []byte, mapping map[string]string) ([]record, error) {
+	cr := csv.NewReader(bytes.NewReader(data))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, &ParseError{Format: FormatCSV, Reason: "no header row"}
+	}
+	if err != nil {
+		return nil, &ParseError{Format: FormatCSV, Reason: err.Error()}
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	fields := map[string]int{}
+	for name, i := range columns {
+		if field := normalizeField(name); csvFields[field] || strings.HasPrefix(field, "label.") {
+			fields[field] = i
+		}
+	}
+	for field, column := range mapping {
+		if !csvFields[field] && !strings.HasPrefix(field, "label.") {
+			return nil, &ParseError{Format: FormatCSV, Reason: fmt.Sprintf("mapping of unknown field %q", field)}
+		}
+		i, ok := columns[column]
+		if !ok {
+			return nil, &ParseError{Format: FormatCSV, Reason: fmt.Sprintf("mapping to unknown column %q", column)}
+		}
+		fields[field] = i
+	}
+	if _, ok := fields["id"]; !ok {
+		if _, ok := fields["name"]; !ok {
+			return nil, &ParseError{Format: FormatCSV, Reason: "no column for id or name"}
+		}
+	}
+
+	var records []record
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The error names the line; FieldPos panics once a read has
+			// failed.
+			return nil, &ParseError{Format: FormatCSV, Reason: err.Error()}
+		}
+		line, _ := cr.FieldPos(0)
+		source := fmt.Sprintf("line %d", line)
+		records = append(records, csvRecord(source, row, fields))
+	}
+	return records, nil
+}
+
+func csvRecord(source string, row []string, fields map[string]int) record {
+	rec := record{Source: source}
+	h := &rec.Host
+	for field, i := range fields {
+		if i >= len(row) {
+			continue
+		}
+		v := strings.TrimSpace(row[i])
+		if v == "" {
+			continue
+		}
+		switch field {
+		case "id":
+			h.ID = v
+		case "name":
+			h.Name = v
+		case "ip":
+			h.IP = v
+		case "port":
+			h.Port = v
+		case "rack":
+			h.Rack = v
+		case "datacenter":
+			h.DataCenter = v
+		case "remark":
+			h.Remark = v
+		case "position", "height":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				rec.Reason = fmt.Sprintf("%s %q is not a number", field, v)
+				return rec
+			}
+			if field == "position" {
+				h.Position = n
+			} else {
+				h.Height = n
+			}
+		default:
+			if h.Labels == nil {
+				h.Labels = map[string]string{}
+			}
+			h.Labels[strings.TrimPrefix(field, "label.")] = v
+		}
+	}
+	if h.ID == "" {
+		h.ID = h.Name
+	}
+	return rec
+}
+
+// parseMapping parses field:column pairs, as given to the endpoint and
+// the command.
+func parseMapping(pairs []string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, p := range pairs {
+		for _, pair := range strings.Split(p, ",") {
+			if pair == "" {
+				continue
+			}
+			i := strings.Index(pair, ":")
+			if i <= 0 || i == len(pair)-1 {
+				return nil, ErrInvalidMapping
+			}
+			mapping[normalizeField(pair[:i])] = pair[i+1:]
+		}
+	}
+	return mapping, nil
+}
+
+// normalizeField lowercases field names, but not the keys of labels.
+func normalizeField(name string) string {
+	if strings.HasPrefix(strings.ToLower(name), "label.") {
+		return "label." + name[len("label."):]
+	}
+	return strings.ToLower(name)
+}
@@ -0,0 +1,87 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+func TestParseCSV(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    string
+		mapping map[string]string
+		want    []record
+		err     string
+	}{
+		{
+			name: "columns named after fields",
+			data: "ID,Name,IP,Rack,DataCenter,Position,Height,label.Team,Owner\n" +
+				"1001,web1,10.0.0.1,r01,dc1,10,2,infra,alice\n",
+			want: []record{{Source: "line 2", Host: host.HostInfo{
+				ID: "1001", Name: "web1", IP: "10.0.0.1", Rack: "r01", DataCenter: "dc1", Position: 10, Height: 2,
+				Labels: map[string]string{"Team": "infra"},
+			}}},
+		},
+		{
+			name:    "mapped columns",
+			data:    "hostname,address,Owner\nweb1,10.0.0.1,alice\n",
+			mapping: map[string]string{"name": "hostname", "ip": "address", "label.owner": "Owner"},
+			want: []record{{Source: "line 2", Host: host.HostInfo{
+				ID: "web1", Name: "web1", IP: "10.0.0.1", Labels: map[string]string{"owner": "alice"},
+			}}},
+		},
+		{
+			name: "quoted, blank and short rows",
+			data: "name,remark,rack\n\"web,1\", \"a \"\"b\"\"\"\nweb2,,\n",
+			want: []record{
+				{Source: "line 2", Host: host.HostInfo{ID: "web,1", Name: "web,1", Remark: `a "b"`}},
+				{Source: "line 3", Host: host.HostInfo{ID: "web2", Name: "web2"}},
+			},
+		},
+		{
+			name: "position not a number",
+			data: "name,position\n,top\n",
+			want: []record{{Source: "line 2", Reason: `position "top" is not a number`}},
+		},
+		{name: "empty file", data: "", err: "invalid csv file: no header row"},
+		{name: "no id or name column", data: "ip\n10.0.0.1\n", err: "invalid csv file: no column for id or name"},
+		{name: "mapping to unknown column", data: "name\nweb1\n", mapping: map[string]string{"ip": "address"}, err: `invalid csv file: mapping to unknown column "address"`},
+		{name: "mapping of unknown field", data: "name\nweb1\n", mapping: map[string]string{"owner": "name"}, err: `invalid csv file: mapping of unknown field "owner"`},
+		{name: "unterminated quote", data: "name\n\"web1\n", err: `extraneous or missing " in quoted-field`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseCSV([]byte(tc.data), tc.mapping)
+			if tc.err != "" {
+				if _, ok := err.(*ParseError); !ok || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("got %v, want %s", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+	got, err := parseMapping([]string{"Name:hostname,ip:address", "label.Owner:owner"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"name": "hostname", "ip": "address", "label.Owner": "owner"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for _, pairs := range []string{"name", ":hostname", "name:"} {
+		if _, err := parseMapping([]string{pairs}); err != ErrInvalidMapping {
+			t.Fatalf("%q: got %v, want %v", pairs, err, ErrInvalidMapping)
+		}
+	}
+}
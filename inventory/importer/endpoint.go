@@ -0,0 +1,36 @@
+package importer
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	ImportHostsEndpoint endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Importer) Endpoints {
+	return Endpoints{
+		ImportHostsEndpoint: MakeImportHostsEndpoint(s),
+	}
+}
+
+func MakeImportHostsEndpoint(s Importer) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(importHostsRequest)
+		res, e := s.ImportHosts(ctx, req.Request)
+		return importHostsResponse{Result: res, Err: e}, nil
+	}
+}
+
+type importHostsRequest struct {
+	Request Request
+}
+
+type importHostsResponse struct {
+	Result Result `json:"result"`
+	Err    error  `json:"err,omitempty"`
+}
+
+func (r importHostsResponse) error() error { return r.Err }
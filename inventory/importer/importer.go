@@ -0,0 +1,242 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+// Importer turns hosts kept elsewhere, in spreadsheets, Ansible
+// inventories or Terraform state, into hosts of the inventory.
+type Importer interface {
+	ImportHosts(ctx context.Context, r Request) (Result, error)
+}
+
+// Import formats.
+const (
+	FormatCSV       = "csv"
+	FormatAnsible   = "ansible"
+	FormatTerraform = "terraform"
+)
+
+// Request is a file to import hosts from. Mapping, for CSV only, maps
+// host fields to the columns they are read from; see parseCSV. With
+// Preview set nothing is written.
+type Request struct {
+	Format  string
+	Mapping map[string]string
+	Data    []byte
+	Preview bool
+}
+
+// Result sorts the hosts of an import, or of its preview, by what was or
+// would be done with them. Hosts that exist are updated with the fields
+// the file sets, and skipped if that changes nothing.
+type Result struct {
+	Preview bool    `json:"preview"`
+	Created []Entry `json:"created"`
+	Updated []Entry `json:"updated"`
+	Skipped []Entry `json:"skipped"`
+	Failed  []Entry `json:"failed"`
+}
+
+// Entry is a host of the file. Source locates it in the file; Changes
+// lists the fields an update changes; Host is the host as written.
+type Entry struct {
+	ID      string         `json:"id,omitempty"`
+	Source  string         `json:"source"`
+	Reason  string         `json:"reason,omitempty"`
+	Changes []string       `json:"changes,omitempty"`
+	Host    *host.HostInfo `json:"host,omitempty"`
+}
+
+var (
+	ErrUnknownFormat  = errors.New("format must be csv, ansible or terraform")
+	ErrInvalidMapping = errors.New("column mapping must be field:column pairs")
+)
+
+// ParseError is returned for a file that cannot be read in its format.
+type ParseError struct {
+	Format string
+	Source string
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.Source == "" {
+		return fmt.Sprintf("invalid %s file: %s", e.Format, e.Reason)
+	}
+	return fmt.Sprintf("invalid %s file at %s: %s", e.Format, e.Source, e.Reason)
+}
+
+// record is a host read from a file, or the reason it could not be.
+type record struct {
+	Source string
+	Host   host.HostInfo
+	Reason string
+}
+
+type importer struct {
+	hosts host.Host
+}
+
+// NewImporter returns an Importer that writes to hosts, in one best-effort
+// batch so that every host goes through the usual checks.
+func NewImporter(hosts host.Host) Importer {
+	return &importer{hosts: hosts}
+}
+
+func parse(r Request) ([]record, error) {
+	switch r.Format {
+	case FormatCSV:
+		return parseCSV(r.Data, r.Mapping)
+	case FormatAnsible:
+		return parseAnsible(r.Data)
+	case FormatTerraform:
+		return parseTerraform(r.Data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+}
+
+func (s *importer) ImportHosts(ctx context.Context, r Request) (Result, error) {
+	records, err := parse(r)
+	if err != nil {
+		return Result{}, err
+	}
+	result := Result{
+		Preview: r.Preview,
+		Created: []Entry{},
+		Updated: []Entry{},
+		Skipped: []Entry{},
+		Failed:  []Entry{},
+	}
+
+	var ops []host.HostOp
+	var entries []Entry
+	seen := map[string]string{}
+	for _, rec := range records {
+		e := Entry{ID: rec.Host.ID, Source: rec.Source, Reason: rec.Reason}
+		if e.Reason == "" && e.ID == "" {
+			e.Reason = "no id or name"
+		}
+		if e.Reason == "" && seen[e.ID] != "" {
+			e.Reason = "same id as " + seen[e.ID]
+		}
+		if e.Reason != "" {
+			result.Skipped = append(result.Skipped, e)
+			continue
+		}
+		seen[e.ID] = e.Source
+
+		last, err := s.hosts.GetHostInfo(ctx, e.ID)
+		switch {
+		case err == host.ErrNotFound:
+			h := rec.Host
+			e.Host = &h
+			ops = append(ops, host.HostOp{Op: host.OpCreate, HostInfo: h})
+		case err != nil:
+			return Result{}, err
+		default:
+			h := merge(last, rec.Host)
+			e.Host = &h
+			if e.Changes = changes(last, h); len(e.Changes) == 0 {
+				e.Reason = "unchanged"
+				result.Skipped = append(result.Skipped, e)
+				continue
+			}
+			ops = append(ops, host.HostOp{Op: host.OpUpdate, HostInfo: h, IfVersion: last.Version})
+		}
+		entries = append(entries, e)
+	}
+
+	if r.Preview || len(ops) == 0 {
+		for i, op := range ops {
+			result.add(op, entries[i])
+		}
+		return result, nil
+	}
+	results, err := s.hosts.BatchHostInfo(ctx, host.Batch{Ops: ops, BestEffort: true})
+	if err != nil {
+		return Result{}, err
+	}
+	for i, op := range ops {
+		if i < len(results) && results[i].Err != nil {
+			entries[i].Reason = results[i].Err.Error()
+			result.Failed = append(result.Failed, entries[i])
+			continue
+		}
+		result.add(op, entries[i])
+	}
+	return result, nil
+}
+
+func (r *Result) add(op host.HostOp, e Entry) {
+	if op.Op == host.OpCreate {
+		r.Created = append(r.Created, e)
+	} else {
+		r.Updated = append(r.Updated, e)
+	}
+}
+
+// merge returns last with the fields that in sets. Labels are merged,
+// those of in winning.
+func merge(last, in host.HostInfo) host.HostInfo {
+	h := last
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&h.Name, in.Name)
+	set(&h.IP, in.IP)
+	set(&h.Port, in.Port)
+	set(&h.Rack, in.Rack)
+	set(&h.DataCenter, in.DataCenter)
+	set(&h.Remark, in.Remark)
+	if in.Position != 0 {
+		h.Position = in.Position
+	}
+	if in.Height != 0 {
+		h.Height = in.Height
+	}
+	if len(in.Labels) > 0 {
+		h.Labels = make(map[string]string, len(last.Labels)+len(in.Labels))
+		for k, v := range last.Labels {
+			h.Labels[k] = v
+		}
+		for k, v := range in.Labels {
+			h.Labels[k] = v
+		}
+	}
+	return h
+}
+
+// changes names the fields of h that differ from last.
+func changes(last, h host.HostInfo) []string {
+	var list []string
+	diff := func(field string, changed bool) {
+		if changed {
+			list = append(list, field)
+		}
+	}
+	diff("name", last.Name != h.Name)
+	diff("ip", last.IP != h.IP)
+	diff("port", last.Port != h.Port)
+	diff("rack", last.Rack != h.Rack)
+	diff("datacenter", last.DataCenter != h.DataCenter)
+	diff("position", last.Position != h.Position)
+	diff("height", last.Height != h.Height)
+	diff("remark", last.Remark != h.Remark)
+	var labels []string
+	for k, v := range h.Labels {
+		if w, ok := last.Labels[k]; !ok || w != v {
+			labels = append(labels, "labels."+k)
+		}
+	}
+	sort.Strings(labels)
+	return append(list, labels...)
+}
@@ -0,0 +1,67 @@
+package importer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+func TestImportHosts(t *testing.T) {
+	ctx := context.Background()
+	hosts := host.NewInmemHost()
+	for _, h := range []host.HostInfo{
+		{ID: "web1", Name: "web1", IP: "10.0.0.1", Labels: map[string]string{"team": "infra"}},
+		{ID: "web2", Name: "web2", IP: "10.0.0.2"},
+		{ID: "db1", Name: "db1", IP: "10.0.0.9"},
+	} {
+		if err := hosts.PostHostInfo(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data := "name,ip,rack,label.env\n" +
+		"web1,10.0.0.1,r01,prod\n" + // updated
+		"web2,10.0.0.2,,\n" + // unchanged
+		"web3,10.0.0.3,r02,\n" + // created
+		"web3,10.0.0.4,,\n" + // same id
+		"web4,10.0.0.9,,\n" // address of db1
+
+	for _, preview := range []bool{true, false} {
+		r, err := NewImporter(hosts).ImportHosts(ctx, Request{Format: FormatCSV, Data: []byte(data), Preview: preview})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(r.Updated) != 1 || r.Updated[0].ID != "web1" {
+			t.Fatalf("preview %v: updated %+v, want web1", preview, r.Updated)
+		}
+		if got := r.Updated[0].Changes; len(got) != 2 || got[0] != "rack" || got[1] != "labels.env" {
+			t.Fatalf("preview %v: changes %v, want rack and labels.env", preview, got)
+		}
+		if len(r.Skipped) != 2 || r.Skipped[0].Reason != "unchanged" || r.Skipped[1].Reason != "same id as line 4" {
+			t.Fatalf("preview %v: skipped %+v", preview, r.Skipped)
+		}
+		if preview {
+			if len(r.Created) != 2 || len(r.Failed) != 0 {
+				t.Fatalf("preview: created %+v, failed %+v, want web3 and web4 created", r.Created, r.Failed)
+			}
+			if _, err := hosts.GetHostInfo(ctx, "web3"); err != host.ErrNotFound {
+				t.Fatalf("preview wrote host web3: %v", err)
+			}
+			continue
+		}
+		if len(r.Created) != 1 || r.Created[0].ID != "web3" {
+			t.Fatalf("created %+v, want web3", r.Created)
+		}
+		if len(r.Failed) != 1 || r.Failed[0].ID != "web4" || r.Failed[0].Reason != host.ErrDuplicateIP.Error() {
+			t.Fatalf("failed %+v, want web4 with a duplicate IP", r.Failed)
+		}
+	}
+
+	web1, err := hosts.GetHostInfo(ctx, "web1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if web1.Rack != "r01" || web1.Labels["team"] != "infra" || web1.Labels["env"] != "prod" {
+		t.Fatalf("web1 %+v: want rack and env set, team kept", web1)
+	}
+}
@@ -0,0 +1,34 @@
+package importer
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Middleware func(Importer) Importer
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Importer) Importer {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Importer
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) ImportHosts(ctx context.Context, r Request) (res Result, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ImportHosts", "namespace", namespace.FromContext(ctx), "format", r.Format, "bytes", len(r.Data), "preview", r.Preview,
+			"created", len(res.Created), "updated", len(res.Updated), "skipped", len(res.Skipped), "failed", len(res.Failed), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ImportHosts(ctx, r)
+}
@@ -0,0 +1,166 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// tfType tells where a Terraform resource type keeps the name, the IP and
+// the tags of an instance. Paths are attribute names, or name.index.name
+// for nested blocks.
+type tfType struct {
+	name []string
+	ip   []string
+	tags []string
+}
+
+var tfTypes = map[string]tfType{
+	"aws_instance": {
+		name: []string{"tags.Name", "id"},
+		ip:   []string{"private_ip", "public_ip"},
+		tags: []string{"tags"},
+	},
+	"google_compute_instance": {
+		name: []string{"name"},
+		ip:   []string{"network_interface.0.network_ip"},
+		tags: []string{"labels"},
+	},
+	"azurerm_linux_virtual_machine": {
+		name: []string{"name"},
+		ip:   []string{"private_ip_address", "public_ip_address"},
+		tags: []string{"tags"},
+	},
+	"azurerm_windows_virtual_machine": {
+		name: []string{"name"},
+		ip:   []string{"private_ip_address", "public_ip_address"},
+		tags: []string{"tags"},
+	},
+	"digitalocean_droplet": {
+		name: []string{"name"},
+		ip:   []string{"ipv4_address_private", "ipv4_address"},
+	},
+	"openstack_compute_instance_v2": {
+		name: []string{"name"},
+		ip:   []string{"access_ip_v4"},
+		tags: []string{"metadata"},
+	},
+	"vsphere_virtual_machine": {
+		name: []string{"name"},
+		ip:   []string{"default_ip_address"},
+	},
+}
+
+type tfState struct {
+	Version   int `json:"version"`
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}            `json:"index_key"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// parseTerraform reads the compute instances of a terraform.tfstate file,
+// version 4, of the resource types in tfTypes; other resources are
+// ignored. A host is named after the instance, has its private IP, or its
+// public one, and its tags as labels, and the address of the resource as
+// remark.
+func parseTerraform(data []byte) ([]record, error) {
+	var st tfState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, &ParseError{Format: FormatTerraform, Reason: err.Error()}
+	}
+	if st.Version != 4 {
+		return nil, &ParseError{Format: FormatTerraform, Reason: fmt.Sprintf("state version %d, not 4", st.Version)}
+	}
+
+	var records []record
+	for _, res := range st.Resources {
+		t, ok := tfTypes[res.Type]
+		if !ok || res.Mode != "managed" {
+			continue
+		}
+		for _, in := range res.Instances {
+			address := res.Type + "." + res.Name
+			if res.Module != "" {
+				address = res.Module + "." + address
+			}
+			switch k := in.IndexKey.(type) {
+			case float64:
+				address += fmt.Sprintf("[%d]", int(k))
+			case string:
+				address += fmt.Sprintf("[%q]", k)
+			}
+
+			rec := record{Source: address}
+			rec.Host.Name = first(in.Attributes, t.name)
+			rec.Host.ID = rec.Host.Name
+			rec.Host.IP = first(in.Attributes, t.ip)
+			rec.Host.Remark = address
+			for _, path := range t.tags {
+				tags, _ := lookup(in.Attributes, path).(map[string]interface{})
+				for k, v := range tags {
+					if s, ok := v.(string); ok {
+						if rec.Host.Labels == nil {
+							rec.Host.Labels = map[string]string{}
+						}
+						rec.Host.Labels[k] = s
+					}
+				}
+			}
+			if rec.Host.IP == "" {
+				rec.Reason = "no IP address"
+			}
+			records = append(records, rec)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Source < records[j].Source })
+	return records, nil
+}
+
+// first returns the first of paths that leads to a non-empty string.
+func first(attrs map[string]interface{}, paths []string) string {
+	for _, path := range paths {
+		if s, ok := lookup(attrs, path).(string); ok && s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// lookup follows path, dot-separated map keys and list indexes, in attrs.
+func lookup(attrs map[string]interface{}, path string) interface{} {
+	var v interface{} = attrs
+	for _, step := range splitPath(path) {
+		switch c := v.(type) {
+		case map[string]interface{}:
+			v = c[step]
+		case []interface{}:
+			var i int
+			if _, err := fmt.Sscanf(step, "%d", &i); err != nil || i < 0 || i >= len(c) {
+				return nil
+			}
+			v = c[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+func splitPath(path string) []string {
+	var steps []string
+	start := 0
+	for i := 0; i < len(path); i++ {
+		if path[i] == '.' {
+			steps = append(steps, path[start:i])
+			start = i + 1
+		}
+	}
+	return append(steps, path[start:])
+}
@@ -0,0 +1,62 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+func TestParseTerraform(t *testing.T) {
+	state := `{
+  "version": 4,
+  "resources": [
+    {"mode": "managed", "type": "google_compute_instance", "name": "db", "instances": [
+      {"attributes": {"name": "db-1", "labels": {"team": "data"}, "network_interface": [{"network_ip": "10.1.0.5"}]}}
+    ]},
+    {"mode": "managed", "type": "aws_instance", "name": "web", "instances": [
+      {"index_key": 0, "attributes": {"id": "i-0a", "private_ip": "10.0.0.1", "tags": {"Name": "web-0", "env": "prod", "size": 2}}},
+      {"index_key": 1, "attributes": {"id": "i-0b", "private_ip": "", "public_ip": "203.0.113.7"}}
+    ]},
+    {"module": "module.edge", "mode": "managed", "type": "digitalocean_droplet", "name": "proxy", "instances": [
+      {"index_key": "ams", "attributes": {"name": "proxy-ams"}}
+    ]},
+    {"mode": "data", "type": "aws_instance", "name": "lookup", "instances": [
+      {"attributes": {"id": "i-data", "private_ip": "10.0.0.9"}}
+    ]},
+    {"mode": "managed", "type": "aws_security_group", "name": "web", "instances": [
+      {"attributes": {"id": "sg-1"}}
+    ]}
+  ]
+}`
+	want := []record{
+		{Source: "aws_instance.web[0]", Host: host.HostInfo{ID: "web-0", Name: "web-0", IP: "10.0.0.1", Remark: "aws_instance.web[0]", Labels: map[string]string{"Name": "web-0", "env": "prod"}}},
+		{Source: "aws_instance.web[1]", Host: host.HostInfo{ID: "i-0b", Name: "i-0b", IP: "203.0.113.7", Remark: "aws_instance.web[1]"}},
+		{Source: "google_compute_instance.db", Host: host.HostInfo{ID: "db-1", Name: "db-1", IP: "10.1.0.5", Remark: "google_compute_instance.db", Labels: map[string]string{"team": "data"}}},
+		{Source: `module.edge.digitalocean_droplet.proxy["ams"]`, Host: host.HostInfo{ID: "proxy-ams", Name: "proxy-ams", Remark: `module.edge.digitalocean_droplet.proxy["ams"]`}, Reason: "no IP address"},
+	}
+	got, err := parseTerraform([]byte(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	for _, tc := range []struct {
+		name string
+		data string
+		err  string
+	}{
+		{"not JSON", "resource \"aws_instance\" \"web\" {}", "invalid terraform file: invalid character"},
+		{"old state version", `{"version": 3, "modules": []}`, "invalid terraform file: state version 3, not 4"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseTerraform([]byte(tc.data))
+			if _, ok := err.(*ParseError); !ok || !strings.HasPrefix(err.Error(), tc.err) {
+				t.Fatalf("got %v, want %s", err, tc.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+	ErrBadPreview = errors.New("preview must be a boolean")
+)
+
+// maxUpload bounds the size of an uploaded file.
+const maxUpload = 32 << 20
+
+func MakeHTTPHandler(s Importer, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext),
+	}
+
+	for _, prefix := range []string{"/import/v1", "/import/v1/namespaces/{ns}"} {
+		r.Methods("POST").Path(prefix + "/hosts").Handler(httptransport.NewServer(
+			e.ImportHostsEndpoint,
+			decodeImportHostsRequest,
+			encodeResponse,
+			options...,
+		))
+	}
+	return r
+}
+
+// decodeImportHostsRequest takes the file as the body, and the format,
+// the column mapping and preview from the query:
+// ?format=csv&map=name:hostname,ip:address&preview=true.
+func decodeImportHostsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	req := Request{Format: q.Get("format")}
+	if v := q.Get("preview"); v != "" {
+		if req.Preview, err = strconv.ParseBool(v); err != nil {
+			return nil, ErrBadPreview
+		}
+	}
+	if req.Mapping, err = parseMapping(q["map"]); err != nil {
+		return nil, err
+	}
+	if req.Data, err = io.ReadAll(io.LimitReader(r.Body, maxUpload)); err != nil {
+		return nil, err
+	}
+	return importHostsRequest{Request: req}, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	if _, ok := err.(*ParseError); ok {
+		return http.StatusBadRequest
+	}
+	switch err {
+	case ErrUnknownFormat, ErrInvalidMapping, ErrBadPreview:
+		return http.StatusBadRequest
+	case host.ErrUnknownNamespace:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
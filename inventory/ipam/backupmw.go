@@ -0,0 +1,32 @@
+package ipam
+
+import (
+	"context"
+
+	"github.com/xinyu/infra/inventory/backup"
+)
+
+// BackupMiddleware rebuilds the allocations of s from the hosts once an
+// archive is restored: a restore replaces the hosts without going through
+// HostMiddleware, and would leave the addresses of the archive free for
+// new hosts until the next periodic sync.
+func BackupMiddleware(s *Syncer) backup.Middleware {
+	return func(next backup.Backup) backup.Backup {
+		return &backupMiddleware{
+			Backup: next,
+			syncer: s,
+		}
+	}
+}
+
+type backupMiddleware struct {
+	backup.Backup
+	syncer *Syncer
+}
+
+func (mw backupMiddleware) Restore(ctx context.Context, a backup.Archive) error {
+	if err := mw.Backup.Restore(ctx, a); err != nil {
+		return err
+	}
+	return mw.syncer.Sync(ctx)
+}
@@ -0,0 +1,160 @@
+package ipam
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	PostSubnetEndpoint      endpoint.Endpoint
+	GetSubnetEndpoint       endpoint.Endpoint
+	DeleteSubnetEndpoint    endpoint.Endpoint
+	ListSubnetsEndpoint     endpoint.Endpoint
+	ListAllocationsEndpoint endpoint.Endpoint
+	GetUtilisationEndpoint  endpoint.Endpoint
+	ListUtilisationEndpoint endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s IPAM) Endpoints {
+	return Endpoints{
+		PostSubnetEndpoint:      MakePostSubnetEndpoint(s),
+		GetSubnetEndpoint:       MakeGetSubnetEndpoint(s),
+		DeleteSubnetEndpoint:    MakeDeleteSubnetEndpoint(s),
+		ListSubnetsEndpoint:     MakeListSubnetsEndpoint(s),
+		ListAllocationsEndpoint: MakeListAllocationsEndpoint(s),
+		GetUtilisationEndpoint:  MakeGetUtilisationEndpoint(s),
+		ListUtilisationEndpoint: MakeListUtilisationEndpoint(s),
+	}
+}
+
+func MakePostSubnetEndpoint(s IPAM) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(postSubnetRequest)
+		e := s.PostSubnet(ctx, req.Subnet)
+		return postSubnetResponse{Err: e}, nil
+	}
+}
+
+func MakeGetSubnetEndpoint(s IPAM) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getSubnetRequest)
+		sn, e := s.GetSubnet(ctx, req.ID)
+		return getSubnetResponse{Subnet: sn, Err: e}, nil
+	}
+}
+
+func MakeDeleteSubnetEndpoint(s IPAM) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteSubnetRequest)
+		e := s.DeleteSubnet(ctx, req.ID)
+		return deleteSubnetResponse{Err: e}, nil
+	}
+}
+
+func MakeListSubnetsEndpoint(s IPAM) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listSubnetsRequest)
+		list, e := s.ListSubnets(ctx, req.DataCenter)
+		return listSubnetsResponse{Subnets: list, Err: e}, nil
+	}
+}
+
+func MakeListAllocationsEndpoint(s IPAM) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listAllocationsRequest)
+		list, e := s.ListAllocations(ctx, req.SubnetID)
+		return listAllocationsResponse{Allocations: list, Err: e}, nil
+	}
+}
+
+func MakeGetUtilisationEndpoint(s IPAM) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getUtilisationRequest)
+		u, e := s.GetUtilisation(ctx, req.SubnetID)
+		return getUtilisationResponse{Utilisation: u, Err: e}, nil
+	}
+}
+
+func MakeListUtilisationEndpoint(s IPAM) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listUtilisationRequest)
+		list, e := s.ListUtilisation(ctx, req.DataCenter)
+		return listUtilisationResponse{Utilisation: list, Err: e}, nil
+	}
+}
+
+type postSubnetRequest struct {
+	Subnet Subnet
+}
+
+type postSubnetResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r postSubnetResponse) error() error { return r.Err }
+
+type getSubnetRequest struct {
+	ID string
+}
+
+type getSubnetResponse struct {
+	Subnet Subnet `json:"subnet"`
+	Err    error  `json:"err,omitempty"`
+}
+
+func (r getSubnetResponse) error() error { return r.Err }
+
+type deleteSubnetRequest struct {
+	ID string
+}
+
+type deleteSubnetResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r deleteSubnetResponse) error() error { return r.Err }
+
+type listSubnetsRequest struct {
+	DataCenter string
+}
+
+type listSubnetsResponse struct {
+	Subnets []Subnet `json:"subnets"`
+	Err     error    `json:"err,omitempty"`
+}
+
+func (r listSubnetsResponse) error() error { return r.Err }
+
+type listAllocationsRequest struct {
+	SubnetID string
+}
+
+type listAllocationsResponse struct {
+	Allocations []Allocation `json:"allocations"`
+	Err         error        `json:"err,omitempty"`
+}
+
+func (r listAllocationsResponse) error() error { return r.Err }
+
+type getUtilisationRequest struct {
+	SubnetID string
+}
+
+type getUtilisationResponse struct {
+	Utilisation Utilisation `json:"utilisation"`
+	Err         error       `json:"err,omitempty"`
+}
+
+func (r getUtilisationResponse) error() error { return r.Err }
+
+type listUtilisationRequest struct {
+	DataCenter string
+}
+
+type listUtilisationResponse struct {
+	Utilisation []Utilisation `json:"utilisation"`
+	Err         error         `json:"err,omitempty"`
+}
+
+func (r listUtilisationResponse) error() error { return r.Err }
@@ -0,0 +1,268 @@
+package ipam
+
+import (
+	"context"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+// HostMiddleware hooks IPAM into the host write path. A host created
+// without any address gets the next free address of its datacenter's
+// subnets as its IP; explicit addresses, on the host or its interfaces, are
+// claimed so that no two hosts share one; addresses are released when a
+// host drops them or is purged. A deleted host keeps its addresses while
+// it is in the trash.
+func HostMiddleware(i IPAM) host.Middleware {
+	return func(next host.Host) host.Host {
+		return &hostMiddleware{
+			Host: next,
+			ipam: i,
+		}
+	}
+}
+
+type hostMiddleware struct {
+	host.Host
+	ipam IPAM
+}
+
+func (mw hostMiddleware) PostHostInfo(ctx context.Context, h host.HostInfo) error {
+	if _, err := mw.Host.GetHostInfo(ctx, h.ID); err == nil {
+		return host.ErrAlreadyExists
+	}
+	if err := mw.checkTrash(ctx, h.ID, h.Addresses()); err != nil {
+		return err
+	}
+
+	var claimed []string
+	if addrs := h.Addresses(); len(addrs) == 0 && h.DataCenter != "" {
+		ip, err := mw.ipam.AllocateIP(ctx, h.DataCenter, h.ID)
+		if err != nil {
+			return hostError(err)
+		}
+		h.IP = ip
+		claimed = []string{ip}
+	} else {
+		var err error
+		if claimed, err = mw.claim(ctx, h.ID, addrs); err != nil {
+			return err
+		}
+	}
+
+	if err := mw.Host.PostHostInfo(ctx, h); err != nil {
+		mw.release(ctx, h.ID, claimed)
+		return err
+	}
+	return nil
+}
+
+func (mw hostMiddleware) PutHostInfo(ctx context.Context, id string, h host.HostInfo) error {
+	last, err := mw.Host.GetHostInfo(ctx, id)
+	if err != nil && err != host.ErrNotFound {
+		return err
+	}
+	oldAddrs, newAddrs := last.Addresses(), h.Addresses()
+	if err == host.ErrNotFound {
+		if err := mw.checkTrash(ctx, id, newAddrs); err != nil {
+			return err
+		}
+	}
+
+	claimed, err := mw.claim(ctx, h.ID, difference(newAddrs, oldAddrs))
+	if err != nil {
+		return err
+	}
+	if err := mw.Host.PutHostInfo(ctx, id, h); err != nil {
+		mw.release(ctx, h.ID, claimed)
+		return err
+	}
+	mw.release(ctx, last.ID, difference(oldAddrs, newAddrs))
+	return nil
+}
+
+func (mw hostMiddleware) PurgeHostInfo(ctx context.Context, id string) (host.HostInfo, error) {
+	last, err := mw.Host.PurgeHostInfo(ctx, id)
+	if err != nil {
+		return last, err
+	}
+	mw.release(ctx, last.ID, last.Addresses())
+	return last, nil
+}
+
+// BatchHostInfo claims the addresses of every operation up front, the same
+// way the single-host methods do. Once the store has applied the batch,
+// the claims of failed operations are released, and so are the addresses
+// dropped by successful updates. When the batch is part of a
+// transaction this waits until the transaction commits or rolls back.
+func (mw hostMiddleware) BatchHostInfo(ctx context.Context, b host.Batch) ([]host.BatchResult, error) {
+	var ids []string
+	var claimed, dropped [][]string
+	// addrs holds the addresses of hosts as earlier operations left them.
+	addrs := map[string][]string{}
+	forwarded := false
+	results, err := host.ForwardBatch(ctx, b, func(op *host.HostOp) error {
+		c, d, err := mw.claimOp(ctx, op, addrs)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, op.HostInfo.ID)
+		claimed = append(claimed, c)
+		dropped = append(dropped, d)
+		return nil
+	}, func(ctx context.Context, forward host.Batch) ([]host.BatchResult, error) {
+		forwarded = true
+		if hold := forward.Hold; hold != nil {
+			forward.Hold = func(commit, rollback func()) {
+				hold(func() {
+					commit()
+					for i := range forward.Ops {
+						mw.release(ctx, ids[i], dropped[i])
+					}
+				}, func() {
+					rollback()
+					for i := range forward.Ops {
+						mw.release(ctx, ids[i], claimed[i])
+					}
+				})
+			}
+		}
+		results, err := mw.Host.BatchHostInfo(ctx, forward)
+		if forward.Hold != nil && err == nil {
+			return results, nil
+		}
+		for i := range forward.Ops {
+			if err != nil || i >= len(results) || results[i].Err != nil {
+				mw.release(ctx, ids[i], claimed[i])
+			} else {
+				mw.release(ctx, ids[i], dropped[i])
+			}
+		}
+		return results, err
+	})
+	if !forwarded {
+		// An atomic batch failed a check before reaching the store.
+		for i := range ids {
+			mw.release(ctx, ids[i], claimed[i])
+		}
+	}
+	return results, err
+}
+
+// claimOp claims the addresses op adds, allocating one when a new host has
+// none, and returns them along with the addresses op drops. addrs tracks
+// the addresses of hosts already written by the batch.
+func (mw hostMiddleware) claimOp(ctx context.Context, op *host.HostOp, addrs map[string][]string) (claimed, dropped []string, err error) {
+	id := op.ID
+	if id == "" {
+		id = op.HostInfo.ID
+	}
+	oldAddrs, ok := addrs[id]
+	if !ok {
+		last, err := mw.Host.GetHostInfo(ctx, id)
+		if err != nil && err != host.ErrNotFound {
+			return nil, nil, err
+		}
+		oldAddrs = last.Addresses()
+		if err == host.ErrNotFound && op.Op != host.OpDelete {
+			if err := mw.checkTrash(ctx, id, op.HostInfo.Addresses()); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	switch op.Op {
+	case host.OpDelete:
+		// The host keeps its addresses in the trash.
+		op.HostInfo.ID = id
+		addrs[id] = oldAddrs
+		return nil, nil, nil
+	case host.OpCreate:
+		h := &op.HostInfo
+		if len(h.Addresses()) == 0 && h.DataCenter != "" {
+			ip, err := mw.ipam.AllocateIP(ctx, h.DataCenter, h.ID)
+			if err != nil {
+				return nil, nil, hostError(err)
+			}
+			h.IP = ip
+			addrs[id] = []string{ip}
+			return []string{ip}, nil, nil
+		}
+		oldAddrs = nil
+	case host.OpUpdate:
+	default:
+		return nil, nil, nil
+	}
+	newAddrs := op.HostInfo.Addresses()
+	claimed, err = mw.claim(ctx, op.HostInfo.ID, difference(newAddrs, oldAddrs))
+	if err != nil {
+		return nil, nil, err
+	}
+	addrs[id] = newAddrs
+	return claimed, difference(oldAddrs, newAddrs), nil
+}
+
+// checkTrash rejects a write of host id that lists one of the addresses
+// the deleted host of that ID still holds: the store refuses the write,
+// and releasing the claims it made would free the addresses of the trashed
+// host.
+func (mw hostMiddleware) checkTrash(ctx context.Context, id string, addrs []string) error {
+	for _, ip := range addrs {
+		list, err := mw.Host.ListHostInfo(ctx, host.HostFilter{IP: ip, IncludeDeleted: true})
+		if err != nil {
+			return err
+		}
+		for _, h := range list {
+			if h.ID == id && h.Deleted() {
+				return host.ErrDeleted
+			}
+		}
+	}
+	return nil
+}
+
+// claim claims every address for hostID, or none of them.
+func (mw hostMiddleware) claim(ctx context.Context, hostID string, addrs []string) ([]string, error) {
+	var claimed []string
+	for _, ip := range addrs {
+		if err := mw.ipam.ClaimIP(ctx, ip, hostID); err != nil {
+			mw.release(ctx, hostID, claimed)
+			return nil, hostError(err)
+		}
+		claimed = append(claimed, ip)
+	}
+	return claimed, nil
+}
+
+func (mw hostMiddleware) release(ctx context.Context, hostID string, addrs []string) {
+	for _, ip := range addrs {
+		mw.ipam.ReleaseIP(ctx, ip, hostID)
+	}
+}
+
+// difference returns the addresses of a that are not in b.
+func difference(a, b []string) []string {
+	in := map[string]bool{}
+	for _, ip := range b {
+		in[ip] = true
+	}
+	var diff []string
+	for _, ip := range a {
+		if !in[ip] {
+			diff = append(diff, ip)
+		}
+	}
+	return diff
+}
+
+func hostError(err error) error {
+	switch err {
+	case ErrInvalidIP:
+		return host.ErrInvalidIP
+	case ErrIPInUse:
+		return host.ErrDuplicateIP
+	case ErrNoFreeIP:
+		return host.ErrNoFreeIP
+	default:
+		return err
+	}
+}
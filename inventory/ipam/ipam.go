@@ -0,0 +1,405 @@
+package ipam
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type IPAM interface {
+	PostSubnet(ctx context.Context, s Subnet) error
+	GetSubnet(ctx context.Context, id string) (Subnet, error)
+	DeleteSubnet(ctx context.Context, id string) error
+	ListSubnets(ctx context.Context, dataCenter string) ([]Subnet, error)
+	ListAllocations(ctx context.Context, subnetID string) ([]Allocation, error)
+	GetUtilisation(ctx context.Context, subnetID string) (Utilisation, error)
+	ListUtilisation(ctx context.Context, dataCenter string) ([]Utilisation, error)
+	AllocateIP(ctx context.Context, dataCenter, hostID string) (string, error)
+	ClaimIP(ctx context.Context, ip, hostID string) error
+	ReleaseIP(ctx context.Context, ip, hostID string) error
+	SyncAllocations(ctx context.Context, hosts []host.HostInfo, asOf time.Time) (added, released int, err error)
+}
+
+// Subnet is an IPv4 or IPv6 prefix from which host addresses of a
+// datacenter are allocated. The gateway address is never allocated.
+type Subnet struct {
+	ID         string    `json:"id"`
+	CIDR       string    `json:"cidr"`
+	DataCenter string    `json:"datacenter"`
+	Gateway    string    `json:"gateway,omitempty"`
+	CreatedAt  time.Time `json:"createtime"`
+	UpdatedAt  time.Time `json:"updatetime"`
+	Remark     string    `json:"remark"`
+}
+
+// Allocation records that an address is held by a host. Addresses outside
+// every subnet are recorded too, so that they stay unique. Addresses are
+// unique across namespaces; Namespace is that of the holding host, taken
+// from the request context.
+type Allocation struct {
+	IP        string    `json:"ip"`
+	Namespace string    `json:"namespace"`
+	HostID    string    `json:"hostid"`
+	SubnetID  string    `json:"subnetid,omitempty"`
+	CreatedAt time.Time `json:"createtime"`
+}
+
+type Utilisation struct {
+	SubnetID   string  `json:"subnetid"`
+	CIDR       string  `json:"cidr"`
+	DataCenter string  `json:"datacenter"`
+	Size       uint64  `json:"size"`
+	Used       uint64  `json:"used"`
+	Free       uint64  `json:"free"`
+	Percent    float64 `json:"percent"`
+}
+
+var (
+	ErrAlreadyExists     = errors.New("already exists")
+	ErrNotFound          = errors.New("not found")
+	ErrInvalidSubnet     = errors.New("invalid subnet")
+	ErrOverlap           = errors.New("subnet overlaps an existing subnet")
+	ErrInUse             = errors.New("in use")
+	ErrInvalidIP         = errors.New("invalid IP address")
+	ErrIPInUse           = errors.New("IP address already in use")
+	ErrNoFreeIP          = errors.New("no free IP address")
+	ErrUnknownDataCenter = errors.New("unknown datacenter")
+)
+
+type inmemIPAM struct {
+	mtx     sync.RWMutex
+	subnets map[string]Subnet
+	nets    map[string]*net.IPNet
+	allocs  map[string]Allocation
+}
+
+func NewInmemIPAM() IPAM {
+	return &inmemIPAM{
+		subnets: map[string]Subnet{},
+		nets:    map[string]*net.IPNet{},
+		allocs:  map[string]Allocation{},
+	}
+}
+
+func (s *inmemIPAM) PostSubnet(ctx context.Context, sn Subnet) error {
+	_, n, err := net.ParseCIDR(sn.CIDR)
+	if err != nil || sn.ID == "" {
+		return ErrInvalidSubnet
+	}
+	if sn.Gateway != "" {
+		gw := net.ParseIP(sn.Gateway)
+		if gw == nil || !n.Contains(gw) {
+			return ErrInvalidSubnet
+		}
+		sn.Gateway = gw.String()
+	}
+	sn.CIDR = n.String()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.subnets[sn.ID]; ok {
+		return ErrAlreadyExists
+	}
+	for _, other := range s.nets {
+		if other.Contains(n.IP) || n.Contains(other.IP) {
+			return ErrOverlap
+		}
+	}
+
+	currentTime := time.Now()
+	sn.CreatedAt = currentTime
+	sn.UpdatedAt = currentTime
+
+	s.subnets[sn.ID] = sn
+	s.nets[sn.ID] = n
+	for ip, a := range s.allocs {
+		if n.Contains(net.ParseIP(ip)) {
+			a.SubnetID = sn.ID
+			s.allocs[ip] = a
+		}
+	}
+	return nil
+}
+
+func (s *inmemIPAM) GetSubnet(ctx context.Context, id string) (Subnet, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	sn, ok := s.subnets[id]
+	if !ok {
+		return Subnet{}, ErrNotFound
+	}
+	return sn, nil
+}
+
+func (s *inmemIPAM) DeleteSubnet(ctx context.Context, id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.subnets[id]; !ok {
+		return ErrNotFound
+	}
+	for _, a := range s.allocs {
+		if a.SubnetID == id {
+			return ErrInUse
+		}
+	}
+	delete(s.subnets, id)
+	delete(s.nets, id)
+	return nil
+}
+
+func (s *inmemIPAM) ListSubnets(ctx context.Context, dataCenter string) ([]Subnet, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []Subnet{}
+	for _, sn := range s.subnets {
+		if dataCenter == "" || sn.DataCenter == dataCenter {
+			list = append(list, sn)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *inmemIPAM) ListAllocations(ctx context.Context, subnetID string) ([]Allocation, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if _, ok := s.subnets[subnetID]; !ok {
+		return nil, ErrNotFound
+	}
+	list := []Allocation{}
+	for _, a := range s.allocs {
+		if a.SubnetID == subnetID {
+			list = append(list, a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(net.ParseIP(list[i].IP), net.ParseIP(list[j].IP)) < 0
+	})
+	return list, nil
+}
+
+func (s *inmemIPAM) GetUtilisation(ctx context.Context, subnetID string) (Utilisation, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	sn, ok := s.subnets[subnetID]
+	if !ok {
+		return Utilisation{}, ErrNotFound
+	}
+	return s.utilisation(sn), nil
+}
+
+func (s *inmemIPAM) ListUtilisation(ctx context.Context, dataCenter string) ([]Utilisation, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []Utilisation{}
+	for _, sn := range s.subnets {
+		if dataCenter == "" || sn.DataCenter == dataCenter {
+			list = append(list, s.utilisation(sn))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].SubnetID < list[j].SubnetID })
+	return list, nil
+}
+
+func (s *inmemIPAM) utilisation(sn Subnet) Utilisation {
+	u := Utilisation{
+		SubnetID:   sn.ID,
+		CIDR:       sn.CIDR,
+		DataCenter: sn.DataCenter,
+		Size:       usableSize(s.nets[sn.ID], sn.Gateway != ""),
+	}
+	for _, a := range s.allocs {
+		if a.SubnetID == sn.ID {
+			u.Used++
+		}
+	}
+	if u.Used < u.Size {
+		u.Free = u.Size - u.Used
+	}
+	if u.Size > 0 {
+		u.Percent = math.Round(float64(u.Used)/float64(u.Size)*10000) / 100
+	}
+	return u
+}
+
+// AllocateIP assigns hostID the lowest free address of the first subnet of
+// dataCenter, in subnet ID order, that has one.
+func (s *inmemIPAM) AllocateIP(ctx context.Context, dataCenter, hostID string) (string, error) {
+	ns := namespace.FromContext(ctx)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	ids := []string{}
+	for id, sn := range s.subnets {
+		if sn.DataCenter == dataCenter {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		sn, n := s.subnets[id], s.nets[id]
+		for ip := firstHost(n); ip != nil && n.Contains(ip); ip = nextIP(ip) {
+			if isBroadcast(n, ip) {
+				break
+			}
+			addr := ip.String()
+			if addr == sn.Gateway {
+				continue
+			}
+			if _, ok := s.allocs[addr]; ok {
+				continue
+			}
+			s.allocs[addr] = Allocation{IP: addr, Namespace: ns, HostID: hostID, SubnetID: id, CreatedAt: time.Now()}
+			return addr, nil
+		}
+	}
+	return "", ErrNoFreeIP
+}
+
+// ClaimIP records that hostID holds ip. Claiming an address the host
+// already holds is not an error.
+func (s *inmemIPAM) ClaimIP(ctx context.Context, ip, hostID string) error {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ErrInvalidIP
+	}
+	addr := parsed.String()
+	ns := namespace.FromContext(ctx)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if a, ok := s.allocs[addr]; ok {
+		if a.Namespace == ns && a.HostID == hostID {
+			return nil
+		}
+		return ErrIPInUse
+	}
+	a := Allocation{IP: addr, Namespace: ns, HostID: hostID, CreatedAt: time.Now()}
+	for id, n := range s.nets {
+		if n.Contains(parsed) {
+			if addr == s.subnets[id].Gateway {
+				return ErrIPInUse
+			}
+			a.SubnetID = id
+		}
+	}
+	s.allocs[addr] = a
+	return nil
+}
+
+func (s *inmemIPAM) ReleaseIP(ctx context.Context, ip, hostID string) error {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ErrInvalidIP
+	}
+	addr := parsed.String()
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	a, ok := s.allocs[addr]
+	if !ok || a.Namespace != namespace.FromContext(ctx) || a.HostID != hostID {
+		return ErrNotFound
+	}
+	delete(s.allocs, addr)
+	return nil
+}
+
+// SyncAllocations makes the allocations match hosts, every host of every
+// namespace, trashed ones included, as listed at asOf: each of their
+// addresses is allocated to them, and allocations made before asOf to a
+// host that does not hold the address are released. Allocations made
+// since are kept, as their hosts may not be written yet.
+func (s *inmemIPAM) SyncAllocations(ctx context.Context, hosts []host.HostInfo, asOf time.Time) (added, released int, err error) {
+	type holder struct{ namespace, hostID string }
+	held := map[string]holder{}
+	for _, h := range hosts {
+		for _, ip := range h.Addresses() {
+			if net.ParseIP(ip) != nil {
+				held[ip] = holder{h.Namespace, h.ID}
+			}
+		}
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for ip, a := range s.allocs {
+		if h, ok := held[ip]; (!ok || h != holder{a.Namespace, a.HostID}) && a.CreatedAt.Before(asOf) {
+			delete(s.allocs, ip)
+			released++
+		}
+	}
+	for ip, h := range held {
+		if _, ok := s.allocs[ip]; ok {
+			continue
+		}
+		a := Allocation{IP: ip, Namespace: h.namespace, HostID: h.hostID, CreatedAt: asOf}
+		for id, n := range s.nets {
+			if n.Contains(net.ParseIP(ip)) {
+				a.SubnetID = id
+			}
+		}
+		s.allocs[ip] = a
+		added++
+	}
+	return added, released, nil
+}
+
+// firstHost returns the first allocatable address of n, skipping the
+// network address of IPv4 subnets larger than /31.
+func firstHost(n *net.IPNet) net.IP {
+	ip := n.IP.Mask(n.Mask)
+	ones, bits := n.Mask.Size()
+	if bits == 32 && bits-ones > 1 {
+		return nextIP(ip)
+	}
+	return ip
+}
+
+func isBroadcast(n *net.IPNet, ip net.IP) bool {
+	ones, bits := n.Mask.Size()
+	if bits != 32 || bits-ones <= 1 {
+		return false
+	}
+	ip4 := ip.To4()
+	for i := range ip4 {
+		if ip4[i]|n.Mask[i] != 0xff {
+			return false
+		}
+	}
+	return true
+}
+
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next
+		}
+	}
+	return nil
+}
+
+func usableSize(n *net.IPNet, gateway bool) uint64 {
+	ones, bits := n.Mask.Size()
+	hostBits := uint(bits - ones)
+	if hostBits >= 64 {
+		return math.MaxUint64
+	}
+	size := uint64(1) << hostBits
+	if bits == 32 && hostBits > 1 {
+		size -= 2
+	}
+	if gateway {
+		size--
+	}
+	return size
+}
@@ -0,0 +1,103 @@
+package ipam
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+type Middleware func(IPAM) IPAM
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next IPAM) IPAM {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   IPAM
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) PostSubnet(ctx context.Context, s Subnet) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostSubnet", "id", s.ID, "cidr", s.CIDR, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostSubnet(ctx, s)
+}
+
+func (mw loggingMiddleware) GetSubnet(ctx context.Context, id string) (s Subnet, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetSubnet", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetSubnet(ctx, id)
+}
+
+func (mw loggingMiddleware) DeleteSubnet(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteSubnet", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteSubnet(ctx, id)
+}
+
+func (mw loggingMiddleware) ListSubnets(ctx context.Context, dataCenter string) (list []Subnet, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListSubnets", "datacenter", dataCenter, "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListSubnets(ctx, dataCenter)
+}
+
+func (mw loggingMiddleware) ListAllocations(ctx context.Context, subnetID string) (list []Allocation, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListAllocations", "subnet", subnetID, "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListAllocations(ctx, subnetID)
+}
+
+func (mw loggingMiddleware) GetUtilisation(ctx context.Context, subnetID string) (u Utilisation, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetUtilisation", "subnet", subnetID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetUtilisation(ctx, subnetID)
+}
+
+func (mw loggingMiddleware) ListUtilisation(ctx context.Context, dataCenter string) (list []Utilisation, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListUtilisation", "datacenter", dataCenter, "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListUtilisation(ctx, dataCenter)
+}
+
+func (mw loggingMiddleware) AllocateIP(ctx context.Context, dataCenter, hostID string) (ip string, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "AllocateIP", "datacenter", dataCenter, "hostid", hostID, "ip", ip, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.AllocateIP(ctx, dataCenter, hostID)
+}
+
+func (mw loggingMiddleware) ClaimIP(ctx context.Context, ip, hostID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ClaimIP", "ip", ip, "hostid", hostID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ClaimIP(ctx, ip, hostID)
+}
+
+func (mw loggingMiddleware) ReleaseIP(ctx context.Context, ip, hostID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ReleaseIP", "ip", ip, "hostid", hostID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ReleaseIP(ctx, ip, hostID)
+}
+
+func (mw loggingMiddleware) SyncAllocations(ctx context.Context, hosts []host.HostInfo, asOf time.Time) (added, released int, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "SyncAllocations", "hosts", len(hosts), "added", added, "released", released, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.SyncAllocations(ctx, hosts, asOf)
+}
@@ -0,0 +1,66 @@
+package ipam
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// Syncer reconciles the allocations of an IPAM with the addresses of the
+// hosts of a store. HostMiddleware keeps them in step for the writes made
+// through it; the others, such as the writes replayed from a write-ahead
+// log at startup, restores or, in a cluster, writes made through other
+// nodes, are caught by Sync.
+type Syncer struct {
+	ipam   IPAM
+	hosts  host.Host
+	logger log.Logger
+}
+
+// NewSyncer returns a Syncer of the allocations of i with the hosts of
+// every namespace of hosts.
+func NewSyncer(i IPAM, hosts host.Host, logger log.Logger) *Syncer {
+	return &Syncer{
+		ipam:   i,
+		hosts:  hosts,
+		logger: logger,
+	}
+}
+
+// Run reconciles the allocations every interval until ctx is cancelled.
+func (s *Syncer) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sync(ctx); err != nil {
+				s.logger.Log("during", "sync", "err", err)
+			}
+		}
+	}
+}
+
+// Sync allocates the addresses of every host, trashed ones included, to
+// it, and releases the allocations of addresses no host holds.
+func (s *Syncer) Sync(ctx context.Context) error {
+	asOf := time.Now()
+	hosts, err := s.hosts.ListHostInfo(namespace.AllNamespaces(ctx), host.HostFilter{IncludeDeleted: true})
+	if err != nil {
+		return err
+	}
+	added, released, err := s.ipam.SyncAllocations(ctx, hosts, asOf)
+	if err != nil {
+		return err
+	}
+	if added > 0 || released > 0 {
+		s.logger.Log("during", "sync", "added", added, "released", released, "hosts", len(hosts))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package ipam
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	i := NewInmemIPAM()
+	if err := i.PostSubnet(ctx, Subnet{ID: "dc1-mgmt", CIDR: "10.1.0.0/29", DataCenter: "dc1", Gateway: "10.1.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+	// Hosts written behind IPAM's back, as a write-ahead log replays them.
+	store := host.NewInmemHost()
+	for _, h := range []host.HostInfo{
+		{ID: "a", DataCenter: "dc1", IP: "10.1.0.2"},
+		{ID: "b", DataCenter: "dc1", Interfaces: []host.Interface{{Name: "eth0", IPv4: []string{"10.1.0.3"}}}},
+	} {
+		if err := store.PostHostInfo(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.PostHostInfo(namespace.NewContext(ctx, "other"), host.HostInfo{ID: "c", IP: "10.1.0.4"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.DeleteHostInfo(namespace.NewContext(ctx, "other"), "c"); err != nil {
+		t.Fatal(err)
+	}
+	// Claims the store no longer backs: a host that is gone, and an
+	// address claimed by another host than the one holding it.
+	if err := i.ClaimIP(ctx, "10.1.0.5", "gone"); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.ClaimIP(ctx, "10.1.0.2", "gone"); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Millisecond)
+	if err := NewSyncer(i, store, log.NewNopLogger()).Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	list, err := i.ListAllocations(ctx, "dc1-mgmt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Allocation{
+		{IP: "10.1.0.2", Namespace: namespace.FromContext(ctx), HostID: "a"},
+		{IP: "10.1.0.3", Namespace: namespace.FromContext(ctx), HostID: "b"},
+		{IP: "10.1.0.4", Namespace: "other", HostID: "c"},
+	}
+	if len(list) != len(want) {
+		t.Fatalf("allocations %+v, want %+v", list, want)
+	}
+	for j, a := range list {
+		if a.IP != want[j].IP || a.Namespace != want[j].Namespace || a.HostID != want[j].HostID || a.SubnetID != "dc1-mgmt" {
+			t.Fatalf("allocations %+v, want %+v", list, want)
+		}
+	}
+
+	// New hosts get addresses no host holds, and addresses freed by the
+	// sync can be claimed again.
+	hosts := HostMiddleware(i)(store)
+	if err := hosts.PostHostInfo(ctx, host.HostInfo{ID: "d", DataCenter: "dc1"}); err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := store.GetHostInfo(ctx, "d"); d.IP != "10.1.0.5" {
+		t.Fatalf("host d got %q, want 10.1.0.5", d.IP)
+	}
+	if err := hosts.PostHostInfo(ctx, host.HostInfo{ID: "e", IP: "10.1.0.6"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncKeepsRecentClaims(t *testing.T) {
+	ctx := context.Background()
+	i := NewInmemIPAM()
+	asOf := time.Now()
+	// Claimed for a host being written while the hosts were listed.
+	if err := i.ClaimIP(ctx, "10.1.0.9", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if _, released, err := i.SyncAllocations(ctx, nil, asOf); err != nil || released != 0 {
+		t.Fatalf("released %d, %v: want the recent claim kept", released, err)
+	}
+	if err := i.ClaimIP(ctx, "10.1.0.9", "other"); err != ErrIPInUse {
+		t.Fatalf("got %v, want %v", err, ErrIPInUse)
+	}
+}
@@ -0,0 +1,30 @@
+package ipam
+
+import (
+	"context"
+
+	"github.com/xinyu/infra/inventory/topology"
+)
+
+// TopologyMiddleware rejects subnets in a datacenter the topology does not
+// know about.
+func TopologyMiddleware(t topology.Topology) Middleware {
+	return func(next IPAM) IPAM {
+		return &topologyMiddleware{
+			IPAM:     next,
+			topology: t,
+		}
+	}
+}
+
+type topologyMiddleware struct {
+	IPAM
+	topology topology.Topology
+}
+
+func (mw topologyMiddleware) PostSubnet(ctx context.Context, s Subnet) error {
+	if _, err := mw.topology.GetDataCenter(ctx, s.DataCenter); err != nil {
+		return ErrUnknownDataCenter
+	}
+	return mw.IPAM.PostSubnet(ctx, s)
+}
@@ -0,0 +1,161 @@
+package ipam
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+)
+
+func MakeHTTPHandler(s IPAM, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+	}
+
+	r.Methods("POST").Path("/ipam/v1/subnets/").Handler(httptransport.NewServer(
+		e.PostSubnetEndpoint,
+		decodePostSubnetRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/ipam/v1/subnets/").Handler(httptransport.NewServer(
+		e.ListSubnetsEndpoint,
+		decodeListSubnetsRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/ipam/v1/subnets/{id}").Handler(httptransport.NewServer(
+		e.GetSubnetEndpoint,
+		decodeGetSubnetRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/ipam/v1/subnets/{id}").Handler(httptransport.NewServer(
+		e.DeleteSubnetEndpoint,
+		decodeDeleteSubnetRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/ipam/v1/subnets/{id}/allocations").Handler(httptransport.NewServer(
+		e.ListAllocationsEndpoint,
+		decodeListAllocationsRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/ipam/v1/subnets/{id}/utilisation").Handler(httptransport.NewServer(
+		e.GetUtilisationEndpoint,
+		decodeGetUtilisationRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/ipam/v1/utilisation").Handler(httptransport.NewServer(
+		e.ListUtilisationEndpoint,
+		decodeListUtilisationRequest,
+		encodeResponse,
+		options...,
+	))
+
+	return r
+}
+
+func decodePostSubnetRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req postSubnetRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Subnet); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeGetSubnetRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getSubnetRequest{ID: id}, nil
+}
+
+func decodeDeleteSubnetRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return deleteSubnetRequest{ID: id}, nil
+}
+
+func decodeListSubnetsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return listSubnetsRequest{DataCenter: r.URL.Query().Get("datacenter")}, nil
+}
+
+func decodeListAllocationsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return listAllocationsRequest{SubnetID: id}, nil
+}
+
+func decodeGetUtilisationRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getUtilisationRequest{SubnetID: id}, nil
+}
+
+func decodeListUtilisationRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return listUtilisationRequest{DataCenter: r.URL.Query().Get("datacenter")}, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	switch err {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrAlreadyExists, ErrInvalidSubnet, ErrInvalidIP, ErrUnknownDataCenter:
+		return http.StatusBadRequest
+	case ErrOverlap, ErrInUse, ErrIPInUse, ErrNoFreeIP:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,21 +1,81 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/xinyu/infra/inventory/admission"
+	"github.com/xinyu/infra/inventory/backup"
+	"github.com/xinyu/infra/inventory/cluster"
+	"github.com/xinyu/infra/inventory/drain"
+	"github.com/xinyu/infra/inventory/export"
 	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/importer"
+	"github.com/xinyu/infra/inventory/ipam"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/placement"
+	"github.com/xinyu/infra/inventory/policy"
+	"github.com/xinyu/infra/inventory/schedule"
+	"github.com/xinyu/infra/inventory/search"
 	"github.com/xinyu/infra/inventory/service"
+	"github.com/xinyu/infra/inventory/sqlite"
+	"github.com/xinyu/infra/inventory/topology"
+	"github.com/xinyu/infra/inventory/txn"
+	"github.com/xinyu/infra/inventory/wal"
+	"github.com/xinyu/infra/inventory/webhook"
 )
 
 func main() {
+	if len(os.Args) > 1 && backup.IsCommand(os.Args[1]) {
+		if err := backup.RunCommand(os.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && importer.IsCommand(os.Args[1]) {
+		if err := importer.RunCommand(os.Args[1:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var (
-		httpAddr = flag.String("http.addr", ":8080", "HTTP listen address")
+		httpAddr   = flag.String("http.addr", ":8080", "HTTP listen address")
+		healthExec = flag.Bool("health.exec", false, "Allow exec health checks to run commands on this server")
+		hostUnique = flag.String("host.unique", "", "Comma-separated unique constraints on hosts of a namespace, fields joined by +, e.g. datacenter+name")
+
+		trashRetention = flag.Duration("trash.retention", 30*24*time.Hour, "How long deleted hosts and services stay in the trash before they are purged; 0 keeps them until purged by hand")
+
+		clusterID           = flag.String("cluster.id", "", "Raft node ID; empty keeps hosts and services in this server's memory only")
+		clusterRaft         = flag.String("cluster.raft", "127.0.0.1:7000", "Raft address of this node, dialed by its peers")
+		clusterHTTP         = flag.String("cluster.http", "", "Base URL of this node's API for its peers (default http://127.0.0.1 and the port of -http.addr)")
+		clusterDir          = flag.String("cluster.dir", "raft", "Directory of the raft log and snapshots")
+		clusterBootstrap    = flag.Bool("cluster.bootstrap", false, "Start a new cluster with this node as its only member")
+		clusterJoin         = flag.String("cluster.join", "", "Base URL of a member of the cluster to join")
+		clusterLinearizable = flag.Bool("cluster.linearizable", false, "Serve reads through the leader so that they see every committed write")
+		clusterSecret       = flag.String("cluster.secret", "", "Secret shared by the nodes, sent with the calls a follower forwards to the leader")
+
+		walDir      = flag.String("wal.dir", "", "Directory of a write-ahead log that keeps hosts and services across restarts; empty keeps them in memory only")
+		walSync     = flag.String("wal.sync", wal.SyncAlways, "When the write-ahead log is flushed to disk: always, interval or never")
+		walInterval = flag.Duration("wal.interval", time.Second, "Flush interval of -wal.sync interval")
+		walSnapshot = flag.Duration("wal.snapshot", 5*time.Minute, "How often hosts and services are snapshotted and the write-ahead log emptied")
+
+		sqlitePath = flag.String("sqlite.path", "", "SQLite database that keeps hosts and services across restarts; empty keeps them in memory only")
+
+		webhookQueue = flag.String("webhook.queue", "", "File that keeps webhook subscriptions and deliveries across restarts; empty keeps them in memory only")
+
+		ipamSync   = flag.Duration("ipam.sync", time.Minute, "How often IP allocations are reconciled with the addresses of hosts, for writes that do not go through this server, such as writes to other cluster nodes")
+		searchSync = flag.Duration("search.sync", time.Minute, "How often the search index is reconciled with the stores, for writes that do not go through this server, such as restores or writes to other cluster nodes")
 	)
 	flag.Parse()
 
@@ -26,22 +86,276 @@ func main() {
 		logger = log.With(logger, "caller", log.DefaultCaller)
 	}
 
+	var ns namespace.Namespace
+	{
+		ns = namespace.NewInmemNamespace()
+		ns = namespace.LoggingMiddleware(logger)(ns)
+	}
+
+	var topo topology.Topology
+	{
+		topo = topology.NewInmemTopology()
+		topo = topology.LoggingMiddleware(logger)(topo)
+	}
+
+	ipamStore := ipam.NewInmemIPAM()
+	var addrs ipam.IPAM
+	{
+		addrs = ipamStore
+		addrs = ipam.LoggingMiddleware(logger)(addrs)
+		addrs = ipam.TopologyMiddleware(topo)(addrs)
+	}
+
+	var hooks webhook.Webhook
+	{
+		if *webhookQueue != "" {
+			var err error
+			hooks, err = webhook.NewFileWebhook(*webhookQueue)
+			if err != nil {
+				logger.Log("during", "webhook.queue", "err", err)
+				os.Exit(1)
+			}
+		} else {
+			hooks = webhook.NewInmemWebhook()
+		}
+		hooks = webhook.LoggingMiddleware(logger)(hooks)
+	}
+
+	var admit admission.Admission
+	{
+		admit = admission.NewInmemAdmission()
+		admit = admission.LoggingMiddleware(logger)(admit)
+	}
+
+	var policies policy.Policy
+	{
+		policies = policy.NewInmemPolicy()
+		policies = policy.LoggingMiddleware(logger)(policies)
+	}
+
+	unique, err := host.ParseUnique(*hostUnique)
+	if err != nil {
+		logger.Log("during", "host.unique", "err", err)
+		os.Exit(1)
+	}
+
+	var node *cluster.Node
+	hostStore, serviceStore := host.NewInmemHost(unique...), service.NewInmemService()
+	if *clusterID != "" {
+		advertise := *clusterHTTP
+		if advertise == "" {
+			_, port, _ := net.SplitHostPort(*httpAddr)
+			advertise = "http://127.0.0.1:" + port
+		}
+		node, err = cluster.NewNode(cluster.Config{
+			ID:           *clusterID,
+			RaftAddr:     *clusterRaft,
+			HTTPAddr:     advertise,
+			Dir:          *clusterDir,
+			Bootstrap:    *clusterBootstrap,
+			Linearizable: *clusterLinearizable,
+			HostUnique:   unique,
+			Secret:       *clusterSecret,
+		}, log.With(logger, "component", "cluster"))
+		if err != nil {
+			logger.Log("during", "cluster", "err", err)
+			os.Exit(1)
+		}
+		defer node.Close()
+		hostStore, serviceStore = node.Hosts(), node.Services()
+	}
+	var writeAhead *wal.Log
+	if *walDir != "" {
+		if node != nil {
+			logger.Log("during", "wal", "err", "-wal.dir and -cluster.id are exclusive: the cluster keeps its own log")
+			os.Exit(1)
+		}
+		writeAhead, err = wal.Open(wal.Config{
+			Dir:              *walDir,
+			Sync:             *walSync,
+			SyncInterval:     *walInterval,
+			SnapshotInterval: *walSnapshot,
+		}, hostStore, serviceStore, log.With(logger, "component", "wal"))
+		if err != nil {
+			logger.Log("during", "wal", "err", err)
+			os.Exit(1)
+		}
+		defer writeAhead.Close()
+		hostStore, serviceStore = writeAhead.Hosts(), writeAhead.Services()
+	}
+	if *sqlitePath != "" {
+		if node != nil || writeAhead != nil {
+			logger.Log("during", "sqlite", "err", "-sqlite.path is exclusive with -wal.dir and -cluster.id")
+			os.Exit(1)
+		}
+		db, err := sqlite.Open(*sqlitePath, hostStore, serviceStore, log.With(logger, "component", "sqlite"))
+		if err != nil {
+			logger.Log("during", "sqlite", "err", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+		hostStore, serviceStore = db.Hosts(), db.Services()
+	}
+
+	var writes backup.WriteLock
+	index := search.NewIndex(hostStore, serviceStore, log.With(logger, "component", "search"))
+
 	var hostInfo host.Host
 	{
-		hostInfo = host.NewInmemHost()
+		hostInfo = hostStore
 		hostInfo = host.LoggingMiddleware(logger)(hostInfo)
+		hostInfo = backup.HostMiddleware(&writes)(hostInfo)
+		hostInfo = search.HostMiddleware(index)(hostInfo)
+		hostInfo = ipam.HostMiddleware(addrs)(hostInfo)
+		hostInfo = topology.HostMiddleware(topo)(hostInfo)
+		hostInfo = policy.HostMiddleware(policies)(hostInfo)
+		hostInfo = admission.HostMiddleware(admit)(hostInfo)
+		hostInfo = host.NamespaceMiddleware(ns)(hostInfo)
+		hostInfo = webhook.HostMiddleware(hooks)(hostInfo)
 	}
 
 	var serviceInfo service.Service
 	{
-		serviceInfo = service.NewInmemService()
+		serviceInfo = serviceStore
 		serviceInfo = service.LoggingMiddleware(logger)(serviceInfo)
+		serviceInfo = backup.ServiceMiddleware(&writes)(serviceInfo)
+		serviceInfo = search.ServiceMiddleware(index)(serviceInfo)
 		serviceInfo = service.HostMiddleware(hostInfo)(serviceInfo)
+		serviceInfo = policy.ServiceMiddleware(policies)(serviceInfo)
+		serviceInfo = admission.ServiceMiddleware(admit)(serviceInfo)
+		serviceInfo = service.NamespaceMiddleware(ns)(serviceInfo)
+		serviceInfo = webhook.ServiceMiddleware(hooks)(serviceInfo)
+	}
+
+	topo = topology.InventoryMiddleware(hostInfo, serviceInfo)(topo)
+	ns = service.NamespaceInventoryMiddleware(hostInfo, serviceInfo)(ns)
+	policies = policy.InventoryMiddleware(hostInfo, serviceInfo)(policies)
+
+	var transactions txn.Txn
+	{
+		transactions = txn.NewCoordinator(hostInfo, serviceInfo)
+		transactions = txn.LoggingMiddleware(logger)(transactions)
+	}
+
+	var drains drain.Drain
+	{
+		drains = drain.NewInmemDrain(hostInfo, serviceInfo, serviceStore)
+		drains = drain.LoggingMiddleware(logger)(drains)
+	}
+
+	var place placement.Placement
+	{
+		place = placement.NewPlacement(hostInfo, serviceStore)
+		place = placement.LoggingMiddleware(logger)(place)
+	}
+
+	bookingStore := schedule.NewInmemSchedule()
+	var bookings schedule.Schedule
+	{
+		bookings = bookingStore
+		bookings = schedule.LoggingMiddleware(logger)(bookings)
+		bookings = schedule.HostMiddleware(hostInfo)(bookings)
+		if node != nil {
+			bookings = schedule.LeaderMiddleware(node.Leader)(bookings)
+		}
+	}
+
+	var imports importer.Importer
+	{
+		imports = importer.NewImporter(hostInfo)
+		imports = importer.LoggingMiddleware(logger)(imports)
+	}
+
+	var exports export.Exporter
+	{
+		// Services are read from the store, as a report reads them host by
+		// host and would otherwise log a line for each.
+		exports = export.NewExporter(hostInfo, serviceStore)
+		exports = export.LoggingMiddleware(logger)(exports)
+	}
+
+	var searcher search.Searcher
+	{
+		searcher = index
+		searcher = search.LoggingMiddleware(logger)(searcher)
+	}
+
+	allocations := ipam.NewSyncer(ipamStore, hostStore, log.With(logger, "component", "ipam"))
+
+	var backups backup.Backup
+	{
+		backups = backup.NewBackup(hostStore.(host.Snapshotter), serviceStore.(service.Snapshotter), &writes)
+		backups = ipam.BackupMiddleware(allocations)(backups)
+		if node != nil {
+			backups = backup.LeaderMiddleware(node.Leader)(backups)
+		}
+		backups = backup.LoggingMiddleware(logger)(backups)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// In a cluster, the loops that write to the replicated stores run on
+	// the leader only, so that nodes do not check, purge or book twice.
+	leader := func(run func(ctx context.Context)) { go run(ctx) }
+	if node != nil {
+		leader = func(run func(ctx context.Context)) { go node.RunWhileLeader(ctx, run) }
+	}
+
+	checker := service.NewHealthChecker(serviceInfo, serviceStore, hostStore, *healthExec, log.With(logger, "component", "health"))
+	leader(checker.Run)
+
+	purger := service.NewPurger(serviceInfo, hostInfo, *trashRetention, log.With(logger, "component", "trash"))
+	leader(purger.Run)
+
+	scheduler := schedule.NewScheduler(bookings, bookingStore, hostInfo, log.With(logger, "component", "scheduler"))
+	leader(scheduler.Run)
+
+	dispatcher := webhook.NewDispatcher(hooks, 8, 10*time.Second, log.With(logger, "component", "webhook"))
+	go dispatcher.Run(ctx)
+
+	go index.Run(ctx, *searchSync)
+
+	// Allocations are rebuilt before serving, from the hosts recovered
+	// from the write-ahead log, the database or the cluster.
+	if err := allocations.Sync(ctx); err != nil {
+		logger.Log("during", "ipam", "err", err)
+		os.Exit(1)
+	}
+	go allocations.Run(ctx, *ipamSync)
+
+	if writeAhead != nil {
+		go writeAhead.Run(ctx)
+	}
+
+	if node != nil && *clusterJoin != "" {
+		go node.Join(ctx, *clusterJoin)
 	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/host/v1/", host.MakeHTTPHandler(hostInfo, log.With(logger, "component", "HTTP")))
 	mux.Handle("/service/v1/", service.MakeHTTPHandler(serviceInfo, log.With(logger, "component", "HTTP")))
+	mux.Handle("/topology/v1/", topology.MakeHTTPHandler(topo, log.With(logger, "component", "HTTP")))
+	mux.Handle("/ipam/v1/", ipam.MakeHTTPHandler(addrs, log.With(logger, "component", "HTTP")))
+	mux.Handle("/namespace/v1/", namespace.MakeHTTPHandler(ns, log.With(logger, "component", "HTTP")))
+	mux.Handle("/drain/v1/", drain.MakeHTTPHandler(drains, log.With(logger, "component", "HTTP")))
+	mux.Handle("/placement/v1/", placement.MakeHTTPHandler(place, log.With(logger, "component", "HTTP")))
+	mux.Handle("/schedule/v1/", schedule.MakeHTTPHandler(bookings, log.With(logger, "component", "HTTP")))
+	mux.Handle("/txn/v1/", txn.MakeHTTPHandler(transactions, log.With(logger, "component", "HTTP")))
+	mux.Handle("/webhook/v1/", webhook.MakeHTTPHandler(hooks, log.With(logger, "component", "HTTP")))
+	mux.Handle("/admission/v1/", admission.MakeHTTPHandler(admit, log.With(logger, "component", "HTTP")))
+	mux.Handle("/policy/v1/", policy.MakeHTTPHandler(policies, log.With(logger, "component", "HTTP")))
+	mux.Handle("/import/v1/", importer.MakeHTTPHandler(imports, log.With(logger, "component", "HTTP")))
+	mux.Handle("/export/v1/", export.MakeHTTPHandler(exports, log.With(logger, "component", "HTTP")))
+	searchHandler := search.MakeHTTPHandler(searcher, log.With(logger, "component", "HTTP"))
+	mux.Handle("/search/v1", searchHandler)
+	mux.Handle("/search/v1/", searchHandler)
+	mux.Handle("/backup/v1/", backup.MakeHTTPHandler(backups, log.With(logger, "component", "HTTP")))
+	if node != nil {
+		var admin cluster.Cluster = node
+		admin = cluster.LoggingMiddleware(logger)(admin)
+		mux.Handle("/cluster/v1/", cluster.MakeHTTPHandler(admin, log.With(logger, "component", "HTTP")))
+	}
 
 	http.Handle("/", accessControl(mux))
 
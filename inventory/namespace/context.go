@@ -0,0 +1,51 @@
+package namespace
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+type contextKey int
+
+const (
+	namespaceKey contextKey = iota
+	allKey
+)
+
+// NewContext returns a copy of ctx that scopes requests to namespace ns.
+func NewContext(ctx context.Context, ns string) context.Context {
+	return context.WithValue(ctx, namespaceKey, ns)
+}
+
+// FromContext returns the namespace ctx is scoped to, or Default.
+func FromContext(ctx context.Context) string {
+	if ns, ok := ctx.Value(namespaceKey).(string); ok && ns != "" {
+		return ns
+	}
+	return Default
+}
+
+// AllNamespaces returns a copy of ctx under which list operations span
+// every namespace. It is meant for internal callers, such as the topology
+// tree or the health checker, that work across tenants; no HTTP route
+// produces it.
+func AllNamespaces(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allKey, true)
+}
+
+// IsAll reports whether ctx was returned by AllNamespaces.
+func IsAll(ctx context.Context) bool {
+	all, _ := ctx.Value(allKey).(bool)
+	return all
+}
+
+// HTTPToContext moves the {ns} route variable, if any, into the context.
+// Routes without it stay in the default namespace.
+func HTTPToContext(ctx context.Context, r *http.Request) context.Context {
+	if ns, ok := mux.Vars(r)["ns"]; ok {
+		return NewContext(ctx, ns)
+	}
+	return ctx
+}
@@ -0,0 +1,115 @@
+package namespace
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	PostNamespaceInfoEndpoint   endpoint.Endpoint
+	GetNamespaceInfoEndpoint    endpoint.Endpoint
+	PutNamespaceInfoEndpoint    endpoint.Endpoint
+	DeleteNamespaceInfoEndpoint endpoint.Endpoint
+	ListNamespaceInfoEndpoint   endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Namespace) Endpoints {
+	return Endpoints{
+		PostNamespaceInfoEndpoint:   MakePostNamespaceInfoEndpoint(s),
+		GetNamespaceInfoEndpoint:    MakeGetNamespaceInfoEndpoint(s),
+		PutNamespaceInfoEndpoint:    MakePutNamespaceInfoEndpoint(s),
+		DeleteNamespaceInfoEndpoint: MakeDeleteNamespaceInfoEndpoint(s),
+		ListNamespaceInfoEndpoint:   MakeListNamespaceInfoEndpoint(s),
+	}
+}
+
+func MakePostNamespaceInfoEndpoint(s Namespace) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(postNamespaceInfoRequest)
+		e := s.PostNamespaceInfo(ctx, req.NamespaceInfo)
+		return postNamespaceInfoResponse{Err: e}, nil
+	}
+}
+
+func MakeGetNamespaceInfoEndpoint(s Namespace) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getNamespaceInfoRequest)
+		n, e := s.GetNamespaceInfo(ctx, req.ID)
+		return getNamespaceInfoResponse{NamespaceInfo: n, Err: e}, nil
+	}
+}
+
+func MakePutNamespaceInfoEndpoint(s Namespace) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putNamespaceInfoRequest)
+		e := s.PutNamespaceInfo(ctx, req.ID, req.NamespaceInfo)
+		return putNamespaceInfoResponse{Err: e}, nil
+	}
+}
+
+func MakeDeleteNamespaceInfoEndpoint(s Namespace) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteNamespaceInfoRequest)
+		e := s.DeleteNamespaceInfo(ctx, req.ID)
+		return deleteNamespaceInfoResponse{Err: e}, nil
+	}
+}
+
+func MakeListNamespaceInfoEndpoint(s Namespace) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		list, e := s.ListNamespaceInfo(ctx)
+		return listNamespaceInfoResponse{Namespaces: list, Err: e}, nil
+	}
+}
+
+type postNamespaceInfoRequest struct {
+	NamespaceInfo NamespaceInfo
+}
+
+type postNamespaceInfoResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r postNamespaceInfoResponse) error() error { return r.Err }
+
+type getNamespaceInfoRequest struct {
+	ID string
+}
+
+type getNamespaceInfoResponse struct {
+	NamespaceInfo NamespaceInfo `json:"namespaceinfo"`
+	Err           error         `json:"err,omitempty"`
+}
+
+func (r getNamespaceInfoResponse) error() error { return r.Err }
+
+type putNamespaceInfoRequest struct {
+	ID            string
+	NamespaceInfo NamespaceInfo
+}
+
+type putNamespaceInfoResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r putNamespaceInfoResponse) error() error { return r.Err }
+
+type deleteNamespaceInfoRequest struct {
+	ID string
+}
+
+type deleteNamespaceInfoResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r deleteNamespaceInfoResponse) error() error { return r.Err }
+
+type listNamespaceInfoRequest struct{}
+
+type listNamespaceInfoResponse struct {
+	Namespaces []NamespaceInfo `json:"namespaces"`
+	Err        error           `json:"err,omitempty"`
+}
+
+func (r listNamespaceInfoResponse) error() error { return r.Err }
@@ -0,0 +1,59 @@
+package namespace
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+type Middleware func(Namespace) Namespace
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Namespace) Namespace {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Namespace
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) PostNamespaceInfo(ctx context.Context, n NamespaceInfo) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostNamespaceInfo", "id", n.ID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostNamespaceInfo(ctx, n)
+}
+
+func (mw loggingMiddleware) GetNamespaceInfo(ctx context.Context, id string) (n NamespaceInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetNamespaceInfo", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetNamespaceInfo(ctx, id)
+}
+
+func (mw loggingMiddleware) PutNamespaceInfo(ctx context.Context, id string, n NamespaceInfo) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutNamespaceInfo", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutNamespaceInfo(ctx, id, n)
+}
+
+func (mw loggingMiddleware) DeleteNamespaceInfo(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteNamespaceInfo", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteNamespaceInfo(ctx, id)
+}
+
+func (mw loggingMiddleware) ListNamespaceInfo(ctx context.Context) (list []NamespaceInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListNamespaceInfo", "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListNamespaceInfo(ctx)
+}
@@ -0,0 +1,158 @@
+package namespace
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default is the namespace of requests that do not name one, which
+// includes every request on the unscoped v1 routes.
+const Default = "default"
+
+type Namespace interface {
+	PostNamespaceInfo(ctx context.Context, n NamespaceInfo) error
+	GetNamespaceInfo(ctx context.Context, id string) (NamespaceInfo, error)
+	PutNamespaceInfo(ctx context.Context, id string, n NamespaceInfo) error
+	DeleteNamespaceInfo(ctx context.Context, id string) error
+	ListNamespaceInfo(ctx context.Context) ([]NamespaceInfo, error)
+}
+
+// NamespaceInfo is a tenant of the inventory. Host and service IDs are
+// unique within a namespace only. SharedWith lists the namespaces whose
+// services may be placed on this namespace's hosts.
+type NamespaceInfo struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	SharedWith []string  `json:"sharedwith,omitempty"`
+	CreatedAt  time.Time `json:"createtime"`
+	UpdatedAt  time.Time `json:"updatetime"`
+	Remark     string    `json:"remark"`
+}
+
+// Shares reports whether services in namespace ns may use the hosts of n.
+func (n NamespaceInfo) Shares(ns string) bool {
+	if ns == n.ID {
+		return true
+	}
+	for _, s := range n.SharedWith {
+		if s == ns {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	ErrInconsistentIDs = errors.New("inconsistent IDs")
+	ErrAlreadyExists   = errors.New("already exists")
+	ErrNotFound        = errors.New("not found")
+	ErrInvalidID       = errors.New("invalid namespace ID")
+	ErrDeleteDefault   = errors.New("the default namespace cannot be deleted")
+	ErrInUse           = errors.New("in use")
+)
+
+var validID = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+func (n NamespaceInfo) validate() error {
+	if !validID.MatchString(n.ID) {
+		return ErrInvalidID
+	}
+	for _, s := range n.SharedWith {
+		if !validID.MatchString(s) {
+			return ErrInvalidID
+		}
+	}
+	return nil
+}
+
+type inmemNamespace struct {
+	mtx sync.RWMutex
+	m   map[string]NamespaceInfo
+}
+
+// NewInmemNamespace returns a store holding only the default namespace.
+func NewInmemNamespace() Namespace {
+	currentTime := time.Now()
+	return &inmemNamespace{
+		m: map[string]NamespaceInfo{
+			Default: {ID: Default, Name: Default, CreatedAt: currentTime, UpdatedAt: currentTime},
+		},
+	}
+}
+
+func (s *inmemNamespace) PostNamespaceInfo(ctx context.Context, n NamespaceInfo) error {
+	if err := n.validate(); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.m[n.ID]; ok {
+		return ErrAlreadyExists
+	}
+
+	currentTime := time.Now()
+	n.CreatedAt = currentTime
+	n.UpdatedAt = currentTime
+
+	s.m[n.ID] = n
+	return nil
+}
+
+func (s *inmemNamespace) GetNamespaceInfo(ctx context.Context, id string) (NamespaceInfo, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	n, ok := s.m[id]
+	if !ok {
+		return NamespaceInfo{}, ErrNotFound
+	}
+	return n, nil
+}
+
+func (s *inmemNamespace) PutNamespaceInfo(ctx context.Context, id string, n NamespaceInfo) error {
+	if id != n.ID {
+		return ErrInconsistentIDs
+	}
+	if err := n.validate(); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	n.UpdatedAt = time.Now()
+	if last, ok := s.m[id]; ok {
+		n.CreatedAt = last.CreatedAt
+	} else {
+		n.CreatedAt = n.UpdatedAt
+	}
+
+	s.m[id] = n
+	return nil
+}
+
+func (s *inmemNamespace) DeleteNamespaceInfo(ctx context.Context, id string) error {
+	if id == Default {
+		return ErrDeleteDefault
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.m[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m, id)
+	return nil
+}
+
+func (s *inmemNamespace) ListNamespaceInfo(ctx context.Context) ([]NamespaceInfo, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []NamespaceInfo{}
+	for _, n := range s.m {
+		list = append(list, n)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
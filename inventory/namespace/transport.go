@@ -0,0 +1,142 @@
+package namespace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+)
+
+func MakeHTTPHandler(s Namespace, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+	}
+
+	r.Methods("POST").Path("/namespace/v1/namespaceinfo/").Handler(httptransport.NewServer(
+		e.PostNamespaceInfoEndpoint,
+		decodePostNamespaceInfoRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/namespace/v1/namespaceinfo/").Handler(httptransport.NewServer(
+		e.ListNamespaceInfoEndpoint,
+		decodeListNamespaceInfoRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/namespace/v1/namespaceinfo/{id}").Handler(httptransport.NewServer(
+		e.GetNamespaceInfoEndpoint,
+		decodeGetNamespaceInfoRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/namespace/v1/namespaceinfo/{id}").Handler(httptransport.NewServer(
+		e.PutNamespaceInfoEndpoint,
+		decodePutNamespaceInfoRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/namespace/v1/namespaceinfo/{id}").Handler(httptransport.NewServer(
+		e.DeleteNamespaceInfoEndpoint,
+		decodeDeleteNamespaceInfoRequest,
+		encodeResponse,
+		options...,
+	))
+	return r
+}
+
+func decodePostNamespaceInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req postNamespaceInfoRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.NamespaceInfo); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeGetNamespaceInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getNamespaceInfoRequest{ID: id}, nil
+}
+
+func decodePutNamespaceInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var n NamespaceInfo
+	if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+		return nil, err
+	}
+	return putNamespaceInfoRequest{
+		ID:            id,
+		NamespaceInfo: n,
+	}, nil
+}
+
+func decodeDeleteNamespaceInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return deleteNamespaceInfoRequest{ID: id}, nil
+}
+
+func decodeListNamespaceInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return listNamespaceInfoRequest{}, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	switch err {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrAlreadyExists, ErrInconsistentIDs, ErrInvalidID, ErrDeleteDefault:
+		return http.StatusBadRequest
+	case ErrInUse:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
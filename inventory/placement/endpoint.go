@@ -0,0 +1,78 @@
+package placement
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	GetHostCapacityEndpoint endpoint.Endpoint
+	ListCapacityEndpoint    endpoint.Endpoint
+	RecommendEndpoint       endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Placement) Endpoints {
+	return Endpoints{
+		GetHostCapacityEndpoint: MakeGetHostCapacityEndpoint(s),
+		ListCapacityEndpoint:    MakeListCapacityEndpoint(s),
+		RecommendEndpoint:       MakeRecommendEndpoint(s),
+	}
+}
+
+func MakeGetHostCapacityEndpoint(s Placement) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getHostCapacityRequest)
+		c, e := s.GetHostCapacity(ctx, req.HostID)
+		return getHostCapacityResponse{Capacity: c, Err: e}, nil
+	}
+}
+
+func MakeListCapacityEndpoint(s Placement) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listCapacityRequest)
+		list, e := s.ListCapacity(ctx, req.Level)
+		return listCapacityResponse{Capacity: list, Err: e}, nil
+	}
+}
+
+func MakeRecommendEndpoint(s Placement) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(recommendRequest)
+		list, e := s.Recommend(ctx, req.Request)
+		return recommendResponse{Candidates: list, Err: e}, nil
+	}
+}
+
+type getHostCapacityRequest struct {
+	HostID string
+}
+
+type getHostCapacityResponse struct {
+	Capacity Capacity `json:"capacity,omitempty"`
+	Err      error    `json:"err,omitempty"`
+}
+
+func (r getHostCapacityResponse) error() error { return r.Err }
+
+type listCapacityRequest struct {
+	Level string
+}
+
+type listCapacityResponse struct {
+	Capacity []Capacity `json:"capacity,omitempty"`
+	Err      error      `json:"err,omitempty"`
+}
+
+func (r listCapacityResponse) error() error { return r.Err }
+
+type recommendRequest struct {
+	Request Request
+}
+
+type recommendResponse struct {
+	Candidates []Candidate `json:"candidates"`
+	Err        error       `json:"err,omitempty"`
+}
+
+func (r recommendResponse) error() error { return r.Err }
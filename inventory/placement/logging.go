@@ -0,0 +1,47 @@
+package placement
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Middleware func(Placement) Placement
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Placement) Placement {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Placement
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) GetHostCapacity(ctx context.Context, hostID string) (c Capacity, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetHostCapacity", "namespace", namespace.FromContext(ctx), "hostid", hostID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetHostCapacity(ctx, hostID)
+}
+
+func (mw loggingMiddleware) ListCapacity(ctx context.Context, level string) (list []Capacity, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListCapacity", "namespace", namespace.FromContext(ctx), "level", level, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListCapacity(ctx, level)
+}
+
+func (mw loggingMiddleware) Recommend(ctx context.Context, r Request) (list []Candidate, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Recommend", "namespace", namespace.FromContext(ctx), "name", r.Name, "strategy", r.Strategy, "candidates", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Recommend(ctx, r)
+}
@@ -0,0 +1,294 @@
+package placement
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+type Placement interface {
+	GetHostCapacity(ctx context.Context, hostID string) (Capacity, error)
+	ListCapacity(ctx context.Context, level string) ([]Capacity, error)
+	Recommend(ctx context.Context, r Request) ([]Candidate, error)
+}
+
+// Capacity levels.
+const (
+	LevelHost       = "host"
+	LevelRack       = "rack"
+	LevelDataCenter = "datacenter"
+)
+
+// Capacity is the capacity of a host, or the total capacity of the hosts
+// of a rack or datacenter, and the part of it requested by the services
+// and instances placed there. Free is negative when a host is overcommitted.
+type Capacity struct {
+	Level      string         `json:"level"`
+	ID         string         `json:"id"`
+	DataCenter string         `json:"datacenter,omitempty"`
+	Hosts      int            `json:"hosts"`
+	Capacity   host.Resources `json:"capacity"`
+	Allocated  host.Resources `json:"allocated"`
+	Free       host.Resources `json:"free"`
+}
+
+// Placement strategies. Spread favours the least utilised hosts, bin
+// packing the most utilised ones that still fit the request.
+const (
+	StrategySpread  = "spread"
+	StrategyBinPack = "binpack"
+)
+
+// Request describes a service to place. Hosts already running a service
+// or instance named Name are left out, so that replicas of a service end
+// up on different hosts, and so are hosts in maintenance or reserved for
+// another owner than Owner. DataCenter, Rack and Labels restrict the
+// candidates; Limit caps the number of candidates returned.
+type Request struct {
+	Name       string            `json:"name"`
+	Owner      string            `json:"owner,omitempty"`
+	Requests   host.Resources    `json:"requests"`
+	Strategy   string            `json:"strategy,omitempty"`
+	DataCenter string            `json:"datacenter,omitempty"`
+	Rack       string            `json:"rack,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Limit      int               `json:"limit,omitempty"`
+}
+
+// Candidate is a host that fits a request. Score ranks candidates, higher
+// is better; Free is the capacity left on the host before placement.
+type Candidate struct {
+	HostID     string         `json:"hostid"`
+	DataCenter string         `json:"datacenter"`
+	Rack       string         `json:"rack"`
+	Score      float64        `json:"score"`
+	Free       host.Resources `json:"free"`
+}
+
+var (
+	ErrInvalidLevel    = errors.New("invalid capacity level")
+	ErrInvalidStrategy = errors.New("invalid placement strategy")
+	ErrInvalidRequest  = errors.New("invalid placement request")
+)
+
+type inventoryPlacement struct {
+	hosts    host.Host
+	services service.Service
+}
+
+// NewPlacement returns a Placement computed from the hosts and services of
+// the inventory. Services and each of their instances request the
+// resources set on the service. Services and instances are listed once
+// for all hosts, from services, the service store.
+func NewPlacement(hosts host.Host, services service.Service) Placement {
+	return &inventoryPlacement{
+		hosts:    hosts,
+		services: services,
+	}
+}
+
+func (s *inventoryPlacement) GetHostCapacity(ctx context.Context, hostID string) (Capacity, error) {
+	h, err := s.hosts.GetHostInfo(ctx, hostID)
+	if err != nil {
+		return Capacity{}, err
+	}
+	u, err := s.usage(ctx)
+	if err != nil {
+		return Capacity{}, err
+	}
+	return hostCapacity(h, u.allocated[h.ID]), nil
+}
+
+func (s *inventoryPlacement) ListCapacity(ctx context.Context, level string) ([]Capacity, error) {
+	if level == "" {
+		level = LevelHost
+	}
+	if level != LevelHost && level != LevelRack && level != LevelDataCenter {
+		return nil, ErrInvalidLevel
+	}
+	hosts, err := s.hosts.ListHostInfo(ctx, host.HostFilter{})
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.usage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[string]*Capacity{}
+	list := []Capacity{}
+	for _, h := range hosts {
+		c := hostCapacity(h, u.allocated[h.ID])
+		switch level {
+		case LevelRack:
+			if h.Rack == "" {
+				continue
+			}
+			c.Level, c.ID = LevelRack, h.Rack
+		case LevelDataCenter:
+			if h.DataCenter == "" {
+				continue
+			}
+			c.Level, c.ID, c.DataCenter = LevelDataCenter, h.DataCenter, ""
+		}
+		if level == LevelHost {
+			list = append(list, c)
+			continue
+		}
+		total, ok := byID[c.ID]
+		if !ok {
+			byID[c.ID] = &c
+			continue
+		}
+		total.Hosts++
+		total.Capacity = total.Capacity.Add(c.Capacity)
+		total.Allocated = total.Allocated.Add(c.Allocated)
+		total.Free = total.Free.Add(c.Free)
+	}
+	for _, c := range byID {
+		list = append(list, *c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// Recommend ranks the hosts that fit r, best first.
+func (s *inventoryPlacement) Recommend(ctx context.Context, r Request) ([]Candidate, error) {
+	switch r.Strategy {
+	case "":
+		r.Strategy = StrategySpread
+	case StrategySpread, StrategyBinPack:
+	default:
+		return nil, ErrInvalidStrategy
+	}
+	if r.Requests.Validate() != nil || r.Limit < 0 {
+		return nil, ErrInvalidRequest
+	}
+	hosts, err := s.hosts.ListHostInfo(ctx, host.HostFilter{DataCenter: r.DataCenter, Rack: r.Rack})
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.usage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	list := []Candidate{}
+	for _, h := range hosts {
+		if h.Cordoned || !h.MatchLabels(r.Labels) || (r.Name != "" && u.names[h.ID][r.Name]) {
+			continue
+		}
+		if h.Status == host.StatusMaintenance || (h.Status == host.StatusReserved && h.ReservedBy != r.Owner) {
+			continue
+		}
+		free := h.Capacity.Sub(u.allocated[h.ID])
+		if !free.Fits(r.Requests) {
+			continue
+		}
+		util := utilisation(h.Capacity, u.allocated[h.ID].Add(r.Requests))
+		score := 1 - util
+		if r.Strategy == StrategyBinPack {
+			score = util
+		}
+		list = append(list, Candidate{
+			HostID:     h.ID,
+			DataCenter: h.DataCenter,
+			Rack:       h.Rack,
+			Score:      math.Round(score*10000) / 10000,
+			Free:       free,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Score != list[j].Score {
+			return list[i].Score > list[j].Score
+		}
+		return list[i].HostID < list[j].HostID
+	})
+	if r.Limit > 0 && len(list) > r.Limit {
+		list = list[:r.Limit]
+	}
+	return list, nil
+}
+
+func hostCapacity(h host.HostInfo, allocated host.Resources) Capacity {
+	return Capacity{
+		Level:      LevelHost,
+		ID:         h.ID,
+		DataCenter: h.DataCenter,
+		Hosts:      1,
+		Capacity:   h.Capacity,
+		Allocated:  allocated,
+		Free:       h.Capacity.Sub(allocated),
+	}
+}
+
+// utilisation returns the mean share of capacity taken by allocated over
+// the resources the host declares.
+func utilisation(capacity, allocated host.Resources) float64 {
+	var sum float64
+	n := 0
+	if capacity.CPU > 0 {
+		sum += allocated.CPU / capacity.CPU
+		n++
+	}
+	if capacity.Memory > 0 {
+		sum += float64(allocated.Memory) / float64(capacity.Memory)
+		n++
+	}
+	if capacity.Disk > 0 {
+		sum += float64(allocated.Disk) / float64(capacity.Disk)
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// usage is what the services and instances placed on hosts request, and
+// the names of those services, by host ID.
+type usage struct {
+	allocated map[string]host.Resources
+	names     map[string]map[string]bool
+}
+
+// usage adds up the requests of every service and instance placed on the
+// hosts of the namespace of ctx, whatever namespace they belong to.
+func (s *inventoryPlacement) usage(ctx context.Context) (usage, error) {
+	u := usage{allocated: map[string]host.Resources{}, names: map[string]map[string]bool{}}
+	add := func(hostID string, svc service.ServiceInfo) {
+		u.allocated[hostID] = u.allocated[hostID].Add(svc.Requests)
+		if u.names[hostID] == nil {
+			u.names[hostID] = map[string]bool{}
+		}
+		u.names[hostID][svc.Name] = true
+	}
+
+	ns := namespace.FromContext(ctx)
+	list, err := s.services.ListServiceInfo(namespace.AllNamespaces(ctx), service.ServiceFilter{})
+	if err != nil {
+		return usage{}, err
+	}
+	byKey := map[string]service.ServiceInfo{}
+	for _, svc := range list {
+		byKey[svc.Namespace+"/"+svc.ID] = svc
+		if svc.HostNamespace == ns {
+			add(svc.HostID, svc)
+		}
+	}
+	instances, err := s.services.ListHostInstances(ctx, "")
+	if err != nil {
+		return usage{}, err
+	}
+	for _, in := range instances {
+		if svc, ok := byKey[in.Namespace+"/"+in.ServiceID]; ok {
+			add(in.HostID, svc)
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,113 @@
+package placement
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// fixture returns a placement over hosts of 8 CPUs, h1 running web, h2 an
+// instance of db, h3 cordoned, h4 in maintenance and h5 reserved by me and
+// running db, and h6 of 2 CPUs.
+func fixture(t *testing.T) Placement {
+	t.Helper()
+	ctx := context.Background()
+	hosts, services := host.NewInmemHost(), service.NewInmemService()
+	for _, h := range []host.HostInfo{
+		{ID: "h1", Capacity: host.Resources{CPU: 8}},
+		{ID: "h2", Capacity: host.Resources{CPU: 8}},
+		{ID: "h3", Capacity: host.Resources{CPU: 8}},
+		{ID: "h4", Capacity: host.Resources{CPU: 8}},
+		{ID: "h5", Capacity: host.Resources{CPU: 8}},
+		{ID: "h6", Capacity: host.Resources{CPU: 2}},
+	} {
+		if err := hosts.PostHostInfo(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := host.Cordon(ctx, hosts, "h3", true); err != nil {
+		t.Fatal(err)
+	}
+	// Statuses are written as the scheduler writes them.
+	mctx := host.NewManagedContext(ctx)
+	if err := hosts.PutHostInfo(mctx, "h4", host.HostInfo{ID: "h4", Capacity: host.Resources{CPU: 8}, Status: host.StatusMaintenance}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hosts.PutHostInfo(mctx, "h5", host.HostInfo{ID: "h5", Capacity: host.Resources{CPU: 8}, Status: host.StatusReserved, ReservedBy: "me"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, svc := range []service.ServiceInfo{
+		{ID: "web", Name: "web", HostID: "h1", Requests: host.Resources{CPU: 4}},
+		{ID: "db", Name: "db", HostID: "h5", Requests: host.Resources{CPU: 1}},
+	} {
+		if err := services.PostServiceInfo(ctx, svc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := services.PostServiceInstance(ctx, "db", service.Instance{ID: "1", HostID: "h2"}); err != nil {
+		t.Fatal(err)
+	}
+	return NewPlacement(hosts, services)
+}
+
+func TestRecommend(t *testing.T) {
+	s := fixture(t)
+	cpu := func(n float64) host.Resources { return host.Resources{CPU: n} }
+	for _, tc := range []struct {
+		name string
+		r    Request
+		want []string
+	}{
+		{"spread", Request{Requests: cpu(2)}, []string{"h2", "h1", "h6"}},
+		{"bin packing", Request{Requests: cpu(2), Strategy: StrategyBinPack}, []string{"h6", "h1", "h2"}},
+		{"owner of the reservation", Request{Requests: cpu(2), Owner: "me"}, []string{"h2", "h5", "h1", "h6"}},
+		{"service already placed", Request{Name: "web", Requests: cpu(2)}, []string{"h2", "h6"}},
+		{"instance already placed", Request{Name: "db", Requests: cpu(2), Owner: "me"}, []string{"h1", "h6"}},
+		{"fits", Request{Requests: cpu(5)}, []string{"h2"}},
+		{"limit", Request{Requests: cpu(2), Limit: 1}, []string{"h2"}},
+	} {
+		list, err := s.Recommend(context.Background(), tc.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, c := range list {
+			got = append(got, c.HostID)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	list, err := s.Recommend(context.Background(), Request{Requests: cpu(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// h2: (1+2)/8 used, h1: (4+2)/8, h6: 2/2.
+	want := []Candidate{
+		{HostID: "h2", Score: 0.625, Free: cpu(7)},
+		{HostID: "h1", Score: 0.25, Free: cpu(4)},
+		{HostID: "h6", Score: 0, Free: cpu(2)},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("got %+v, want %+v", list, want)
+	}
+
+	if _, err := s.Recommend(context.Background(), Request{Strategy: "random"}); err != ErrInvalidStrategy {
+		t.Fatalf("got %v, want %v", err, ErrInvalidStrategy)
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	s := fixture(t)
+	c, err := s.GetHostCapacity(context.Background(), "h2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Allocated.CPU != 1 || c.Free.CPU != 7 {
+		t.Fatalf("got %+v, want the db instance allocated", c)
+	}
+}
@@ -0,0 +1,109 @@
+package placement
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+)
+
+func MakeHTTPHandler(s Placement, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext),
+	}
+
+	for _, prefix := range []string{"/placement/v1", "/placement/v1/namespaces/{ns}"} {
+		r.Methods("GET").Path(prefix + "/capacity/").Handler(httptransport.NewServer(
+			e.ListCapacityEndpoint,
+			decodeListCapacityRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/capacity/hosts/{hostid}").Handler(httptransport.NewServer(
+			e.GetHostCapacityEndpoint,
+			decodeGetHostCapacityRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("POST").Path(prefix + "/recommendations").Handler(httptransport.NewServer(
+			e.RecommendEndpoint,
+			decodeRecommendRequest,
+			encodeResponse,
+			options...,
+		))
+	}
+	return r
+}
+
+func decodeGetHostCapacityRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	hostID, ok := vars["hostid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getHostCapacityRequest{HostID: hostID}, nil
+}
+
+func decodeListCapacityRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return listCapacityRequest{Level: r.URL.Query().Get("level")}, nil
+}
+
+func decodeRecommendRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req recommendRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Request); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	switch err {
+	case host.ErrNotFound, host.ErrUnknownNamespace:
+		return http.StatusNotFound
+	case ErrInvalidLevel, ErrInvalidStrategy, ErrInvalidRequest:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,136 @@
+package policy
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	PostPolicyInfoEndpoint   endpoint.Endpoint
+	GetPolicyInfoEndpoint    endpoint.Endpoint
+	PutPolicyInfoEndpoint    endpoint.Endpoint
+	DeletePolicyInfoEndpoint endpoint.Endpoint
+	ListPolicyInfoEndpoint   endpoint.Endpoint
+	DryRunEndpoint           endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Policy) Endpoints {
+	return Endpoints{
+		PostPolicyInfoEndpoint:   MakePostPolicyInfoEndpoint(s),
+		GetPolicyInfoEndpoint:    MakeGetPolicyInfoEndpoint(s),
+		PutPolicyInfoEndpoint:    MakePutPolicyInfoEndpoint(s),
+		DeletePolicyInfoEndpoint: MakeDeletePolicyInfoEndpoint(s),
+		ListPolicyInfoEndpoint:   MakeListPolicyInfoEndpoint(s),
+		DryRunEndpoint:           MakeDryRunEndpoint(s),
+	}
+}
+
+func MakePostPolicyInfoEndpoint(s Policy) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(postPolicyInfoRequest)
+		e := s.PostPolicyInfo(ctx, req.PolicyInfo)
+		return postPolicyInfoResponse{Err: e}, nil
+	}
+}
+
+func MakeGetPolicyInfoEndpoint(s Policy) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getPolicyInfoRequest)
+		p, e := s.GetPolicyInfo(ctx, req.ID)
+		return getPolicyInfoResponse{PolicyInfo: p, Err: e}, nil
+	}
+}
+
+func MakePutPolicyInfoEndpoint(s Policy) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putPolicyInfoRequest)
+		e := s.PutPolicyInfo(ctx, req.ID, req.PolicyInfo)
+		return putPolicyInfoResponse{Err: e}, nil
+	}
+}
+
+func MakeDeletePolicyInfoEndpoint(s Policy) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deletePolicyInfoRequest)
+		e := s.DeletePolicyInfo(ctx, req.ID)
+		return deletePolicyInfoResponse{Err: e}, nil
+	}
+}
+
+func MakeListPolicyInfoEndpoint(s Policy) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		list, e := s.ListPolicyInfo(ctx)
+		return listPolicyInfoResponse{Policies: list, Err: e}, nil
+	}
+}
+
+func MakeDryRunEndpoint(s Policy) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(dryRunRequest)
+		result, e := s.DryRun(ctx, req.DryRunRequest)
+		return dryRunResponse{Result: result, Err: e}, nil
+	}
+}
+
+type postPolicyInfoRequest struct {
+	PolicyInfo PolicyInfo
+}
+
+type postPolicyInfoResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r postPolicyInfoResponse) error() error { return r.Err }
+
+type getPolicyInfoRequest struct {
+	ID string
+}
+
+type getPolicyInfoResponse struct {
+	PolicyInfo PolicyInfo `json:"policyinfo"`
+	Err        error      `json:"err,omitempty"`
+}
+
+func (r getPolicyInfoResponse) error() error { return r.Err }
+
+type putPolicyInfoRequest struct {
+	ID         string
+	PolicyInfo PolicyInfo
+}
+
+type putPolicyInfoResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r putPolicyInfoResponse) error() error { return r.Err }
+
+type deletePolicyInfoRequest struct {
+	ID string
+}
+
+type deletePolicyInfoResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r deletePolicyInfoResponse) error() error { return r.Err }
+
+type listPolicyInfoRequest struct{}
+
+type listPolicyInfoResponse struct {
+	Policies []PolicyInfo `json:"policies"`
+	Err      error        `json:"err,omitempty"`
+}
+
+func (r listPolicyInfoResponse) error() error { return r.Err }
+
+type dryRunRequest struct {
+	DryRunRequest DryRunRequest
+}
+
+type dryRunResponse struct {
+	Result DryRunResult `json:"result"`
+	Err    error        `json:"err,omitempty"`
+}
+
+func (r dryRunResponse) error() error { return r.Err }
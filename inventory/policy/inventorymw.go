@@ -0,0 +1,207 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// HostMiddleware rejects host creates and updates, including those of
+// batches, that violate a policy of their namespace.
+func HostMiddleware(p Policy) host.Middleware {
+	return func(next host.Host) host.Host {
+		return &hostMiddleware{
+			Host:   next,
+			policy: p,
+		}
+	}
+}
+
+type hostMiddleware struct {
+	host.Host
+	policy Policy
+}
+
+func (mw hostMiddleware) PostHostInfo(ctx context.Context, h host.HostInfo) error {
+	if err := mw.check(ctx, h.ID, h); err != nil {
+		return err
+	}
+	return mw.Host.PostHostInfo(ctx, h)
+}
+
+func (mw hostMiddleware) PutHostInfo(ctx context.Context, id string, h host.HostInfo) error {
+	if err := mw.check(ctx, id, h); err != nil {
+		return err
+	}
+	return mw.Host.PutHostInfo(ctx, id, h)
+}
+
+func (mw hostMiddleware) BatchHostInfo(ctx context.Context, b host.Batch) ([]host.BatchResult, error) {
+	return host.ForwardBatch(ctx, b, func(op *host.HostOp) error {
+		if op.Op != host.OpCreate && op.Op != host.OpUpdate {
+			return nil
+		}
+		id := op.ID
+		if id == "" {
+			id = op.HostInfo.ID
+		}
+		return mw.check(ctx, id, op.HostInfo)
+	}, mw.Host.BatchHostInfo)
+}
+
+// check evaluates the write of h as host id, an update if the host exists.
+func (mw hostMiddleware) check(ctx context.Context, id string, h host.HostInfo) error {
+	in := Input{
+		Namespace: namespace.FromContext(ctx),
+		Resource:  ResourceHost,
+		Operation: OpCreate,
+		ObjectID:  id,
+	}
+	if last, err := mw.Host.GetHostInfo(ctx, id); err == nil {
+		in.Operation = OpUpdate
+		in.OldObject, _ = json.Marshal(last)
+	}
+	by, reason, err := evaluate(ctx, mw.policy, in, h)
+	if err != nil {
+		return err
+	}
+	if by != "" {
+		return &host.DeniedError{By: by, Reason: reason}
+	}
+	return nil
+}
+
+// ServiceMiddleware rejects service creates and updates, including those
+// of batches, that violate a policy of their namespace.
+func ServiceMiddleware(p Policy) service.MiddlewareService {
+	return func(next service.Service) service.Service {
+		return &serviceMiddleware{
+			Service: next,
+			policy:  p,
+		}
+	}
+}
+
+type serviceMiddleware struct {
+	service.Service
+	policy Policy
+}
+
+func (mw serviceMiddleware) PostServiceInfo(ctx context.Context, s service.ServiceInfo) error {
+	if err := mw.check(ctx, s.ID, s); err != nil {
+		return err
+	}
+	return mw.Service.PostServiceInfo(ctx, s)
+}
+
+func (mw serviceMiddleware) PutServiceInfo(ctx context.Context, id string, s service.ServiceInfo) error {
+	if err := mw.check(ctx, id, s); err != nil {
+		return err
+	}
+	return mw.Service.PutServiceInfo(ctx, id, s)
+}
+
+func (mw serviceMiddleware) BatchServiceInfo(ctx context.Context, b service.Batch) ([]service.BatchResult, error) {
+	return service.ForwardBatch(ctx, b, func(op *service.ServiceOp) error {
+		if op.Op != service.OpCreate && op.Op != service.OpUpdate {
+			return nil
+		}
+		id := op.ID
+		if id == "" {
+			id = op.ServiceInfo.ID
+		}
+		return mw.check(ctx, id, op.ServiceInfo)
+	}, mw.Service.BatchServiceInfo)
+}
+
+// check evaluates the write of s as service id, an update if the service
+// exists.
+func (mw serviceMiddleware) check(ctx context.Context, id string, s service.ServiceInfo) error {
+	in := Input{
+		Namespace: namespace.FromContext(ctx),
+		Resource:  ResourceService,
+		Operation: OpCreate,
+		ObjectID:  id,
+	}
+	if last, err := mw.Service.GetServiceInfo(ctx, id); err == nil {
+		in.Operation = OpUpdate
+		in.OldObject, _ = json.Marshal(last)
+	}
+	by, reason, err := evaluate(ctx, mw.policy, in, s)
+	if err != nil {
+		return err
+	}
+	if by != "" {
+		return &service.DeniedError{By: by, Reason: reason}
+	}
+	return nil
+}
+
+// evaluate runs in, with object as in.Object, through p. If policies are
+// violated it names them in by and joins their messages in reason.
+func evaluate(ctx context.Context, p Policy, in Input, object interface{}) (by, reason string, err error) {
+	if in.Object, err = json.Marshal(object); err != nil {
+		return "", "", err
+	}
+	violations, err := p.Evaluate(ctx, in)
+	if err != nil || len(violations) == 0 {
+		return "", "", err
+	}
+	var ids, messages []string
+	for _, v := range violations {
+		ids = append(ids, v.PolicyID)
+		if v.Error != "" {
+			messages = append(messages, v.Message+" ("+v.Error+")")
+		} else {
+			messages = append(messages, v.Message)
+		}
+	}
+	return "policy " + strings.Join(ids, ", "), strings.Join(messages, "; "), nil
+}
+
+// InventoryMiddleware runs dry runs that carry no inputs against every
+// host and service of the namespace, as if each were written again
+// unchanged.
+func InventoryMiddleware(hosts host.Host, services service.Service) Middleware {
+	return func(next Policy) Policy {
+		return &inventoryMiddleware{
+			Policy:   next,
+			hosts:    hosts,
+			services: services,
+		}
+	}
+}
+
+type inventoryMiddleware struct {
+	Policy
+	hosts    host.Host
+	services service.Service
+}
+
+func (mw inventoryMiddleware) DryRun(ctx context.Context, r DryRunRequest) (DryRunResult, error) {
+	if len(r.Inputs) > 0 {
+		return mw.Policy.DryRun(ctx, r)
+	}
+	ns := namespace.FromContext(ctx)
+	hosts, err := mw.hosts.ListHostInfo(ctx, host.HostFilter{})
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	for _, h := range hosts {
+		b, _ := json.Marshal(h)
+		r.Inputs = append(r.Inputs, Input{Namespace: ns, Resource: ResourceHost, Operation: OpUpdate, ObjectID: h.ID, Object: b, OldObject: b})
+	}
+	services, err := mw.services.ListServiceInfo(ctx, service.ServiceFilter{})
+	if err != nil {
+		return DryRunResult{}, err
+	}
+	for _, s := range services {
+		b, _ := json.Marshal(s)
+		r.Inputs = append(r.Inputs, Input{Namespace: ns, Resource: ResourceService, Operation: OpUpdate, ObjectID: s.ID, Object: b, OldObject: b})
+	}
+	return mw.Policy.DryRun(ctx, r)
+}
@@ -0,0 +1,75 @@
+package policy
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Middleware func(Policy) Policy
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Policy) Policy {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Policy
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) PostPolicyInfo(ctx context.Context, p PolicyInfo) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostPolicyInfo", "namespace", namespace.FromContext(ctx), "id", p.ID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostPolicyInfo(ctx, p)
+}
+
+func (mw loggingMiddleware) GetPolicyInfo(ctx context.Context, id string) (p PolicyInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetPolicyInfo", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetPolicyInfo(ctx, id)
+}
+
+func (mw loggingMiddleware) PutPolicyInfo(ctx context.Context, id string, p PolicyInfo) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutPolicyInfo", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutPolicyInfo(ctx, id, p)
+}
+
+func (mw loggingMiddleware) DeletePolicyInfo(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeletePolicyInfo", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeletePolicyInfo(ctx, id)
+}
+
+func (mw loggingMiddleware) ListPolicyInfo(ctx context.Context) (list []PolicyInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListPolicyInfo", "namespace", namespace.FromContext(ctx), "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListPolicyInfo(ctx)
+}
+
+func (mw loggingMiddleware) Evaluate(ctx context.Context, in Input) (violations []Violation, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Evaluate", "namespace", namespace.FromContext(ctx), "resource", in.Resource, "operation", in.Operation, "objectid", in.ObjectID, "violations", len(violations), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Evaluate(ctx, in)
+}
+
+func (mw loggingMiddleware) DryRun(ctx context.Context, r DryRunRequest) (result DryRunResult, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DryRun", "namespace", namespace.FromContext(ctx), "policyid", r.PolicyID, "evaluated", result.Evaluated, "violations", len(result.Violations), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DryRun(ctx, r)
+}
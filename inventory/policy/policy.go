@@ -0,0 +1,380 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/cel-go/cel"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// Policy keeps the policies of every namespace, compiled, and evaluates
+// them against the hosts and services written to it.
+type Policy interface {
+	PostPolicyInfo(ctx context.Context, p PolicyInfo) error
+	GetPolicyInfo(ctx context.Context, id string) (PolicyInfo, error)
+	PutPolicyInfo(ctx context.Context, id string, p PolicyInfo) error
+	DeletePolicyInfo(ctx context.Context, id string) error
+	ListPolicyInfo(ctx context.Context) ([]PolicyInfo, error)
+	Evaluate(ctx context.Context, in Input) ([]Violation, error)
+	DryRun(ctx context.Context, r DryRunRequest) (DryRunResult, error)
+}
+
+// Resources and operations policies apply to.
+const (
+	ResourceHost    = "host"
+	ResourceService = "service"
+
+	OpCreate = "create"
+	OpUpdate = "update"
+)
+
+// PolicyInfo is a CEL expression that every host or service write of its
+// namespace matching Resources and Operations must satisfy. Empty
+// Resources and Operations match every write. The expression sees the
+// record being written as object, the stored record as oldObject (null on
+// create), and the resource, operation and namespace of the write; field
+// names are those of the JSON API. Message explains a violation.
+type PolicyInfo struct {
+	ID         string    `json:"id"`
+	Namespace  string    `json:"namespace"`
+	Resources  []string  `json:"resources,omitempty"`
+	Operations []string  `json:"operations,omitempty"`
+	Expression string    `json:"expression"`
+	Message    string    `json:"message,omitempty"`
+	CreatedAt  time.Time `json:"createtime"`
+	UpdatedAt  time.Time `json:"updatetime"`
+	Remark     string    `json:"remark"`
+}
+
+func (p PolicyInfo) match(in Input) bool {
+	if len(p.Resources) > 0 && !contains(p.Resources, in.Resource) {
+		return false
+	}
+	if len(p.Operations) > 0 && !contains(p.Operations, in.Operation) {
+		return false
+	}
+	return true
+}
+
+func (p PolicyInfo) message() string {
+	if p.Message != "" {
+		return p.Message
+	}
+	return "expression is false: " + p.Expression
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Input is a write to evaluate policies against. Object and OldObject are
+// the records as the JSON API shows them.
+type Input struct {
+	Namespace string          `json:"namespace"`
+	Resource  string          `json:"resource"`
+	Operation string          `json:"operation"`
+	ObjectID  string          `json:"objectid"`
+	Object    json.RawMessage `json:"object"`
+	OldObject json.RawMessage `json:"oldobject,omitempty"`
+}
+
+// Violation is a policy that a write does not satisfy. Error is set when
+// the expression could not be evaluated, which counts as a violation.
+type Violation struct {
+	PolicyID string `json:"policyid"`
+	Resource string `json:"resource"`
+	ObjectID string `json:"objectid"`
+	Message  string `json:"message"`
+	Error    string `json:"error,omitempty"`
+}
+
+// DryRunRequest names a stored policy, or carries one that need not be
+// stored, to evaluate against Inputs. Every input is evaluated, whatever
+// the operations of the policy.
+type DryRunRequest struct {
+	PolicyID string      `json:"policyid,omitempty"`
+	Policy   *PolicyInfo `json:"policy,omitempty"`
+	Inputs   []Input     `json:"inputs,omitempty"`
+}
+
+type DryRunResult struct {
+	Evaluated  int         `json:"evaluated"`
+	Violations []Violation `json:"violations"`
+}
+
+// Expressions get at most maxCost units of work, so that a policy cannot
+// stall writes.
+const maxCost = 1000000
+
+var (
+	ErrInconsistentIDs = errors.New("inconsistent IDs")
+	ErrAlreadyExists   = errors.New("already exists")
+	ErrNotFound        = errors.New("not found")
+	ErrInvalidPolicy   = errors.New("invalid policy")
+	ErrInvalidDryRun   = errors.New("dry run needs exactly one of policyid or policy")
+)
+
+// ExpressionError is returned when a policy expression does not compile
+// or does not evaluate to a bool.
+type ExpressionError struct {
+	Expression string
+	Reason     string
+}
+
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("invalid policy expression %q: %s", e.Expression, e.Reason)
+}
+
+// key identifies a policy across namespaces.
+type key struct {
+	namespace string
+	id        string
+}
+
+// compiled is a policy along with its program.
+type compiled struct {
+	PolicyInfo
+	program cel.Program
+}
+
+type inmemPolicy struct {
+	mtx      sync.RWMutex
+	policies map[key]compiled
+	env      *cel.Env
+}
+
+// NewInmemPolicy returns a Policy that keeps its policies in memory. They
+// are compiled when written and the programs kept for every evaluation.
+func NewInmemPolicy() Policy {
+	env, err := cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.Variable("oldObject", cel.DynType),
+		cel.Variable("resource", cel.StringType),
+		cel.Variable("operation", cel.StringType),
+		cel.Variable("namespace", cel.StringType),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return &inmemPolicy{
+		policies: map[key]compiled{},
+		env:      env,
+	}
+}
+
+func (s *inmemPolicy) PostPolicyInfo(ctx context.Context, p PolicyInfo) error {
+	p.Namespace = namespace.FromContext(ctx)
+	c, err := s.compile(p)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: p.Namespace, id: p.ID}
+	if _, ok := s.policies[k]; ok {
+		return ErrAlreadyExists
+	}
+
+	currentTime := time.Now()
+	c.CreatedAt = currentTime
+	c.UpdatedAt = currentTime
+
+	s.policies[k] = c
+	return nil
+}
+
+func (s *inmemPolicy) GetPolicyInfo(ctx context.Context, id string) (PolicyInfo, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	c, ok := s.policies[key{namespace: namespace.FromContext(ctx), id: id}]
+	if !ok {
+		return PolicyInfo{}, ErrNotFound
+	}
+	return c.PolicyInfo, nil
+}
+
+func (s *inmemPolicy) PutPolicyInfo(ctx context.Context, id string, p PolicyInfo) error {
+	if id != p.ID {
+		return ErrInconsistentIDs
+	}
+	p.Namespace = namespace.FromContext(ctx)
+	c, err := s.compile(p)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: p.Namespace, id: id}
+	c.UpdatedAt = time.Now()
+	c.CreatedAt = c.UpdatedAt
+	if last, ok := s.policies[k]; ok {
+		c.CreatedAt = last.CreatedAt
+	}
+
+	s.policies[k] = c
+	return nil
+}
+
+func (s *inmemPolicy) DeletePolicyInfo(ctx context.Context, id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: namespace.FromContext(ctx), id: id}
+	if _, ok := s.policies[k]; !ok {
+		return ErrNotFound
+	}
+	delete(s.policies, k)
+	return nil
+}
+
+func (s *inmemPolicy) ListPolicyInfo(ctx context.Context) ([]PolicyInfo, error) {
+	ns := namespace.FromContext(ctx)
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []PolicyInfo{}
+	for _, c := range s.policies {
+		if c.Namespace == ns {
+			list = append(list, c.PolicyInfo)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// Evaluate returns the policies of the input's namespace that it
+// violates, in ID order. An empty result allows the write.
+func (s *inmemPolicy) Evaluate(ctx context.Context, in Input) ([]Violation, error) {
+	if in.Namespace == "" {
+		in.Namespace = namespace.FromContext(ctx)
+	}
+	var policies []compiled
+	s.mtx.RLock()
+	for _, c := range s.policies {
+		if c.Namespace == in.Namespace && c.match(in) {
+			policies = append(policies, c)
+		}
+	}
+	s.mtx.RUnlock()
+	sort.Slice(policies, func(i, j int) bool { return policies[i].ID < policies[j].ID })
+
+	violations := []Violation{}
+	for _, c := range policies {
+		if v, ok := c.eval(ctx, in); !ok {
+			violations = append(violations, v)
+		}
+	}
+	return violations, nil
+}
+
+// DryRun evaluates a policy against the inputs of r without storing
+// anything.
+func (s *inmemPolicy) DryRun(ctx context.Context, r DryRunRequest) (DryRunResult, error) {
+	var c compiled
+	switch {
+	case r.PolicyID != "" && r.Policy == nil:
+		s.mtx.RLock()
+		var ok bool
+		c, ok = s.policies[key{namespace: namespace.FromContext(ctx), id: r.PolicyID}]
+		s.mtx.RUnlock()
+		if !ok {
+			return DryRunResult{}, ErrNotFound
+		}
+	case r.PolicyID == "" && r.Policy != nil:
+		p := *r.Policy
+		p.Namespace = namespace.FromContext(ctx)
+		var err error
+		if c, err = s.compile(p); err != nil {
+			return DryRunResult{}, err
+		}
+	default:
+		return DryRunResult{}, ErrInvalidDryRun
+	}
+
+	result := DryRunResult{Violations: []Violation{}}
+	for _, in := range r.Inputs {
+		if len(c.Resources) > 0 && !contains(c.Resources, in.Resource) {
+			continue
+		}
+		result.Evaluated++
+		if v, ok := c.eval(ctx, in); !ok {
+			result.Violations = append(result.Violations, v)
+		}
+	}
+	return result, nil
+}
+
+// compile validates p and compiles its expression.
+func (s *inmemPolicy) compile(p PolicyInfo) (compiled, error) {
+	if p.ID == "" || p.Expression == "" {
+		return compiled{}, ErrInvalidPolicy
+	}
+	for _, r := range p.Resources {
+		if r != ResourceHost && r != ResourceService {
+			return compiled{}, ErrInvalidPolicy
+		}
+	}
+	for _, op := range p.Operations {
+		if op != OpCreate && op != OpUpdate {
+			return compiled{}, ErrInvalidPolicy
+		}
+	}
+	ast, iss := s.env.Compile(p.Expression)
+	if iss.Err() != nil {
+		return compiled{}, &ExpressionError{Expression: p.Expression, Reason: iss.Err().Error()}
+	}
+	if t := ast.OutputType(); t != cel.BoolType && t != cel.DynType {
+		return compiled{}, &ExpressionError{Expression: p.Expression, Reason: "evaluates to " + t.String() + ", not bool"}
+	}
+	program, err := s.env.Program(ast, cel.CostLimit(maxCost), cel.InterruptCheckFrequency(100))
+	if err != nil {
+		return compiled{}, &ExpressionError{Expression: p.Expression, Reason: err.Error()}
+	}
+	return compiled{PolicyInfo: p, program: program}, nil
+}
+
+// eval reports whether in satisfies c, and the violation if it does not.
+func (c compiled) eval(ctx context.Context, in Input) (Violation, bool) {
+	v := Violation{PolicyID: c.ID, Resource: in.Resource, ObjectID: in.ObjectID, Message: c.message()}
+	vars := map[string]interface{}{
+		"resource":  in.Resource,
+		"operation": in.Operation,
+		"namespace": in.Namespace,
+		"oldObject": nil,
+	}
+	var object, oldObject interface{}
+	if err := json.Unmarshal(in.Object, &object); err != nil {
+		v.Error = err.Error()
+		return v, false
+	}
+	vars["object"] = object
+	if len(in.OldObject) > 0 {
+		if err := json.Unmarshal(in.OldObject, &oldObject); err != nil {
+			v.Error = err.Error()
+			return v, false
+		}
+		vars["oldObject"] = oldObject
+	}
+
+	out, _, err := c.program.ContextEval(ctx, vars)
+	if err != nil {
+		v.Error = err.Error()
+		return v, false
+	}
+	allowed, ok := out.Value().(bool)
+	if !ok {
+		v.Error = fmt.Sprintf("expression evaluated to %v, not bool", out.Value())
+		return v, false
+	}
+	return v, allowed
+}
@@ -0,0 +1,141 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+func TestCompile(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name string
+		p    PolicyInfo
+		want string // "" for no error, "expression" for an *ExpressionError, or the error text
+	}{
+		{"valid", PolicyInfo{ID: "p", Expression: `object.datacenter != ""`}, ""},
+		{"dynamic result", PolicyInfo{ID: "p", Expression: `object.enabled`}, ""},
+		{"syntax error", PolicyInfo{ID: "p", Expression: `object.datacenter ==`}, "expression"},
+		{"undeclared variable", PolicyInfo{ID: "p", Expression: `host.datacenter != ""`}, "expression"},
+		{"not a bool", PolicyInfo{ID: "p", Expression: `resource + "x"`}, "expression"},
+		{"no expression", PolicyInfo{ID: "p"}, ErrInvalidPolicy.Error()},
+		{"unknown resource", PolicyInfo{ID: "p", Expression: "true", Resources: []string{"rack"}}, ErrInvalidPolicy.Error()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := NewInmemPolicy().PostPolicyInfo(ctx, tc.p)
+			switch {
+			case tc.want == "":
+				if err != nil {
+					t.Fatalf("got %v, want no error", err)
+				}
+			case tc.want == "expression":
+				if _, ok := err.(*ExpressionError); !ok {
+					t.Fatalf("got %v, want an expression error", err)
+				}
+			case err == nil || err.Error() != tc.want:
+				t.Fatalf("got %v, want %s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	ctx := context.Background()
+	s := NewInmemPolicy()
+	for _, p := range []PolicyInfo{
+		{ID: "datacenter", Resources: []string{ResourceHost}, Expression: `object.datacenter != ""`, Message: "hosts need a datacenter"},
+		{ID: "immutable-rack", Resources: []string{ResourceHost}, Operations: []string{OpUpdate}, Expression: `oldObject.rack == "" || object.rack == oldObject.rack`},
+		{ID: "owner", Resources: []string{ResourceService}, Expression: `has(object.labels) && "owner" in object.labels`},
+	} {
+		if err := s.PostPolicyInfo(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		in   Input
+		want []string // IDs of the violated policies
+	}{
+		{"host satisfies", Input{Resource: ResourceHost, Operation: OpCreate, Object: json.RawMessage(`{"datacenter":"dc1"}`)}, nil},
+		{"host without datacenter", Input{Resource: ResourceHost, Operation: OpCreate, Object: json.RawMessage(`{"datacenter":""}`)}, []string{"datacenter"}},
+		{"rack moved", Input{Resource: ResourceHost, Operation: OpUpdate, Object: json.RawMessage(`{"datacenter":"dc1","rack":"r2"}`), OldObject: json.RawMessage(`{"rack":"r1"}`)}, []string{"immutable-rack"}},
+		{"rack set on create", Input{Resource: ResourceHost, Operation: OpCreate, Object: json.RawMessage(`{"datacenter":"dc1","rack":"r2"}`)}, nil},
+		{"service without labels", Input{Resource: ResourceService, Operation: OpCreate, Object: json.RawMessage(`{}`)}, []string{"owner"}},
+		{"service with owner", Input{Resource: ResourceService, Operation: OpCreate, Object: json.RawMessage(`{"labels":{"owner":"infra"}}`)}, nil},
+		{"missing field is an error", Input{Resource: ResourceHost, Operation: OpCreate, Object: json.RawMessage(`{}`)}, []string{"datacenter"}},
+		{"other namespace", Input{Namespace: "other", Resource: ResourceHost, Operation: OpCreate, Object: json.RawMessage(`{}`)}, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			violations, err := s.Evaluate(ctx, tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(violations) != len(tc.want) {
+				t.Fatalf("violations %+v, want %v", violations, tc.want)
+			}
+			for i, v := range violations {
+				if v.PolicyID != tc.want[i] {
+					t.Fatalf("violations %+v, want %v", violations, tc.want)
+				}
+			}
+		})
+	}
+
+	violations, _ := s.Evaluate(ctx, Input{Resource: ResourceHost, Operation: OpCreate, Object: json.RawMessage(`{}`)})
+	if v := violations[0]; v.Error == "" || v.Message != "hosts need a datacenter" {
+		t.Fatalf("violation %+v: want the message and the evaluation error", v)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	ctx := context.Background()
+	hosts := host.NewInmemHost()
+	services := service.NewInmemService()
+	for _, h := range []host.HostInfo{{ID: "a", DataCenter: "dc1"}, {ID: "b"}} {
+		if err := hosts.PostHostInfo(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := services.PostServiceInfo(ctx, service.ServiceInfo{ID: "s", HostID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	s := InventoryMiddleware(hosts, services)(NewInmemPolicy())
+	stored := PolicyInfo{ID: "datacenter", Resources: []string{ResourceHost}, Operations: []string{OpCreate}, Expression: `object.datacenter != ""`}
+	if err := s.PostPolicyInfo(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name       string
+		r          DryRunRequest
+		err        error
+		evaluated  int
+		violations []string // IDs of the violating objects
+	}{
+		{"stored policy against the inventory", DryRunRequest{PolicyID: "datacenter"}, nil, 2, []string{"b"}},
+		{"unstored policy against the inventory", DryRunRequest{Policy: &PolicyInfo{ID: "x", Expression: `resource == "host"`}}, nil, 3, []string{"s"}},
+		{"given inputs", DryRunRequest{PolicyID: "datacenter", Inputs: []Input{{Resource: ResourceHost, ObjectID: "c", Object: json.RawMessage(`{"datacenter":""}`)}}}, nil, 1, []string{"c"}},
+		{"unknown policy", DryRunRequest{PolicyID: "nope"}, ErrNotFound, 0, nil},
+		{"policy and ID", DryRunRequest{PolicyID: "datacenter", Policy: &stored}, ErrInvalidDryRun, 0, nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := s.DryRun(ctx, tc.r)
+			if err != tc.err {
+				t.Fatalf("got %v, want %v", err, tc.err)
+			}
+			if result.Evaluated != tc.evaluated || len(result.Violations) != len(tc.violations) {
+				t.Fatalf("result %+v, want %d evaluated and violations by %v", result, tc.evaluated, tc.violations)
+			}
+			for i, v := range result.Violations {
+				if v.ObjectID != tc.violations[i] {
+					t.Fatalf("result %+v, want violations by %v", result, tc.violations)
+				}
+			}
+		})
+	}
+	if list, _ := s.ListPolicyInfo(ctx); len(list) != 1 {
+		t.Fatalf("policies %+v: a dry run stored its policy", list)
+	}
+}
@@ -0,0 +1,164 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+)
+
+func MakeHTTPHandler(s Policy, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext),
+	}
+
+	for _, prefix := range []string{"/policy/v1", "/policy/v1/namespaces/{ns}"} {
+		r.Methods("POST").Path(prefix + "/policies/").Handler(httptransport.NewServer(
+			e.PostPolicyInfoEndpoint,
+			decodePostPolicyInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/policies/").Handler(httptransport.NewServer(
+			e.ListPolicyInfoEndpoint,
+			decodeListPolicyInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/policies/{id}").Handler(httptransport.NewServer(
+			e.GetPolicyInfoEndpoint,
+			decodeGetPolicyInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("PUT").Path(prefix + "/policies/{id}").Handler(httptransport.NewServer(
+			e.PutPolicyInfoEndpoint,
+			decodePutPolicyInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("DELETE").Path(prefix + "/policies/{id}").Handler(httptransport.NewServer(
+			e.DeletePolicyInfoEndpoint,
+			decodeDeletePolicyInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("POST").Path(prefix + "/dryrun").Handler(httptransport.NewServer(
+			e.DryRunEndpoint,
+			decodeDryRunRequest,
+			encodeResponse,
+			options...,
+		))
+	}
+	return r
+}
+
+func decodePostPolicyInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req postPolicyInfoRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.PolicyInfo); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeGetPolicyInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getPolicyInfoRequest{ID: id}, nil
+}
+
+func decodePutPolicyInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var p PolicyInfo
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		return nil, err
+	}
+	return putPolicyInfoRequest{
+		ID:         id,
+		PolicyInfo: p,
+	}, nil
+}
+
+func decodeDeletePolicyInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return deletePolicyInfoRequest{ID: id}, nil
+}
+
+func decodeListPolicyInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return listPolicyInfoRequest{}, nil
+}
+
+// decodeDryRunRequest reads a DryRunRequest. Inputs always belong to the
+// namespace of the route.
+func decodeDryRunRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req dryRunRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.DryRunRequest); e != nil {
+		return nil, e
+	}
+	for i := range req.DryRunRequest.Inputs {
+		req.DryRunRequest.Inputs[i].Namespace = ""
+	}
+	return req, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	if _, ok := err.(*ExpressionError); ok {
+		return http.StatusBadRequest
+	}
+	switch err {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrAlreadyExists, ErrInconsistentIDs, ErrInvalidPolicy, ErrInvalidDryRun:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
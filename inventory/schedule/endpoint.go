@@ -0,0 +1,118 @@
+package schedule
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	PostBookingEndpoint   endpoint.Endpoint
+	GetBookingEndpoint    endpoint.Endpoint
+	PutBookingEndpoint    endpoint.Endpoint
+	DeleteBookingEndpoint endpoint.Endpoint
+	ListBookingsEndpoint  endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Schedule) Endpoints {
+	return Endpoints{
+		PostBookingEndpoint:   MakePostBookingEndpoint(s),
+		GetBookingEndpoint:    MakeGetBookingEndpoint(s),
+		PutBookingEndpoint:    MakePutBookingEndpoint(s),
+		DeleteBookingEndpoint: MakeDeleteBookingEndpoint(s),
+		ListBookingsEndpoint:  MakeListBookingsEndpoint(s),
+	}
+}
+
+func MakePostBookingEndpoint(s Schedule) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(postBookingRequest)
+		e := s.PostBooking(ctx, req.Booking)
+		return postBookingResponse{Err: e}, nil
+	}
+}
+
+func MakeGetBookingEndpoint(s Schedule) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getBookingRequest)
+		b, e := s.GetBooking(ctx, req.ID)
+		return getBookingResponse{Booking: b, Err: e}, nil
+	}
+}
+
+func MakePutBookingEndpoint(s Schedule) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putBookingRequest)
+		e := s.PutBooking(ctx, req.ID, req.Booking)
+		return putBookingResponse{Err: e}, nil
+	}
+}
+
+func MakeDeleteBookingEndpoint(s Schedule) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteBookingRequest)
+		e := s.DeleteBooking(ctx, req.ID)
+		return deleteBookingResponse{Err: e}, nil
+	}
+}
+
+func MakeListBookingsEndpoint(s Schedule) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listBookingsRequest)
+		list, e := s.ListBookings(ctx, req.Filter)
+		return listBookingsResponse{Bookings: list, Err: e}, nil
+	}
+}
+
+type postBookingRequest struct {
+	Booking Booking
+}
+
+type postBookingResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r postBookingResponse) error() error { return r.Err }
+
+type getBookingRequest struct {
+	ID string
+}
+
+type getBookingResponse struct {
+	Booking Booking `json:"booking"`
+	Err     error   `json:"err,omitempty"`
+}
+
+func (r getBookingResponse) error() error { return r.Err }
+
+type putBookingRequest struct {
+	ID      string
+	Booking Booking
+}
+
+type putBookingResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r putBookingResponse) error() error { return r.Err }
+
+type deleteBookingRequest struct {
+	ID string
+}
+
+type deleteBookingResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r deleteBookingResponse) error() error { return r.Err }
+
+type listBookingsRequest struct {
+	Filter BookingFilter
+}
+
+type listBookingsResponse struct {
+	Bookings []Booking `json:"bookings"`
+	Err      error     `json:"err,omitempty"`
+}
+
+func (r listBookingsResponse) error() error { return r.Err }
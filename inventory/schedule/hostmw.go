@@ -0,0 +1,63 @@
+package schedule
+
+import (
+	"context"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+// HostMiddleware only books hosts that exist, and gives a host back its
+// normal status when a booking is deleted while active.
+func HostMiddleware(hosts host.Host) Middleware {
+	return func(next Schedule) Schedule {
+		return &hostMiddleware{
+			Schedule: next,
+			hosts:    hosts,
+		}
+	}
+}
+
+type hostMiddleware struct {
+	Schedule
+	hosts host.Host
+}
+
+func (mw hostMiddleware) PostBooking(ctx context.Context, b Booking) error {
+	if err := mw.checkHost(ctx, b.HostID); err != nil {
+		return err
+	}
+	return mw.Schedule.PostBooking(ctx, b)
+}
+
+func (mw hostMiddleware) PutBooking(ctx context.Context, id string, b Booking) error {
+	if err := mw.checkHost(ctx, b.HostID); err != nil {
+		return err
+	}
+	return mw.Schedule.PutBooking(ctx, id, b)
+}
+
+func (mw hostMiddleware) DeleteBooking(ctx context.Context, id string) error {
+	b, err := mw.Schedule.GetBooking(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := mw.Schedule.DeleteBooking(ctx, id); err != nil {
+		return err
+	}
+	if b.State == BookingActive {
+		if err := setHostStatus(ctx, mw.hosts, b, false); err != nil && err != host.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mw hostMiddleware) checkHost(ctx context.Context, hostID string) error {
+	_, err := mw.hosts.GetHostInfo(ctx, hostID)
+	switch err {
+	case nil, host.ErrUnknownNamespace:
+		return err
+	default:
+		return ErrUnknownHost
+	}
+}
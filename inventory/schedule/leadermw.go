@@ -0,0 +1,50 @@
+package schedule
+
+import (
+	"context"
+)
+
+// LeaderMiddleware refuses to write bookings unless leading reports true.
+// In a cluster, bookings are kept in the memory of a node and moved along
+// by the scheduler of the leader only, so they are made on the leader.
+func LeaderMiddleware(leading func() bool) Middleware {
+	return func(next Schedule) Schedule {
+		return &leaderMiddleware{
+			Schedule: next,
+			leading:  leading,
+		}
+	}
+}
+
+type leaderMiddleware struct {
+	Schedule
+	leading func() bool
+}
+
+func (mw leaderMiddleware) PostBooking(ctx context.Context, b Booking) error {
+	if !mw.leading() {
+		return ErrNotLeader
+	}
+	return mw.Schedule.PostBooking(ctx, b)
+}
+
+func (mw leaderMiddleware) PutBooking(ctx context.Context, id string, b Booking) error {
+	if !mw.leading() {
+		return ErrNotLeader
+	}
+	return mw.Schedule.PutBooking(ctx, id, b)
+}
+
+func (mw leaderMiddleware) DeleteBooking(ctx context.Context, id string) error {
+	if !mw.leading() {
+		return ErrNotLeader
+	}
+	return mw.Schedule.DeleteBooking(ctx, id)
+}
+
+func (mw leaderMiddleware) PutBookingState(ctx context.Context, id string, s BookingState) error {
+	if !mw.leading() {
+		return ErrNotLeader
+	}
+	return mw.Schedule.PutBookingState(ctx, id, s)
+}
@@ -0,0 +1,68 @@
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Middleware func(Schedule) Schedule
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Schedule) Schedule {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Schedule
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) PostBooking(ctx context.Context, b Booking) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostBooking", "namespace", namespace.FromContext(ctx), "id", b.ID, "hostid", b.HostID, "kind", b.Kind, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostBooking(ctx, b)
+}
+
+func (mw loggingMiddleware) GetBooking(ctx context.Context, id string) (b Booking, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetBooking", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetBooking(ctx, id)
+}
+
+func (mw loggingMiddleware) PutBooking(ctx context.Context, id string, b Booking) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutBooking", "namespace", namespace.FromContext(ctx), "id", id, "hostid", b.HostID, "kind", b.Kind, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutBooking(ctx, id, b)
+}
+
+func (mw loggingMiddleware) DeleteBooking(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteBooking", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteBooking(ctx, id)
+}
+
+func (mw loggingMiddleware) ListBookings(ctx context.Context, f BookingFilter) (list []Booking, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListBookings", "namespace", namespace.FromContext(ctx), "hostid", f.HostID, "kind", f.Kind, "state", f.State, "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListBookings(ctx, f)
+}
+
+func (mw loggingMiddleware) PutBookingState(ctx context.Context, id string, s BookingState) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutBookingState", "namespace", namespace.FromContext(ctx), "id", id, "state", s, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutBookingState(ctx, id, s)
+}
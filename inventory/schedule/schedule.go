@@ -0,0 +1,247 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Schedule interface {
+	PostBooking(ctx context.Context, b Booking) error
+	GetBooking(ctx context.Context, id string) (Booking, error)
+	PutBooking(ctx context.Context, id string, b Booking) error
+	DeleteBooking(ctx context.Context, id string) error
+	ListBookings(ctx context.Context, f BookingFilter) ([]Booking, error)
+	PutBookingState(ctx context.Context, id string, s BookingState) error
+}
+
+// Booking kinds.
+const (
+	KindMaintenance = "maintenance"
+	KindReservation = "reservation"
+)
+
+type BookingState string
+
+// A booking is scheduled until its window starts, active during the window
+// and completed once it has ended. The Scheduler moves bookings from one
+// state to the next.
+const (
+	BookingScheduled BookingState = "scheduled"
+	BookingActive    BookingState = "active"
+	BookingCompleted BookingState = "completed"
+)
+
+// Booking books a host of its namespace from Start to End, either for
+// maintenance or as a reservation for Owner. While a booking is active the
+// host is in maintenance, or reserved for Owner.
+type Booking struct {
+	ID        string       `json:"id"`
+	Namespace string       `json:"namespace"`
+	HostID    string       `json:"hostid"`
+	Kind      string       `json:"kind"`
+	Owner     string       `json:"owner,omitempty"`
+	Start     time.Time    `json:"start"`
+	End       time.Time    `json:"end"`
+	State     BookingState `json:"state"`
+	CreatedAt time.Time    `json:"createtime"`
+	UpdatedAt time.Time    `json:"updatetime"`
+	Remark    string       `json:"remark"`
+}
+
+// BookingFilter selects bookings in ListBookings. Empty fields match every
+// booking.
+type BookingFilter struct {
+	HostID string
+	Kind   string
+	State  BookingState
+}
+
+func (f BookingFilter) match(b Booking) bool {
+	if f.HostID != "" && f.HostID != b.HostID {
+		return false
+	}
+	if f.Kind != "" && f.Kind != b.Kind {
+		return false
+	}
+	if f.State != "" && f.State != b.State {
+		return false
+	}
+	return true
+}
+
+var (
+	ErrInconsistentIDs = errors.New("inconsistent IDs")
+	ErrAlreadyExists   = errors.New("already exists")
+	ErrNotFound        = errors.New("not found")
+	ErrInvalidBooking  = errors.New("invalid booking")
+	ErrOverlap         = errors.New("booking overlaps another booking of the host")
+	ErrStarted         = errors.New("booking has already started")
+	ErrUnknownHost     = errors.New("unknown host")
+	ErrNotLeader       = errors.New("bookings are kept by the cluster leader")
+)
+
+// key identifies a booking across namespaces.
+type key struct {
+	namespace string
+	id        string
+}
+
+type inmemSchedule struct {
+	mtx sync.RWMutex
+	m   map[key]Booking
+}
+
+func NewInmemSchedule() Schedule {
+	return &inmemSchedule{
+		m: map[key]Booking{},
+	}
+}
+
+func (s *inmemSchedule) PostBooking(ctx context.Context, b Booking) error {
+	b.Namespace = namespace.FromContext(ctx)
+	if err := b.validate(); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: b.Namespace, id: b.ID}
+	if _, ok := s.m[k]; ok {
+		return ErrAlreadyExists
+	}
+	if err := s.checkOverlap(b); err != nil {
+		return err
+	}
+
+	currentTime := time.Now()
+	b.CreatedAt = currentTime
+	b.UpdatedAt = currentTime
+	b.State = BookingScheduled
+
+	s.m[k] = b
+	return nil
+}
+
+func (s *inmemSchedule) GetBooking(ctx context.Context, id string) (Booking, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	b, ok := s.m[key{namespace: namespace.FromContext(ctx), id: id}]
+	if !ok {
+		return Booking{}, ErrNotFound
+	}
+	return b, nil
+}
+
+// PutBooking creates or reschedules a booking. A booking that has started
+// can no longer be changed, only deleted.
+func (s *inmemSchedule) PutBooking(ctx context.Context, id string, b Booking) error {
+	if id != b.ID {
+		return ErrInconsistentIDs
+	}
+	b.Namespace = namespace.FromContext(ctx)
+	if err := b.validate(); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: b.Namespace, id: id}
+	b.UpdatedAt = time.Now()
+	b.CreatedAt = b.UpdatedAt
+	if last, ok := s.m[k]; ok {
+		if last.State != BookingScheduled {
+			return ErrStarted
+		}
+		b.CreatedAt = last.CreatedAt
+	}
+	if err := s.checkOverlap(b); err != nil {
+		return err
+	}
+	b.State = BookingScheduled
+
+	s.m[k] = b
+	return nil
+}
+
+func (s *inmemSchedule) DeleteBooking(ctx context.Context, id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: namespace.FromContext(ctx), id: id}
+	if _, ok := s.m[k]; !ok {
+		return ErrNotFound
+	}
+	delete(s.m, k)
+	return nil
+}
+
+// ListBookings returns the bookings of the namespace of ctx, or of every
+// namespace, by start time.
+func (s *inmemSchedule) ListBookings(ctx context.Context, f BookingFilter) ([]Booking, error) {
+	ns := namespace.FromContext(ctx)
+	all := namespace.IsAll(ctx)
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []Booking{}
+	for _, b := range s.m {
+		if (all || b.Namespace == ns) && f.match(b) {
+			list = append(list, b)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Start.Equal(list[j].Start) {
+			return list[i].Start.Before(list[j].Start)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+func (s *inmemSchedule) PutBookingState(ctx context.Context, id string, st BookingState) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: namespace.FromContext(ctx), id: id}
+	b, ok := s.m[k]
+	if !ok {
+		return ErrNotFound
+	}
+	b.State = st
+	b.UpdatedAt = time.Now()
+	s.m[k] = b
+	return nil
+}
+
+func (b Booking) validate() error {
+	if b.ID == "" || b.HostID == "" || !b.End.After(b.Start) {
+		return ErrInvalidBooking
+	}
+	switch b.Kind {
+	case KindMaintenance:
+		if b.Owner != "" {
+			return ErrInvalidBooking
+		}
+	case KindReservation:
+		if b.Owner == "" {
+			return ErrInvalidBooking
+		}
+	default:
+		return ErrInvalidBooking
+	}
+	return nil
+}
+
+// checkOverlap rejects b if its window overlaps that of another booking of
+// the same host that has not completed.
+func (s *inmemSchedule) checkOverlap(b Booking) error {
+	for _, other := range s.m {
+		if other.Namespace != b.Namespace || other.HostID != b.HostID || other.ID == b.ID || other.State == BookingCompleted {
+			continue
+		}
+		if b.Start.Before(other.End) && other.Start.Before(b.End) {
+			return ErrOverlap
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// Scheduler starts and ends bookings as time passes: it puts a host in
+// maintenance, or reserves it, when a booking starts, and clears that
+// status when the booking ends.
+type Scheduler struct {
+	schedule Schedule
+	store    Schedule
+	hosts    host.Host
+	logger   log.Logger
+}
+
+// NewScheduler returns a scheduler that moves bookings along through s.
+// The bookings are polled every second from store, the store behind s, so
+// that an idle scheduler is not logged.
+func NewScheduler(s, store Schedule, hosts host.Host, logger log.Logger) *Scheduler {
+	return &Scheduler{
+		schedule: s,
+		store:    store,
+		hosts:    hosts,
+		logger:   logger,
+	}
+}
+
+// Run moves bookings along until ctx is cancelled.
+func (c *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.tick(ctx, now)
+		}
+	}
+}
+
+// tick moves every booking whose window has started or ended to its next
+// state. A host update that fails is retried on the next tick; a host that
+// no longer exists does not hold the booking back.
+func (c *Scheduler) tick(ctx context.Context, now time.Time) {
+	list, err := c.store.ListBookings(namespace.AllNamespaces(ctx), BookingFilter{})
+	if err != nil {
+		c.logger.Log("err", err)
+		return
+	}
+	for _, b := range list {
+		var next BookingState
+		err = nil
+		switch {
+		case b.State != BookingCompleted && !now.Before(b.End):
+			next = BookingCompleted
+			if b.State == BookingActive {
+				err = setHostStatus(ctx, c.hosts, b, false)
+			}
+		case b.State == BookingScheduled && !now.Before(b.Start):
+			next = BookingActive
+			err = setHostStatus(ctx, c.hosts, b, true)
+		default:
+			continue
+		}
+		if err != nil && err != host.ErrNotFound {
+			c.logger.Log("namespace", b.Namespace, "booking", b.ID, "host", b.HostID, "err", err)
+			continue
+		}
+		if err := c.schedule.PutBookingState(namespace.NewContext(ctx, b.Namespace), b.ID, next); err != nil {
+			if err != ErrNotFound {
+				c.logger.Log("namespace", b.Namespace, "booking", b.ID, "err", err)
+			}
+			continue
+		}
+		c.logger.Log("namespace", b.Namespace, "booking", b.ID, "host", b.HostID, "state", next)
+	}
+}
+
+// setHostStatus gives the host of b the status of an active booking of its
+// kind or, if active is false, clears it. A status that no longer is the
+// one b set is left alone. Only the scheduler writes host statuses: other
+// updates keep them.
+func setHostStatus(ctx context.Context, hosts host.Host, b Booking, active bool) error {
+	hctx := namespace.NewContext(ctx, b.Namespace)
+	h, err := hosts.GetHostInfo(hctx, b.HostID)
+	if err != nil {
+		return err
+	}
+	status, owner := host.StatusMaintenance, ""
+	if b.Kind == KindReservation {
+		status, owner = host.StatusReserved, b.Owner
+	}
+	if active {
+		h.Status, h.ReservedBy = status, owner
+	} else {
+		if h.Status != status || h.ReservedBy != owner {
+			return nil
+		}
+		h.Status, h.ReservedBy = "", ""
+	}
+	results, err := hosts.BatchHostInfo(host.NewManagedContext(hctx), host.Batch{Ops: []host.HostOp{{Op: host.OpUpdate, HostInfo: h, IfVersion: h.Version}}})
+	if err != nil && len(results) == 1 && results[0].Err != nil {
+		return results[0].Err
+	}
+	return err
+}
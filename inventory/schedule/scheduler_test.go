@@ -0,0 +1,93 @@
+package schedule
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+func TestTick(t *testing.T) {
+	start := time.Now().Add(time.Hour)
+	end := start.Add(time.Hour)
+	for _, tc := range []struct {
+		name   string
+		kind   string
+		owner  string
+		ticks  []time.Time
+		change func(ctx context.Context, hosts host.Host) error // between the ticks
+		state  BookingState
+		status string
+		by     string
+	}{
+		{name: "not started", kind: KindMaintenance, ticks: []time.Time{start.Add(-time.Second)}, state: BookingScheduled},
+		{name: "maintenance starts", kind: KindMaintenance, ticks: []time.Time{start}, state: BookingActive, status: host.StatusMaintenance},
+		{name: "reservation starts", kind: KindReservation, owner: "me", ticks: []time.Time{start}, state: BookingActive, status: host.StatusReserved, by: "me"},
+		{name: "ends", kind: KindReservation, owner: "me", ticks: []time.Time{start, end}, state: BookingCompleted},
+		{name: "ends unstarted", kind: KindMaintenance, ticks: []time.Time{end}, state: BookingCompleted},
+		{
+			name:  "host deleted",
+			kind:  KindMaintenance,
+			ticks: []time.Time{start, end},
+			change: func(ctx context.Context, hosts host.Host) error {
+				return hosts.DeleteHostInfo(ctx, "h1")
+			},
+			state: BookingCompleted,
+		},
+		{
+			name:  "status changed by someone else",
+			kind:  KindMaintenance,
+			ticks: []time.Time{start, end},
+			change: func(ctx context.Context, hosts host.Host) error {
+				return hosts.PutHostInfo(host.NewManagedContext(ctx), "h1", host.HostInfo{ID: "h1", Status: host.StatusReserved, ReservedBy: "you"})
+			},
+			state:  BookingCompleted,
+			status: host.StatusReserved,
+			by:     "you",
+		},
+		{
+			name:  "update other than the scheduler's",
+			kind:  KindMaintenance,
+			ticks: []time.Time{start, end},
+			change: func(ctx context.Context, hosts host.Host) error {
+				return hosts.PutHostInfo(ctx, "h1", host.HostInfo{ID: "h1", Name: "web1"})
+			},
+			state: BookingCompleted,
+		},
+	} {
+		ctx := context.Background()
+		hosts, bookings := host.NewInmemHost(), NewInmemSchedule()
+		if err := hosts.PostHostInfo(ctx, host.HostInfo{ID: "h1"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := bookings.PostBooking(ctx, Booking{ID: "b1", HostID: "h1", Kind: tc.kind, Owner: tc.owner, Start: start, End: end}); err != nil {
+			t.Fatal(err)
+		}
+		c := NewScheduler(bookings, bookings, hosts, log.NewNopLogger())
+		for i, now := range tc.ticks {
+			if i == 1 && tc.change != nil {
+				if err := tc.change(ctx, hosts); err != nil {
+					t.Fatal(err)
+				}
+			}
+			c.tick(ctx, now)
+		}
+
+		if b, _ := bookings.GetBooking(ctx, "b1"); b.State != tc.state {
+			t.Errorf("%s: got booking %s, want %s", tc.name, b.State, tc.state)
+		}
+		h, err := hosts.GetHostInfo(ctx, "h1")
+		if err == host.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Status != tc.status || h.ReservedBy != tc.by {
+			t.Errorf("%s: got host status %q by %q, want %q by %q", tc.name, h.Status, h.ReservedBy, tc.status, tc.by)
+		}
+	}
+}
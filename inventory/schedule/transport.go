@@ -0,0 +1,155 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+)
+
+func MakeHTTPHandler(s Schedule, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext),
+	}
+
+	for _, prefix := range []string{"/schedule/v1", "/schedule/v1/namespaces/{ns}"} {
+		r.Methods("POST").Path(prefix + "/bookings/").Handler(httptransport.NewServer(
+			e.PostBookingEndpoint,
+			decodePostBookingRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/bookings/").Handler(httptransport.NewServer(
+			e.ListBookingsEndpoint,
+			decodeListBookingsRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/bookings/{id}").Handler(httptransport.NewServer(
+			e.GetBookingEndpoint,
+			decodeGetBookingRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("PUT").Path(prefix + "/bookings/{id}").Handler(httptransport.NewServer(
+			e.PutBookingEndpoint,
+			decodePutBookingRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("DELETE").Path(prefix + "/bookings/{id}").Handler(httptransport.NewServer(
+			e.DeleteBookingEndpoint,
+			decodeDeleteBookingRequest,
+			encodeResponse,
+			options...,
+		))
+	}
+	return r
+}
+
+func decodePostBookingRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req postBookingRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Booking); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeGetBookingRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getBookingRequest{ID: id}, nil
+}
+
+func decodePutBookingRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var b Booking
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		return nil, err
+	}
+	return putBookingRequest{
+		ID:      id,
+		Booking: b,
+	}, nil
+}
+
+func decodeDeleteBookingRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return deleteBookingRequest{ID: id}, nil
+}
+
+func decodeListBookingsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	return listBookingsRequest{Filter: BookingFilter{
+		HostID: q.Get("hostid"),
+		Kind:   q.Get("kind"),
+		State:  BookingState(q.Get("state")),
+	}}, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	switch err {
+	case ErrNotFound, ErrUnknownHost, host.ErrUnknownNamespace:
+		return http.StatusNotFound
+	case ErrAlreadyExists, ErrInconsistentIDs, ErrInvalidBooking:
+		return http.StatusBadRequest
+	case ErrOverlap, ErrStarted, host.ErrConditionFailed, host.ErrVersionConflict:
+		return http.StatusConflict
+	case ErrNotLeader:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
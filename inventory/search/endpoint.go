@@ -0,0 +1,36 @@
+package search
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	SearchEndpoint endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Searcher) Endpoints {
+	return Endpoints{
+		SearchEndpoint: MakeSearchEndpoint(s),
+	}
+}
+
+func MakeSearchEndpoint(s Searcher) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(searchRequest)
+		r, e := s.Search(ctx, req.Query)
+		return searchResponse{Results: r, Err: e}, nil
+	}
+}
+
+type searchRequest struct {
+	Query Query
+}
+
+type searchResponse struct {
+	Results
+	Err error `json:"err,omitempty"`
+}
+
+func (r searchResponse) error() error { return r.Err }
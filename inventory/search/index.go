@@ -0,0 +1,277 @@
+package search
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+type key struct {
+	kind      string
+	namespace string
+	id        string
+}
+
+// doc is an indexed host or service, with the words of each of its fields
+// in order.
+type doc struct {
+	key     key
+	host    *host.HostInfo
+	service *service.ServiceInfo
+	fields  map[string][]string
+}
+
+// Index is an inverted index of hosts and services, held in memory. Writes
+// made through HostMiddleware and ServiceMiddleware are indexed as soon as
+// they are made; Run reconciles the index with the stores to catch those
+// that are not, such as restores or, in a cluster, writes made through
+// other nodes.
+type Index struct {
+	hosts    host.Host
+	services service.Service
+	logger   log.Logger
+
+	mtx      sync.RWMutex
+	docs     map[key]*doc
+	postings map[string]map[key]bool
+	// onHost holds the services on each host, whose docs carry fields of
+	// their host.
+	onHost map[key]map[key]bool
+}
+
+// NewIndex returns an empty Index of the hosts and services of the given
+// stores, across namespaces. Writes are read back from the stores rather
+// than through the middlewares, which would log every read.
+func NewIndex(hosts host.Host, services service.Service, logger log.Logger) *Index {
+	return &Index{
+		hosts:    hosts,
+		services: services,
+		logger:   logger,
+		docs:     map[key]*doc{},
+		postings: map[string]map[key]bool{},
+		onHost:   map[key]map[key]bool{},
+	}
+}
+
+// Run reconciles the index with the stores at once, then every interval,
+// until ctx is cancelled.
+func (x *Index) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := x.Sync(ctx); err != nil {
+			x.logger.Log("during", "sync", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync indexes the hosts and services that changed since they were last
+// indexed, and drops those that are gone.
+func (x *Index) Sync(ctx context.Context) error {
+	actx := namespace.AllNamespaces(ctx)
+	hosts, err := x.hosts.ListHostInfo(actx, host.HostFilter{})
+	if err != nil {
+		return err
+	}
+	services, err := x.services.ListServiceInfo(actx, service.ServiceFilter{})
+	if err != nil {
+		return err
+	}
+
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+	seen := map[key]bool{}
+	changed := 0
+	for i := range hosts {
+		h := &hosts[i]
+		k := key{KindHost, h.Namespace, h.ID}
+		seen[k] = true
+		if d, ok := x.docs[k]; !ok || d.host.Version != h.Version || !d.host.UpdatedAt.Equal(h.UpdatedAt) {
+			x.putHost(*h)
+			changed++
+		}
+	}
+	for i := range services {
+		s := &services[i]
+		k := key{KindService, s.Namespace, s.ID}
+		seen[k] = true
+		if d, ok := x.docs[k]; !ok || d.service.Version != s.Version || !d.service.UpdatedAt.Equal(s.UpdatedAt) {
+			x.putService(*s)
+			changed++
+		}
+	}
+	removed := 0
+	for k := range x.docs {
+		if !seen[k] {
+			x.remove(k)
+			removed++
+		}
+	}
+	if changed > 0 || removed > 0 {
+		x.logger.Log("during", "sync", "indexed", changed, "removed", removed, "docs", len(x.docs))
+	}
+	return nil
+}
+
+// refreshHost indexes host id of the namespace of ctx as it now is in the
+// store.
+func (x *Index) refreshHost(ctx context.Context, id string) {
+	h, err := x.hosts.GetHostInfo(ctx, id)
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+	switch err {
+	case nil:
+		x.putHost(h)
+	case host.ErrNotFound:
+		x.remove(key{KindHost, namespace.FromContext(ctx), id})
+	default:
+		x.logger.Log("during", "index", "kind", KindHost, "id", id, "err", err)
+	}
+}
+
+// refreshService indexes service id of the namespace of ctx as it now is
+// in the store.
+func (x *Index) refreshService(ctx context.Context, id string) {
+	s, err := x.services.GetServiceInfo(ctx, id)
+	x.mtx.Lock()
+	defer x.mtx.Unlock()
+	switch err {
+	case nil:
+		x.putService(s)
+	case service.ErrNotFound:
+		x.remove(key{KindService, namespace.FromContext(ctx), id})
+	default:
+		x.logger.Log("during", "index", "kind", KindService, "id", id, "err", err)
+	}
+}
+
+func (x *Index) putHost(h host.HostInfo) {
+	k := key{KindHost, h.Namespace, h.ID}
+	fields := map[string][]string{
+		"id":         tokenize(h.ID),
+		"name":       tokenize(h.Name),
+		"remark":     tokenize(h.Remark),
+		"ip":         tokenize(strings.Join(h.Addresses(), " ")),
+		"rack":       tokenize(h.Rack),
+		"datacenter": tokenize(h.DataCenter),
+	}
+	addLabels(fields, h.Labels)
+	x.put(&doc{key: k, host: &h, fields: fields})
+	x.reindexServices(k)
+}
+
+// reindexServices indexes the services on host hk again, with the fields
+// they take from it.
+func (x *Index) reindexServices(hk key) {
+	var list []service.ServiceInfo
+	for sk := range x.onHost[hk] {
+		list = append(list, *x.docs[sk].service)
+	}
+	for _, s := range list {
+		x.putService(s)
+	}
+}
+
+func (x *Index) putService(s service.ServiceInfo) {
+	k := key{KindService, s.Namespace, s.ID}
+	hk := key{KindHost, s.HostNamespace, s.HostID}
+	fields := map[string][]string{
+		"id":     tokenize(s.ID),
+		"name":   tokenize(s.Name),
+		"remark": tokenize(s.Remark),
+		"owner":  tokenize(s.Owner),
+		"host":   tokenize(s.HostID),
+	}
+	if h, ok := x.docs[hk]; ok {
+		for _, f := range []string{"ip", "rack", "datacenter"} {
+			fields[f] = h.fields[f]
+		}
+	}
+	addLabels(fields, s.Labels)
+	if old, ok := x.docs[k]; ok {
+		x.unlinkService(old)
+	}
+	x.put(&doc{key: k, service: &s, fields: fields})
+	if x.onHost[hk] == nil {
+		x.onHost[hk] = map[key]bool{}
+	}
+	x.onHost[hk][k] = true
+}
+
+// put replaces the doc of d.key with d.
+func (x *Index) put(d *doc) {
+	if old, ok := x.docs[d.key]; ok {
+		x.unpost(old)
+	}
+	x.docs[d.key] = d
+	for _, words := range d.fields {
+		for _, w := range words {
+			if x.postings[w] == nil {
+				x.postings[w] = map[key]bool{}
+			}
+			x.postings[w][d.key] = true
+		}
+	}
+}
+
+func (x *Index) remove(k key) {
+	d, ok := x.docs[k]
+	if !ok {
+		return
+	}
+	x.unpost(d)
+	delete(x.docs, k)
+	if d.service != nil {
+		x.unlinkService(d)
+	} else {
+		x.reindexServices(k)
+	}
+}
+
+func (x *Index) unpost(d *doc) {
+	for _, words := range d.fields {
+		for _, w := range words {
+			delete(x.postings[w], d.key)
+			if len(x.postings[w]) == 0 {
+				delete(x.postings, w)
+			}
+		}
+	}
+}
+
+func (x *Index) unlinkService(d *doc) {
+	hk := key{KindHost, d.service.HostNamespace, d.service.HostID}
+	delete(x.onHost[hk], d.key)
+	if len(x.onHost[hk]) == 0 {
+		delete(x.onHost, hk)
+	}
+}
+
+// addLabels indexes labels under labels, keys and values alike, and the
+// value of each under labels.<key>.
+func addLabels(fields map[string][]string, labels map[string]string) {
+	for k, v := range labels {
+		fields["labels"] = append(fields["labels"], tokenize(k+" "+v)...)
+		fields["labels."+strings.ToLower(k)] = tokenize(v)
+	}
+}
+
+// tokenize splits s into lowercase words of letters and digits.
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
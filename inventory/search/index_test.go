@@ -0,0 +1,165 @@
+package search
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+func ids(r Results) []string {
+	var list []string
+	for _, res := range r.Results {
+		list = append(list, res.Kind+":"+res.ID)
+	}
+	return list
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	hostStore, serviceStore := host.NewInmemHost(), service.NewInmemService()
+	x := NewIndex(hostStore, serviceStore, log.NewNopLogger())
+	hosts := HostMiddleware(x)(hostStore)
+	services := ServiceMiddleware(x)(serviceStore)
+
+	for _, h := range []host.HostInfo{
+		{ID: "kafka-01", Name: "kafka broker", IP: "10.0.0.1", Rack: "B7", DataCenter: "dc1", Labels: map[string]string{"env": "prod"}},
+		{ID: "kafka-02", Name: "kafka broker", IP: "10.0.0.2", Rack: "B8", DataCenter: "dc1", Labels: map[string]string{"env": "staging"}},
+		{ID: "web-01", Name: "web", IP: "10.0.1.1", Rack: "B7", DataCenter: "dc1", Remark: "runs next to the kafka broker"},
+	} {
+		if err := hosts.PostHostInfo(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := services.PostServiceInfo(ctx, service.ServiceInfo{ID: "orders", Name: "orders", Owner: "payments", HostID: "kafka-01"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		text string
+		want []string
+		err  error
+	}{
+		{text: "kafka", want: []string{"host:kafka-01", "host:kafka-02", "host:web-01", "service:orders"}},
+		{text: "kaf*", want: []string{"host:kafka-01", "host:kafka-02", "host:web-01", "service:orders"}},
+		{text: `"broker kafka"`, want: nil},
+		{text: `"kafka broker"`, want: []string{"host:kafka-01", "host:kafka-02", "host:web-01"}},
+		{text: `name:"kafka broker"`, want: []string{"host:kafka-01", "host:kafka-02"}},
+		{text: "rack:b7", want: []string{"host:kafka-01", "host:web-01", "service:orders"}},
+		{text: "rack:b7 kind:host", want: []string{"host:kafka-01", "host:web-01"}},
+		{text: "rack:b7 -kind:host", want: []string{"service:orders"}},
+		{text: "labels.env:prod", want: []string{"host:kafka-01"}},
+		{text: "kafka -labels.env:prod", want: []string{"host:kafka-02", "host:web-01", "service:orders"}},
+		{text: "kafka -rack:b7", want: []string{"host:kafka-02"}},
+		{text: "kafka -kind:service -host:kafka", want: []string{"host:kafka-01", "host:kafka-02", "host:web-01"}},
+		{text: `kafka -"next to"`, want: []string{"host:kafka-01", "host:kafka-02", "service:orders"}},
+		{text: "kafka -web*", want: []string{"host:kafka-01", "host:kafka-02", "service:orders"}},
+		{text: "10.0.0.1", want: []string{"host:kafka-01", "service:orders"}},
+		{text: "owner:payments", want: []string{"service:orders"}},
+		{text: "", err: ErrEmptyQuery},
+		{text: "-kafka", err: ErrEmptyQuery},
+		{text: "kind:host", err: ErrEmptyQuery},
+		{text: "kafka kind:rack", err: ErrUnknownKind},
+	} {
+		t.Run(tc.text, func(t *testing.T) {
+			r, err := x.Search(ctx, Query{Text: tc.text})
+			if err != tc.err {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			got := ids(r)
+			if len(got) != len(tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+			// Results are ranked; compare them as a set.
+			seen := map[string]bool{}
+			for _, id := range got {
+				seen[id] = true
+			}
+			for _, id := range tc.want {
+				if !seen[id] {
+					t.Fatalf("got %v, want %v", got, tc.want)
+				}
+			}
+		})
+	}
+
+	r, err := x.Search(ctx, Query{Text: "kafka"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := r.Results[3]; last.ID != "web-01" || last.Score >= r.Results[2].Score || !reflect.DeepEqual(last.Fields, []string{"remark"}) {
+		t.Fatalf("got %+v, want the remark match ranked last", r.Results)
+	}
+	if r, _ := x.Search(ctx, Query{Text: "kafka", Limit: 1}); r.Total != 4 || len(r.Results) != 1 {
+		t.Fatalf("got %d of %d results, want 1 of 4", len(r.Results), r.Total)
+	}
+	if r, _ := x.Search(namespace.NewContext(ctx, "team-a"), Query{Text: "kafka"}); r.Total != 0 {
+		t.Fatalf("got %v in another namespace", ids(r))
+	}
+
+	// A service takes the rack of its host, and loses it with the host.
+	h, _ := hostStore.GetHostInfo(ctx, "kafka-01")
+	h.Rack = "C1"
+	if err := hosts.PutHostInfo(ctx, "kafka-01", h); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := x.Search(ctx, Query{Text: "rack:c1"}); !reflect.DeepEqual(ids(r), []string{"host:kafka-01", "service:orders"}) {
+		t.Fatalf("rack:c1 got %v, want kafka-01 and orders", ids(r))
+	}
+	if err := hosts.DeleteHostInfo(ctx, "kafka-01"); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := x.Search(ctx, Query{Text: "rack:c1"}); r.Total != 0 {
+		t.Fatalf("rack:c1 got %v after deleting kafka-01", ids(r))
+	}
+	if r, _ := x.Search(ctx, Query{Text: "orders"}); !reflect.DeepEqual(ids(r), []string{"service:orders"}) {
+		t.Fatalf("orders got %v, want the service", ids(r))
+	}
+}
+
+func TestSync(t *testing.T) {
+	ctx := context.Background()
+	hosts, services := host.NewInmemHost(), service.NewInmemService()
+	x := NewIndex(hosts, services, log.NewNopLogger())
+	for _, id := range []string{"db-01", "db-02"} {
+		if err := hosts.PostHostInfo(ctx, host.HostInfo{ID: id, Name: "postgres"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r, _ := x.Search(ctx, Query{Text: "postgres"}); r.Total != 0 {
+		t.Fatalf("got %v before a sync", ids(r))
+	}
+	if err := x.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := x.Search(ctx, Query{Text: "postgres"}); r.Total != 2 {
+		t.Fatalf("got %v, want db-01 and db-02", ids(r))
+	}
+
+	// Writes the index did not see are caught by the next sync.
+	h, _ := hosts.GetHostInfo(ctx, "db-01")
+	h.Name = "mysql"
+	if err := hosts.PutHostInfo(ctx, "db-01", h); err != nil {
+		t.Fatal(err)
+	}
+	if err := hosts.DeleteHostInfo(ctx, "db-02"); err != nil {
+		t.Fatal(err)
+	}
+	if err := x.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := x.Search(ctx, Query{Text: "postgres"}); r.Total != 0 {
+		t.Fatalf("postgres got %v after a sync", ids(r))
+	}
+	if r, _ := x.Search(ctx, Query{Text: "mysql"}); !reflect.DeepEqual(ids(r), []string{"host:db-01"}) {
+		t.Fatalf("mysql got %v, want db-01", ids(r))
+	}
+	if len(x.postings["postgres"]) != 0 {
+		t.Fatalf("postings of postgres left: %v", x.postings["postgres"])
+	}
+}
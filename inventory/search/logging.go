@@ -0,0 +1,33 @@
+package search
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Middleware func(Searcher) Searcher
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Searcher) Searcher {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Searcher
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) Search(ctx context.Context, q Query) (r Results, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Search", "namespace", namespace.FromContext(ctx), "q", q.Text, "limit", q.Limit, "total", r.Total, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Search(ctx, q)
+}
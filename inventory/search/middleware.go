@@ -0,0 +1,174 @@
+package search
+
+import (
+	"context"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// HostMiddleware indexes the hosts written through it once the writes are
+// made; a held batch, once it is committed.
+func HostMiddleware(x *Index) host.Middleware {
+	return func(next host.Host) host.Host {
+		return &hostMiddleware{
+			Host:  next,
+			index: x,
+		}
+	}
+}
+
+type hostMiddleware struct {
+	host.Host
+	index *Index
+}
+
+func (mw hostMiddleware) PostHostInfo(ctx context.Context, h host.HostInfo) error {
+	err := mw.Host.PostHostInfo(ctx, h)
+	if err == nil {
+		mw.index.refreshHost(ctx, h.ID)
+	}
+	return err
+}
+
+func (mw hostMiddleware) PutHostInfo(ctx context.Context, id string, h host.HostInfo) error {
+	err := mw.Host.PutHostInfo(ctx, id, h)
+	if err == nil {
+		mw.index.refreshHost(ctx, id)
+	}
+	return err
+}
+
+func (mw hostMiddleware) DeleteHostInfo(ctx context.Context, id string) error {
+	err := mw.Host.DeleteHostInfo(ctx, id)
+	if err == nil {
+		mw.index.refreshHost(ctx, id)
+	}
+	return err
+}
+
+func (mw hostMiddleware) UndeleteHostInfo(ctx context.Context, id string) (host.HostInfo, error) {
+	h, err := mw.Host.UndeleteHostInfo(ctx, id)
+	if err == nil {
+		mw.index.refreshHost(ctx, id)
+	}
+	return h, err
+}
+
+func (mw hostMiddleware) PurgeHostInfo(ctx context.Context, id string) (host.HostInfo, error) {
+	h, err := mw.Host.PurgeHostInfo(ctx, id)
+	if err == nil {
+		mw.index.refreshHost(ctx, id)
+	}
+	return h, err
+}
+
+// BatchHostInfo indexes every host of the batch again, as a best-effort
+// batch may have applied some of its operations however it ended.
+func (mw hostMiddleware) BatchHostInfo(ctx context.Context, b host.Batch) ([]host.BatchResult, error) {
+	refresh := func() {
+		for _, op := range b.Ops {
+			id := op.ID
+			if id == "" {
+				id = op.HostInfo.ID
+			}
+			mw.index.refreshHost(ctx, id)
+		}
+	}
+	if b.Hold == nil {
+		results, err := mw.Host.BatchHostInfo(ctx, b)
+		refresh()
+		return results, err
+	}
+	forward := b
+	forward.Hold = func(commit, rollback func()) {
+		b.Hold(func() {
+			commit()
+			refresh()
+		}, rollback)
+	}
+	return mw.Host.BatchHostInfo(ctx, forward)
+}
+
+// ServiceMiddleware indexes the services written through it once the
+// writes are made; a held batch, once it is committed.
+func ServiceMiddleware(x *Index) service.MiddlewareService {
+	return func(next service.Service) service.Service {
+		return &serviceMiddleware{
+			Service: next,
+			index:   x,
+		}
+	}
+}
+
+type serviceMiddleware struct {
+	service.Service
+	index *Index
+}
+
+func (mw serviceMiddleware) PostServiceInfo(ctx context.Context, s service.ServiceInfo) error {
+	err := mw.Service.PostServiceInfo(ctx, s)
+	if err == nil {
+		mw.index.refreshService(ctx, s.ID)
+	}
+	return err
+}
+
+func (mw serviceMiddleware) PutServiceInfo(ctx context.Context, id string, s service.ServiceInfo) error {
+	err := mw.Service.PutServiceInfo(ctx, id, s)
+	if err == nil {
+		mw.index.refreshService(ctx, id)
+	}
+	return err
+}
+
+func (mw serviceMiddleware) DeleteServiceInfo(ctx context.Context, id string) error {
+	err := mw.Service.DeleteServiceInfo(ctx, id)
+	if err == nil {
+		mw.index.refreshService(ctx, id)
+	}
+	return err
+}
+
+func (mw serviceMiddleware) UndeleteServiceInfo(ctx context.Context, id string) (service.ServiceInfo, error) {
+	s, err := mw.Service.UndeleteServiceInfo(ctx, id)
+	if err == nil {
+		mw.index.refreshService(ctx, id)
+	}
+	return s, err
+}
+
+func (mw serviceMiddleware) PurgeServiceInfo(ctx context.Context, id string) (service.ServiceInfo, error) {
+	s, err := mw.Service.PurgeServiceInfo(ctx, id)
+	if err == nil {
+		mw.index.refreshService(ctx, id)
+	}
+	return s, err
+}
+
+// BatchServiceInfo indexes every service of the batch again, as
+// BatchHostInfo does hosts.
+func (mw serviceMiddleware) BatchServiceInfo(ctx context.Context, b service.Batch) ([]service.BatchResult, error) {
+	refresh := func() {
+		for _, op := range b.Ops {
+			id := op.ID
+			if id == "" {
+				id = op.ServiceInfo.ID
+			}
+			mw.index.refreshService(ctx, id)
+		}
+	}
+	if b.Hold == nil {
+		results, err := mw.Service.BatchServiceInfo(ctx, b)
+		refresh()
+		return results, err
+	}
+	forward := b
+	forward.Hold = func(commit, rollback func()) {
+		b.Hold(func() {
+			commit()
+			refresh()
+		}, rollback)
+	}
+	return mw.Service.BatchServiceInfo(ctx, forward)
+}
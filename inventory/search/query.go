@@ -0,0 +1,274 @@
+package search
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// weights rank matches by the field they are in. Fields not listed, the
+// labels.<key> fields, weigh as labels.
+var weights = map[string]float64{
+	"id":         3,
+	"name":       3,
+	"ip":         3,
+	"rack":       2,
+	"datacenter": 2,
+	"owner":      2,
+	"host":       1.5,
+	"labels":     1.5,
+	"remark":     1,
+}
+
+// clause is a term of a query: words to find in field, or in any field,
+// next to each other. With prefix set, the last word need only start
+// the word it matches; with negate set, the words must not be found.
+type clause struct {
+	field  string
+	words  []string
+	prefix bool
+	negate bool
+}
+
+func isField(name string) bool {
+	_, ok := weights[name]
+	return ok || strings.HasPrefix(name, "labels.") && len(name) > len("labels.")
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// parse reads the clauses of a query and the kind of results it asks for,
+// if any. A qualifier that is not a field, as in kafka:9092, is taken as
+// part of the term. A term led by - is negated; -kind:host asks for the
+// other kind.
+func parse(text string) (clauses []clause, kind string, err error) {
+	for i := 0; i < len(text); {
+		if isSpace(text[i]) {
+			i++
+			continue
+		}
+		var c clause
+		if text[i] == '-' && i+1 < len(text) && !isSpace(text[i+1]) {
+			c.negate = true
+			i++
+		}
+		j := i
+		for j < len(text) && !isSpace(text[j]) && text[j] != ':' && text[j] != '"' {
+			j++
+		}
+		if j < len(text) && text[j] == ':' {
+			if name := strings.ToLower(text[i:j]); isField(name) || name == "kind" {
+				c.field, i = name, j+1
+			}
+		}
+		var value string
+		if i < len(text) && text[i] == '"' {
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				value, i = text[i+1:], len(text)
+			} else {
+				value, i = text[i+1:i+1+end], i+2+end
+			}
+		} else {
+			j := i
+			for j < len(text) && !isSpace(text[j]) {
+				j++
+			}
+			value, i = text[i:j], j
+		}
+
+		if c.field == "kind" {
+			switch kind = strings.ToLower(value); {
+			case kind != KindHost && kind != KindService:
+				return nil, "", ErrUnknownKind
+			case c.negate && kind == KindHost:
+				kind = KindService
+			case c.negate:
+				kind = KindHost
+			}
+			continue
+		}
+		if strings.HasSuffix(value, "*") {
+			c.prefix = true
+			value = strings.TrimRight(value, "*")
+		}
+		if c.words = tokenize(value); len(c.words) > 0 {
+			clauses = append(clauses, c)
+		}
+	}
+	return clauses, kind, nil
+}
+
+// candidates returns the docs that may match c: those with its rarest
+// whole word or, for a lone prefix, with a word that starts with it.
+func (x *Index) candidates(c clause) map[key]bool {
+	exact := c.words
+	if c.prefix {
+		exact = exact[:len(exact)-1]
+	}
+	if len(exact) > 0 {
+		best := x.postings[exact[0]]
+		for _, w := range exact[1:] {
+			if len(x.postings[w]) < len(best) {
+				best = x.postings[w]
+			}
+		}
+		return best
+	}
+	p := c.words[0]
+	union := map[key]bool{}
+	for w, docs := range x.postings {
+		if strings.HasPrefix(w, p) {
+			for k := range docs {
+				union[k] = true
+			}
+		}
+	}
+	return union
+}
+
+// match scores d against c, and returns the fields c matches. A word that
+// only matches as a prefix counts half.
+func (c clause) match(d *doc) (score float64, fields []string) {
+	n := len(c.words)
+	for f, words := range d.fields {
+		if c.field == "" && strings.HasPrefix(f, "labels.") || c.field != "" && c.field != f {
+			continue
+		}
+		tf := 0.0
+	occurrences:
+		for i := 0; i+n <= len(words); i++ {
+			for j, w := range c.words[:n-1] {
+				if words[i+j] != w {
+					continue occurrences
+				}
+			}
+			last, w := c.words[n-1], words[i+n-1]
+			switch {
+			case w == last:
+				tf++
+			case c.prefix && strings.HasPrefix(w, last):
+				tf += 0.5
+			}
+		}
+		if tf == 0 {
+			continue
+		}
+		weight, ok := weights[f]
+		if !ok {
+			weight = weights["labels"]
+		}
+		score += weight * tf * 2.2 / (tf + 1.2)
+		fields = append(fields, f)
+	}
+	return score, fields
+}
+
+// idf weighs a clause matched by df of n docs: the rarer, the heavier.
+func idf(n, df int) float64 {
+	return math.Log(1 + (float64(n)-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// Search returns the hosts and services of the namespace of ctx that match
+// every clause of q and none of its negated clauses, best first.
+func (x *Index) Search(ctx context.Context, q Query) (Results, error) {
+	all, kind, err := parse(q.Text)
+	if err != nil {
+		return Results{}, err
+	}
+	var clauses, negated []clause
+	for _, c := range all {
+		if c.negate {
+			negated = append(negated, c)
+		} else {
+			clauses = append(clauses, c)
+		}
+	}
+	if len(clauses) == 0 {
+		return Results{}, ErrEmptyQuery
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	if limit > MaxLimit {
+		limit = MaxLimit
+	}
+	ns := namespace.FromContext(ctx)
+
+	x.mtx.RLock()
+	defer x.mtx.RUnlock()
+	cands := make([]map[key]bool, len(clauses))
+	for i, c := range clauses {
+		cands[i] = x.candidates(c)
+	}
+	order := make([]int, len(clauses))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return len(cands[order[a]]) < len(cands[order[b]]) })
+	excluded := make([]map[key]bool, len(negated))
+	for i, c := range negated {
+		excluded[i] = x.candidates(c)
+	}
+
+	results := []Result{}
+next:
+	for k := range cands[order[0]] {
+		if k.namespace != ns || kind != "" && k.kind != kind {
+			continue
+		}
+		d := x.docs[k]
+		for i, c := range negated {
+			if score, _ := c.match(d); excluded[i][k] && score > 0 {
+				continue next
+			}
+		}
+		r := Result{Kind: k.kind, Namespace: k.namespace, ID: k.id, Host: d.host, Service: d.service}
+		matched := map[string]bool{}
+		for _, i := range order {
+			if !cands[i][k] {
+				continue next
+			}
+			score, fields := clauses[i].match(d)
+			if score == 0 {
+				continue next
+			}
+			r.Score += idf(len(x.docs), len(cands[i])) * score
+			for _, f := range fields {
+				matched[f] = true
+			}
+		}
+		for f := range matched {
+			r.Fields = append(r.Fields, f)
+		}
+		sort.Strings(r.Fields)
+		r.Score = math.Round(r.Score*1000) / 1000
+		if d.host != nil {
+			r.Name = d.host.Name
+		} else {
+			r.Name = d.service.Name
+		}
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.ID < b.ID
+	})
+	total := len(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return Results{Total: total, Results: results}, nil
+}
@@ -0,0 +1,50 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		text    string
+		clauses []clause
+		kind    string
+		err     error
+	}{
+		{name: "words", text: " Kafka  broker\t", clauses: []clause{{words: []string{"kafka"}}, {words: []string{"broker"}}}},
+		{name: "prefix", text: "kaf*", clauses: []clause{{words: []string{"kaf"}, prefix: true}}},
+		{name: "phrase", text: `"kafka broker"`, clauses: []clause{{words: []string{"kafka", "broker"}}}},
+		{name: "phrase with prefix", text: `"web-0*"`, clauses: []clause{{words: []string{"web", "0"}, prefix: true}}},
+		{name: "unterminated phrase", text: `"kafka broker`, clauses: []clause{{words: []string{"kafka", "broker"}}}},
+		{name: "term as phrase of its words", text: "10.0.0.1", clauses: []clause{{words: []string{"10", "0", "0", "1"}}}},
+		{name: "field", text: "Rack:b7", clauses: []clause{{field: "rack", words: []string{"b7"}}}},
+		{name: "field phrase", text: `name:"kafka broker"`, clauses: []clause{{field: "name", words: []string{"kafka", "broker"}}}},
+		{name: "label field", text: "labels.env:prod", clauses: []clause{{field: "labels.env", words: []string{"prod"}}}},
+		{name: "not a field", text: "kafka:9092", clauses: []clause{{words: []string{"kafka", "9092"}}}},
+		{name: "labels without key", text: "labels.:prod", clauses: []clause{{words: []string{"labels", "prod"}}}},
+		{name: "negated", text: "kafka -rack:b7 -\"old broker\"", clauses: []clause{
+			{words: []string{"kafka"}},
+			{field: "rack", words: []string{"b7"}, negate: true},
+			{words: []string{"old", "broker"}, negate: true},
+		}},
+		{name: "lone dash", text: "kafka - broker", clauses: []clause{{words: []string{"kafka"}}, {words: []string{"broker"}}}},
+		{name: "dash inside a term", text: "web-01", clauses: []clause{{words: []string{"web", "01"}}}},
+		{name: "kind", text: "kafka kind:Service", clauses: []clause{{words: []string{"kafka"}}}, kind: KindService},
+		{name: "negated kind", text: "kafka -kind:service", clauses: []clause{{words: []string{"kafka"}}}, kind: KindHost},
+		{name: "unknown kind", text: "kind:rack", err: ErrUnknownKind},
+		{name: "empty", text: "", clauses: nil},
+		{name: "no words", text: `"" * -- ,`, clauses: nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clauses, kind, err := parse(tc.text)
+			if err != tc.err {
+				t.Fatalf("got error %v, want %v", err, tc.err)
+			}
+			if !reflect.DeepEqual(clauses, tc.clauses) || kind != tc.kind {
+				t.Fatalf("got %+v kind %q, want %+v kind %q", clauses, kind, tc.clauses, tc.kind)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package search
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// Searcher finds hosts and services by the words of their names, remarks,
+// addresses, racks, datacenters and labels.
+type Searcher interface {
+	Search(ctx context.Context, q Query) (Results, error)
+}
+
+// Query is a search of the namespace of the context. Text is a list of
+// terms, all of which a result must match:
+//
+//	kafka              a word, in any field
+//	kaf*               a word starting with kaf
+//	"kafka broker"     words next to each other, in this order
+//	rack:b7            a word in one field; name:"kafka broker" a phrase
+//	labels.env:prod    a word in the value of one label
+//	kind:service       only services, or only hosts with kind:host
+//	-decommissioned    not a word; -rack:b7 or -"kafka broker" alike
+//
+// Fields are id, name, remark, ip, rack, datacenter, labels, labels.<key>
+// and, for services, owner and host, the ID of their host. Services are
+// also matched by the ip, rack and datacenter of their host. Terms such as
+// 10.0.0.1 or web-01 are searched as phrases of their words. A query needs
+// a term that is not negated.
+type Query struct {
+	Text  string
+	Limit int
+}
+
+// Results are the best matches of a query, Total the number of matches.
+type Results struct {
+	Total   int      `json:"total"`
+	Results []Result `json:"results"`
+}
+
+// Result is a host or a service, as it was when last indexed, with the
+// fields that matched.
+type Result struct {
+	Kind      string               `json:"kind"`
+	Namespace string               `json:"namespace"`
+	ID        string               `json:"id"`
+	Name      string               `json:"name"`
+	Score     float64              `json:"score"`
+	Fields    []string             `json:"fields"`
+	Host      *host.HostInfo       `json:"host,omitempty"`
+	Service   *service.ServiceInfo `json:"service,omitempty"`
+}
+
+// Kinds of results.
+const (
+	KindHost    = "host"
+	KindService = "service"
+)
+
+// DefaultLimit and MaxLimit bound the results of a query.
+const (
+	DefaultLimit = 20
+	MaxLimit     = 1000
+)
+
+var (
+	ErrEmptyQuery  = errors.New("query must have a term to search for")
+	ErrUnknownKind = errors.New("kind must be host or service")
+)
@@ -0,0 +1,86 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+	ErrBadLimit   = errors.New("limit must be a positive number")
+)
+
+func MakeHTTPHandler(s Searcher, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext),
+	}
+
+	for _, prefix := range []string{"/search/v1", "/search/v1/namespaces/{ns}"} {
+		r.Methods("GET").Path(prefix).Handler(httptransport.NewServer(
+			e.SearchEndpoint,
+			decodeSearchRequest,
+			encodeResponse,
+			options...,
+		))
+	}
+	return r
+}
+
+func decodeSearchRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	query := Query{Text: q.Get("q")}
+	if v := q.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit <= 0 {
+			return nil, ErrBadLimit
+		}
+	}
+	return searchRequest{Query: query}, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	switch err {
+	case ErrEmptyQuery, ErrUnknownKind, ErrBadLimit:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
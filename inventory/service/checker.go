@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// HealthChecker periodically runs the health checks declared on services
+// and records the results through PutServiceHealth.
+type HealthChecker struct {
+	services   Service
+	store      Service
+	hosts      host.Host
+	logger     log.Logger
+	enableExec bool
+	client     *http.Client
+	mtx        sync.Mutex
+	next       map[key]time.Time
+	inflight   map[key]bool
+}
+
+// NewHealthChecker returns a checker that records the results of the checks
+// through s. The services are polled every second from store, the store
+// behind s, and their hosts read from hosts, the host store, so that the
+// polls are not logged. Exec checks run arbitrary commands on the
+// inventory server and are only executed when enableExec is set;
+// otherwise they are reported as critical.
+func NewHealthChecker(s, store Service, hosts host.Host, enableExec bool, logger log.Logger) *HealthChecker {
+	return &HealthChecker{
+		services:   s,
+		store:      store,
+		hosts:      hosts,
+		logger:     logger,
+		enableExec: enableExec,
+		client:     &http.Client{},
+		next:       map[key]time.Time{},
+		inflight:   map[key]bool{},
+	}
+}
+
+// Run schedules checks until ctx is cancelled.
+func (c *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.schedule(ctx, now)
+		}
+	}
+}
+
+func (c *HealthChecker) schedule(ctx context.Context, now time.Time) {
+	list, err := c.store.ListServiceInfo(namespace.AllNamespaces(ctx), ServiceFilter{})
+	if err != nil {
+		c.logger.Log("err", err)
+		return
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	seen := map[key]bool{}
+	for _, s := range list {
+		if s.Check == nil {
+			continue
+		}
+		k := keyOf(s)
+		seen[k] = true
+		if c.inflight[k] || now.Before(c.next[k]) {
+			continue
+		}
+		c.inflight[k] = true
+		c.next[k] = now.Add(time.Duration(s.Check.Interval))
+		go c.check(ctx, s)
+	}
+	for k := range c.next {
+		if !seen[k] {
+			delete(c.next, k)
+		}
+	}
+}
+
+func (c *HealthChecker) check(ctx context.Context, s ServiceInfo) {
+	defer func() {
+		c.mtx.Lock()
+		delete(c.inflight, keyOf(s))
+		c.mtx.Unlock()
+	}()
+
+	r := CheckResult{Status: HealthCritical}
+	h, err := c.hosts.GetHostInfo(namespace.NewContext(ctx, s.HostNamespace), s.HostID)
+	if err != nil {
+		r.Output = fmt.Sprintf("host %s: %v", s.HostID, err)
+	} else {
+		cctx, cancel := context.WithTimeout(ctx, time.Duration(s.Check.Timeout))
+		r.Status, r.Output = c.run(cctx, *s.Check, h)
+		cancel()
+	}
+	r.CheckedAt = time.Now()
+
+	if err := c.services.PutServiceHealth(namespace.NewContext(ctx, s.Namespace), s.ID, r); err != nil && err != ErrNotFound {
+		c.logger.Log("namespace", s.Namespace, "service", s.ID, "err", err)
+	}
+}
+
+func (c *HealthChecker) run(ctx context.Context, check HealthCheck, h host.HostInfo) (HealthStatus, string) {
+	addr := net.JoinHostPort(h.IP, h.Port)
+	switch check.Type {
+	case CheckTCP:
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return HealthCritical, err.Error()
+		}
+		conn.Close()
+		return HealthPassing, "connected to " + addr
+
+	case CheckHTTP:
+		path := check.Path
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		req, err := http.NewRequest("GET", "http://"+addr+path, nil)
+		if err != nil {
+			return HealthCritical, err.Error()
+		}
+		resp, err := c.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return HealthCritical, err.Error()
+		}
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return HealthPassing, resp.Status
+		case resp.StatusCode == http.StatusTooManyRequests:
+			return HealthWarning, resp.Status
+		default:
+			return HealthCritical, resp.Status
+		}
+
+	case CheckExec:
+		if !c.enableExec {
+			return HealthCritical, "exec checks are disabled"
+		}
+		cmd := exec.CommandContext(ctx, check.Command[0], check.Command[1:]...)
+		cmd.Env = append(os.Environ(), "HOST_IP="+h.IP, "HOST_PORT="+h.Port)
+		out, err := cmd.CombinedOutput()
+		output := strings.TrimSpace(string(out))
+		if err == nil {
+			return HealthPassing, output
+		}
+		// Exit code 1 is a warning, anything else is critical, the same
+		// convention as Nagios plugins.
+		if ee, ok := err.(*exec.ExitError); ok && ee.ExitCode() == 1 {
+			return HealthWarning, output
+		}
+		if output == "" {
+			output = err.Error()
+		}
+		return HealthCritical, output
+	}
+	return HealthCritical, ErrInvalidCheck.Error()
+}
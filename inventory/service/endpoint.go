@@ -7,6 +7,8 @@ import (
 
 	"github.com/go-kit/kit/endpoint"
 	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/host"
 )
 
 type Endpoints struct {
@@ -14,6 +16,19 @@ type Endpoints struct {
 	GetServiceInfoEndpoint    endpoint.Endpoint
 	PutServiceInfoEndpoint   endpoint.Endpoint
 	DeleteServiceInfoEndpoint    endpoint.Endpoint
+	ListServiceInfoEndpoint   endpoint.Endpoint
+	GetServiceHealthEndpoint   endpoint.Endpoint
+	GetHostPortsEndpoint   endpoint.Endpoint
+	PostServiceInstanceEndpoint   endpoint.Endpoint
+	PutServiceInstanceEndpoint   endpoint.Endpoint
+	DeleteServiceInstanceEndpoint   endpoint.Endpoint
+	ListServiceInstancesEndpoint   endpoint.Endpoint
+	ListHostInstancesEndpoint   endpoint.Endpoint
+	GetServiceDependentsEndpoint   endpoint.Endpoint
+	GetHostDependentsEndpoint   endpoint.Endpoint
+	BatchServiceInfoEndpoint   endpoint.Endpoint
+	UndeleteServiceInfoEndpoint endpoint.Endpoint
+	PurgeServiceInfoEndpoint    endpoint.Endpoint
 }
 
 func MakeServerEndpoints(s Service) Endpoints {
@@ -22,6 +37,19 @@ func MakeServerEndpoints(s Service) Endpoints {
 		GetServiceInfoEndpoint:    MakeGetServiceInfoEndpoint(s),
 		PutServiceInfoEndpoint:    MakePutServiceInfoEndpoint(s),
 		DeleteServiceInfoEndpoint:    MakeDeleteServiceInfoEndpoint(s),
+		ListServiceInfoEndpoint:    MakeListServiceInfoEndpoint(s),
+		GetServiceHealthEndpoint:    MakeGetServiceHealthEndpoint(s),
+		GetHostPortsEndpoint:    MakeGetHostPortsEndpoint(s),
+		PostServiceInstanceEndpoint:    MakePostServiceInstanceEndpoint(s),
+		PutServiceInstanceEndpoint:    MakePutServiceInstanceEndpoint(s),
+		DeleteServiceInstanceEndpoint:    MakeDeleteServiceInstanceEndpoint(s),
+		ListServiceInstancesEndpoint:    MakeListServiceInstancesEndpoint(s),
+		ListHostInstancesEndpoint:    MakeListHostInstancesEndpoint(s),
+		GetServiceDependentsEndpoint:    MakeGetServiceDependentsEndpoint(s),
+		GetHostDependentsEndpoint:    MakeGetHostDependentsEndpoint(s),
+		BatchServiceInfoEndpoint:    MakeBatchServiceInfoEndpoint(s),
+		UndeleteServiceInfoEndpoint: MakeUndeleteServiceInfoEndpoint(s),
+		PurgeServiceInfoEndpoint:    MakePurgeServiceInfoEndpoint(s),
 	}
 }
 
@@ -35,13 +63,28 @@ func MakeClientEndpoints(instance string) (Endpoints, error) {
 	}
 	tgt.Path = ""
 
-	options := []httptransport.ClientOption{}
+	options := []httptransport.ClientOption{
+		httptransport.ClientBefore(host.ActorToHTTP),
+	}
 
 	return Endpoints{
 		PostServiceInfoEndpoint:   httptransport.NewClient("POST", tgt, encodePostServiceInfoRequest, decodePostServiceInfoResponse, options...).Endpoint(),
 		GetServiceInfoEndpoint:    httptransport.NewClient("GET", tgt, encodeGetServiceInfoRequest, decodeGetServiceInfoResponse, options...).Endpoint(),
 		PutServiceInfoEndpoint:    httptransport.NewClient("PUT", tgt, encodePutServiceInfoRequest, decodePutServiceInfoResponse, options...).Endpoint(),
 		DeleteServiceInfoEndpoint:    httptransport.NewClient("DELETE", tgt, encodeDeleteServiceInfoRequest, decodeDeleteServiceInfoResponse, options...).Endpoint(),
+		ListServiceInfoEndpoint:    httptransport.NewClient("GET", tgt, encodeListServiceInfoRequest, decodeListServiceInfoResponse, options...).Endpoint(),
+		GetServiceHealthEndpoint:    httptransport.NewClient("GET", tgt, encodeGetServiceHealthRequest, decodeGetServiceHealthResponse, options...).Endpoint(),
+		GetHostPortsEndpoint:    httptransport.NewClient("GET", tgt, encodeGetHostPortsRequest, decodeGetHostPortsResponse, options...).Endpoint(),
+		PostServiceInstanceEndpoint:    httptransport.NewClient("POST", tgt, encodePostServiceInstanceRequest, decodePostServiceInstanceResponse, options...).Endpoint(),
+		PutServiceInstanceEndpoint:    httptransport.NewClient("PUT", tgt, encodePutServiceInstanceRequest, decodePutServiceInstanceResponse, options...).Endpoint(),
+		DeleteServiceInstanceEndpoint:    httptransport.NewClient("DELETE", tgt, encodeDeleteServiceInstanceRequest, decodeDeleteServiceInstanceResponse, options...).Endpoint(),
+		ListServiceInstancesEndpoint:    httptransport.NewClient("GET", tgt, encodeListServiceInstancesRequest, decodeListServiceInstancesResponse, options...).Endpoint(),
+		ListHostInstancesEndpoint:    httptransport.NewClient("GET", tgt, encodeListHostInstancesRequest, decodeListHostInstancesResponse, options...).Endpoint(),
+		GetServiceDependentsEndpoint:    httptransport.NewClient("GET", tgt, encodeGetServiceDependentsRequest, decodeGetServiceDependentsResponse, options...).Endpoint(),
+		GetHostDependentsEndpoint:    httptransport.NewClient("GET", tgt, encodeGetHostDependentsRequest, decodeGetHostDependentsResponse, options...).Endpoint(),
+		BatchServiceInfoEndpoint:    httptransport.NewClient("POST", tgt, encodeBatchServiceInfoRequest, decodeBatchServiceInfoResponse, options...).Endpoint(),
+		UndeleteServiceInfoEndpoint: httptransport.NewClient("POST", tgt, encodeUndeleteServiceInfoRequest, decodeUndeleteServiceInfoResponse, options...).Endpoint(),
+		PurgeServiceInfoEndpoint:    httptransport.NewClient("DELETE", tgt, encodePurgeServiceInfoRequest, decodePurgeServiceInfoResponse, options...).Endpoint(),
 	}, nil
 }
 
@@ -85,6 +128,136 @@ func (e Endpoints) DeleteServiceInfo(ctx context.Context, id string) error {
 	return resp.Err
 }
 
+func (e Endpoints) ListServiceInfo(ctx context.Context, f ServiceFilter) ([]ServiceInfo, error) {
+	request := listServiceInfoRequest{Filter: f}
+	response, err := e.ListServiceInfoEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listServiceInfoResponse)
+	return resp.ServiceInfos, resp.Err
+}
+
+func (e Endpoints) GetServiceHealth(ctx context.Context, id string) (ServiceHealth, error) {
+	request := getServiceHealthRequest{ID: id}
+	response, err := e.GetServiceHealthEndpoint(ctx, request)
+	if err != nil {
+		return ServiceHealth{}, err
+	}
+	resp := response.(getServiceHealthResponse)
+	return resp.ServiceHealth, resp.Err
+}
+
+func (e Endpoints) GetHostPorts(ctx context.Context, hostID string) (HostPorts, error) {
+	request := getHostPortsRequest{HostID: hostID}
+	response, err := e.GetHostPortsEndpoint(ctx, request)
+	if err != nil {
+		return HostPorts{}, err
+	}
+	resp := response.(getHostPortsResponse)
+	return resp.HostPorts, resp.Err
+}
+
+func (e Endpoints) PostServiceInstance(ctx context.Context, serviceID string, in Instance) error {
+	request := postServiceInstanceRequest{ServiceID: serviceID, Instance: in}
+	response, err := e.PostServiceInstanceEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	resp := response.(postServiceInstanceResponse)
+	return resp.Err
+}
+
+func (e Endpoints) PutServiceInstance(ctx context.Context, serviceID, instanceID string, in Instance) error {
+	request := putServiceInstanceRequest{ServiceID: serviceID, InstanceID: instanceID, Instance: in}
+	response, err := e.PutServiceInstanceEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	resp := response.(putServiceInstanceResponse)
+	return resp.Err
+}
+
+func (e Endpoints) DeleteServiceInstance(ctx context.Context, serviceID, instanceID string) error {
+	request := deleteServiceInstanceRequest{ServiceID: serviceID, InstanceID: instanceID}
+	response, err := e.DeleteServiceInstanceEndpoint(ctx, request)
+	if err != nil {
+		return err
+	}
+	resp := response.(deleteServiceInstanceResponse)
+	return resp.Err
+}
+
+func (e Endpoints) ListServiceInstances(ctx context.Context, serviceID string) ([]Instance, error) {
+	request := listServiceInstancesRequest{ServiceID: serviceID}
+	response, err := e.ListServiceInstancesEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listServiceInstancesResponse)
+	return resp.Instances, resp.Err
+}
+
+func (e Endpoints) ListHostInstances(ctx context.Context, hostID string) ([]Instance, error) {
+	request := listHostInstancesRequest{HostID: hostID}
+	response, err := e.ListHostInstancesEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(listHostInstancesResponse)
+	return resp.Instances, resp.Err
+}
+
+func (e Endpoints) GetServiceDependents(ctx context.Context, id string) (DependencyGraph, error) {
+	request := getServiceDependentsRequest{ID: id}
+	response, err := e.GetServiceDependentsEndpoint(ctx, request)
+	if err != nil {
+		return DependencyGraph{}, err
+	}
+	resp := response.(getServiceDependentsResponse)
+	return resp.Graph, resp.Err
+}
+
+func (e Endpoints) GetHostDependents(ctx context.Context, hostID string) (DependencyGraph, error) {
+	request := getHostDependentsRequest{HostID: hostID}
+	response, err := e.GetHostDependentsEndpoint(ctx, request)
+	if err != nil {
+		return DependencyGraph{}, err
+	}
+	resp := response.(getHostDependentsResponse)
+	return resp.Graph, resp.Err
+}
+
+func (e Endpoints) BatchServiceInfo(ctx context.Context, b Batch) ([]BatchResult, error) {
+	request := batchServiceInfoRequest{Batch: b}
+	response, err := e.BatchServiceInfoEndpoint(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(batchServiceInfoResponse)
+	return resp.Results, resp.Err
+}
+
+func (e Endpoints) UndeleteServiceInfo(ctx context.Context, id string) (ServiceInfo, error) {
+	request := undeleteServiceInfoRequest{ID: id}
+	response, err := e.UndeleteServiceInfoEndpoint(ctx, request)
+	if err != nil {
+		return ServiceInfo{}, err
+	}
+	resp := response.(undeleteServiceInfoResponse)
+	return resp.ServiceInfo, resp.Err
+}
+
+func (e Endpoints) PurgeServiceInfo(ctx context.Context, id string) (ServiceInfo, error) {
+	request := purgeServiceInfoRequest{ID: id}
+	response, err := e.PurgeServiceInfoEndpoint(ctx, request)
+	if err != nil {
+		return ServiceInfo{}, err
+	}
+	resp := response.(purgeServiceInfoResponse)
+	return resp.ServiceInfo, resp.Err
+}
+
 func MakePostServiceInfoEndpoint(s Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(postServiceInfoRequest)
@@ -117,6 +290,110 @@ func MakeDeleteServiceInfoEndpoint(s Service) endpoint.Endpoint {
 	}
 }
 
+func MakeListServiceInfoEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listServiceInfoRequest)
+		list, e := s.ListServiceInfo(ctx, req.Filter)
+		return listServiceInfoResponse{ServiceInfos: list, Err: e}, nil
+	}
+}
+
+func MakeGetServiceHealthEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getServiceHealthRequest)
+		sh, e := s.GetServiceHealth(ctx, req.ID)
+		return getServiceHealthResponse{ServiceHealth: sh, Err: e}, nil
+	}
+}
+
+func MakeGetHostPortsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getHostPortsRequest)
+		hp, e := s.GetHostPorts(ctx, req.HostID)
+		return getHostPortsResponse{HostPorts: hp, Err: e}, nil
+	}
+}
+
+func MakePostServiceInstanceEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(postServiceInstanceRequest)
+		e := s.PostServiceInstance(ctx, req.ServiceID, req.Instance)
+		return postServiceInstanceResponse{Err: e}, nil
+	}
+}
+
+func MakePutServiceInstanceEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putServiceInstanceRequest)
+		e := s.PutServiceInstance(ctx, req.ServiceID, req.InstanceID, req.Instance)
+		return putServiceInstanceResponse{Err: e}, nil
+	}
+}
+
+func MakeDeleteServiceInstanceEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteServiceInstanceRequest)
+		e := s.DeleteServiceInstance(ctx, req.ServiceID, req.InstanceID)
+		return deleteServiceInstanceResponse{Err: e}, nil
+	}
+}
+
+func MakeListServiceInstancesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listServiceInstancesRequest)
+		list, e := s.ListServiceInstances(ctx, req.ServiceID)
+		return listServiceInstancesResponse{Instances: list, Err: e}, nil
+	}
+}
+
+func MakeListHostInstancesEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listHostInstancesRequest)
+		list, e := s.ListHostInstances(ctx, req.HostID)
+		return listHostInstancesResponse{Instances: list, Err: e}, nil
+	}
+}
+
+func MakeGetServiceDependentsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getServiceDependentsRequest)
+		g, e := s.GetServiceDependents(ctx, req.ID)
+		return getServiceDependentsResponse{Graph: g, Format: req.Format, Err: e}, nil
+	}
+}
+
+func MakeGetHostDependentsEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getHostDependentsRequest)
+		g, e := s.GetHostDependents(ctx, req.HostID)
+		return getHostDependentsResponse{Graph: g, Format: req.Format, Err: e}, nil
+	}
+}
+
+func MakeBatchServiceInfoEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(batchServiceInfoRequest)
+		results, e := s.BatchServiceInfo(ctx, req.Batch)
+		return batchServiceInfoResponse{Results: results, Err: e}, nil
+	}
+}
+
+func MakeUndeleteServiceInfoEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(undeleteServiceInfoRequest)
+		h, e := s.UndeleteServiceInfo(ctx, req.ID)
+		return undeleteServiceInfoResponse{ServiceInfo: h, Err: e}, nil
+	}
+}
+
+func MakePurgeServiceInfoEndpoint(s Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(purgeServiceInfoRequest)
+		h, e := s.PurgeServiceInfo(ctx, req.ID)
+		return purgeServiceInfoResponse{ServiceInfo: h, Err: e}, nil
+	}
+}
+
 type postServiceInfoRequest struct {
 	ServiceInfo ServiceInfo
 }
@@ -147,7 +424,7 @@ type putServiceInfoResponse struct {
 	Err error `json:"err,omitempty"`
 }
 
-func (r putServiceInfoResponse) error() error { return nil }
+func (r putServiceInfoResponse) error() error { return r.Err }
 
 type deleteServiceInfoRequest struct {
 	ID string
@@ -158,3 +435,155 @@ type deleteServiceInfoResponse struct {
 }
 
 func (r deleteServiceInfoResponse) error() error { return r.Err }
+
+type listServiceInfoRequest struct {
+	Filter ServiceFilter
+}
+
+type listServiceInfoResponse struct {
+	ServiceInfos []ServiceInfo `json:"serviceinfos"`
+	Err          error         `json:"err,omitempty"`
+}
+
+func (r listServiceInfoResponse) error() error { return r.Err }
+
+type getServiceHealthRequest struct {
+	ID string
+}
+
+type getServiceHealthResponse struct {
+	ServiceHealth ServiceHealth `json:"health"`
+	Err           error         `json:"err,omitempty"`
+}
+
+func (r getServiceHealthResponse) error() error { return r.Err }
+
+type getHostPortsRequest struct {
+	HostID string
+}
+
+type getHostPortsResponse struct {
+	HostPorts HostPorts `json:"ports"`
+	Err       error     `json:"err,omitempty"`
+}
+
+func (r getHostPortsResponse) error() error { return r.Err }
+
+type postServiceInstanceRequest struct {
+	ServiceID string
+	Instance  Instance
+}
+
+type postServiceInstanceResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r postServiceInstanceResponse) error() error { return r.Err }
+
+type putServiceInstanceRequest struct {
+	ServiceID  string
+	InstanceID string
+	Instance   Instance
+}
+
+type putServiceInstanceResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r putServiceInstanceResponse) error() error { return r.Err }
+
+type deleteServiceInstanceRequest struct {
+	ServiceID  string
+	InstanceID string
+}
+
+type deleteServiceInstanceResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r deleteServiceInstanceResponse) error() error { return r.Err }
+
+type listServiceInstancesRequest struct {
+	ServiceID string
+}
+
+type listServiceInstancesResponse struct {
+	Instances []Instance `json:"instances"`
+	Err       error      `json:"err,omitempty"`
+}
+
+func (r listServiceInstancesResponse) error() error { return r.Err }
+
+type listHostInstancesRequest struct {
+	HostID string
+}
+
+type listHostInstancesResponse struct {
+	Instances []Instance `json:"instances"`
+	Err       error      `json:"err,omitempty"`
+}
+
+func (r listHostInstancesResponse) error() error { return r.Err }
+
+type getServiceDependentsRequest struct {
+	ID string
+	Format string
+}
+
+type getServiceDependentsResponse struct {
+	Graph  DependencyGraph `json:"graph"`
+	Format string          `json:"-"`
+	Err    error           `json:"err,omitempty"`
+}
+
+func (r getServiceDependentsResponse) error() error { return r.Err }
+
+func (r getServiceDependentsResponse) graph() (DependencyGraph, string) { return r.Graph, r.Format }
+
+type getHostDependentsRequest struct {
+	HostID string
+	Format string
+}
+
+type getHostDependentsResponse struct {
+	Graph  DependencyGraph `json:"graph"`
+	Format string          `json:"-"`
+	Err    error           `json:"err,omitempty"`
+}
+
+func (r getHostDependentsResponse) error() error { return r.Err }
+
+func (r getHostDependentsResponse) graph() (DependencyGraph, string) { return r.Graph, r.Format }
+
+type batchServiceInfoRequest struct {
+	Batch Batch
+}
+
+type batchServiceInfoResponse struct {
+	Results []BatchResult
+	Err     error
+}
+
+func (r batchServiceInfoResponse) error() error { return r.Err }
+
+type undeleteServiceInfoRequest struct {
+	ID string
+}
+
+type undeleteServiceInfoResponse struct {
+	ServiceInfo ServiceInfo `json:"serviceinfo,omitempty"`
+	Err         error       `json:"err,omitempty"`
+}
+
+func (r undeleteServiceInfoResponse) error() error { return r.Err }
+
+type purgeServiceInfoRequest struct {
+	ID string
+}
+
+type purgeServiceInfoResponse struct {
+	ServiceInfo ServiceInfo `json:"serviceinfo,omitempty"`
+	Err         error       `json:"err,omitempty"`
+}
+
+func (r purgeServiceInfoResponse) error() error { return r.Err }
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// DependencyGraph is the part of the service dependency graph affected by
+// a change to its roots. An edge points from a service to a service it
+// depends on. Roots and edges refer to services of other namespaces than
+// the graph's own as namespace/id.
+type DependencyGraph struct {
+	Namespace string      `json:"namespace"`
+	Roots     []string    `json:"roots"`
+	Nodes     []GraphNode `json:"nodes"`
+	Edges     []GraphEdge `json:"edges"`
+}
+
+type GraphNode struct {
+	ID        string `json:"id"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	HostID    string `json:"hostid"`
+}
+
+type GraphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// WriteDOT renders g in the Graphviz DOT language. Roots are filled.
+func (g DependencyGraph) WriteDOT(w io.Writer) error {
+	roots := map[string]bool{}
+	for _, id := range g.Roots {
+		roots[id] = true
+	}
+	if _, err := fmt.Fprintln(w, "digraph dependents {"); err != nil {
+		return err
+	}
+	for _, n := range g.Nodes {
+		id := g.ref(n.Namespace, n.ID)
+		label := strconv.Quote(n.Name + "\n" + id)
+		attrs := "label=" + label
+		if roots[id] {
+			attrs += ", style=filled"
+		}
+		if _, err := fmt.Fprintf(w, "\t%s [%s];\n", strconv.Quote(id), attrs); err != nil {
+			return err
+		}
+	}
+	for _, e := range g.Edges {
+		if _, err := fmt.Fprintf(w, "\t%s -> %s;\n", strconv.Quote(e.From), strconv.Quote(e.To)); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+func newDependencyGraph(ns string) DependencyGraph {
+	return DependencyGraph{Namespace: ns, Roots: []string{}, Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+}
+
+// ref returns how g refers to service id of namespace ns.
+func (g DependencyGraph) ref(ns, id string) string {
+	if ns == g.Namespace {
+		return id
+	}
+	return ns + "/" + id
+}
+
+// merge adds other, a graph of a single namespace, to g.
+func (g *DependencyGraph) merge(other DependencyGraph) {
+	for _, id := range other.Roots {
+		g.Roots = append(g.Roots, g.ref(other.Namespace, id))
+	}
+	g.Nodes = append(g.Nodes, other.Nodes...)
+	for _, e := range other.Edges {
+		g.Edges = append(g.Edges, GraphEdge{From: g.ref(other.Namespace, e.From), To: g.ref(other.Namespace, e.To)})
+	}
+}
+
+func (g *DependencyGraph) sort() {
+	sort.Strings(g.Roots)
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		if g.Nodes[i].Namespace != g.Nodes[j].Namespace {
+			return g.Nodes[i].Namespace < g.Nodes[j].Namespace
+		}
+		return g.Nodes[i].ID < g.Nodes[j].ID
+	})
+	sort.Slice(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+}
+
+// dependentsGraph walks the reverse dependency edges of m, the services of
+// namespace ns, from roots and returns every service that directly or
+// transitively depends on them.
+func dependentsGraph(m map[string]ServiceInfo, ns string, roots []string) DependencyGraph {
+	dependents := map[string][]string{}
+	for _, s := range m {
+		for _, dep := range s.DependsOn {
+			dependents[dep] = append(dependents[dep], s.ID)
+		}
+	}
+
+	g := newDependencyGraph(ns)
+	g.Roots = append(g.Roots, roots...)
+	seen := map[string]bool{}
+	queue := append([]string(nil), roots...)
+	for _, id := range roots {
+		seen[id] = true
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		s := m[id]
+		g.Nodes = append(g.Nodes, GraphNode{ID: s.ID, Namespace: ns, Name: s.Name, HostID: s.HostID})
+		for _, d := range dependents[id] {
+			g.Edges = append(g.Edges, GraphEdge{From: d, To: id})
+			if !seen[d] {
+				seen[d] = true
+				queue = append(queue, d)
+			}
+		}
+	}
+
+	g.sort()
+	return g
+}
+
+// checkDependencies verifies that every dependency of s exists in m and
+// that adding s to m does not close a cycle.
+func checkDependencies(m map[string]ServiceInfo, s ServiceInfo) error {
+	for _, dep := range s.DependsOn {
+		if dep == s.ID {
+			return ErrDependencyCycle
+		}
+		if _, ok := m[dep]; !ok {
+			return ErrUnknownDependency
+		}
+	}
+
+	// s closes a cycle if it is reachable from one of its own dependencies.
+	seen := map[string]bool{}
+	stack := append([]string(nil), s.DependsOn...)
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if id == s.ID {
+			return ErrDependencyCycle
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		stack = append(stack, m[id].DependsOn...)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// HealthStatus is the outcome of the most recent health check of a service.
+type HealthStatus string
+
+const (
+	HealthPassing  HealthStatus = "passing"
+	HealthWarning  HealthStatus = "warning"
+	HealthCritical HealthStatus = "critical"
+)
+
+// Check types understood by the HealthChecker.
+const (
+	CheckTCP  = "tcp"
+	CheckHTTP = "http"
+	CheckExec = "exec"
+)
+
+// maxHealthHistory bounds the number of results kept per service.
+const maxHealthHistory = 20
+
+// HealthCheck declares how the server probes a service. Checks run against
+// the IP and Port of the host the service is placed on.
+type HealthCheck struct {
+	Type     string   `json:"type"`
+	Path     string   `json:"path,omitempty"`
+	Command  []string `json:"command,omitempty"`
+	Interval Duration `json:"interval"`
+	Timeout  Duration `json:"timeout"`
+}
+
+func (c *HealthCheck) validate() error {
+	if c == nil {
+		return nil
+	}
+	switch c.Type {
+	case CheckTCP, CheckHTTP:
+	case CheckExec:
+		if len(c.Command) == 0 {
+			return ErrInvalidCheck
+		}
+	default:
+		return ErrInvalidCheck
+	}
+	if c.Interval <= 0 || c.Timeout <= 0 || c.Timeout > c.Interval {
+		return ErrInvalidCheck
+	}
+	return nil
+}
+
+// CheckResult is a single run of a health check.
+type CheckResult struct {
+	Status    HealthStatus `json:"status"`
+	Output    string       `json:"output,omitempty"`
+	CheckedAt time.Time    `json:"checktime"`
+}
+
+// ServiceHealth is the current status of a service and its recent history,
+// newest last.
+type ServiceHealth struct {
+	ServiceID string        `json:"serviceid"`
+	Status    HealthStatus  `json:"status,omitempty"`
+	Output    string        `json:"output,omitempty"`
+	CheckedAt time.Time     `json:"checktime"`
+	History   []CheckResult `json:"history"`
+}
+
+func (sh ServiceHealth) record(r CheckResult) ServiceHealth {
+	sh.Status = r.Status
+	sh.Output = r.Output
+	sh.CheckedAt = r.CheckedAt
+	history := append([]CheckResult(nil), sh.History...)
+	history = append(history, r)
+	if len(history) > maxHealthHistory {
+		history = history[len(history)-maxHealthHistory:]
+	}
+	sh.History = history
+	return sh
+}
+
+// Duration is a time.Duration that reads and writes JSON as a string such
+// as "10s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
 )
 
 type MiddlewareService func(Service) Service
@@ -22,27 +23,158 @@ type hostMiddleware struct {
 	hostInfo host.Host
 }
 
+// Hosts are looked up in the host namespace of the record being written;
+// NamespaceMiddleware has already checked that it is shared.
 func (mw hostMiddleware) PostServiceInfo(ctx context.Context, h ServiceInfo) (err error) {
-	if _, err := mw.hostInfo.GetHostInfo(ctx, h.HostID); err != nil {
-		return host.ErrNotFoundID
+	h.setNamespace(ctx)
+	if err := mw.checkPlacement(ctx, h.HostNamespace, h.HostID, h.Owner, false); err != nil {
+		return err
 	}
 
 	return mw.next.PostServiceInfo(ctx, h)
 }
 
 func (mw hostMiddleware) PutServiceInfo(ctx context.Context, id string, h ServiceInfo) (err error) {
-	if _, err := mw.hostInfo.GetHostInfo(ctx, h.HostID); err != nil {
-		return host.ErrNotFoundID
+	h.setNamespace(ctx)
+	if err := mw.checkPlacement(ctx, h.HostNamespace, h.HostID, h.Owner, mw.placed(ctx, id, h)); err != nil {
+		return err
 	}
 
 	return mw.next.PutServiceInfo(ctx, id, h)
 }
 
+// checkPlacement verifies that a host exists and, unless the record being
+// written already sits on it, that it is not cordoned, in maintenance or
+// reserved for another owner than owner.
+func (mw hostMiddleware) checkPlacement(ctx context.Context, hostNamespace, hostID, owner string, placed bool) error {
+	hi, err := mw.hostInfo.GetHostInfo(namespace.NewContext(ctx, hostNamespace), hostID)
+	if err != nil {
+		return host.ErrNotFoundID
+	}
+	switch {
+	case placed:
+		return nil
+	case hi.Cordoned:
+		return ErrHostCordoned
+	case hi.Status == host.StatusMaintenance:
+		return ErrHostInMaintenance
+	case hi.Status == host.StatusReserved && hi.ReservedBy != owner:
+		return ErrHostReserved
+	}
+	return nil
+}
+
+// placed reports whether service id is stored on the host h names.
+func (mw hostMiddleware) placed(ctx context.Context, id string, h ServiceInfo) bool {
+	last, err := mw.next.GetServiceInfo(ctx, id)
+	return err == nil && last.HostID == h.HostID && last.HostNamespace == h.HostNamespace
+}
+
+// checkInstance verifies the placement of in. Its port is checked by the
+// store, which holds the claims of every host.
+func (mw hostMiddleware) checkInstance(ctx context.Context, serviceID string, in Instance) error {
+	in.setNamespace(ctx)
+	owner := ""
+	if s, err := mw.next.GetServiceInfo(ctx, serviceID); err == nil {
+		owner = s.Owner
+	}
+	placed := false
+	if list, err := mw.next.ListServiceInstances(ctx, serviceID); err == nil {
+		for _, last := range list {
+			if last.ID == in.ID && last.HostID == in.HostID && last.HostNamespace == in.HostNamespace {
+				placed = true
+			}
+		}
+	}
+	return mw.checkPlacement(ctx, in.HostNamespace, in.HostID, owner, placed)
+}
+
+// BatchServiceInfo validates the host of every operation. Ports are checked
+// by the store as it applies the batch, so that the claims of earlier
+// operations count.
+func (mw hostMiddleware) BatchServiceInfo(ctx context.Context, b Batch) ([]BatchResult, error) {
+	return ForwardBatch(ctx, b, func(op *ServiceOp) error {
+		if op.Op != OpCreate && op.Op != OpUpdate {
+			return nil
+		}
+		h := op.ServiceInfo
+		h.setNamespace(ctx)
+		placed := op.Op == OpUpdate && mw.placed(ctx, op.id(), h)
+		return mw.checkPlacement(ctx, h.HostNamespace, h.HostID, h.Owner, placed)
+	}, mw.next.BatchServiceInfo)
+}
+
 func (mw hostMiddleware) GetServiceInfo(ctx context.Context, id string) (h ServiceInfo, err error) {
-	
 	return mw.next.GetServiceInfo(ctx, id)
 }
 
 func (mw hostMiddleware) DeleteServiceInfo(ctx context.Context, id string) (err error) {
 	return mw.next.DeleteServiceInfo(ctx, id)
 }
+
+func (mw hostMiddleware) UndeleteServiceInfo(ctx context.Context, id string) (ServiceInfo, error) {
+	return mw.next.UndeleteServiceInfo(ctx, id)
+}
+
+func (mw hostMiddleware) PurgeServiceInfo(ctx context.Context, id string) (ServiceInfo, error) {
+	return mw.next.PurgeServiceInfo(ctx, id)
+}
+
+func (mw hostMiddleware) ListServiceInfo(ctx context.Context, f ServiceFilter) ([]ServiceInfo, error) {
+	return mw.next.ListServiceInfo(ctx, f)
+}
+
+func (mw hostMiddleware) GetServiceHealth(ctx context.Context, id string) (ServiceHealth, error) {
+	return mw.next.GetServiceHealth(ctx, id)
+}
+
+func (mw hostMiddleware) PutServiceHealth(ctx context.Context, id string, r CheckResult) error {
+	return mw.next.PutServiceHealth(ctx, id, r)
+}
+
+func (mw hostMiddleware) GetHostPorts(ctx context.Context, hostID string) (HostPorts, error) {
+	if _, err := mw.hostInfo.GetHostInfo(ctx, hostID); err != nil {
+		return HostPorts{}, host.ErrNotFoundID
+	}
+	return mw.next.GetHostPorts(ctx, hostID)
+}
+
+func (mw hostMiddleware) PostServiceInstance(ctx context.Context, serviceID string, in Instance) error {
+	if err := mw.checkInstance(ctx, serviceID, in); err != nil {
+		return err
+	}
+	return mw.next.PostServiceInstance(ctx, serviceID, in)
+}
+
+func (mw hostMiddleware) PutServiceInstance(ctx context.Context, serviceID, instanceID string, in Instance) error {
+	if err := mw.checkInstance(ctx, serviceID, in); err != nil {
+		return err
+	}
+	return mw.next.PutServiceInstance(ctx, serviceID, instanceID, in)
+}
+
+func (mw hostMiddleware) DeleteServiceInstance(ctx context.Context, serviceID, instanceID string) error {
+	return mw.next.DeleteServiceInstance(ctx, serviceID, instanceID)
+}
+
+func (mw hostMiddleware) ListServiceInstances(ctx context.Context, serviceID string) ([]Instance, error) {
+	return mw.next.ListServiceInstances(ctx, serviceID)
+}
+
+func (mw hostMiddleware) ListHostInstances(ctx context.Context, hostID string) ([]Instance, error) {
+	if _, err := mw.hostInfo.GetHostInfo(ctx, hostID); err != nil {
+		return nil, host.ErrNotFoundID
+	}
+	return mw.next.ListHostInstances(ctx, hostID)
+}
+
+func (mw hostMiddleware) GetServiceDependents(ctx context.Context, id string) (DependencyGraph, error) {
+	return mw.next.GetServiceDependents(ctx, id)
+}
+
+func (mw hostMiddleware) GetHostDependents(ctx context.Context, hostID string) (DependencyGraph, error) {
+	if _, err := mw.hostInfo.GetHostInfo(ctx, hostID); err != nil {
+		return DependencyGraph{}, host.ErrNotFoundID
+	}
+	return mw.next.GetHostDependents(ctx, hostID)
+}
@@ -0,0 +1,53 @@
+package service
+
+// keySet is the set of services placed on one host.
+type keySet map[key]struct{}
+
+// hostIndex maps host IDs to the services placed on a host of that ID, in
+// any host namespace. Instances are not indexed.
+type hostIndex map[string]keySet
+
+func (ix hostIndex) add(h ServiceInfo) {
+	if h.HostID == "" {
+		return
+	}
+	if ix[h.HostID] == nil {
+		ix[h.HostID] = keySet{}
+	}
+	ix[h.HostID][keyOf(h)] = struct{}{}
+}
+
+func (ix hostIndex) remove(h ServiceInfo) {
+	delete(ix[h.HostID], keyOf(h))
+	if len(ix[h.HostID]) == 0 {
+		delete(ix, h.HostID)
+	}
+}
+
+// onHost returns the services placed on host hostID of namespace hostNS.
+func (s *inmemService) onHost(hostNS, hostID string) []ServiceInfo {
+	var list []ServiceInfo
+	for k := range s.byHost[hostID] {
+		if h := s.m[k]; h.HostNamespace == hostNS {
+			list = append(list, h)
+		}
+	}
+	return list
+}
+
+// candidates returns the services that may match f, read from the host
+// index when f names a host. The caller still matches them against f.
+func (s *inmemService) candidates(f ServiceFilter) []ServiceInfo {
+	if f.HostID != "" {
+		list := make([]ServiceInfo, 0, len(s.byHost[f.HostID]))
+		for k := range s.byHost[f.HostID] {
+			list = append(list, s.m[k])
+		}
+		return list
+	}
+	list := make([]ServiceInfo, 0, len(s.m))
+	for _, h := range s.m {
+		list = append(list, h)
+	}
+	return list
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// InstanceStatus is the lifecycle state of a single instance of a service.
+type InstanceStatus string
+
+const (
+	InstanceRunning  InstanceStatus = "running"
+	InstanceStopped  InstanceStatus = "stopped"
+	InstanceStarting InstanceStatus = "starting"
+	InstanceFailed   InstanceStatus = "failed"
+)
+
+// Instance is one replica of a service, bound to a host and port. A service
+// may have any number of instances spread over different hosts.
+type Instance struct {
+	ID            string         `json:"id"`
+	Namespace     string         `json:"namespace"`
+	ServiceID     string         `json:"serviceid"`
+	HostID        string         `json:"hostid"`
+	HostNamespace string         `json:"hostnamespace"`
+	Port          int            `json:"port"`
+	Protocol      string         `json:"protocol,omitempty"`
+	Status        InstanceStatus `json:"status"`
+	CreatedAt     time.Time      `json:"createtime"`
+	UpdatedAt     time.Time      `json:"updatetime"`
+}
+
+// setNamespace scopes in to the namespace of ctx, which is that of its
+// service. An instance without a host namespace is placed on a host of its
+// own namespace.
+func (in *Instance) setNamespace(ctx context.Context) {
+	in.Namespace = namespace.FromContext(ctx)
+	if in.HostNamespace == "" {
+		in.HostNamespace = in.Namespace
+	}
+}
+
+func (in Instance) port() ServicePort {
+	return ServicePort{Port: in.Port, Protocol: in.Protocol}
+}
+
+func (in *Instance) validate() error {
+	if in.ID == "" || in.HostID == "" {
+		return ErrInvalidInstance
+	}
+	if in.Port != 0 {
+		if err := validatePorts([]ServicePort{in.port()}); err != nil {
+			return err
+		}
+	}
+	switch in.Status {
+	case "":
+		in.Status = InstanceRunning
+	case InstanceRunning, InstanceStopped, InstanceStarting, InstanceFailed:
+	default:
+		return ErrInvalidInstance
+	}
+	return nil
+}
@@ -5,6 +5,9 @@ import (
 	"time"
 
 	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
 )
 
 type Middleware func(Service) Service
@@ -25,29 +28,127 @@ type loggingMiddleware struct {
 
 func (mw loggingMiddleware) PostServiceInfo(ctx context.Context, h ServiceInfo) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "PostServiceInfo", "id", h.ID, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "PostServiceInfo", "namespace", namespace.FromContext(ctx), "id", h.ID, "took", time.Since(begin), "err", err)
 	}(time.Now())
 	return mw.next.PostServiceInfo(ctx, h)
 }
 
 func (mw loggingMiddleware) GetServiceInfo(ctx context.Context, id string) (h ServiceInfo, err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "GetServiceInfo", "id", id, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "GetServiceInfo", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
 	}(time.Now())
 	return mw.next.GetServiceInfo(ctx, id)
 }
 
 func (mw loggingMiddleware) PutServiceInfo(ctx context.Context, id string, h ServiceInfo) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "PutServiceInfo", "id", id, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "PutServiceInfo", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
 	}(time.Now())
 	return mw.next.PutServiceInfo(ctx, id, h)
 }
 
 func (mw loggingMiddleware) DeleteServiceInfo(ctx context.Context, id string) (err error) {
 	defer func(begin time.Time) {
-		mw.logger.Log("method", "DeleteServiceInfo", "id", id, "took", time.Since(begin), "err", err)
+		mw.logger.Log("method", "DeleteServiceInfo", "namespace", namespace.FromContext(ctx), "id", id, "actor", host.ActorFromContext(ctx), "took", time.Since(begin), "err", err)
 	}(time.Now())
 	return mw.next.DeleteServiceInfo(ctx, id)
 }
 
+
+func (mw loggingMiddleware) ListServiceInfo(ctx context.Context, f ServiceFilter) (list []ServiceInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListServiceInfo", "namespace", namespace.FromContext(ctx), "hostid", f.HostID, "health", f.Health, "deleted", f.IncludeDeleted, "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListServiceInfo(ctx, f)
+}
+
+func (mw loggingMiddleware) GetServiceHealth(ctx context.Context, id string) (sh ServiceHealth, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetServiceHealth", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetServiceHealth(ctx, id)
+}
+
+func (mw loggingMiddleware) PutServiceHealth(ctx context.Context, id string, r CheckResult) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutServiceHealth", "namespace", namespace.FromContext(ctx), "id", id, "status", r.Status, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutServiceHealth(ctx, id, r)
+}
+
+func (mw loggingMiddleware) GetHostPorts(ctx context.Context, hostID string) (hp HostPorts, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetHostPorts", "namespace", namespace.FromContext(ctx), "hostid", hostID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetHostPorts(ctx, hostID)
+}
+
+func (mw loggingMiddleware) PostServiceInstance(ctx context.Context, serviceID string, in Instance) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostServiceInstance", "namespace", namespace.FromContext(ctx), "id", serviceID, "instanceid", in.ID, "hostid", in.HostID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostServiceInstance(ctx, serviceID, in)
+}
+
+func (mw loggingMiddleware) PutServiceInstance(ctx context.Context, serviceID, instanceID string, in Instance) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutServiceInstance", "namespace", namespace.FromContext(ctx), "id", serviceID, "instanceid", instanceID, "hostid", in.HostID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutServiceInstance(ctx, serviceID, instanceID, in)
+}
+
+func (mw loggingMiddleware) DeleteServiceInstance(ctx context.Context, serviceID, instanceID string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteServiceInstance", "namespace", namespace.FromContext(ctx), "id", serviceID, "instanceid", instanceID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteServiceInstance(ctx, serviceID, instanceID)
+}
+
+func (mw loggingMiddleware) ListServiceInstances(ctx context.Context, serviceID string) (list []Instance, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListServiceInstances", "namespace", namespace.FromContext(ctx), "id", serviceID, "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListServiceInstances(ctx, serviceID)
+}
+
+func (mw loggingMiddleware) ListHostInstances(ctx context.Context, hostID string) (list []Instance, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListHostInstances", "namespace", namespace.FromContext(ctx), "hostid", hostID, "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListHostInstances(ctx, hostID)
+}
+
+func (mw loggingMiddleware) GetServiceDependents(ctx context.Context, id string) (g DependencyGraph, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetServiceDependents", "namespace", namespace.FromContext(ctx), "id", id, "dependents", len(g.Nodes), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetServiceDependents(ctx, id)
+}
+
+func (mw loggingMiddleware) GetHostDependents(ctx context.Context, hostID string) (g DependencyGraph, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetHostDependents", "namespace", namespace.FromContext(ctx), "hostid", hostID, "dependents", len(g.Nodes), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetHostDependents(ctx, hostID)
+}
+
+func (mw loggingMiddleware) BatchServiceInfo(ctx context.Context, b Batch) (results []BatchResult, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "BatchServiceInfo", "namespace", namespace.FromContext(ctx), "ops", len(b.Ops), "besteffort", b.BestEffort, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.BatchServiceInfo(ctx, b)
+}
+
+func (mw loggingMiddleware) UndeleteServiceInfo(ctx context.Context, id string) (s ServiceInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "UndeleteServiceInfo", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.UndeleteServiceInfo(ctx, id)
+}
+
+func (mw loggingMiddleware) PurgeServiceInfo(ctx context.Context, id string) (s ServiceInfo, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PurgeServiceInfo", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PurgeServiceInfo(ctx, id)
+}
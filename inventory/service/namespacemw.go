@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// NamespaceMiddleware rejects requests scoped to a namespace that does not
+// exist, and services or instances placed on a host of another namespace
+// that is not shared with theirs.
+func NamespaceMiddleware(ns namespace.Namespace) Middleware {
+	return func(next Service) Service {
+		return &namespaceMiddleware{
+			next: next,
+			ns:   ns,
+		}
+	}
+}
+
+type namespaceMiddleware struct {
+	next Service
+	ns   namespace.Namespace
+}
+
+func (mw namespaceMiddleware) check(ctx context.Context) error {
+	if namespace.IsAll(ctx) {
+		return nil
+	}
+	if _, err := mw.ns.GetNamespaceInfo(ctx, namespace.FromContext(ctx)); err != nil {
+		return ErrUnknownNamespace
+	}
+	return nil
+}
+
+// checkHost verifies that services of the namespace in ctx may use the
+// hosts of hostNS.
+func (mw namespaceMiddleware) checkHost(ctx context.Context, hostNS string) error {
+	if err := mw.check(ctx); err != nil {
+		return err
+	}
+	own := namespace.FromContext(ctx)
+	if hostNS == "" || hostNS == own {
+		return nil
+	}
+	n, err := mw.ns.GetNamespaceInfo(ctx, hostNS)
+	if err != nil {
+		return ErrUnknownNamespace
+	}
+	if !n.Shares(own) {
+		return ErrHostNotShared
+	}
+	return nil
+}
+
+func (mw namespaceMiddleware) PostServiceInfo(ctx context.Context, h ServiceInfo) error {
+	if err := mw.checkHost(ctx, h.HostNamespace); err != nil {
+		return err
+	}
+	return mw.next.PostServiceInfo(ctx, h)
+}
+
+func (mw namespaceMiddleware) GetServiceInfo(ctx context.Context, id string) (ServiceInfo, error) {
+	if err := mw.check(ctx); err != nil {
+		return ServiceInfo{}, err
+	}
+	return mw.next.GetServiceInfo(ctx, id)
+}
+
+func (mw namespaceMiddleware) PutServiceInfo(ctx context.Context, id string, h ServiceInfo) error {
+	if err := mw.checkHost(ctx, h.HostNamespace); err != nil {
+		return err
+	}
+	return mw.next.PutServiceInfo(ctx, id, h)
+}
+
+func (mw namespaceMiddleware) DeleteServiceInfo(ctx context.Context, id string) error {
+	if err := mw.check(ctx); err != nil {
+		return err
+	}
+	return mw.next.DeleteServiceInfo(ctx, id)
+}
+
+func (mw namespaceMiddleware) UndeleteServiceInfo(ctx context.Context, id string) (ServiceInfo, error) {
+	if err := mw.check(ctx); err != nil {
+		return ServiceInfo{}, err
+	}
+	return mw.next.UndeleteServiceInfo(ctx, id)
+}
+
+func (mw namespaceMiddleware) PurgeServiceInfo(ctx context.Context, id string) (ServiceInfo, error) {
+	if err := mw.check(ctx); err != nil {
+		return ServiceInfo{}, err
+	}
+	return mw.next.PurgeServiceInfo(ctx, id)
+}
+
+func (mw namespaceMiddleware) ListServiceInfo(ctx context.Context, f ServiceFilter) ([]ServiceInfo, error) {
+	if err := mw.check(ctx); err != nil {
+		return nil, err
+	}
+	return mw.next.ListServiceInfo(ctx, f)
+}
+
+func (mw namespaceMiddleware) GetServiceHealth(ctx context.Context, id string) (ServiceHealth, error) {
+	if err := mw.check(ctx); err != nil {
+		return ServiceHealth{}, err
+	}
+	return mw.next.GetServiceHealth(ctx, id)
+}
+
+func (mw namespaceMiddleware) PutServiceHealth(ctx context.Context, id string, r CheckResult) error {
+	if err := mw.check(ctx); err != nil {
+		return err
+	}
+	return mw.next.PutServiceHealth(ctx, id, r)
+}
+
+func (mw namespaceMiddleware) GetHostPorts(ctx context.Context, hostID string) (HostPorts, error) {
+	if err := mw.check(ctx); err != nil {
+		return HostPorts{}, err
+	}
+	return mw.next.GetHostPorts(ctx, hostID)
+}
+
+func (mw namespaceMiddleware) PostServiceInstance(ctx context.Context, serviceID string, in Instance) error {
+	if err := mw.checkHost(ctx, in.HostNamespace); err != nil {
+		return err
+	}
+	return mw.next.PostServiceInstance(ctx, serviceID, in)
+}
+
+func (mw namespaceMiddleware) PutServiceInstance(ctx context.Context, serviceID, instanceID string, in Instance) error {
+	if err := mw.checkHost(ctx, in.HostNamespace); err != nil {
+		return err
+	}
+	return mw.next.PutServiceInstance(ctx, serviceID, instanceID, in)
+}
+
+func (mw namespaceMiddleware) DeleteServiceInstance(ctx context.Context, serviceID, instanceID string) error {
+	if err := mw.check(ctx); err != nil {
+		return err
+	}
+	return mw.next.DeleteServiceInstance(ctx, serviceID, instanceID)
+}
+
+func (mw namespaceMiddleware) ListServiceInstances(ctx context.Context, serviceID string) ([]Instance, error) {
+	if err := mw.check(ctx); err != nil {
+		return nil, err
+	}
+	return mw.next.ListServiceInstances(ctx, serviceID)
+}
+
+func (mw namespaceMiddleware) ListHostInstances(ctx context.Context, hostID string) ([]Instance, error) {
+	if err := mw.check(ctx); err != nil {
+		return nil, err
+	}
+	return mw.next.ListHostInstances(ctx, hostID)
+}
+
+func (mw namespaceMiddleware) GetServiceDependents(ctx context.Context, id string) (DependencyGraph, error) {
+	if err := mw.check(ctx); err != nil {
+		return DependencyGraph{}, err
+	}
+	return mw.next.GetServiceDependents(ctx, id)
+}
+
+func (mw namespaceMiddleware) GetHostDependents(ctx context.Context, hostID string) (DependencyGraph, error) {
+	if err := mw.check(ctx); err != nil {
+		return DependencyGraph{}, err
+	}
+	return mw.next.GetHostDependents(ctx, hostID)
+}
+
+func (mw namespaceMiddleware) BatchServiceInfo(ctx context.Context, b Batch) ([]BatchResult, error) {
+	if err := mw.check(ctx); err != nil {
+		return nil, err
+	}
+	return ForwardBatch(ctx, b, func(op *ServiceOp) error {
+		if op.Op != OpCreate && op.Op != OpUpdate {
+			return nil
+		}
+		return mw.checkHost(ctx, op.ServiceInfo.HostNamespace)
+	}, mw.next.BatchServiceInfo)
+}
+
+// NamespaceInventoryMiddleware refuses to delete a namespace that still
+// holds hosts or services, and to withdraw sharing from a namespace whose
+// services still use its hosts.
+func NamespaceInventoryMiddleware(hosts host.Host, services Service) namespace.Middleware {
+	return func(next namespace.Namespace) namespace.Namespace {
+		return &namespaceInventoryMiddleware{
+			Namespace: next,
+			hosts:     hosts,
+			services:  services,
+		}
+	}
+}
+
+type namespaceInventoryMiddleware struct {
+	namespace.Namespace
+	hosts    host.Host
+	services Service
+}
+
+func (mw namespaceInventoryMiddleware) PutNamespaceInfo(ctx context.Context, id string, n namespace.NamespaceInfo) error {
+	users, err := mw.hostUsers(ctx, id)
+	if err != nil {
+		return err
+	}
+	for ns := range users {
+		if !n.Shares(ns) {
+			return namespace.ErrInUse
+		}
+	}
+	return mw.Namespace.PutNamespaceInfo(ctx, id, n)
+}
+
+func (mw namespaceInventoryMiddleware) DeleteNamespaceInfo(ctx context.Context, id string) error {
+	if id == namespace.Default {
+		return mw.Namespace.DeleteNamespaceInfo(ctx, id)
+	}
+	nctx := namespace.NewContext(ctx, id)
+	hosts, err := mw.hosts.ListHostInfo(nctx, host.HostFilter{})
+	if err != nil && err != host.ErrUnknownNamespace {
+		return err
+	}
+	services, err := mw.services.ListServiceInfo(nctx, ServiceFilter{})
+	if err != nil && err != ErrUnknownNamespace {
+		return err
+	}
+	if len(hosts) > 0 || len(services) > 0 {
+		return namespace.ErrInUse
+	}
+	return mw.Namespace.DeleteNamespaceInfo(ctx, id)
+}
+
+// hostUsers returns the namespaces whose services or instances are placed
+// on hosts of namespace id.
+func (mw namespaceInventoryMiddleware) hostUsers(ctx context.Context, id string) (map[string]bool, error) {
+	users := map[string]bool{}
+	actx := namespace.AllNamespaces(ctx)
+	services, err := mw.services.ListServiceInfo(actx, ServiceFilter{HostNamespace: id})
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range services {
+		users[s.Namespace] = true
+	}
+	hosts, err := mw.hosts.ListHostInfo(namespace.NewContext(ctx, id), host.HostFilter{})
+	if err != nil && err != host.ErrUnknownNamespace {
+		return nil, err
+	}
+	for _, h := range hosts {
+		instances, err := mw.services.ListHostInstances(namespace.NewContext(ctx, id), h.ID)
+		if err != nil && err != ErrUnknownNamespace {
+			return nil, err
+		}
+		for _, in := range instances {
+			users[in.Namespace] = true
+		}
+	}
+	return users, nil
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Port protocols accepted on a ServicePort. An empty protocol means tcp.
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
+const (
+	minPort = 1
+	maxPort = 65535
+)
+
+// ServicePort is a port a service listens on, on the host it is placed on.
+type ServicePort struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+func (p ServicePort) protocol() string {
+	if p.Protocol == "" {
+		return ProtocolTCP
+	}
+	return p.Protocol
+}
+
+// PortClaim is a port in use on a host and the service holding it, either
+// directly or through one of its instances.
+type PortClaim struct {
+	ServicePort
+	Namespace  string `json:"namespace"`
+	ServiceID  string `json:"serviceid"`
+	InstanceID string `json:"instanceid,omitempty"`
+}
+
+// PortRange is an inclusive range of free ports.
+type PortRange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+// HostPorts lists the used ports of a host and, per protocol, the ranges
+// still free.
+type HostPorts struct {
+	HostID string                 `json:"hostid"`
+	Used   []PortClaim            `json:"used"`
+	Free   map[string][]PortRange `json:"free"`
+}
+
+// PortConflictError is returned when a service claims a port already held
+// by another service on the same host. The holder may belong to another
+// namespace the host is shared with.
+type PortConflictError struct {
+	HostID     string
+	Port       int
+	Protocol   string
+	Namespace  string
+	ServiceID  string
+	InstanceID string
+}
+
+func (e *PortConflictError) Error() string {
+	if e.InstanceID != "" {
+		return fmt.Sprintf("port %d/%s on host %s already claimed by instance %s of service %s", e.Port, e.Protocol, e.HostID, e.InstanceID, e.ServiceID)
+	}
+	return fmt.Sprintf("port %d/%s on host %s already claimed by service %s", e.Port, e.Protocol, e.HostID, e.ServiceID)
+}
+
+func validatePorts(ports []ServicePort) error {
+	seen := map[string]bool{}
+	for _, p := range ports {
+		if p.Port < minPort || p.Port > maxPort {
+			return ErrInvalidPort
+		}
+		proto := p.protocol()
+		if proto != ProtocolTCP && proto != ProtocolUDP {
+			return ErrInvalidPort
+		}
+		key := fmt.Sprintf("%d/%s", p.Port, proto)
+		if seen[key] {
+			return ErrInvalidPort
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// findPortConflict returns the first of ports already held by one of the
+// claims on hostID. Claims for which self returns true belong to the record
+// being written and are ignored.
+func findPortConflict(hostID string, ports []ServicePort, claims []PortClaim, self func(PortClaim) bool) error {
+	for _, c := range claims {
+		if self(c) {
+			continue
+		}
+		for _, p := range ports {
+			if p.Port == c.Port && p.protocol() == c.protocol() {
+				return &PortConflictError{
+					HostID:     hostID,
+					Port:       p.Port,
+					Protocol:   p.protocol(),
+					Namespace:  c.Namespace,
+					ServiceID:  c.ServiceID,
+					InstanceID: c.InstanceID,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// hostClaims returns the ports in use on host hostID of namespace hostNS,
+// claimed by services of any namespace or by their instances.
+func (s *inmemService) hostClaims(hostNS, hostID string) []PortClaim {
+	var used []PortClaim
+	for _, h := range s.onHost(hostNS, hostID) {
+		for _, p := range h.Ports {
+			used = append(used, PortClaim{ServicePort: p, Namespace: h.Namespace, ServiceID: h.ID})
+		}
+	}
+	for _, instances := range s.instances {
+		for _, in := range instances {
+			if in.HostNamespace == hostNS && in.HostID == hostID && in.Port != 0 {
+				used = append(used, PortClaim{ServicePort: in.port(), Namespace: in.Namespace, ServiceID: in.ServiceID, InstanceID: in.ID})
+			}
+		}
+	}
+	return used
+}
+
+// checkPorts refuses h if one of its ports is already claimed on its host.
+// It runs under the lock of s, so that two writes cannot both take a port.
+func (s *inmemService) checkPorts(h ServiceInfo) error {
+	if len(h.Ports) == 0 {
+		return nil
+	}
+	return findPortConflict(h.HostID, h.Ports, s.hostClaims(h.HostNamespace, h.HostID), func(c PortClaim) bool {
+		return c.Namespace == h.Namespace && c.ServiceID == h.ID && c.InstanceID == ""
+	})
+}
+
+// checkInstancePort refuses in if its port is already claimed on its host.
+func (s *inmemService) checkInstancePort(in Instance) error {
+	if in.Port == 0 {
+		return nil
+	}
+	return findPortConflict(in.HostID, []ServicePort{in.port()}, s.hostClaims(in.HostNamespace, in.HostID), func(c PortClaim) bool {
+		return c.Namespace == in.Namespace && c.ServiceID == in.ServiceID && c.InstanceID == in.ID
+	})
+}
+
+func newHostPorts(hostID string, used []PortClaim) HostPorts {
+	for i := range used {
+		used[i].Protocol = used[i].protocol()
+	}
+	sort.Slice(used, func(i, j int) bool {
+		if used[i].Protocol != used[j].Protocol {
+			return used[i].Protocol < used[j].Protocol
+		}
+		return used[i].Port < used[j].Port
+	})
+
+	free := map[string][]PortRange{}
+	for _, proto := range []string{ProtocolTCP, ProtocolUDP} {
+		next := minPort
+		for _, u := range used {
+			if u.Protocol != proto || u.Port < next {
+				continue
+			}
+			if u.Port > next {
+				free[proto] = append(free[proto], PortRange{From: next, To: u.Port - 1})
+			}
+			next = u.Port + 1
+		}
+		if next <= maxPort {
+			free[proto] = append(free[proto], PortRange{From: next, To: maxPort})
+		}
+	}
+
+	if used == nil {
+		used = []PortClaim{}
+	}
+	return HostPorts{HostID: hostID, Used: used, Free: free}
+}
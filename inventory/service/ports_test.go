@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestPortConflicts(t *testing.T) {
+	ctx := context.Background()
+	http := []ServicePort{{Name: "http", Port: 8080}}
+	for _, tc := range []struct {
+		name  string
+		write func(s Service) error
+		want  string // ID of the holder of the port, or "" for no conflict
+	}{
+		{
+			name: "post on the same host",
+			write: func(s Service) error {
+				return s.PostServiceInfo(ctx, ServiceInfo{ID: "b", HostID: "h1", Ports: http})
+			},
+			want: "a",
+		},
+		{
+			name: "post on another host",
+			write: func(s Service) error {
+				return s.PostServiceInfo(ctx, ServiceInfo{ID: "b", HostID: "h2", Ports: http})
+			},
+		},
+		{
+			name: "post with another protocol",
+			write: func(s Service) error {
+				return s.PostServiceInfo(ctx, ServiceInfo{ID: "b", HostID: "h1", Ports: []ServicePort{{Port: 8080, Protocol: ProtocolUDP}}})
+			},
+		},
+		{
+			name: "update keeps its own port",
+			write: func(s Service) error {
+				return s.PutServiceInfo(ctx, "a", ServiceInfo{ID: "a", HostID: "h1", Ports: http, Remark: "updated"})
+			},
+		},
+		{
+			name: "instance on the same host",
+			write: func(s Service) error {
+				return s.PostServiceInstance(ctx, "a", Instance{ID: "i1", HostID: "h1", Port: 8080})
+			},
+			want: "a",
+		},
+		{
+			name: "batch claims a port twice",
+			write: func(s Service) error {
+				results, _ := s.BatchServiceInfo(ctx, Batch{BestEffort: true, Ops: []ServiceOp{
+					{Op: OpCreate, ServiceInfo: ServiceInfo{ID: "b", HostID: "h2", Ports: http}},
+					{Op: OpCreate, ServiceInfo: ServiceInfo{ID: "c", HostID: "h2", Ports: http}},
+				}})
+				return results[1].Err
+			},
+			want: "b",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewInmemService()
+			if err := s.PostServiceInfo(ctx, ServiceInfo{ID: "a", HostID: "h1", Ports: http}); err != nil {
+				t.Fatal(err)
+			}
+			err := tc.write(s)
+			if tc.want == "" {
+				if err != nil {
+					t.Fatalf("got %v, want no error", err)
+				}
+				return
+			}
+			conflict, ok := err.(*PortConflictError)
+			if !ok || conflict.ServiceID != tc.want {
+				t.Fatalf("got %v, want a conflict with %s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestPortConflictsConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s := NewInmemService()
+	const writers = 20
+	errs := make(chan error, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- s.PostServiceInfo(ctx, ServiceInfo{ID: fmt.Sprint(i), HostID: "h1", Ports: []ServicePort{{Port: 443}}})
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	stored := 0
+	for err := range errs {
+		switch err.(type) {
+		case nil:
+			stored++
+		case *PortConflictError:
+		default:
+			t.Fatal(err)
+		}
+	}
+	if stored != 1 {
+		t.Fatalf("%d services claimed the port, want 1", stored)
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// Purger empties the trash: it periodically purges the services and hosts
+// of every namespace deleted more than the retention ago.
+type Purger struct {
+	services  Service
+	hosts     host.Host
+	retention time.Duration
+	logger    log.Logger
+}
+
+// NewPurger returns a purger for the trash of services and hosts. A zero
+// retention keeps deleted records until they are purged by hand.
+func NewPurger(services Service, hosts host.Host, retention time.Duration, logger log.Logger) *Purger {
+	return &Purger{
+		services:  services,
+		hosts:     hosts,
+		retention: retention,
+		logger:    logger,
+	}
+}
+
+// Run purges expired records until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	if p.retention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			p.purge(ctx, now.Add(-p.retention))
+		}
+	}
+}
+
+// purge purges the records deleted before cutoff. Services go first, so
+// that no service is left on a purged host.
+func (p *Purger) purge(ctx context.Context, cutoff time.Time) {
+	actx := namespace.AllNamespaces(ctx)
+	services, err := p.services.ListServiceInfo(actx, ServiceFilter{IncludeDeleted: true})
+	if err != nil {
+		p.logger.Log("during", "list", "kind", "service", "err", err)
+	} else {
+		for _, s := range services {
+			if !s.Deleted() || !s.DeletedAt.Before(cutoff) {
+				continue
+			}
+			_, err := p.services.PurgeServiceInfo(namespace.NewContext(ctx, s.Namespace), s.ID)
+			if err != nil && err != ErrNotFound {
+				p.logger.Log("during", "purge", "kind", "service", "namespace", s.Namespace, "id", s.ID, "err", err)
+			}
+		}
+	}
+
+	hosts, err := p.hosts.ListHostInfo(actx, host.HostFilter{IncludeDeleted: true})
+	if err != nil {
+		p.logger.Log("during", "list", "kind", "host", "err", err)
+		return
+	}
+	for _, h := range hosts {
+		if !h.Deleted() || !h.DeletedAt.Before(cutoff) {
+			continue
+		}
+		_, err := p.hosts.PurgeHostInfo(namespace.NewContext(ctx, h.Namespace), h.ID)
+		if err != nil && err != host.ErrNotFound {
+			p.logger.Log("during", "purge", "kind", "host", "namespace", h.Namespace, "id", h.ID, "err", err)
+		}
+	}
+}
@@ -3,8 +3,13 @@ package service
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
 )
 
 type Service interface {
@@ -12,46 +17,191 @@ type Service interface {
 	GetServiceInfo(ctx context.Context, id string) (ServiceInfo, error)
 	PutServiceInfo(ctx context.Context, id string, h ServiceInfo) error
 	DeleteServiceInfo(ctx context.Context, id string) error
+	ListServiceInfo(ctx context.Context, f ServiceFilter) ([]ServiceInfo, error)
+	GetServiceHealth(ctx context.Context, id string) (ServiceHealth, error)
+	PutServiceHealth(ctx context.Context, id string, r CheckResult) error
+	GetHostPorts(ctx context.Context, hostID string) (HostPorts, error)
+	PostServiceInstance(ctx context.Context, serviceID string, in Instance) error
+	PutServiceInstance(ctx context.Context, serviceID, instanceID string, in Instance) error
+	DeleteServiceInstance(ctx context.Context, serviceID, instanceID string) error
+	ListServiceInstances(ctx context.Context, serviceID string) ([]Instance, error)
+	ListHostInstances(ctx context.Context, hostID string) ([]Instance, error)
+	GetServiceDependents(ctx context.Context, id string) (DependencyGraph, error)
+	GetHostDependents(ctx context.Context, hostID string) (DependencyGraph, error)
+	BatchServiceInfo(ctx context.Context, b Batch) ([]BatchResult, error)
+	UndeleteServiceInfo(ctx context.Context, id string) (ServiceInfo, error)
+	PurgeServiceInfo(ctx context.Context, id string) (ServiceInfo, error)
 }
 
 type ServiceInfo struct {
 	ID         string     `json:"id"`
+	Namespace  string     `json:"namespace"`
 	Name       string     `json:"name"`
+	Owner      string     `json:"owner,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
 	HostID     string     `json:"hostid"`
+	HostNamespace string  `json:"hostnamespace"`
 	CreatedAt  time.Time  `json:"createtime"`
 	UpdatedAt  time.Time  `json:"updatetime"`
 	Remark     string     `json:"remark"`
+	Ports      []ServicePort `json:"ports,omitempty"`
+	DependsOn  []string   `json:"dependson,omitempty"`
+	Check      *HealthCheck `json:"check,omitempty"`
+	Health     HealthStatus `json:"health,omitempty"`
+	Requests   host.Resources `json:"requests"`
+	Version    uint64     `json:"version"`
+	DeletedAt  *time.Time `json:"deletetime,omitempty"`
+	DeletedBy  string     `json:"deletedby,omitempty"`
+}
+
+// setNamespace scopes s to the namespace of ctx. A service without a host
+// namespace is placed on a host of its own namespace.
+func (s *ServiceInfo) setNamespace(ctx context.Context) {
+	s.Namespace = namespace.FromContext(ctx)
+	if s.HostNamespace == "" {
+		s.HostNamespace = s.Namespace
+	}
+}
+
+// ServiceFilter selects services in ListServiceInfo. Empty fields match
+// every service. Deleted services are only listed with IncludeDeleted.
+type ServiceFilter struct {
+	HostID         string
+	HostNamespace  string
+	Health         HealthStatus
+	IncludeDeleted bool
+}
+
+func (f ServiceFilter) match(s ServiceInfo) bool {
+	if s.Deleted() && !f.IncludeDeleted {
+		return false
+	}
+	if f.HostID != "" && f.HostID != s.HostID {
+		return false
+	}
+	if f.HostNamespace != "" && f.HostNamespace != s.HostNamespace {
+		return false
+	}
+	if f.Health != "" && f.Health != s.Health {
+		return false
+	}
+	return true
 }
 
 var (
 	ErrInconsistentIDs = errors.New("inconsistent IDs")
 	ErrAlreadyExists   = errors.New("already exists")
 	ErrNotFound        = errors.New("not found")
+	ErrInvalidCheck    = errors.New("invalid health check")
+	ErrInvalidPort     = errors.New("invalid port")
+	ErrInvalidInstance = errors.New("invalid instance")
+	ErrInvalidRequests = errors.New("invalid resource requests")
+	ErrUnknownDependency = errors.New("unknown dependency")
+	ErrDependencyCycle   = errors.New("dependency cycle")
+	ErrHasDependents     = errors.New("service has dependents")
+	ErrUnknownNamespace  = errors.New("unknown namespace")
+	ErrHostCordoned      = errors.New("host is cordoned")
+	ErrHostInMaintenance = errors.New("host is in maintenance")
+	ErrHostReserved      = errors.New("host is reserved by another owner")
+	ErrHostNotShared     = errors.New("host namespace is not shared with the service's namespace")
+	ErrDeleted           = errors.New("deleted, undelete or purge it first")
 )
 
+// DeniedError is returned when an admission hook or a policy rejects a
+// write. By names what rejected it and Reason is the explanation given.
+type DeniedError struct {
+	By     string
+	Reason string
+}
+
+func (e *DeniedError) Error() string {
+	return fmt.Sprintf("denied by %s: %s", e.By, e.Reason)
+}
+
+// key identifies a service across namespaces.
+type key struct {
+	namespace string
+	id        string
+}
+
+func keyOf(s ServiceInfo) key {
+	return key{namespace: s.Namespace, id: s.ID}
+}
+
+func keyFrom(ctx context.Context, id string) key {
+	return key{namespace: namespace.FromContext(ctx), id: id}
+}
+
 type inmemService struct {
-	mtx sync.RWMutex
-	m   map[string]ServiceInfo
+	mtx       sync.RWMutex
+	m         map[key]ServiceInfo
+	health    map[key]ServiceHealth
+	instances map[key]map[string]Instance
+	byHost    hostIndex
 }
 
+// NewInmemService returns a store that keeps services in memory, indexed
+// by the host they are placed on.
 func NewInmemService() Service {
 	return &inmemService{
-		m: map[string]ServiceInfo{},
+		m:         map[key]ServiceInfo{},
+		health:    map[key]ServiceHealth{},
+		instances: map[key]map[string]Instance{},
+		byHost:    hostIndex{},
 	}
 }
 
+// inNamespace returns the services of namespace ns by ID, leaving out
+// deleted ones. Dependencies never cross namespaces.
+func (s *inmemService) inNamespace(ns string) map[string]ServiceInfo {
+	m := map[string]ServiceInfo{}
+	for k, h := range s.m {
+		if k.namespace == ns && !h.Deleted() {
+			m[k.id] = h
+		}
+	}
+	return m
+}
+
 func (s *inmemService) PostServiceInfo(ctx context.Context, h ServiceInfo) error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
-	if _, ok := s.m[h.ID]; ok {
+	return s.post(ctx, h)
+}
+
+func (s *inmemService) post(ctx context.Context, h ServiceInfo) error {
+	h.setNamespace(ctx)
+	if err := h.Check.validate(); err != nil {
+		return err
+	}
+	if err := validatePorts(h.Ports); err != nil {
+		return err
+	}
+	if err := h.Requests.Validate(); err != nil {
+		return ErrInvalidRequests
+	}
+	if last, ok := s.m[keyOf(h)]; ok {
+		if last.Deleted() {
+			return ErrDeleted
+		}
 		return ErrAlreadyExists
 	}
+	if err := checkDependencies(s.inNamespace(h.Namespace), h); err != nil {
+		return err
+	}
+	if err := s.checkPorts(h); err != nil {
+		return err
+	}
 
-	currentTime := time.Now()
+	currentTime := host.TimeFromContext(ctx)
 	h.CreatedAt = currentTime
 	h.UpdatedAt = currentTime
+	h.Health = ""
+	h.DeletedAt, h.DeletedBy = nil, ""
+	h.Version = 1
 
-	s.m[h.ID] = h
+	s.m[keyOf(h)] = h
+	s.byHost.add(h)
 
 	return nil
 }
@@ -59,29 +209,60 @@ func (s *inmemService) PostServiceInfo(ctx context.Context, h ServiceInfo) error
 func (s *inmemService) GetServiceInfo(ctx context.Context, id string) (ServiceInfo, error) {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
-	h, ok := s.m[id]
-	if !ok {
+	k := keyFrom(ctx, id)
+	h, ok := s.m[k]
+	if !ok || h.Deleted() {
 		return ServiceInfo{}, ErrNotFound
 	}
+	h.Health = s.health[k].Status
 	return h, nil
 }
 
 func (s *inmemService) PutServiceInfo(ctx context.Context, id string, h ServiceInfo) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return s.put(ctx, id, h)
+}
+
+func (s *inmemService) put(ctx context.Context, id string, h ServiceInfo) error {
 	if id != h.ID {
 		return ErrInconsistentIDs
 	}
-	s.mtx.Lock()
-	defer s.mtx.Unlock()
+	h.setNamespace(ctx)
+	if err := h.Check.validate(); err != nil {
+		return err
+	}
+	if err := validatePorts(h.Ports); err != nil {
+		return err
+	}
+	if err := h.Requests.Validate(); err != nil {
+		return ErrInvalidRequests
+	}
+	hLast, ok := s.m[keyOf(h)]
+	if ok && hLast.Deleted() {
+		return ErrDeleted
+	}
+	if err := checkDependencies(s.inNamespace(h.Namespace), h); err != nil {
+		return err
+	}
+	if err := s.checkPorts(h); err != nil {
+		return err
+	}
 
-	currentTime := time.Now()
+	currentTime := host.TimeFromContext(ctx)
 	h.UpdatedAt = currentTime
+	h.Health = ""
+	h.DeletedAt, h.DeletedBy = nil, ""
 
-	hLast, ok := s.m[id]
+	h.Version = 1
 	if ok {
 		h.CreatedAt = hLast.CreatedAt
+		h.Version = hLast.Version + 1
+		s.byHost.remove(hLast)
 	}
 
-	s.m[id] = h
+	s.m[keyOf(h)] = h
+	s.byHost.add(h)
 
 	return nil
 }
@@ -89,10 +270,249 @@ func (s *inmemService) PutServiceInfo(ctx context.Context, id string, h ServiceI
 func (s *inmemService) DeleteServiceInfo(ctx context.Context, id string) error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
-	if _, ok := s.m[id]; !ok {
+	return s.delete(ctx, id)
+}
+
+// delete moves the service to the trash. Its ports, health and instances
+// are kept until it is purged, so that undeleting it restores them.
+func (s *inmemService) delete(ctx context.Context, id string) error {
+	k := keyFrom(ctx, id)
+	h, ok := s.m[k]
+	if !ok || h.Deleted() {
+		return ErrNotFound
+	}
+	if err := s.checkDependents(k); err != nil {
+		return err
+	}
+	deletedAt := host.TimeFromContext(ctx)
+	h.DeletedAt, h.DeletedBy = &deletedAt, host.ActorFromContext(ctx)
+	h.Version++
+	s.m[k] = h
+	return nil
+}
+
+// checkDependents refuses to remove the service k while others depend on
+// it.
+func (s *inmemService) checkDependents(k key) error {
+	for _, other := range s.inNamespace(k.namespace) {
+		for _, dep := range other.DependsOn {
+			if dep == k.id {
+				return ErrHasDependents
+			}
+		}
+	}
+	return nil
+}
+
+func (s *inmemService) ListServiceInfo(ctx context.Context, f ServiceFilter) ([]ServiceInfo, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	ns, all := namespace.FromContext(ctx), namespace.IsAll(ctx)
+	list := []ServiceInfo{}
+	for _, h := range s.candidates(f) {
+		k := keyOf(h)
+		h.Health = s.health[k].Status
+		if (all || k.namespace == ns) && f.match(h) {
+			list = append(list, h)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Namespace != list[j].Namespace {
+			return list[i].Namespace < list[j].Namespace
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list, nil
+}
+
+func (s *inmemService) GetServiceHealth(ctx context.Context, id string) (ServiceHealth, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	k := keyFrom(ctx, id)
+	if !s.exists(k) {
+		return ServiceHealth{}, ErrNotFound
+	}
+	sh := s.health[k]
+	sh.ServiceID = id
+	sh.History = append([]CheckResult(nil), sh.History...)
+	return sh, nil
+}
+
+func (s *inmemService) PutServiceHealth(ctx context.Context, id string, r CheckResult) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := keyFrom(ctx, id)
+	if !s.exists(k) {
 		return ErrNotFound
 	}
-	delete(s.m, id)
+	s.health[k] = s.health[k].record(r)
+	return nil
+}
+
+// GetHostPorts returns the ports in use on host hostID of the namespace in
+// ctx, claimed by services of any namespace the host is shared with.
+func (s *inmemService) GetHostPorts(ctx context.Context, hostID string) (HostPorts, error) {
+	hostNS := namespace.FromContext(ctx)
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	return newHostPorts(hostID, s.hostClaims(hostNS, hostID)), nil
+}
+
+func (s *inmemService) PostServiceInstance(ctx context.Context, serviceID string, in Instance) error {
+	in.setNamespace(ctx)
+	if err := in.validate(); err != nil {
+		return err
+	}
+	k := keyFrom(ctx, serviceID)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if !s.exists(k) {
+		return ErrNotFound
+	}
+	instances, ok := s.instances[k]
+	if !ok {
+		instances = map[string]Instance{}
+		s.instances[k] = instances
+	}
+	if _, ok := instances[in.ID]; ok {
+		return ErrAlreadyExists
+	}
+	in.ServiceID = serviceID
+	if err := s.checkInstancePort(in); err != nil {
+		return err
+	}
+
+	currentTime := host.TimeFromContext(ctx)
+	in.CreatedAt = currentTime
+	in.UpdatedAt = currentTime
+
+	instances[in.ID] = in
 	return nil
 }
 
+func (s *inmemService) PutServiceInstance(ctx context.Context, serviceID, instanceID string, in Instance) error {
+	if instanceID != in.ID {
+		return ErrInconsistentIDs
+	}
+	in.setNamespace(ctx)
+	if err := in.validate(); err != nil {
+		return err
+	}
+	k := keyFrom(ctx, serviceID)
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	last, ok := s.instances[k][instanceID]
+	if !ok {
+		return ErrNotFound
+	}
+	in.ServiceID = serviceID
+	if err := s.checkInstancePort(in); err != nil {
+		return err
+	}
+
+	in.CreatedAt = last.CreatedAt
+	in.UpdatedAt = host.TimeFromContext(ctx)
+
+	s.instances[k][instanceID] = in
+	return nil
+}
+
+func (s *inmemService) DeleteServiceInstance(ctx context.Context, serviceID, instanceID string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := keyFrom(ctx, serviceID)
+	if _, ok := s.instances[k][instanceID]; !ok {
+		return ErrNotFound
+	}
+	delete(s.instances[k], instanceID)
+	return nil
+}
+
+func (s *inmemService) ListServiceInstances(ctx context.Context, serviceID string) ([]Instance, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	k := keyFrom(ctx, serviceID)
+	if !s.exists(k) {
+		return nil, ErrNotFound
+	}
+	list := []Instance{}
+	for _, in := range s.instances[k] {
+		list = append(list, in)
+	}
+	sortInstances(list)
+	return list, nil
+}
+
+// ListHostInstances returns the instances, of any namespace, placed on host
+// hostID of the namespace in ctx, or on every host of that namespace if
+// hostID is empty.
+func (s *inmemService) ListHostInstances(ctx context.Context, hostID string) ([]Instance, error) {
+	hostNS := namespace.FromContext(ctx)
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []Instance{}
+	for _, instances := range s.instances {
+		for _, in := range instances {
+			if in.HostNamespace == hostNS && (hostID == "" || in.HostID == hostID) {
+				list = append(list, in)
+			}
+		}
+	}
+	sortInstances(list)
+	return list, nil
+}
+
+func (s *inmemService) GetServiceDependents(ctx context.Context, id string) (DependencyGraph, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	k := keyFrom(ctx, id)
+	if !s.exists(k) {
+		return DependencyGraph{}, ErrNotFound
+	}
+	return dependentsGraph(s.inNamespace(k.namespace), k.namespace, []string{id}), nil
+}
+
+// GetHostDependents returns the services affected by host hostID of the
+// namespace in ctx. Services of other namespaces sharing the host are
+// included, with their IDs written namespace/id.
+func (s *inmemService) GetHostDependents(ctx context.Context, hostID string) (DependencyGraph, error) {
+	hostNS := namespace.FromContext(ctx)
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	placed := map[key]bool{}
+	for _, h := range s.onHost(hostNS, hostID) {
+		if !h.Deleted() {
+			placed[keyOf(h)] = true
+		}
+	}
+	for k, instances := range s.instances {
+		if !s.exists(k) {
+			continue
+		}
+		for _, in := range instances {
+			if in.HostNamespace == hostNS && in.HostID == hostID {
+				placed[k] = true
+			}
+		}
+	}
+	roots := map[string][]string{}
+	for k := range placed {
+		roots[k.namespace] = append(roots[k.namespace], k.id)
+	}
+	g := newDependencyGraph(hostNS)
+	for ns, ids := range roots {
+		sort.Strings(ids)
+		g.merge(dependentsGraph(s.inNamespace(ns), ns, ids))
+	}
+	g.sort()
+	return g, nil
+}
+
+func sortInstances(list []Instance) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ServiceID != list[j].ServiceID {
+			return list[i].ServiceID < list[j].ServiceID
+		}
+		return list[i].ID < list[j].ID
+	})
+}
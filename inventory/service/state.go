@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"sort"
+)
+
+// State is the whole content of a service store: every service of every
+// namespace, with its health and instances.
+type State struct {
+	Services  []ServiceInfo  `json:"services"`
+	Health    []HealthRecord `json:"health"`
+	Instances []Instance     `json:"instances"`
+}
+
+// HealthRecord is the health of a service of Namespace.
+type HealthRecord struct {
+	Namespace string `json:"namespace"`
+	ServiceHealth
+}
+
+// Snapshotter is implemented by stores whose whole content can be read and
+// replaced at once, to replicate or back it up. LoadState replaces the
+// content of the store with st.
+type Snapshotter interface {
+	DumpState(ctx context.Context) (State, error)
+	LoadState(ctx context.Context, st State) error
+}
+
+// RecordReader is implemented by stores that can read one service, health
+// record or instance as they keep it, in the trash or not, so that a
+// backend can write only the records a write changed. The methods report
+// false for a record the store does not have.
+type RecordReader interface {
+	GetServiceRecord(ctx context.Context, id string) (ServiceInfo, bool)
+	GetHealthRecord(ctx context.Context, id string) (HealthRecord, bool)
+	GetInstanceRecord(ctx context.Context, serviceID, id string) (Instance, bool)
+}
+
+func (s *inmemService) GetServiceRecord(ctx context.Context, id string) (ServiceInfo, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	h, ok := s.m[keyFrom(ctx, id)]
+	return h, ok
+}
+
+func (s *inmemService) GetHealthRecord(ctx context.Context, id string) (HealthRecord, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	k := keyFrom(ctx, id)
+	sh, ok := s.health[k]
+	sh.ServiceID = id
+	return HealthRecord{Namespace: k.namespace, ServiceHealth: sh}, ok
+}
+
+func (s *inmemService) GetInstanceRecord(ctx context.Context, serviceID, id string) (Instance, bool) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	in, ok := s.instances[keyFrom(ctx, serviceID)][id]
+	return in, ok
+}
+
+func (s *inmemService) DumpState(ctx context.Context) (State, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	st := State{
+		Services:  make([]ServiceInfo, 0, len(s.m)),
+		Health:    []HealthRecord{},
+		Instances: []Instance{},
+	}
+	for _, h := range s.m {
+		st.Services = append(st.Services, h)
+	}
+	for k, sh := range s.health {
+		sh.ServiceID = k.id
+		st.Health = append(st.Health, HealthRecord{Namespace: k.namespace, ServiceHealth: sh})
+	}
+	for _, instances := range s.instances {
+		for _, in := range instances {
+			st.Instances = append(st.Instances, in)
+		}
+	}
+	sort.Slice(st.Services, func(i, j int) bool {
+		if st.Services[i].Namespace != st.Services[j].Namespace {
+			return st.Services[i].Namespace < st.Services[j].Namespace
+		}
+		return st.Services[i].ID < st.Services[j].ID
+	})
+	sort.Slice(st.Health, func(i, j int) bool {
+		if st.Health[i].Namespace != st.Health[j].Namespace {
+			return st.Health[i].Namespace < st.Health[j].Namespace
+		}
+		return st.Health[i].ServiceID < st.Health[j].ServiceID
+	})
+	sort.Slice(st.Instances, func(i, j int) bool {
+		a, b := st.Instances[i], st.Instances[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.ServiceID != b.ServiceID {
+			return a.ServiceID < b.ServiceID
+		}
+		return a.ID < b.ID
+	})
+	return st, nil
+}
+
+// LoadState takes the services of st as they are, versions and times
+// included. Health and instances of unknown services are refused.
+func (s *inmemService) LoadState(ctx context.Context, st State) error {
+	c := &inmemService{
+		m:         make(map[key]ServiceInfo, len(st.Services)),
+		health:    map[key]ServiceHealth{},
+		instances: map[key]map[string]Instance{},
+		byHost:    hostIndex{},
+	}
+	for _, h := range st.Services {
+		if _, ok := c.m[keyOf(h)]; ok {
+			return ErrAlreadyExists
+		}
+		h.Health = ""
+		c.m[keyOf(h)] = h
+		c.byHost.add(h)
+	}
+	for _, r := range st.Health {
+		k := key{namespace: r.Namespace, id: r.ServiceID}
+		if _, ok := c.m[k]; !ok {
+			return ErrNotFound
+		}
+		c.health[k] = r.ServiceHealth
+	}
+	for _, in := range st.Instances {
+		k := key{namespace: in.Namespace, id: in.ServiceID}
+		if _, ok := c.m[k]; !ok {
+			return ErrNotFound
+		}
+		if c.instances[k] == nil {
+			c.instances[k] = map[string]Instance{}
+		}
+		c.instances[k][in.ID] = in
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.m, s.health, s.instances, s.byHost = c.m, c.health, c.instances, c.byHost
+	return nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s := NewInmemService()
+	if err := s.PostServiceInfo(ctx, ServiceInfo{ID: "a", HostID: "h1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PostServiceInstance(ctx, "a", Instance{ID: "1", HostID: "h2", Port: 9000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutServiceHealth(ctx, "a", CheckResult{Status: HealthPassing, CheckedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	st, err := s.(Snapshotter).DumpState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewInmemService()
+	if err := c.(Snapshotter).LoadState(ctx, st); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.(Snapshotter).DumpState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, st) {
+		t.Fatalf("loaded %+v, want %+v", got, st)
+	}
+	if sh, err := c.GetServiceHealth(ctx, "a"); err != nil || sh.Status != HealthPassing {
+		t.Fatalf("got health %+v, %v, want passing", sh, err)
+	}
+}
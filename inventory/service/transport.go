@@ -14,6 +14,9 @@ import (
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/transport"
 	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
 )
 
 var (
@@ -26,33 +29,115 @@ func MakeHTTPHandler(s Service, logger log.Logger) http.Handler {
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
 		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext, host.ActorHTTPToContext),
 	}
 
-	r.Methods("POST").Path("/service/v1/serviceinfo/").Handler(httptransport.NewServer(
-		e.PostServiceInfoEndpoint,
-		decodePostServiceInfoRequest,
-		encodeResponse,
-		options...,
-	))
-	r.Methods("GET").Path("/service/v1/serviceinfo/{id}").Handler(httptransport.NewServer(
-		e.GetServiceInfoEndpoint,
-		decodeGetServiceInfoRequest,
-		encodeResponse,
-		options...,
-	))
-	r.Methods("PUT").Path("/service/v1/serviceinfo/{id}").Handler(httptransport.NewServer(
-		e.PutServiceInfoEndpoint,
-		decodePutServiceInfoRequest,
-		encodeResponse,
-		options...,
-	))
-	r.Methods("DELETE").Path("/service/v1/serviceinfo/{id}").Handler(httptransport.NewServer(
-		e.DeleteServiceInfoEndpoint,
-		decodeDeleteServiceInfoRequest,
-		encodeResponse,
-		options...,
-	))
+	// The unscoped routes serve the default namespace.
+	for _, prefix := range []string{"/service/v1", "/service/v1/namespaces/{ns}"} {
+		r.Methods("POST").Path(prefix + "/serviceinfo/").Handler(httptransport.NewServer(
+			e.PostServiceInfoEndpoint,
+			decodePostServiceInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/serviceinfo/{id}").Handler(httptransport.NewServer(
+			e.GetServiceInfoEndpoint,
+			decodeGetServiceInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("PUT").Path(prefix + "/serviceinfo/{id}").Handler(httptransport.NewServer(
+			e.PutServiceInfoEndpoint,
+			decodePutServiceInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("DELETE").Path(prefix + "/serviceinfo/{id}").Queries("purge", "true").Handler(httptransport.NewServer(
+			e.PurgeServiceInfoEndpoint,
+			decodePurgeServiceInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("DELETE").Path(prefix + "/serviceinfo/{id}").Handler(httptransport.NewServer(
+			e.DeleteServiceInfoEndpoint,
+			decodeDeleteServiceInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("POST").Path(prefix + "/serviceinfo/{id}/undelete").Handler(httptransport.NewServer(
+			e.UndeleteServiceInfoEndpoint,
+			decodeUndeleteServiceInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/serviceinfo/").Handler(httptransport.NewServer(
+			e.ListServiceInfoEndpoint,
+			decodeListServiceInfoRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/serviceinfo/{id}/health").Handler(httptransport.NewServer(
+			e.GetServiceHealthEndpoint,
+			decodeGetServiceHealthRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/hosts/{hostid}/ports").Handler(httptransport.NewServer(
+			e.GetHostPortsEndpoint,
+			decodeGetHostPortsRequest,
+			encodeResponse,
+			options...,
+		))
 
+		r.Methods("POST").Path(prefix + "/serviceinfo/{id}/instances/").Handler(httptransport.NewServer(
+			e.PostServiceInstanceEndpoint,
+			decodePostServiceInstanceRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("PUT").Path(prefix + "/serviceinfo/{id}/instances/{instanceid}").Handler(httptransport.NewServer(
+			e.PutServiceInstanceEndpoint,
+			decodePutServiceInstanceRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("DELETE").Path(prefix + "/serviceinfo/{id}/instances/{instanceid}").Handler(httptransport.NewServer(
+			e.DeleteServiceInstanceEndpoint,
+			decodeDeleteServiceInstanceRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/serviceinfo/{id}/instances/").Handler(httptransport.NewServer(
+			e.ListServiceInstancesEndpoint,
+			decodeListServiceInstancesRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/hosts/{hostid}/instances").Handler(httptransport.NewServer(
+			e.ListHostInstancesEndpoint,
+			decodeListHostInstancesRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/serviceinfo/{id}/dependents").Handler(httptransport.NewServer(
+			e.GetServiceDependentsEndpoint,
+			decodeGetServiceDependentsRequest,
+			encodeGraphResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/hosts/{hostid}/dependents").Handler(httptransport.NewServer(
+			e.GetHostDependentsEndpoint,
+			decodeGetHostDependentsRequest,
+			encodeGraphResponse,
+			options...,
+		))
+		r.Methods("POST").Path(prefix + "/batch").Handler(httptransport.NewServer(
+			e.BatchServiceInfoEndpoint,
+			decodeBatchServiceInfoRequest,
+			encodeBatchResponse,
+			options...,
+		))
+	}
 	return r
 }
 
@@ -98,34 +183,276 @@ func decodeDeleteServiceInfoRequest(_ context.Context, r *http.Request) (request
 	return deleteServiceInfoRequest{ID: id}, nil
 }
 
+func decodeUndeleteServiceInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return undeleteServiceInfoRequest{ID: id}, nil
+}
+
+func decodePurgeServiceInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return purgeServiceInfoRequest{ID: id}, nil
+}
+
+func decodeListServiceInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	return listServiceInfoRequest{Filter: ServiceFilter{
+		HostID:         q.Get("hostid"),
+		HostNamespace:  q.Get("hostnamespace"),
+		Health:         HealthStatus(q.Get("health")),
+		IncludeDeleted: q.Get("includeDeleted") == "true",
+	}}, nil
+}
+
+func decodeGetServiceHealthRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getServiceHealthRequest{ID: id}, nil
+}
+
+func decodeGetHostPortsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	hostID, ok := vars["hostid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getHostPortsRequest{HostID: hostID}, nil
+}
+
+func decodePostServiceInstanceRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var instance Instance
+	if err := json.NewDecoder(r.Body).Decode(&instance); err != nil {
+		return nil, err
+	}
+	return postServiceInstanceRequest{
+		ServiceID: id,
+		Instance:  instance,
+	}, nil
+}
+
+func decodePutServiceInstanceRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	instanceID, ok := vars["instanceid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var instance Instance
+	if err := json.NewDecoder(r.Body).Decode(&instance); err != nil {
+		return nil, err
+	}
+	return putServiceInstanceRequest{
+		ServiceID:  id,
+		InstanceID: instanceID,
+		Instance:   instance,
+	}, nil
+}
+
+func decodeDeleteServiceInstanceRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	instanceID, ok := vars["instanceid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return deleteServiceInstanceRequest{ServiceID: id, InstanceID: instanceID}, nil
+}
+
+func decodeListServiceInstancesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return listServiceInstancesRequest{ServiceID: id}, nil
+}
+
+func decodeListHostInstancesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	hostID, ok := vars["hostid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return listHostInstancesRequest{HostID: hostID}, nil
+}
+
+func decodeGetServiceDependentsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getServiceDependentsRequest{ID: id, Format: r.URL.Query().Get("format")}, nil
+}
+
+func decodeGetHostDependentsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	hostID, ok := vars["hostid"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getHostDependentsRequest{HostID: hostID, Format: r.URL.Query().Get("format")}, nil
+}
+
+func decodeBatchServiceInfoRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req batchServiceInfoRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Batch); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
 func encodePostServiceInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
-	req.URL.Path = "/service/v1/serviceinfo/"
+	req.URL.Path = basePath(ctx) + "/serviceinfo/"
 	return encodeRequest(ctx, req, request)
 }
 
 func encodeGetServiceInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
 	r := request.(getServiceInfoRequest)
 	serviceID := url.QueryEscape(r.ID)
-	req.URL.Path = "/service/v1/serviceinfo/" + serviceID
+	req.URL.Path = basePath(ctx) + "/serviceinfo/" + serviceID
 	return encodeRequest(ctx, req, request)
 }
 
 func encodePutServiceInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
-	// r.Methods("PUT").Path("/serviceinfo/{id}")
 	r := request.(putServiceInfoRequest)
 	serviceID := url.QueryEscape(r.ID)
-	req.URL.Path = "/serviceinfo/" + serviceID
+	req.URL.Path = basePath(ctx) + "/serviceinfo/" + serviceID
 	return encodeRequest(ctx, req, request)
 }
 
 func encodeDeleteServiceInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
-	// r.Methods("DELETE").Path("/serviceinfo/{id}")
 	r := request.(deleteServiceInfoRequest)
 	serviceID := url.QueryEscape(r.ID)
-	req.URL.Path = "/serviceinfo/" + serviceID
+	req.URL.Path = basePath(ctx) + "/serviceinfo/" + serviceID
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeListServiceInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(listServiceInfoRequest)
+	q := url.Values{}
+	if r.Filter.HostID != "" {
+		q.Set("hostid", r.Filter.HostID)
+	}
+	if r.Filter.HostNamespace != "" {
+		q.Set("hostnamespace", r.Filter.HostNamespace)
+	}
+	if r.Filter.Health != "" {
+		q.Set("health", string(r.Filter.Health))
+	}
+	if r.Filter.IncludeDeleted {
+		q.Set("includeDeleted", "true")
+	}
+	req.URL.Path = basePath(ctx) + "/serviceinfo/"
+	req.URL.RawQuery = q.Encode()
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeGetServiceHealthRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(getServiceHealthRequest)
+	serviceID := url.QueryEscape(r.ID)
+	req.URL.Path = basePath(ctx) + "/serviceinfo/" + serviceID + "/health"
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeGetHostPortsRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(getHostPortsRequest)
+	hostID := url.QueryEscape(r.HostID)
+	req.URL.Path = basePath(ctx) + "/hosts/" + hostID + "/ports"
 	return encodeRequest(ctx, req, request)
 }
 
+func encodePostServiceInstanceRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(postServiceInstanceRequest)
+	serviceID := url.QueryEscape(r.ServiceID)
+	req.URL.Path = basePath(ctx) + "/serviceinfo/" + serviceID + "/instances/"
+	return encodeRequest(ctx, req, r.Instance)
+}
+
+func encodePutServiceInstanceRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(putServiceInstanceRequest)
+	serviceID := url.QueryEscape(r.ServiceID)
+	instanceID := url.QueryEscape(r.InstanceID)
+	req.URL.Path = basePath(ctx) + "/serviceinfo/" + serviceID + "/instances/" + instanceID
+	return encodeRequest(ctx, req, r.Instance)
+}
+
+func encodeDeleteServiceInstanceRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(deleteServiceInstanceRequest)
+	serviceID := url.QueryEscape(r.ServiceID)
+	instanceID := url.QueryEscape(r.InstanceID)
+	req.URL.Path = basePath(ctx) + "/serviceinfo/" + serviceID + "/instances/" + instanceID
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeListServiceInstancesRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(listServiceInstancesRequest)
+	serviceID := url.QueryEscape(r.ServiceID)
+	req.URL.Path = basePath(ctx) + "/serviceinfo/" + serviceID + "/instances/"
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeListHostInstancesRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(listHostInstancesRequest)
+	hostID := url.QueryEscape(r.HostID)
+	req.URL.Path = basePath(ctx) + "/hosts/" + hostID + "/instances"
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeGetServiceDependentsRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(getServiceDependentsRequest)
+	id := url.QueryEscape(r.ID)
+	req.URL.Path = basePath(ctx) + "/serviceinfo/" + id + "/dependents"
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeGetHostDependentsRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(getHostDependentsRequest)
+	hostID := url.QueryEscape(r.HostID)
+	req.URL.Path = basePath(ctx) + "/hosts/" + hostID + "/dependents"
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeUndeleteServiceInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(undeleteServiceInfoRequest)
+	req.URL.Path = basePath(ctx) + "/serviceinfo/" + url.QueryEscape(r.ID) + "/undelete"
+	return encodeRequest(ctx, req, request)
+}
+
+func encodePurgeServiceInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(purgeServiceInfoRequest)
+	req.URL.Path = basePath(ctx) + "/serviceinfo/" + url.QueryEscape(r.ID)
+	req.URL.RawQuery = "purge=true"
+	return encodeRequest(ctx, req, request)
+}
+
+func encodeBatchServiceInfoRequest(ctx context.Context, req *http.Request, request interface{}) error {
+	r := request.(batchServiceInfoRequest)
+	req.URL.Path = basePath(ctx) + "/batch"
+	return encodeRequest(ctx, req, r.Batch)
+}
+
 func decodePostServiceInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
 	var response postServiceInfoResponse
 	err := json.NewDecoder(resp.Body).Decode(&response)
@@ -150,6 +477,97 @@ func decodeDeleteServiceInfoResponse(_ context.Context, resp *http.Response) (in
 	return response, err
 }
 
+func decodeListServiceInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response listServiceInfoResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeGetServiceHealthResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getServiceHealthResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeGetHostPortsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getHostPortsResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodePostServiceInstanceResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response postServiceInstanceResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodePutServiceInstanceResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response putServiceInstanceResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeDeleteServiceInstanceResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response deleteServiceInstanceResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeListServiceInstancesResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response listServiceInstancesResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeListHostInstancesResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response listHostInstancesResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeGetServiceDependentsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getServiceDependentsResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeGetHostDependentsResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response getHostDependentsResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeUndeleteServiceInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response undeleteServiceInfoResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodePurgeServiceInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var response purgeServiceInfoResponse
+	err := json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
+
+func decodeBatchServiceInfoResponse(_ context.Context, resp *http.Response) (interface{}, error) {
+	var body batchBody
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	response := batchServiceInfoResponse{}
+	for _, r := range body.Results {
+		result := BatchResult{ID: r.ID}
+		if r.Error != "" {
+			result.Err = errors.New(r.Error)
+		}
+		response.Results = append(response.Results, result)
+	}
+	if body.Error != "" {
+		response.Err = errors.New(body.Error)
+	}
+	return response, nil
+}
+
 type errorer interface {
 	error() error
 }
@@ -163,6 +581,34 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 	return json.NewEncoder(w).Encode(response)
 }
 
+type grapher interface {
+	graph() (DependencyGraph, string)
+}
+
+// encodeGraphResponse writes a dependency graph as JSON, or as Graphviz DOT
+// when the request asked for format=dot.
+func encodeGraphResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	if g, ok := response.(grapher); ok {
+		if graph, format := g.graph(); format == "dot" {
+			w.Header().Set("Content-Type", "text/vnd.graphviz; charset=utf-8")
+			return graph.WriteDOT(w)
+		}
+	}
+	return encodeResponse(ctx, w, response)
+}
+
+// basePath returns the route prefix for the namespace in ctx.
+func basePath(ctx context.Context) string {
+	if ns := namespace.FromContext(ctx); ns != namespace.Default {
+		return "/service/v1/namespaces/" + url.PathEscape(ns)
+	}
+	return "/service/v1"
+}
+
 func encodeRequest(_ context.Context, req *http.Request, request interface{}) error {
 	var buf bytes.Buffer
 	err := json.NewEncoder(&buf).Encode(request)
@@ -173,23 +619,77 @@ func encodeRequest(_ context.Context, req *http.Request, request interface{}) er
 	return nil
 }
 
+// batchBody is the wire form of a batch response. Every result carries
+// the HTTP status its operation would have had on its own.
+type batchBody struct {
+	Error   string            `json:"error,omitempty"`
+	Results []batchResultBody `json:"results"`
+}
+
+type batchResultBody struct {
+	ID     string `json:"id"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// encodeBatchResponse writes the per-operation results of a batch, also
+// when an atomic batch was aborted.
+func encodeBatchResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	r := response.(batchServiceInfoResponse)
+	if r.Err != nil && r.Results == nil {
+		encodeError(ctx, r.Err, w)
+		return nil
+	}
+	body := batchBody{Results: make([]batchResultBody, len(r.Results))}
+	for i, result := range r.Results {
+		body.Results[i].ID = result.ID
+		body.Results[i].Status = http.StatusOK
+		if result.Err != nil {
+			body.Results[i].Status = codeFrom(result.Err)
+			body.Results[i].Error = result.Err.Error()
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if r.Err != nil {
+		body.Error = r.Err.Error()
+		w.WriteHeader(codeFrom(r.Err))
+	}
+	return json.NewEncoder(w).Encode(body)
+}
+
 func encodeError(_ context.Context, err error, w http.ResponseWriter) {
 	if err == nil {
 		panic("encodeError with nil error")
 	}
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	w.WriteHeader(codeFrom(err))
-	json.NewEncoder(w).Encode(map[string]interface{}{
+	body := map[string]interface{}{
 		"error": err.Error(),
-	})
+	}
+	if e, ok := err.(*PortConflictError); ok {
+		body["namespace"] = e.Namespace
+		body["serviceid"] = e.ServiceID
+	}
+	json.NewEncoder(w).Encode(body)
 }
 
 func codeFrom(err error) int {
+	if _, ok := err.(*PortConflictError); ok {
+		return http.StatusConflict
+	}
+	if _, ok := err.(*DeniedError); ok {
+		return http.StatusForbidden
+	}
 	switch err {
-	case ErrNotFound:
+	case ErrNotFound, ErrUnknownNamespace:
 		return http.StatusNotFound
-	case ErrAlreadyExists, ErrInconsistentIDs:
+	case ErrAlreadyExists, ErrInconsistentIDs, ErrInvalidCheck, ErrInvalidPort, ErrInvalidInstance,
+		ErrUnknownDependency, ErrDependencyCycle, ErrInvalidOp, ErrInvalidRequests:
 		return http.StatusBadRequest
+	case ErrHostNotShared:
+		return http.StatusForbidden
+	case ErrHasDependents, ErrDeleted, ErrHostCordoned, ErrHostInMaintenance, ErrHostReserved, ErrBatchAborted, ErrConditionFailed, ErrVersionConflict:
+		return http.StatusConflict
 	default:
 		return http.StatusInternalServerError
 	}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+// Deleted reports whether s is in the trash: deleted but not yet purged.
+func (s ServiceInfo) Deleted() bool {
+	return s.DeletedAt != nil
+}
+
+// exists reports whether the service k is known and not deleted.
+func (s *inmemService) exists(k key) bool {
+	h, ok := s.m[k]
+	return ok && !h.Deleted()
+}
+
+// UndeleteServiceInfo takes the service out of the trash and returns it as
+// restored. The services it depends on must still exist.
+func (s *inmemService) UndeleteServiceInfo(ctx context.Context, id string) (ServiceInfo, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := keyFrom(ctx, id)
+	h, ok := s.m[k]
+	if !ok || !h.Deleted() {
+		return ServiceInfo{}, ErrNotFound
+	}
+	if err := checkDependencies(s.inNamespace(k.namespace), h); err != nil {
+		return ServiceInfo{}, err
+	}
+	h.DeletedAt, h.DeletedBy = nil, ""
+	h.UpdatedAt = host.TimeFromContext(ctx)
+	h.Version++
+	s.m[k] = h
+	return h, nil
+}
+
+// PurgeServiceInfo removes the service for good, whether it is in the
+// trash or not, and returns it as it was. A service others depend on
+// cannot be purged.
+func (s *inmemService) PurgeServiceInfo(ctx context.Context, id string) (ServiceInfo, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := keyFrom(ctx, id)
+	h, ok := s.m[k]
+	if !ok {
+		return ServiceInfo{}, ErrNotFound
+	}
+	if !h.Deleted() {
+		if err := s.checkDependents(k); err != nil {
+			return ServiceInfo{}, err
+		}
+	}
+	s.byHost.remove(h)
+	delete(s.m, k)
+	delete(s.health, k)
+	delete(s.instances, k)
+	return h, nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTrashKeepsInstances(t *testing.T) {
+	ctx := context.Background()
+	s := NewInmemService()
+	if err := s.PostServiceInfo(ctx, ServiceInfo{ID: "a", HostID: "h1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PostServiceInstance(ctx, "a", Instance{ID: "1", HostID: "h2", Port: 9000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutServiceHealth(ctx, "a", CheckResult{Status: HealthPassing, CheckedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteServiceInfo(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	if list, err := s.ListHostInstances(ctx, "h2"); err != nil || len(list) != 1 {
+		t.Fatalf("got instances %+v, %v on h2 after delete, want instance 1", list, err)
+	}
+	if err := s.PostServiceInfo(ctx, ServiceInfo{ID: "b", HostID: "h2", Ports: []ServicePort{{Port: 9000}}}); err == nil {
+		t.Fatal("took the port of an instance of a trashed service")
+	}
+	if g, err := s.GetHostDependents(ctx, "h2"); err != nil || len(g.Nodes) != 0 {
+		t.Fatalf("got dependents %+v, %v of h2, want none for a trashed service", g, err)
+	}
+
+	if _, err := s.UndeleteServiceInfo(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := s.ListServiceInstances(ctx, "a"); err != nil || len(list) != 1 {
+		t.Fatalf("got instances %+v, %v after undelete, want instance 1", list, err)
+	}
+	if h, err := s.GetServiceHealth(ctx, "a"); err != nil || h.Status != HealthPassing {
+		t.Fatalf("got health %+v, %v after undelete, want passing", h, err)
+	}
+
+	if err := s.DeleteServiceInfo(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PurgeServiceInfo(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := s.ListHostInstances(ctx, "h2"); err != nil || len(list) != 0 {
+		t.Fatalf("got instances %+v, %v on h2 after purge, want none", list, err)
+	}
+}
@@ -0,0 +1,356 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	// The driver registers itself as "sqlite3"; it is built with cgo.
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// schemaVersion is the version of the tables, kept in the user_version of
+// the database.
+const schemaVersion = 1
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS hosts (
+		namespace TEXT NOT NULL,
+		id TEXT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (namespace, id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS services (
+		namespace TEXT NOT NULL,
+		id TEXT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (namespace, id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS instances (
+		namespace TEXT NOT NULL,
+		serviceid TEXT NOT NULL,
+		id TEXT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (namespace, serviceid, id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS health (
+		namespace TEXT NOT NULL,
+		serviceid TEXT NOT NULL,
+		data TEXT NOT NULL,
+		PRIMARY KEY (namespace, serviceid)
+	)`,
+}
+
+// ErrSchemaVersion is returned for a database written by a later version.
+var ErrSchemaVersion = errors.New("database schema is newer than this server")
+
+// DB keeps an in-memory host and service store in a SQLite database. The
+// stores are loaded from the database when it is opened, and serve every
+// read; every write is applied to them, then the rows it changed are
+// written to the database in one SQL transaction before it returns.
+type DB struct {
+	db       *sql.DB
+	hosts    host.Host
+	services service.Service
+	logger   log.Logger
+
+	// hostMtx and serviceMtx keep a write and the writing of its rows
+	// together, so that the rows are written in the order of the writes.
+	hostMtx    sync.Mutex
+	serviceMtx sync.Mutex
+
+	mtx    sync.Mutex
+	failed error
+}
+
+// Open opens the database at path, creating it if need be, and loads its
+// hosts and services into hosts and services, which must be empty and
+// implement the Snapshotter and RecordReader of their package.
+func Open(path string, hosts host.Host, services service.Service, logger log.Logger) (*DB, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_journal_mode=WAL&_synchronous=FULL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// One connection: the writes are serialized by the stores anyway.
+	db.SetMaxOpenConns(1)
+	d := &DB{
+		db:       db,
+		hosts:    hosts,
+		services: services,
+		logger:   logger,
+	}
+	if err := d.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := d.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// migrate creates the tables of a new database.
+func (d *DB) migrate() error {
+	var v int
+	if err := d.db.QueryRow(`PRAGMA user_version`).Scan(&v); err != nil {
+		return err
+	}
+	if v > schemaVersion {
+		return ErrSchemaVersion
+	}
+	for _, stmt := range schema {
+		if _, err := d.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	_, err := d.db.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, schemaVersion))
+	return err
+}
+
+// load reads every row into the stores.
+func (d *DB) load() error {
+	var hs host.State
+	err := scanRows(d.db, `SELECT data FROM hosts ORDER BY namespace, id`, func(data []byte) error {
+		var h host.HostInfo
+		if err := json.Unmarshal(data, &h); err != nil {
+			return err
+		}
+		hs.Hosts = append(hs.Hosts, h)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	ss := service.State{Services: []service.ServiceInfo{}, Health: []service.HealthRecord{}, Instances: []service.Instance{}}
+	err = scanRows(d.db, `SELECT data FROM services ORDER BY namespace, id`, func(data []byte) error {
+		var s service.ServiceInfo
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		ss.Services = append(ss.Services, s)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = scanRows(d.db, `SELECT data FROM health ORDER BY namespace, serviceid`, func(data []byte) error {
+		var r service.HealthRecord
+		if err := json.Unmarshal(data, &r); err != nil {
+			return err
+		}
+		ss.Health = append(ss.Health, r)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = scanRows(d.db, `SELECT data FROM instances ORDER BY namespace, serviceid, id`, func(data []byte) error {
+		var in service.Instance
+		if err := json.Unmarshal(data, &in); err != nil {
+			return err
+		}
+		ss.Instances = append(ss.Instances, in)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := d.hosts.(host.Snapshotter).LoadState(ctx, hs); err != nil {
+		return err
+	}
+	if err := d.services.(service.Snapshotter).LoadState(ctx, ss); err != nil {
+		return err
+	}
+	d.logger.Log("during", "load", "hosts", len(hs.Hosts), "services", len(ss.Services))
+	return nil
+}
+
+func scanRows(db *sql.DB, query string, fn func(data []byte) error) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Close closes the database.
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// err returns the error that stopped the database from taking writes.
+func (d *DB) err() error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	return d.failed
+}
+
+// fail stops the database from taking writes: the stores hold a write
+// the database does not, and would drift further from it.
+func (d *DB) fail(err error) error {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if d.failed == nil {
+		d.failed = fmt.Errorf("sqlite: %v; restart to reload the database", err)
+		d.logger.Log("during", "write", "err", err)
+	}
+	return d.failed
+}
+
+// tx runs fn in one SQL transaction.
+func (d *DB) tx(fn func(tx *sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// putHosts writes the rows of hosts ids of the namespace of ctx as the
+// store keeps them, and deletes those of the hosts it no longer has.
+func (d *DB) putHosts(ctx context.Context, tx *sql.Tx, ids []string) error {
+	ns := namespace.FromContext(ctx)
+	for _, id := range ids {
+		h, ok := d.hosts.(host.RecordReader).GetHostRecord(ctx, id)
+		if !ok {
+			if _, err := tx.Exec(`DELETE FROM hosts WHERE namespace = ? AND id = ?`, ns, id); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := put(tx, `INSERT OR REPLACE INTO hosts (namespace, id, data) VALUES (?, ?, ?)`, h, h.Namespace, h.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceHosts rewrites every host row from the store, once a state is
+// loaded into it.
+func (d *DB) replaceHosts(tx *sql.Tx) error {
+	st, err := d.hosts.(host.Snapshotter).DumpState(context.Background())
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM hosts`); err != nil {
+		return err
+	}
+	for _, h := range st.Hosts {
+		if err := put(tx, `INSERT OR REPLACE INTO hosts (namespace, id, data) VALUES (?, ?, ?)`, h, h.Namespace, h.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// putServices writes the rows of services ids of the namespace of ctx as
+// the store keeps them. A service it no longer has was purged, with its
+// health and instances, so their rows are deleted too.
+func (d *DB) putServices(ctx context.Context, tx *sql.Tx, ids []string) error {
+	ns := namespace.FromContext(ctx)
+	for _, id := range ids {
+		s, ok := d.services.(service.RecordReader).GetServiceRecord(ctx, id)
+		if ok {
+			if err := put(tx, `INSERT OR REPLACE INTO services (namespace, id, data) VALUES (?, ?, ?)`, s, s.Namespace, s.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, stmt := range []string{
+			`DELETE FROM services WHERE namespace = ? AND id = ?`,
+			`DELETE FROM health WHERE namespace = ? AND serviceid = ?`,
+			`DELETE FROM instances WHERE namespace = ? AND serviceid = ?`,
+		} {
+			if _, err := tx.Exec(stmt, ns, id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// putHealth writes the health row of service id of the namespace of ctx.
+func (d *DB) putHealth(ctx context.Context, tx *sql.Tx, id string) error {
+	r, ok := d.services.(service.RecordReader).GetHealthRecord(ctx, id)
+	if !ok {
+		_, err := tx.Exec(`DELETE FROM health WHERE namespace = ? AND serviceid = ?`, namespace.FromContext(ctx), id)
+		return err
+	}
+	return put(tx, `INSERT OR REPLACE INTO health (namespace, serviceid, data) VALUES (?, ?, ?)`, r, r.Namespace, r.ServiceID)
+}
+
+// putInstance writes the row of instance id of service serviceID of the
+// namespace of ctx, or deletes it if the store no longer has the instance.
+func (d *DB) putInstance(ctx context.Context, tx *sql.Tx, serviceID, id string) error {
+	in, ok := d.services.(service.RecordReader).GetInstanceRecord(ctx, serviceID, id)
+	if !ok {
+		_, err := tx.Exec(`DELETE FROM instances WHERE namespace = ? AND serviceid = ? AND id = ?`, namespace.FromContext(ctx), serviceID, id)
+		return err
+	}
+	return put(tx, `INSERT OR REPLACE INTO instances (namespace, serviceid, id, data) VALUES (?, ?, ?, ?)`, in, in.Namespace, in.ServiceID, in.ID)
+}
+
+// replaceServices rewrites every service, health and instance row from the
+// store, once a state is loaded into it.
+func (d *DB) replaceServices(tx *sql.Tx) error {
+	st, err := d.services.(service.Snapshotter).DumpState(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"services", "health", "instances"} {
+		if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+			return err
+		}
+	}
+	for _, s := range st.Services {
+		if err := put(tx, `INSERT OR REPLACE INTO services (namespace, id, data) VALUES (?, ?, ?)`, s, s.Namespace, s.ID); err != nil {
+			return err
+		}
+	}
+	for _, r := range st.Health {
+		if err := put(tx, `INSERT OR REPLACE INTO health (namespace, serviceid, data) VALUES (?, ?, ?)`, r, r.Namespace, r.ServiceID); err != nil {
+			return err
+		}
+	}
+	for _, in := range st.Instances {
+		if err := put(tx, `INSERT OR REPLACE INTO instances (namespace, serviceid, id, data) VALUES (?, ?, ?, ?)`, in, in.Namespace, in.ServiceID, in.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// put writes v as the data of a row keyed by keys.
+func put(tx *sql.Tx, stmt string, v interface{}, keys ...interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(stmt, append(keys, string(data))...)
+	return err
+}
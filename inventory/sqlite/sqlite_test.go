@@ -0,0 +1,194 @@
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+func open(t *testing.T, path string) *DB {
+	t.Helper()
+	d, err := Open(path, host.NewInmemHost(), service.NewInmemService(), log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+// dump returns the content of the stores of d as JSON, to compare it
+// across a reopen.
+func dump(t *testing.T, d *DB) string {
+	t.Helper()
+	ctx := context.Background()
+	hs, err := d.Hosts().(host.Snapshotter).DumpState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss, err := d.Services().(service.Snapshotter).DumpState(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(struct {
+		Hosts    host.State
+		Services service.State
+	}{hs, ss})
+	return string(b)
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "inventory.db")
+	d := open(t, path)
+	hosts, services := d.Hosts(), d.Services()
+
+	for _, h := range []host.HostInfo{
+		{ID: "1001", Name: "web1", IP: "10.0.0.1", Labels: map[string]string{"env": "prod"}},
+		{ID: "1002", Name: "web2", IP: "10.0.0.2"},
+		{ID: "1003", Name: "db1", IP: "10.0.0.3"},
+	} {
+		if err := hosts.PostHostInfo(ctx, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h, _ := hosts.GetHostInfo(ctx, "1002")
+	h.Rack = "r01"
+	if err := hosts.PutHostInfo(ctx, "1002", h); err != nil {
+		t.Fatal(err)
+	}
+	if err := hosts.DeleteHostInfo(ctx, "1003"); err != nil {
+		t.Fatal(err)
+	}
+	if err := hosts.PostHostInfo(ctx, host.HostInfo{ID: "1004", IP: "10.0.0.1"}); err != host.ErrDuplicateIP {
+		t.Fatalf("got %v, want %v", err, host.ErrDuplicateIP)
+	}
+	_, err := hosts.BatchHostInfo(ctx, host.Batch{BestEffort: true, Ops: []host.HostOp{
+		{Op: host.OpCreate, HostInfo: host.HostInfo{ID: "1005", Name: "cache1"}},
+		{Op: host.OpCreate, HostInfo: host.HostInfo{ID: "1001"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := services.PostServiceInfo(ctx, service.ServiceInfo{ID: "web", HostID: "1001", Ports: []service.ServicePort{{Port: 80}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := services.PostServiceInfo(ctx, service.ServiceInfo{ID: "old", HostID: "1002"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := services.PostServiceInstance(ctx, "web", service.Instance{ID: "1", HostID: "1002", Port: 8080}); err != nil {
+		t.Fatal(err)
+	}
+	if err := services.PostServiceInstance(ctx, "web", service.Instance{ID: "2", HostID: "1005"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := services.DeleteServiceInstance(ctx, "web", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := services.PutServiceHealth(ctx, "web", service.CheckResult{Status: service.HealthPassing, CheckedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	// Purging a service drops its health and instances with it.
+	if err := services.PostServiceInstance(ctx, "old", service.Instance{ID: "1", HostID: "1001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := services.PutServiceHealth(ctx, "old", service.CheckResult{Status: service.HealthCritical, CheckedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := services.PurgeServiceInfo(ctx, "old"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := dump(t, d)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	d = open(t, path)
+	defer d.Close()
+	if got := dump(t, d); got != want {
+		t.Fatalf("reopened with\n%s\nwant\n%s", got, want)
+	}
+	var rows int
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM health WHERE serviceid = 'old'`).Scan(&rows); err != nil || rows != 0 {
+		t.Fatalf("got %d health rows of the purged service, %v, want none", rows, err)
+	}
+	if _, err := d.Hosts().GetHostInfo(ctx, "1003"); err != host.ErrNotFound {
+		t.Fatalf("got %v for a trashed host, want %v", err, host.ErrNotFound)
+	}
+	if _, err := d.Hosts().UndeleteHostInfo(ctx, "1003"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeldBatch(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "inventory.db")
+	d := open(t, path)
+	hosts := d.Hosts()
+
+	for i, commit := range []bool{false, true} {
+		id := []string{"rolled-back", "committed"}[i]
+		var settle func()
+		_, err := hosts.BatchHostInfo(ctx, host.Batch{
+			Ops: []host.HostOp{{Op: host.OpCreate, HostInfo: host.HostInfo{ID: id}}},
+			Hold: func(c, r func()) {
+				if commit {
+					settle = c
+				} else {
+					settle = r
+				}
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		settle()
+	}
+	want := dump(t, d)
+	d.Close()
+
+	d = open(t, path)
+	defer d.Close()
+	if got := dump(t, d); got != want {
+		t.Fatalf("reopened with\n%s\nwant\n%s", got, want)
+	}
+	if _, err := d.Hosts().GetHostInfo(ctx, "committed"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Hosts().GetHostInfo(ctx, "rolled-back"); err != host.ErrNotFound {
+		t.Fatalf("got %v, want the rolled back host missing", err)
+	}
+}
+
+func TestLoadState(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "inventory.db")
+	d := open(t, path)
+	if err := d.Hosts().PostHostInfo(ctx, host.HostInfo{ID: "gone"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A state taken from another store, as a restore loads it.
+	src := host.NewInmemHost()
+	if err := src.PostHostInfo(ctx, host.HostInfo{ID: "1001", Name: "web1"}); err != nil {
+		t.Fatal(err)
+	}
+	st, _ := src.(host.Snapshotter).DumpState(ctx)
+	if err := d.Hosts().(host.Snapshotter).LoadState(ctx, st); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	d = open(t, path)
+	defer d.Close()
+	list, err := d.Hosts().ListHostInfo(ctx, host.HostFilter{})
+	if err != nil || len(list) != 1 || list[0].ID != "1001" || list[0].Version != 1 {
+		t.Fatalf("got %+v, %v, want host 1001 as loaded", list, err)
+	}
+}
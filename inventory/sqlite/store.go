@@ -0,0 +1,281 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// Hosts returns the host store that writes to the database. It also
+// implements host.Snapshotter; loading a state rewrites every host row.
+func (d *DB) Hosts() host.Host {
+	return &sqlHost{Host: d.hosts, db: d}
+}
+
+// Services returns the service store that writes to the database. It also
+// implements service.Snapshotter.
+func (d *DB) Services() service.Service {
+	return &sqlService{Service: d.services, db: d}
+}
+
+// write applies a write with apply, then writes the rows it touched with
+// rows, holding mtx throughout. A write that fails may still have changed
+// some rows, as a best-effort batch does, so they are written either way.
+func (d *DB) write(mtx *sync.Mutex, rows func(tx *sql.Tx) error, apply func() error) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if err := d.err(); err != nil {
+		return err
+	}
+	err := apply()
+	if ferr := d.tx(rows); ferr != nil {
+		return d.fail(ferr)
+	}
+	return err
+}
+
+// batch applies a batch through apply, which passes the Hold it is given
+// on to the store. A batch held by a transaction is written when it
+// commits, and mtx stays locked until it commits or rolls back.
+func (d *DB) batch(mtx *sync.Mutex, rows func(tx *sql.Tx) error, hold func(commit, rollback func()), apply func(hold func(commit, rollback func())) error) error {
+	if hold == nil {
+		return d.write(mtx, rows, func() error { return apply(nil) })
+	}
+	mtx.Lock()
+	if err := d.err(); err != nil {
+		mtx.Unlock()
+		return err
+	}
+	held := false
+	err := apply(func(commit, rollback func()) {
+		held = true
+		hold(func() {
+			commit()
+			if err := d.tx(rows); err != nil {
+				// Committing keeps the stores as the transaction
+				// reported them; the database refuses any further
+				// write.
+				d.fail(err)
+			}
+			mtx.Unlock()
+		}, func() {
+			rollback()
+			mtx.Unlock()
+		})
+	})
+	if !held {
+		defer mtx.Unlock()
+		if ferr := d.tx(rows); ferr != nil {
+			return d.fail(ferr)
+		}
+	}
+	return err
+}
+
+type sqlHost struct {
+	host.Host
+	db *DB
+}
+
+// write applies a write of the rows that rows writes.
+func (s *sqlHost) write(rows func(tx *sql.Tx) error, apply func() error) error {
+	return s.db.write(&s.db.hostMtx, rows, apply)
+}
+
+// hosts writes the rows of hosts ids of the namespace of ctx.
+func (s *sqlHost) hosts(ctx context.Context, ids ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		return s.db.putHosts(ctx, tx, ids)
+	}
+}
+
+func (s *sqlHost) PostHostInfo(ctx context.Context, h host.HostInfo) error {
+	return s.write(s.hosts(ctx, h.ID), func() error {
+		return s.Host.PostHostInfo(ctx, h)
+	})
+}
+
+func (s *sqlHost) PutHostInfo(ctx context.Context, id string, h host.HostInfo) error {
+	return s.write(s.hosts(ctx, id), func() error {
+		return s.Host.PutHostInfo(ctx, id, h)
+	})
+}
+
+func (s *sqlHost) DeleteHostInfo(ctx context.Context, id string) error {
+	return s.write(s.hosts(ctx, id), func() error {
+		return s.Host.DeleteHostInfo(ctx, id)
+	})
+}
+
+func (s *sqlHost) UndeleteHostInfo(ctx context.Context, id string) (h host.HostInfo, err error) {
+	err = s.write(s.hosts(ctx, id), func() error {
+		h, err = s.Host.UndeleteHostInfo(ctx, id)
+		return err
+	})
+	return h, err
+}
+
+func (s *sqlHost) PurgeHostInfo(ctx context.Context, id string) (h host.HostInfo, err error) {
+	err = s.write(s.hosts(ctx, id), func() error {
+		h, err = s.Host.PurgeHostInfo(ctx, id)
+		return err
+	})
+	return h, err
+}
+
+func (s *sqlHost) BatchHostInfo(ctx context.Context, b host.Batch) (results []host.BatchResult, err error) {
+	var ids []string
+	for _, op := range b.Ops {
+		if op.Op != host.OpCheck {
+			ids = append(ids, hostOpID(op))
+		}
+	}
+	err = s.db.batch(&s.db.hostMtx, s.hosts(ctx, ids...), b.Hold, func(hold func(commit, rollback func())) error {
+		b.Hold = hold
+		results, err = s.Host.BatchHostInfo(ctx, b)
+		return err
+	})
+	return results, err
+}
+
+func (s *sqlHost) DumpState(ctx context.Context) (host.State, error) {
+	return s.Host.(host.Snapshotter).DumpState(ctx)
+}
+
+func (s *sqlHost) LoadState(ctx context.Context, st host.State) error {
+	return s.db.write(&s.db.hostMtx, s.db.replaceHosts, func() error {
+		return s.Host.(host.Snapshotter).LoadState(ctx, st)
+	})
+}
+
+type sqlService struct {
+	service.Service
+	db *DB
+}
+
+// write applies a write of the rows that rows writes.
+func (s *sqlService) write(rows func(tx *sql.Tx) error, apply func() error) error {
+	return s.db.write(&s.db.serviceMtx, rows, apply)
+}
+
+// services writes the rows of services ids of the namespace of ctx.
+func (s *sqlService) services(ctx context.Context, ids ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		return s.db.putServices(ctx, tx, ids)
+	}
+}
+
+// instance writes the row of instance id of service serviceID of the
+// namespace of ctx.
+func (s *sqlService) instance(ctx context.Context, serviceID, id string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		return s.db.putInstance(ctx, tx, serviceID, id)
+	}
+}
+
+func (s *sqlService) PostServiceInfo(ctx context.Context, svc service.ServiceInfo) error {
+	return s.write(s.services(ctx, svc.ID), func() error {
+		return s.Service.PostServiceInfo(ctx, svc)
+	})
+}
+
+func (s *sqlService) PutServiceInfo(ctx context.Context, id string, svc service.ServiceInfo) error {
+	return s.write(s.services(ctx, id), func() error {
+		return s.Service.PutServiceInfo(ctx, id, svc)
+	})
+}
+
+func (s *sqlService) DeleteServiceInfo(ctx context.Context, id string) error {
+	return s.write(s.services(ctx, id), func() error {
+		return s.Service.DeleteServiceInfo(ctx, id)
+	})
+}
+
+func (s *sqlService) UndeleteServiceInfo(ctx context.Context, id string) (svc service.ServiceInfo, err error) {
+	err = s.write(s.services(ctx, id), func() error {
+		svc, err = s.Service.UndeleteServiceInfo(ctx, id)
+		return err
+	})
+	return svc, err
+}
+
+func (s *sqlService) PurgeServiceInfo(ctx context.Context, id string) (svc service.ServiceInfo, err error) {
+	err = s.write(s.services(ctx, id), func() error {
+		svc, err = s.Service.PurgeServiceInfo(ctx, id)
+		return err
+	})
+	return svc, err
+}
+
+func (s *sqlService) PutServiceHealth(ctx context.Context, id string, r service.CheckResult) error {
+	rows := func(tx *sql.Tx) error {
+		return s.db.putHealth(ctx, tx, id)
+	}
+	return s.write(rows, func() error {
+		return s.Service.PutServiceHealth(ctx, id, r)
+	})
+}
+
+func (s *sqlService) PostServiceInstance(ctx context.Context, serviceID string, in service.Instance) error {
+	return s.write(s.instance(ctx, serviceID, in.ID), func() error {
+		return s.Service.PostServiceInstance(ctx, serviceID, in)
+	})
+}
+
+func (s *sqlService) PutServiceInstance(ctx context.Context, serviceID, instanceID string, in service.Instance) error {
+	return s.write(s.instance(ctx, serviceID, instanceID), func() error {
+		return s.Service.PutServiceInstance(ctx, serviceID, instanceID, in)
+	})
+}
+
+func (s *sqlService) DeleteServiceInstance(ctx context.Context, serviceID, instanceID string) error {
+	return s.write(s.instance(ctx, serviceID, instanceID), func() error {
+		return s.Service.DeleteServiceInstance(ctx, serviceID, instanceID)
+	})
+}
+
+func (s *sqlService) BatchServiceInfo(ctx context.Context, b service.Batch) (results []service.BatchResult, err error) {
+	var ids []string
+	for _, op := range b.Ops {
+		if op.Op != service.OpCheck {
+			ids = append(ids, serviceOpID(op))
+		}
+	}
+	err = s.db.batch(&s.db.serviceMtx, s.services(ctx, ids...), b.Hold, func(hold func(commit, rollback func())) error {
+		b.Hold = hold
+		results, err = s.Service.BatchServiceInfo(ctx, b)
+		return err
+	})
+	return results, err
+}
+
+func (s *sqlService) DumpState(ctx context.Context) (service.State, error) {
+	return s.Service.(service.Snapshotter).DumpState(ctx)
+}
+
+func (s *sqlService) LoadState(ctx context.Context, st service.State) error {
+	return s.write(s.db.replaceServices, func() error {
+		return s.Service.(service.Snapshotter).LoadState(ctx, st)
+	})
+}
+
+// hostOpID returns the ID of the host op writes, which defaults to that of
+// its HostInfo.
+func hostOpID(op host.HostOp) string {
+	if op.ID != "" {
+		return op.ID
+	}
+	return op.HostInfo.ID
+}
+
+// serviceOpID returns the ID of the service op writes, which defaults to
+// that of its ServiceInfo.
+func serviceOpID(op service.ServiceOp) string {
+	if op.ID != "" {
+		return op.ID
+	}
+	return op.ServiceInfo.ID
+}
@@ -0,0 +1,87 @@
+package topology
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+// Elevation is the front view of a rack. Units are listed from the top of
+// the rack down; Unpositioned lists hosts in the rack without a position.
+// Hosts in the trash keep their units until they are purged, and are
+// marked deleted.
+type Elevation struct {
+	Rack         Rack       `json:"rack"`
+	Units        []RackUnit `json:"units"`
+	Free         int        `json:"free"`
+	Unpositioned []string   `json:"unpositioned"`
+}
+
+// RackUnit is a single unit of a rack and the host occupying it, if any.
+type RackUnit struct {
+	Unit     int    `json:"unit"`
+	HostID   string `json:"hostid,omitempty"`
+	HostName string `json:"hostname,omitempty"`
+	Deleted  bool   `json:"deleted,omitempty"`
+}
+
+func newElevation(r Rack) Elevation {
+	e := Elevation{Rack: r, Free: r.Units, Unpositioned: []string{}}
+	for u := r.Units; u >= 1; u-- {
+		e.Units = append(e.Units, RackUnit{Unit: u})
+	}
+	return e
+}
+
+// place marks the units h occupies. A deleted host without a position
+// occupies nothing and is left out.
+func (e *Elevation) place(h host.HostInfo) {
+	if h.Position == 0 {
+		if !h.Deleted() {
+			e.Unpositioned = append(e.Unpositioned, h.ID)
+		}
+		return
+	}
+	for u := h.Position; u <= h.Top() && u <= e.Rack.Units; u++ {
+		unit := &e.Units[e.Rack.Units-u]
+		if unit.HostID == "" {
+			e.Free--
+		}
+		unit.HostID = h.ID
+		unit.HostName = h.Name
+		unit.Deleted = h.Deleted()
+	}
+}
+
+// WriteText draws e as a plain-text rack diagram, one line per unit.
+func (e Elevation) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "rack %s (%s) %dU, %d free\n", e.Rack.ID, e.Rack.DataCenter, e.Rack.Units, e.Free); err != nil {
+		return err
+	}
+	for i, u := range e.Units {
+		label := "."
+		switch {
+		case u.HostID == "":
+		case i > 0 && e.Units[i-1].HostID == u.HostID:
+			label = "|"
+		default:
+			label = u.HostID
+			if u.HostName != "" {
+				label = u.HostName + " (" + u.HostID + ")"
+			}
+			if u.Deleted {
+				label += " deleted"
+			}
+		}
+		if _, err := fmt.Fprintf(w, "U%-3d [ %s ]\n", u.Unit, label); err != nil {
+			return err
+		}
+	}
+	for _, id := range e.Unpositioned {
+		if _, err := fmt.Fprintf(w, "unpositioned: %s\n", id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
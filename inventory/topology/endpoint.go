@@ -0,0 +1,262 @@
+package topology
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	PostDataCenterEndpoint   endpoint.Endpoint
+	GetDataCenterEndpoint    endpoint.Endpoint
+	PutDataCenterEndpoint    endpoint.Endpoint
+	DeleteDataCenterEndpoint endpoint.Endpoint
+	ListDataCentersEndpoint  endpoint.Endpoint
+	PostRackEndpoint         endpoint.Endpoint
+	GetRackEndpoint          endpoint.Endpoint
+	PutRackEndpoint          endpoint.Endpoint
+	DeleteRackEndpoint       endpoint.Endpoint
+	ListRacksEndpoint        endpoint.Endpoint
+	GetTreeEndpoint          endpoint.Endpoint
+	GetElevationEndpoint     endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Topology) Endpoints {
+	return Endpoints{
+		PostDataCenterEndpoint:   MakePostDataCenterEndpoint(s),
+		GetDataCenterEndpoint:    MakeGetDataCenterEndpoint(s),
+		PutDataCenterEndpoint:    MakePutDataCenterEndpoint(s),
+		DeleteDataCenterEndpoint: MakeDeleteDataCenterEndpoint(s),
+		ListDataCentersEndpoint:  MakeListDataCentersEndpoint(s),
+		PostRackEndpoint:         MakePostRackEndpoint(s),
+		GetRackEndpoint:          MakeGetRackEndpoint(s),
+		PutRackEndpoint:          MakePutRackEndpoint(s),
+		DeleteRackEndpoint:       MakeDeleteRackEndpoint(s),
+		ListRacksEndpoint:        MakeListRacksEndpoint(s),
+		GetTreeEndpoint:          MakeGetTreeEndpoint(s),
+		GetElevationEndpoint:     MakeGetElevationEndpoint(s),
+	}
+}
+
+func MakePostDataCenterEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(postDataCenterRequest)
+		e := s.PostDataCenter(ctx, req.DataCenter)
+		return postDataCenterResponse{Err: e}, nil
+	}
+}
+
+func MakeGetDataCenterEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getDataCenterRequest)
+		d, e := s.GetDataCenter(ctx, req.ID)
+		return getDataCenterResponse{DataCenter: d, Err: e}, nil
+	}
+}
+
+func MakePutDataCenterEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putDataCenterRequest)
+		e := s.PutDataCenter(ctx, req.ID, req.DataCenter)
+		return putDataCenterResponse{Err: e}, nil
+	}
+}
+
+func MakeDeleteDataCenterEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteDataCenterRequest)
+		e := s.DeleteDataCenter(ctx, req.ID)
+		return deleteDataCenterResponse{Err: e}, nil
+	}
+}
+
+func MakeListDataCentersEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		list, e := s.ListDataCenters(ctx)
+		return listDataCentersResponse{DataCenters: list, Err: e}, nil
+	}
+}
+
+func MakePostRackEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(postRackRequest)
+		e := s.PostRack(ctx, req.Rack)
+		return postRackResponse{Err: e}, nil
+	}
+}
+
+func MakeGetRackEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getRackRequest)
+		r, e := s.GetRack(ctx, req.ID)
+		return getRackResponse{Rack: r, Err: e}, nil
+	}
+}
+
+func MakePutRackEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putRackRequest)
+		e := s.PutRack(ctx, req.ID, req.Rack)
+		return putRackResponse{Err: e}, nil
+	}
+}
+
+func MakeDeleteRackEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteRackRequest)
+		e := s.DeleteRack(ctx, req.ID)
+		return deleteRackResponse{Err: e}, nil
+	}
+}
+
+func MakeListRacksEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listRacksRequest)
+		list, e := s.ListRacks(ctx, req.DataCenter)
+		return listRacksResponse{Racks: list, Err: e}, nil
+	}
+}
+
+func MakeGetTreeEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getTreeRequest)
+		list, e := s.GetTree(ctx, req.DataCenter)
+		return getTreeResponse{DataCenters: list, Err: e}, nil
+	}
+}
+
+func MakeGetElevationEndpoint(s Topology) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getElevationRequest)
+		el, e := s.GetElevation(ctx, req.RackID)
+		return getElevationResponse{Elevation: el, Format: req.Format, Err: e}, nil
+	}
+}
+
+type postDataCenterRequest struct {
+	DataCenter DataCenter
+}
+
+type postDataCenterResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r postDataCenterResponse) error() error { return r.Err }
+
+type getDataCenterRequest struct {
+	ID string
+}
+
+type getDataCenterResponse struct {
+	DataCenter DataCenter `json:"datacenter"`
+	Err        error      `json:"err,omitempty"`
+}
+
+func (r getDataCenterResponse) error() error { return r.Err }
+
+type putDataCenterRequest struct {
+	ID         string
+	DataCenter DataCenter
+}
+
+type putDataCenterResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r putDataCenterResponse) error() error { return r.Err }
+
+type deleteDataCenterRequest struct {
+	ID string
+}
+
+type deleteDataCenterResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r deleteDataCenterResponse) error() error { return r.Err }
+
+type listDataCentersRequest struct{}
+
+type listDataCentersResponse struct {
+	DataCenters []DataCenter `json:"datacenters"`
+	Err         error        `json:"err,omitempty"`
+}
+
+func (r listDataCentersResponse) error() error { return r.Err }
+
+type postRackRequest struct {
+	Rack Rack
+}
+
+type postRackResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r postRackResponse) error() error { return r.Err }
+
+type getRackRequest struct {
+	ID string
+}
+
+type getRackResponse struct {
+	Rack Rack  `json:"rack"`
+	Err  error `json:"err,omitempty"`
+}
+
+func (r getRackResponse) error() error { return r.Err }
+
+type putRackRequest struct {
+	ID   string
+	Rack Rack
+}
+
+type putRackResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r putRackResponse) error() error { return r.Err }
+
+type deleteRackRequest struct {
+	ID string
+}
+
+type deleteRackResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r deleteRackResponse) error() error { return r.Err }
+
+type listRacksRequest struct {
+	DataCenter string
+}
+
+type listRacksResponse struct {
+	Racks []Rack `json:"racks"`
+	Err   error  `json:"err,omitempty"`
+}
+
+func (r listRacksResponse) error() error { return r.Err }
+
+type getTreeRequest struct {
+	DataCenter string
+}
+
+type getTreeResponse struct {
+	DataCenters []DataCenterNode `json:"datacenters"`
+	Err         error            `json:"err,omitempty"`
+}
+
+func (r getTreeResponse) error() error { return r.Err }
+
+type getElevationRequest struct {
+	RackID string
+	Format string
+}
+
+type getElevationResponse struct {
+	Elevation Elevation `json:"elevation"`
+	Format    string    `json:"-"`
+	Err       error     `json:"err,omitempty"`
+}
+
+func (r getElevationResponse) error() error { return r.Err }
@@ -0,0 +1,68 @@
+package topology
+
+import (
+	"context"
+
+	"github.com/xinyu/infra/inventory/host"
+)
+
+// HostMiddleware validates the DataCenter and Rack of host writes against
+// the topology, so that a host can only be placed in a datacenter and rack
+// that exist.
+func HostMiddleware(t Topology) host.Middleware {
+	return func(next host.Host) host.Host {
+		return &hostMiddleware{
+			Host:     next,
+			topology: t,
+		}
+	}
+}
+
+type hostMiddleware struct {
+	host.Host
+	topology Topology
+}
+
+func (mw hostMiddleware) PostHostInfo(ctx context.Context, h host.HostInfo) error {
+	if err := mw.validate(ctx, h); err != nil {
+		return err
+	}
+	return mw.Host.PostHostInfo(ctx, h)
+}
+
+func (mw hostMiddleware) PutHostInfo(ctx context.Context, id string, h host.HostInfo) error {
+	if err := mw.validate(ctx, h); err != nil {
+		return err
+	}
+	return mw.Host.PutHostInfo(ctx, id, h)
+}
+
+func (mw hostMiddleware) BatchHostInfo(ctx context.Context, b host.Batch) ([]host.BatchResult, error) {
+	return host.ForwardBatch(ctx, b, func(op *host.HostOp) error {
+		if op.Op != host.OpCreate && op.Op != host.OpUpdate {
+			return nil
+		}
+		return mw.validate(ctx, op.HostInfo)
+	}, mw.Host.BatchHostInfo)
+}
+
+func (mw hostMiddleware) validate(ctx context.Context, h host.HostInfo) error {
+	if h.DataCenter != "" {
+		if _, err := mw.topology.GetDataCenter(ctx, h.DataCenter); err != nil {
+			return host.ErrUnknownDataCenter
+		}
+	}
+	if h.Rack != "" {
+		r, err := mw.topology.GetRack(ctx, h.Rack)
+		if err != nil {
+			return host.ErrUnknownRack
+		}
+		if r.DataCenter != h.DataCenter {
+			return host.ErrRackDataCenter
+		}
+		if h.Top() > r.Units {
+			return host.ErrOutsideRack
+		}
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package topology
+
+import (
+	"context"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// InventoryMiddleware joins the topology with the hosts and services placed
+// in it. It fills the hosts and services into the topology tree and refuses
+// to delete a datacenter or rack that hosts are still placed in. Racks are
+// physical, so hosts and services of every namespace are considered.
+func InventoryMiddleware(hosts host.Host, services service.Service) Middleware {
+	return func(next Topology) Topology {
+		return &inventoryMiddleware{
+			Topology: next,
+			hosts:    hosts,
+			services: services,
+		}
+	}
+}
+
+type inventoryMiddleware struct {
+	Topology
+	hosts    host.Host
+	services service.Service
+}
+
+func (mw inventoryMiddleware) DeleteDataCenter(ctx context.Context, id string) error {
+	if err := mw.checkEmpty(ctx, host.HostFilter{DataCenter: id}); err != nil {
+		return err
+	}
+	return mw.Topology.DeleteDataCenter(ctx, id)
+}
+
+// PutRack and the Delete methods count the hosts in the trash too, as they
+// get their place back when undeleted.
+func (mw inventoryMiddleware) PutRack(ctx context.Context, id string, r Rack) error {
+	hosts, err := mw.hosts.ListHostInfo(namespace.AllNamespaces(ctx), host.HostFilter{Rack: id, IncludeDeleted: true})
+	if err != nil {
+		return err
+	}
+	for _, h := range hosts {
+		if h.DataCenter != r.DataCenter || h.Top() > r.Units {
+			return ErrInUse
+		}
+	}
+	return mw.Topology.PutRack(ctx, id, r)
+}
+
+func (mw inventoryMiddleware) DeleteRack(ctx context.Context, id string) error {
+	if err := mw.checkEmpty(ctx, host.HostFilter{Rack: id}); err != nil {
+		return err
+	}
+	return mw.Topology.DeleteRack(ctx, id)
+}
+
+func (mw inventoryMiddleware) checkEmpty(ctx context.Context, f host.HostFilter) error {
+	f.IncludeDeleted = true
+	hosts, err := mw.hosts.ListHostInfo(namespace.AllNamespaces(ctx), f)
+	if err != nil {
+		return err
+	}
+	if len(hosts) > 0 {
+		return ErrInUse
+	}
+	return nil
+}
+
+func (mw inventoryMiddleware) GetTree(ctx context.Context, dataCenter string) ([]DataCenterNode, error) {
+	tree, err := mw.Topology.GetTree(ctx, dataCenter)
+	if err != nil {
+		return nil, err
+	}
+	actx := namespace.AllNamespaces(ctx)
+	hosts, err := mw.hosts.ListHostInfo(actx, host.HostFilter{DataCenter: dataCenter})
+	if err != nil {
+		return nil, err
+	}
+	services, err := mw.services.ListServiceInfo(actx, service.ServiceFilter{})
+	if err != nil {
+		return nil, err
+	}
+	servicesByID := map[serviceKey]service.ServiceInfo{}
+	for _, s := range services {
+		servicesByID[serviceKey{s.Namespace, s.ID}] = s
+	}
+
+	for i := range tree {
+		dc := &tree[i]
+		racks := map[string]*RackNode{}
+		for j := range dc.Racks {
+			racks[dc.Racks[j].ID] = &dc.Racks[j]
+		}
+		for _, h := range hosts {
+			if h.DataCenter != dc.ID {
+				continue
+			}
+			node, err := mw.hostNode(ctx, h, services, servicesByID)
+			if err != nil {
+				return nil, err
+			}
+			if r, ok := racks[h.Rack]; ok {
+				r.Hosts = append(r.Hosts, node)
+			} else {
+				dc.Hosts = append(dc.Hosts, node)
+			}
+		}
+	}
+	return tree, nil
+}
+
+func (mw inventoryMiddleware) GetElevation(ctx context.Context, rackID string) (Elevation, error) {
+	e, err := mw.Topology.GetElevation(ctx, rackID)
+	if err != nil {
+		return Elevation{}, err
+	}
+	hosts, err := mw.hosts.ListHostInfo(namespace.AllNamespaces(ctx), host.HostFilter{Rack: rackID, IncludeDeleted: true})
+	if err != nil {
+		return Elevation{}, err
+	}
+	for _, h := range hosts {
+		e.place(h)
+	}
+	return e, nil
+}
+
+type serviceKey struct {
+	namespace string
+	id        string
+}
+
+// hostNode collects the services placed on h, either directly or through
+// one of their instances.
+func (mw inventoryMiddleware) hostNode(ctx context.Context, h host.HostInfo, services []service.ServiceInfo, byID map[serviceKey]service.ServiceInfo) (HostNode, error) {
+	node := HostNode{HostInfo: h, Services: []service.ServiceInfo{}}
+	placed := map[serviceKey]bool{}
+	for _, s := range services {
+		if s.HostNamespace == h.Namespace && s.HostID == h.ID {
+			placed[serviceKey{s.Namespace, s.ID}] = true
+			node.Services = append(node.Services, s)
+		}
+	}
+	instances, err := mw.services.ListHostInstances(namespace.NewContext(ctx, h.Namespace), h.ID)
+	if err != nil && err != host.ErrNotFoundID {
+		return HostNode{}, err
+	}
+	for _, in := range instances {
+		k := serviceKey{in.Namespace, in.ServiceID}
+		if s, ok := byID[k]; ok && !placed[k] {
+			placed[k] = true
+			node.Services = append(node.Services, s)
+		}
+	}
+	return node, nil
+}
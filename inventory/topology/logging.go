@@ -0,0 +1,108 @@
+package topology
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+type Middleware func(Topology) Topology
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Topology) Topology {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Topology
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) PostDataCenter(ctx context.Context, d DataCenter) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostDataCenter", "id", d.ID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostDataCenter(ctx, d)
+}
+
+func (mw loggingMiddleware) GetDataCenter(ctx context.Context, id string) (d DataCenter, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetDataCenter", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetDataCenter(ctx, id)
+}
+
+func (mw loggingMiddleware) PutDataCenter(ctx context.Context, id string, d DataCenter) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutDataCenter", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutDataCenter(ctx, id, d)
+}
+
+func (mw loggingMiddleware) DeleteDataCenter(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteDataCenter", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteDataCenter(ctx, id)
+}
+
+func (mw loggingMiddleware) ListDataCenters(ctx context.Context) (list []DataCenter, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListDataCenters", "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListDataCenters(ctx)
+}
+
+func (mw loggingMiddleware) PostRack(ctx context.Context, r Rack) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostRack", "id", r.ID, "datacenter", r.DataCenter, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostRack(ctx, r)
+}
+
+func (mw loggingMiddleware) GetRack(ctx context.Context, id string) (r Rack, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetRack", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetRack(ctx, id)
+}
+
+func (mw loggingMiddleware) PutRack(ctx context.Context, id string, r Rack) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutRack", "id", id, "datacenter", r.DataCenter, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutRack(ctx, id, r)
+}
+
+func (mw loggingMiddleware) DeleteRack(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteRack", "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteRack(ctx, id)
+}
+
+func (mw loggingMiddleware) ListRacks(ctx context.Context, dataCenter string) (list []Rack, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListRacks", "datacenter", dataCenter, "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListRacks(ctx, dataCenter)
+}
+
+func (mw loggingMiddleware) GetTree(ctx context.Context, dataCenter string) (tree []DataCenterNode, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetTree", "datacenter", dataCenter, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetTree(ctx, dataCenter)
+}
+
+func (mw loggingMiddleware) GetElevation(ctx context.Context, rackID string) (e Elevation, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetElevation", "rack", rackID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetElevation(ctx, rackID)
+}
@@ -0,0 +1,276 @@
+package topology
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+type Topology interface {
+	PostDataCenter(ctx context.Context, d DataCenter) error
+	GetDataCenter(ctx context.Context, id string) (DataCenter, error)
+	PutDataCenter(ctx context.Context, id string, d DataCenter) error
+	DeleteDataCenter(ctx context.Context, id string) error
+	ListDataCenters(ctx context.Context) ([]DataCenter, error)
+	PostRack(ctx context.Context, r Rack) error
+	GetRack(ctx context.Context, id string) (Rack, error)
+	PutRack(ctx context.Context, id string, r Rack) error
+	DeleteRack(ctx context.Context, id string) error
+	ListRacks(ctx context.Context, dataCenter string) ([]Rack, error)
+	GetTree(ctx context.Context, dataCenter string) ([]DataCenterNode, error)
+	GetElevation(ctx context.Context, rackID string) (Elevation, error)
+}
+
+type DataCenter struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Location    string    `json:"location"`
+	PowerBudget float64   `json:"powerbudget"`
+	CreatedAt   time.Time `json:"createtime"`
+	UpdatedAt   time.Time `json:"updatetime"`
+	Remark      string    `json:"remark"`
+}
+
+// Rack is a rack in a datacenter. Units is its height in rack units and
+// PowerBudget its power allowance in kW.
+type Rack struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	DataCenter  string    `json:"datacenter"`
+	Location    string    `json:"location"`
+	Units       int       `json:"units"`
+	PowerBudget float64   `json:"powerbudget"`
+	CreatedAt   time.Time `json:"createtime"`
+	UpdatedAt   time.Time `json:"updatetime"`
+	Remark      string    `json:"remark"`
+}
+
+// DataCenterNode is the root of the topology tree of one datacenter. Hosts
+// lists hosts placed in the datacenter without a rack.
+type DataCenterNode struct {
+	DataCenter
+	Racks []RackNode `json:"racks"`
+	Hosts []HostNode `json:"hosts"`
+}
+
+type RackNode struct {
+	Rack
+	Hosts []HostNode `json:"hosts"`
+}
+
+type HostNode struct {
+	host.HostInfo
+	Services []service.ServiceInfo `json:"services"`
+}
+
+var (
+	ErrInconsistentIDs    = errors.New("inconsistent IDs")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrNotFound           = errors.New("not found")
+	ErrNotFoundDataCenter = errors.New("not found datacenter ID")
+	ErrInvalidRack        = errors.New("invalid rack")
+	ErrInUse              = errors.New("in use")
+)
+
+type inmemTopology struct {
+	mtx   sync.RWMutex
+	dcs   map[string]DataCenter
+	racks map[string]Rack
+}
+
+func NewInmemTopology() Topology {
+	return &inmemTopology{
+		dcs:   map[string]DataCenter{},
+		racks: map[string]Rack{},
+	}
+}
+
+func (s *inmemTopology) PostDataCenter(ctx context.Context, d DataCenter) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.dcs[d.ID]; ok {
+		return ErrAlreadyExists
+	}
+
+	currentTime := time.Now()
+	d.CreatedAt = currentTime
+	d.UpdatedAt = currentTime
+
+	s.dcs[d.ID] = d
+	return nil
+}
+
+func (s *inmemTopology) GetDataCenter(ctx context.Context, id string) (DataCenter, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	d, ok := s.dcs[id]
+	if !ok {
+		return DataCenter{}, ErrNotFound
+	}
+	return d, nil
+}
+
+func (s *inmemTopology) PutDataCenter(ctx context.Context, id string, d DataCenter) error {
+	if id != d.ID {
+		return ErrInconsistentIDs
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	d.UpdatedAt = time.Now()
+	if last, ok := s.dcs[id]; ok {
+		d.CreatedAt = last.CreatedAt
+	} else {
+		d.CreatedAt = d.UpdatedAt
+	}
+
+	s.dcs[id] = d
+	return nil
+}
+
+func (s *inmemTopology) DeleteDataCenter(ctx context.Context, id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.dcs[id]; !ok {
+		return ErrNotFound
+	}
+	for _, r := range s.racks {
+		if r.DataCenter == id {
+			return ErrInUse
+		}
+	}
+	delete(s.dcs, id)
+	return nil
+}
+
+func (s *inmemTopology) ListDataCenters(ctx context.Context) ([]DataCenter, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []DataCenter{}
+	for _, d := range s.dcs {
+		list = append(list, d)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (s *inmemTopology) PostRack(ctx context.Context, r Rack) error {
+	if r.Units <= 0 {
+		return ErrInvalidRack
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.racks[r.ID]; ok {
+		return ErrAlreadyExists
+	}
+	if _, ok := s.dcs[r.DataCenter]; !ok {
+		return ErrNotFoundDataCenter
+	}
+
+	currentTime := time.Now()
+	r.CreatedAt = currentTime
+	r.UpdatedAt = currentTime
+
+	s.racks[r.ID] = r
+	return nil
+}
+
+func (s *inmemTopology) GetRack(ctx context.Context, id string) (Rack, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	r, ok := s.racks[id]
+	if !ok {
+		return Rack{}, ErrNotFound
+	}
+	return r, nil
+}
+
+func (s *inmemTopology) PutRack(ctx context.Context, id string, r Rack) error {
+	if id != r.ID {
+		return ErrInconsistentIDs
+	}
+	if r.Units <= 0 {
+		return ErrInvalidRack
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.dcs[r.DataCenter]; !ok {
+		return ErrNotFoundDataCenter
+	}
+
+	r.UpdatedAt = time.Now()
+	if last, ok := s.racks[id]; ok {
+		r.CreatedAt = last.CreatedAt
+	} else {
+		r.CreatedAt = r.UpdatedAt
+	}
+
+	s.racks[id] = r
+	return nil
+}
+
+func (s *inmemTopology) DeleteRack(ctx context.Context, id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if _, ok := s.racks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.racks, id)
+	return nil
+}
+
+func (s *inmemTopology) ListRacks(ctx context.Context, dataCenter string) ([]Rack, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []Rack{}
+	for _, r := range s.racks {
+		if dataCenter == "" || r.DataCenter == dataCenter {
+			list = append(list, r)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// GetTree returns the datacenters and their racks. The store does not know
+// about hosts; InventoryMiddleware fills them in.
+func (s *inmemTopology) GetTree(ctx context.Context, dataCenter string) ([]DataCenterNode, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	if _, ok := s.dcs[dataCenter]; dataCenter != "" && !ok {
+		return nil, ErrNotFound
+	}
+	tree := []DataCenterNode{}
+	for _, d := range s.dcs {
+		if dataCenter != "" && d.ID != dataCenter {
+			continue
+		}
+		node := DataCenterNode{DataCenter: d, Racks: []RackNode{}, Hosts: []HostNode{}}
+		for _, r := range s.racks {
+			if r.DataCenter == d.ID {
+				node.Racks = append(node.Racks, RackNode{Rack: r, Hosts: []HostNode{}})
+			}
+		}
+		sort.Slice(node.Racks, func(i, j int) bool { return node.Racks[i].ID < node.Racks[j].ID })
+		tree = append(tree, node)
+	}
+	sort.Slice(tree, func(i, j int) bool { return tree[i].ID < tree[j].ID })
+	return tree, nil
+}
+
+// GetElevation returns the units of a rack, all free. InventoryMiddleware
+// places the hosts.
+func (s *inmemTopology) GetElevation(ctx context.Context, rackID string) (Elevation, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	r, ok := s.racks[rackID]
+	if !ok {
+		return Elevation{}, ErrNotFound
+	}
+	return newElevation(r), nil
+}
@@ -0,0 +1,254 @@
+package topology
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+)
+
+func MakeHTTPHandler(s Topology, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+	}
+
+	r.Methods("POST").Path("/topology/v1/datacenters/").Handler(httptransport.NewServer(
+		e.PostDataCenterEndpoint,
+		decodePostDataCenterRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/topology/v1/datacenters/").Handler(httptransport.NewServer(
+		e.ListDataCentersEndpoint,
+		decodeListDataCentersRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/topology/v1/datacenters/{id}").Handler(httptransport.NewServer(
+		e.GetDataCenterEndpoint,
+		decodeGetDataCenterRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/topology/v1/datacenters/{id}").Handler(httptransport.NewServer(
+		e.PutDataCenterEndpoint,
+		decodePutDataCenterRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/topology/v1/datacenters/{id}").Handler(httptransport.NewServer(
+		e.DeleteDataCenterEndpoint,
+		decodeDeleteDataCenterRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("POST").Path("/topology/v1/racks/").Handler(httptransport.NewServer(
+		e.PostRackEndpoint,
+		decodePostRackRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/topology/v1/racks/").Handler(httptransport.NewServer(
+		e.ListRacksEndpoint,
+		decodeListRacksRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/topology/v1/racks/{id}").Handler(httptransport.NewServer(
+		e.GetRackEndpoint,
+		decodeGetRackRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("PUT").Path("/topology/v1/racks/{id}").Handler(httptransport.NewServer(
+		e.PutRackEndpoint,
+		decodePutRackRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("DELETE").Path("/topology/v1/racks/{id}").Handler(httptransport.NewServer(
+		e.DeleteRackEndpoint,
+		decodeDeleteRackRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/topology/v1/tree").Handler(httptransport.NewServer(
+		e.GetTreeEndpoint,
+		decodeGetTreeRequest,
+		encodeResponse,
+		options...,
+	))
+	r.Methods("GET").Path("/topology/v1/racks/{id}/elevation").Handler(httptransport.NewServer(
+		e.GetElevationEndpoint,
+		decodeGetElevationRequest,
+		encodeElevationResponse,
+		options...,
+	))
+
+	return r
+}
+
+func decodePostDataCenterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req postDataCenterRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.DataCenter); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeGetDataCenterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getDataCenterRequest{ID: id}, nil
+}
+
+func decodePutDataCenterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var dataCenter DataCenter
+	if err := json.NewDecoder(r.Body).Decode(&dataCenter); err != nil {
+		return nil, err
+	}
+	return putDataCenterRequest{
+		ID:         id,
+		DataCenter: dataCenter,
+	}, nil
+}
+
+func decodeDeleteDataCenterRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return deleteDataCenterRequest{ID: id}, nil
+}
+
+func decodeListDataCentersRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return listDataCentersRequest{}, nil
+}
+
+func decodePostRackRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req postRackRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Rack); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeGetRackRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getRackRequest{ID: id}, nil
+}
+
+func decodePutRackRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var rack Rack
+	if err := json.NewDecoder(r.Body).Decode(&rack); err != nil {
+		return nil, err
+	}
+	return putRackRequest{
+		ID:   id,
+		Rack: rack,
+	}, nil
+}
+
+func decodeDeleteRackRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return deleteRackRequest{ID: id}, nil
+}
+
+func decodeListRacksRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return listRacksRequest{DataCenter: r.URL.Query().Get("datacenter")}, nil
+}
+
+func decodeGetTreeRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return getTreeRequest{DataCenter: r.URL.Query().Get("datacenter")}, nil
+}
+
+func decodeGetElevationRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getElevationRequest{RackID: id, Format: r.URL.Query().Get("format")}, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+// encodeElevationResponse writes a rack elevation as JSON, or as a text
+// diagram when the request asked for format=text.
+func encodeElevationResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if r, ok := response.(getElevationResponse); ok && r.Err == nil && r.Format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		return r.Elevation.WriteText(w)
+	}
+	return encodeResponse(ctx, w, response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	switch err {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrAlreadyExists, ErrInconsistentIDs, ErrNotFoundDataCenter, ErrInvalidRack:
+		return http.StatusBadRequest
+	case ErrInUse:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,36 @@
+package txn
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	CommitEndpoint endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Txn) Endpoints {
+	return Endpoints{
+		CommitEndpoint: MakeCommitEndpoint(s),
+	}
+}
+
+func MakeCommitEndpoint(s Txn) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(commitRequest)
+		r, e := s.Commit(ctx, req.Transaction)
+		return commitResponse{Result: r, Err: e}, nil
+	}
+}
+
+type commitRequest struct {
+	Transaction Transaction
+}
+
+type commitResponse struct {
+	Result Result
+	Err    error
+}
+
+func (r commitResponse) error() error { return r.Err }
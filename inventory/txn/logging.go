@@ -0,0 +1,33 @@
+package txn
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Middleware func(Txn) Txn
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Txn) Txn {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Txn
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) Commit(ctx context.Context, t Transaction) (r Result, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Commit", "namespace", namespace.FromContext(ctx), "hosts", len(t.Hosts), "services", len(t.Services), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Commit(ctx, t)
+}
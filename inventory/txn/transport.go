@@ -0,0 +1,111 @@
+package txn
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+func MakeHTTPHandler(s Txn, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext),
+	}
+
+	for _, prefix := range []string{"/txn/v1", "/txn/v1/namespaces/{ns}"} {
+		r.Methods("POST").Path(prefix + "/commit").Handler(httptransport.NewServer(
+			e.CommitEndpoint,
+			decodeCommitRequest,
+			encodeCommitResponse,
+			options...,
+		))
+	}
+	return r
+}
+
+func decodeCommitRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req commitRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Transaction); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+// commitBody is the wire form of a commit response. Every result carries
+// the error of its operation, if any.
+type commitBody struct {
+	Error    string       `json:"error,omitempty"`
+	Hosts    []resultBody `json:"hosts"`
+	Services []resultBody `json:"services"`
+}
+
+type resultBody struct {
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// encodeCommitResponse writes the per-operation results of a transaction,
+// also when it was aborted.
+func encodeCommitResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	r := response.(commitResponse)
+	if r.Err != nil && r.Result.Hosts == nil && r.Result.Services == nil {
+		encodeError(ctx, r.Err, w)
+		return nil
+	}
+	body := commitBody{Hosts: []resultBody{}, Services: []resultBody{}}
+	for _, result := range r.Result.Hosts {
+		body.Hosts = append(body.Hosts, newResultBody(result.ID, result.Err))
+	}
+	for _, result := range r.Result.Services {
+		body.Services = append(body.Services, newResultBody(result.ID, result.Err))
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if r.Err != nil {
+		body.Error = r.Err.Error()
+		w.WriteHeader(codeFrom(r.Err))
+	}
+	return json.NewEncoder(w).Encode(body)
+}
+
+func newResultBody(id string, err error) resultBody {
+	b := resultBody{ID: id}
+	if err != nil {
+		b.Error = err.Error()
+	}
+	return b
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	switch err {
+	case host.ErrUnknownNamespace, service.ErrUnknownNamespace:
+		return http.StatusNotFound
+	case ErrAborted:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,100 @@
+package txn
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// Txn commits units of work spanning the host and service stores.
+type Txn interface {
+	Commit(ctx context.Context, t Transaction) (Result, error)
+}
+
+// Transaction is a unit of work: host and service operations, including
+// check operations that only evaluate conditions, applied all together or
+// not at all. Conditions are evaluated while the stores are locked, so no
+// other writer can interleave with the transaction.
+type Transaction struct {
+	Hosts    []host.HostOp       `json:"hosts,omitempty"`
+	Services []service.ServiceOp `json:"services,omitempty"`
+}
+
+// Result holds the outcome of every operation of a transaction, in order.
+type Result struct {
+	Hosts    []host.BatchResult
+	Services []service.BatchResult
+}
+
+var (
+	ErrAborted = errors.New("transaction aborted, no operation was applied")
+)
+
+type coordinator struct {
+	hosts    host.Host
+	services service.Service
+}
+
+// NewCoordinator returns a Txn that applies transactions as one atomic
+// batch per store. Each store applies its batch and stays locked until
+// every batch has been applied; the coordinator then commits all of them,
+// or rolls all of them back if one failed.
+//
+// Service batches run first: validating services reads the host store,
+// which must not be locked by the transaction at that point. As a
+// consequence a service cannot refer to a host created by the same
+// transaction.
+func NewCoordinator(hosts host.Host, services service.Service) Txn {
+	return &coordinator{
+		hosts:    hosts,
+		services: services,
+	}
+}
+
+type hold struct {
+	commit, rollback func()
+}
+
+func (c *coordinator) Commit(ctx context.Context, t Transaction) (Result, error) {
+	var held []hold
+	keep := func(commit, rollback func()) {
+		held = append(held, hold{commit: commit, rollback: rollback})
+	}
+	abort := func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].rollback()
+		}
+	}
+
+	var r Result
+	var err error
+	if len(t.Services) > 0 {
+		r.Services, err = c.services.BatchServiceInfo(ctx, service.Batch{Ops: t.Services, Hold: keep})
+		if err != nil {
+			abort()
+			return r, abortError(err)
+		}
+	}
+	if len(t.Hosts) > 0 {
+		r.Hosts, err = c.hosts.BatchHostInfo(ctx, host.Batch{Ops: t.Hosts, Hold: keep})
+		if err != nil {
+			abort()
+			return r, abortError(err)
+		}
+	}
+	for _, h := range held {
+		h.commit()
+	}
+	return r, nil
+}
+
+// abortError reports an aborted batch as an aborted transaction and passes
+// other errors, such as an unknown namespace, through.
+func abortError(err error) error {
+	if err == host.ErrBatchAborted || err == service.ErrBatchAborted {
+		return ErrAborted
+	}
+	return err
+}
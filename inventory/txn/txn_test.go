@@ -0,0 +1,145 @@
+package txn
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+func newStores(t *testing.T) (host.Host, service.Service) {
+	t.Helper()
+	ctx := context.Background()
+	hosts, services := host.NewInmemHost(), service.NewInmemService()
+	for _, id := range []string{"1001", "1002"} {
+		if err := hosts.PostHostInfo(ctx, host.HostInfo{ID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := services.PostServiceInfo(ctx, service.ServiceInfo{ID: "100001", HostID: "1001"}); err != nil {
+		t.Fatal(err)
+	}
+	return hosts, services
+}
+
+// move is the transaction of the API docs: the service moves to host 1002
+// and host 1001 is retired, both only if still at the versions read.
+func move(hostVersion uint64) Transaction {
+	return Transaction{
+		Services: []service.ServiceOp{{Op: service.OpUpdate, IfVersion: 1, ServiceInfo: service.ServiceInfo{ID: "100001", HostID: "1002"}}},
+		Hosts:    []host.HostOp{{Op: host.OpDelete, ID: "1001", IfVersion: hostVersion}},
+	}
+}
+
+func TestCommit(t *testing.T) {
+	ctx := context.Background()
+	hosts, services := newStores(t)
+	r, err := NewCoordinator(hosts, services).Commit(ctx, move(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Services) != 1 || r.Services[0].Err != nil || len(r.Hosts) != 1 || r.Hosts[0].Err != nil {
+		t.Fatalf("results %+v", r)
+	}
+	s, err := services.GetServiceInfo(ctx, "100001")
+	if err != nil || s.HostID != "1002" || s.Version != 2 {
+		t.Fatalf("service %+v, %v", s, err)
+	}
+	if _, err := hosts.GetHostInfo(ctx, "1001"); err != host.ErrNotFound {
+		t.Fatalf("host 1001: got %v, want it deleted", err)
+	}
+}
+
+func TestRollbackOnHostFailure(t *testing.T) {
+	ctx := context.Background()
+	hosts, services := newStores(t)
+	r, err := NewCoordinator(hosts, services).Commit(ctx, move(7))
+	if err != ErrAborted {
+		t.Fatalf("got %v, want %v", err, ErrAborted)
+	}
+	if r.Hosts[0].Err != host.ErrVersionConflict {
+		t.Fatalf("host result %v, want %v", r.Hosts[0].Err, host.ErrVersionConflict)
+	}
+	s, err := services.GetServiceInfo(ctx, "100001")
+	if err != nil || s.HostID != "1001" || s.Version != 1 {
+		t.Fatalf("service %+v, %v: the held service batch was not rolled back", s, err)
+	}
+	if _, err := hosts.GetHostInfo(ctx, "1001"); err != nil {
+		t.Fatal(err)
+	}
+	// Both stores were unlocked by the rollback.
+	if err := services.PutServiceInfo(ctx, "100001", service.ServiceInfo{ID: "100001", HostID: "1001"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := hosts.DeleteHostInfo(ctx, "1002"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRollbackOnServiceFailure(t *testing.T) {
+	ctx := context.Background()
+	hosts, services := newStores(t)
+	tx := move(1)
+	tx.Services[0].IfVersion = 7
+	if _, err := NewCoordinator(hosts, services).Commit(ctx, tx); err != ErrAborted {
+		t.Fatalf("got %v, want %v", err, ErrAborted)
+	}
+	if _, err := hosts.GetHostInfo(ctx, "1001"); err != nil {
+		t.Fatalf("host 1001: %v, the host batch ran after a failed service batch", err)
+	}
+}
+
+// pausingHosts signals when the host batch of a transaction starts, and
+// waits for release before applying it.
+type pausingHosts struct {
+	host.Host
+	started, release chan struct{}
+}
+
+func (h pausingHosts) BatchHostInfo(ctx context.Context, b host.Batch) ([]host.BatchResult, error) {
+	close(h.started)
+	<-h.release
+	return h.Host.BatchHostInfo(ctx, b)
+}
+
+func TestConcurrentWriter(t *testing.T) {
+	ctx := context.Background()
+	hosts, services := newStores(t)
+	paused := pausingHosts{Host: hosts, started: make(chan struct{}), release: make(chan struct{})}
+
+	committed := make(chan error, 1)
+	go func() {
+		_, err := NewCoordinator(paused, services).Commit(ctx, move(1))
+		committed <- err
+	}()
+	<-paused.started
+
+	// The service batch is held: a writer of the service store waits for
+	// the transaction.
+	written := make(chan error, 1)
+	go func() {
+		written <- services.PutServiceInfo(ctx, "100001", service.ServiceInfo{ID: "100001", HostID: "1001", Remark: "concurrent"})
+	}()
+	select {
+	case err := <-written:
+		t.Fatalf("concurrent write returned %v while the transaction held the store", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(paused.release)
+	if err := <-committed; err != nil {
+		t.Fatal(err)
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	s, err := services.GetServiceInfo(ctx, "100001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Remark != "concurrent" || s.Version != 3 {
+		t.Fatalf("service %+v: the concurrent write was not applied after the transaction", s)
+	}
+}
@@ -0,0 +1,133 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Records are framed as a 4-byte little-endian length, the CRC-32C of the
+// payload, the CRC-32C of those 8 bytes, and the payload, JSON. The
+// header has its own checksum so that a damaged length is not mistaken
+// for a record running past the end of the file.
+const headerSize = 12
+
+// maxRecord bounds the length of a record.
+const maxRecord = 1 << 30
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// CorruptError is returned when a record that is not the last of its file
+// does not match its checksum: the file was damaged, not torn by a crash.
+type CorruptError struct {
+	File   string
+	Offset int64
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("corrupt record in %s at offset %d", e.File, e.Offset)
+}
+
+var errTorn = errors.New("torn record")
+
+func frame(payload []byte) []byte {
+	b := make([]byte, headerSize+len(payload))
+	binary.LittleEndian.PutUint32(b[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(b[4:8], crc32.Checksum(payload, crcTable))
+	binary.LittleEndian.PutUint32(b[8:12], crc32.Checksum(b[0:8], crcTable))
+	copy(b[headerSize:], payload)
+	return b
+}
+
+// readRecord reads the record at offset of f, which is size bytes long. It
+// returns errTorn only for the last record of the file: one cut short, one
+// whose payload does not match its checksum and ends the file, or zeros
+// up to the end of the file, which some file systems leave after a crash.
+// Any other mismatch is a *CorruptError.
+func readRecord(f *os.File, offset, size int64) ([]byte, error) {
+	if size-offset < headerSize {
+		return nil, errTorn
+	}
+	var h [headerSize]byte
+	if _, err := f.ReadAt(h[:], offset); err != nil {
+		return nil, err
+	}
+	if crc32.Checksum(h[0:8], crcTable) != binary.LittleEndian.Uint32(h[8:12]) {
+		zero, err := zeros(f, offset, size)
+		if err != nil {
+			return nil, err
+		}
+		if zero {
+			return nil, errTorn
+		}
+		return nil, &CorruptError{File: f.Name(), Offset: offset}
+	}
+	n := int64(binary.LittleEndian.Uint32(h[0:4]))
+	end := offset + headerSize + n
+	if n > maxRecord {
+		return nil, &CorruptError{File: f.Name(), Offset: offset}
+	}
+	if end > size {
+		return nil, errTorn
+	}
+	payload := make([]byte, n)
+	if _, err := f.ReadAt(payload, offset+headerSize); err != nil && err != io.EOF {
+		return nil, err
+	}
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(h[4:8]) {
+		if end == size {
+			return nil, errTorn
+		}
+		return nil, &CorruptError{File: f.Name(), Offset: offset}
+	}
+	return payload, nil
+}
+
+// zeros reports whether f holds only zero bytes from offset to size.
+func zeros(f *os.File, offset, size int64) (bool, error) {
+	buf := make([]byte, 32<<10)
+	for offset < size {
+		if int64(len(buf)) > size-offset {
+			buf = buf[:size-offset]
+		}
+		if _, err := f.ReadAt(buf, offset); err != nil && err != io.EOF {
+			return false, err
+		}
+		for _, c := range buf {
+			if c != 0 {
+				return false, nil
+			}
+		}
+		offset += int64(len(buf))
+	}
+	return true, nil
+}
+
+// scan calls fn with every record of f in order, and returns the offset
+// where the last whole record ends, which is short of the size of f if
+// its tail was torn.
+func scan(f *os.File, fn func(payload []byte) error) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := fi.Size()
+	var offset int64
+	for offset < size {
+		payload, err := readRecord(f, offset, size)
+		if err == errTorn {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, err
+		}
+		if err := fn(payload); err != nil {
+			return offset, err
+		}
+		offset += headerSize + int64(len(payload))
+	}
+	return offset, nil
+}
@@ -0,0 +1,229 @@
+package wal
+
+import (
+	"context"
+	"sync"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// Hosts returns the host store that writes through the log. It also
+// implements host.Snapshotter; loading a state is logged like any write.
+func (l *Log) Hosts() host.Host {
+	return &walHost{Host: l.hosts, log: l}
+}
+
+// Services returns the service store that writes through the log. It also
+// implements service.Snapshotter.
+func (l *Log) Services() service.Service {
+	return &walService{Service: l.services, log: l}
+}
+
+// write logs the call of method, then applies it with apply, holding mtx
+// so that the store applies writes in the order they were logged.
+func (l *Log) write(ctx context.Context, mtx *sync.Mutex, method, id, instanceID string, args interface{}, apply func(ctx context.Context) error) error {
+	mtx.Lock()
+	defer mtx.Unlock()
+	r, ctx, err := newRecord(ctx, method, id, instanceID, args)
+	if err != nil {
+		return err
+	}
+	if err := l.append(r); err != nil {
+		return err
+	}
+	return apply(ctx)
+}
+
+// hold wraps the Hold of a batch that takes part in a transaction. Such a
+// batch is logged when it commits, while the store is still locked, and
+// not at all if it rolls back. mtx stays locked until then.
+func (l *Log) hold(mtx *sync.Mutex, r record, held *bool, next func(commit, rollback func())) func(commit, rollback func()) {
+	return func(commit, rollback func()) {
+		*held = true
+		next(func() {
+			if err := l.append(r); err != nil {
+				// Committing keeps the stores as the transaction
+				// reported them; the log refuses any further write.
+				l.logger.Log("during", "commit", "method", r.Method, "err", err)
+			}
+			commit()
+			mtx.Unlock()
+		}, func() {
+			rollback()
+			mtx.Unlock()
+		})
+	}
+}
+
+type walHost struct {
+	host.Host
+	log *Log
+}
+
+func (s *walHost) PostHostInfo(ctx context.Context, h host.HostInfo) error {
+	return s.log.write(ctx, &s.log.hostMtx, "PostHostInfo", "", "", h, func(ctx context.Context) error {
+		return s.Host.PostHostInfo(ctx, h)
+	})
+}
+
+func (s *walHost) PutHostInfo(ctx context.Context, id string, h host.HostInfo) error {
+	return s.log.write(ctx, &s.log.hostMtx, "PutHostInfo", id, "", h, func(ctx context.Context) error {
+		return s.Host.PutHostInfo(ctx, id, h)
+	})
+}
+
+func (s *walHost) DeleteHostInfo(ctx context.Context, id string) error {
+	return s.log.write(ctx, &s.log.hostMtx, "DeleteHostInfo", id, "", nil, func(ctx context.Context) error {
+		return s.Host.DeleteHostInfo(ctx, id)
+	})
+}
+
+func (s *walHost) UndeleteHostInfo(ctx context.Context, id string) (h host.HostInfo, err error) {
+	err = s.log.write(ctx, &s.log.hostMtx, "UndeleteHostInfo", id, "", nil, func(ctx context.Context) error {
+		h, err = s.Host.UndeleteHostInfo(ctx, id)
+		return err
+	})
+	return h, err
+}
+
+func (s *walHost) PurgeHostInfo(ctx context.Context, id string) (h host.HostInfo, err error) {
+	err = s.log.write(ctx, &s.log.hostMtx, "PurgeHostInfo", id, "", nil, func(ctx context.Context) error {
+		h, err = s.Host.PurgeHostInfo(ctx, id)
+		return err
+	})
+	return h, err
+}
+
+func (s *walHost) BatchHostInfo(ctx context.Context, b host.Batch) (results []host.BatchResult, err error) {
+	if b.Hold == nil {
+		err = s.log.write(ctx, &s.log.hostMtx, "BatchHostInfo", "", "", b, func(ctx context.Context) error {
+			results, err = s.Host.BatchHostInfo(ctx, b)
+			return err
+		})
+		return results, err
+	}
+
+	s.log.hostMtx.Lock()
+	r, ctx, err := newRecord(ctx, "BatchHostInfo", "", "", b)
+	if err != nil {
+		s.log.hostMtx.Unlock()
+		return nil, err
+	}
+	held := false
+	forward := b
+	forward.Hold = s.log.hold(&s.log.hostMtx, r, &held, b.Hold)
+	results, err = s.Host.BatchHostInfo(ctx, forward)
+	if !held {
+		s.log.hostMtx.Unlock()
+	}
+	return results, err
+}
+
+func (s *walHost) DumpState(ctx context.Context) (host.State, error) {
+	return s.Host.(host.Snapshotter).DumpState(ctx)
+}
+
+func (s *walHost) LoadState(ctx context.Context, st host.State) error {
+	return s.log.write(ctx, &s.log.hostMtx, "LoadHostState", "", "", st, func(ctx context.Context) error {
+		return s.Host.(host.Snapshotter).LoadState(ctx, st)
+	})
+}
+
+type walService struct {
+	service.Service
+	log *Log
+}
+
+func (s *walService) PostServiceInfo(ctx context.Context, svc service.ServiceInfo) error {
+	return s.log.write(ctx, &s.log.serviceMtx, "PostServiceInfo", "", "", svc, func(ctx context.Context) error {
+		return s.Service.PostServiceInfo(ctx, svc)
+	})
+}
+
+func (s *walService) PutServiceInfo(ctx context.Context, id string, svc service.ServiceInfo) error {
+	return s.log.write(ctx, &s.log.serviceMtx, "PutServiceInfo", id, "", svc, func(ctx context.Context) error {
+		return s.Service.PutServiceInfo(ctx, id, svc)
+	})
+}
+
+func (s *walService) DeleteServiceInfo(ctx context.Context, id string) error {
+	return s.log.write(ctx, &s.log.serviceMtx, "DeleteServiceInfo", id, "", nil, func(ctx context.Context) error {
+		return s.Service.DeleteServiceInfo(ctx, id)
+	})
+}
+
+func (s *walService) UndeleteServiceInfo(ctx context.Context, id string) (svc service.ServiceInfo, err error) {
+	err = s.log.write(ctx, &s.log.serviceMtx, "UndeleteServiceInfo", id, "", nil, func(ctx context.Context) error {
+		svc, err = s.Service.UndeleteServiceInfo(ctx, id)
+		return err
+	})
+	return svc, err
+}
+
+func (s *walService) PurgeServiceInfo(ctx context.Context, id string) (svc service.ServiceInfo, err error) {
+	err = s.log.write(ctx, &s.log.serviceMtx, "PurgeServiceInfo", id, "", nil, func(ctx context.Context) error {
+		svc, err = s.Service.PurgeServiceInfo(ctx, id)
+		return err
+	})
+	return svc, err
+}
+
+func (s *walService) PutServiceHealth(ctx context.Context, id string, r service.CheckResult) error {
+	return s.log.write(ctx, &s.log.serviceMtx, "PutServiceHealth", id, "", r, func(ctx context.Context) error {
+		return s.Service.PutServiceHealth(ctx, id, r)
+	})
+}
+
+func (s *walService) PostServiceInstance(ctx context.Context, serviceID string, in service.Instance) error {
+	return s.log.write(ctx, &s.log.serviceMtx, "PostServiceInstance", serviceID, "", in, func(ctx context.Context) error {
+		return s.Service.PostServiceInstance(ctx, serviceID, in)
+	})
+}
+
+func (s *walService) PutServiceInstance(ctx context.Context, serviceID, instanceID string, in service.Instance) error {
+	return s.log.write(ctx, &s.log.serviceMtx, "PutServiceInstance", serviceID, instanceID, in, func(ctx context.Context) error {
+		return s.Service.PutServiceInstance(ctx, serviceID, instanceID, in)
+	})
+}
+
+func (s *walService) DeleteServiceInstance(ctx context.Context, serviceID, instanceID string) error {
+	return s.log.write(ctx, &s.log.serviceMtx, "DeleteServiceInstance", serviceID, instanceID, nil, func(ctx context.Context) error {
+		return s.Service.DeleteServiceInstance(ctx, serviceID, instanceID)
+	})
+}
+
+func (s *walService) BatchServiceInfo(ctx context.Context, b service.Batch) (results []service.BatchResult, err error) {
+	if b.Hold == nil {
+		err = s.log.write(ctx, &s.log.serviceMtx, "BatchServiceInfo", "", "", b, func(ctx context.Context) error {
+			results, err = s.Service.BatchServiceInfo(ctx, b)
+			return err
+		})
+		return results, err
+	}
+
+	s.log.serviceMtx.Lock()
+	r, ctx, err := newRecord(ctx, "BatchServiceInfo", "", "", b)
+	if err != nil {
+		s.log.serviceMtx.Unlock()
+		return nil, err
+	}
+	held := false
+	forward := b
+	forward.Hold = s.log.hold(&s.log.serviceMtx, r, &held, b.Hold)
+	results, err = s.Service.BatchServiceInfo(ctx, forward)
+	if !held {
+		s.log.serviceMtx.Unlock()
+	}
+	return results, err
+}
+
+func (s *walService) DumpState(ctx context.Context) (service.State, error) {
+	return s.Service.(service.Snapshotter).DumpState(ctx)
+}
+
+func (s *walService) LoadState(ctx context.Context, st service.State) error {
+	return s.log.write(ctx, &s.log.serviceMtx, "LoadServiceState", "", "", st, func(ctx context.Context) error {
+		return s.Service.(service.Snapshotter).LoadState(ctx, st)
+	})
+}
@@ -0,0 +1,511 @@
+package wal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/namespace"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// Sync policies: when the log is flushed to disk.
+const (
+	// SyncAlways flushes every write before it is applied, so that no
+	// acknowledged write is lost.
+	SyncAlways = "always"
+	// SyncInterval flushes every SyncInterval, and may lose the writes of
+	// the last interval.
+	SyncInterval = "interval"
+	// SyncNever leaves flushing to the operating system.
+	SyncNever = "never"
+)
+
+// Config configures a Log.
+type Config struct {
+	// Dir holds the log and the snapshot.
+	Dir string
+	// Sync is one of SyncAlways, SyncInterval and SyncNever.
+	Sync string
+	// SyncInterval is the flush interval of SyncInterval. Zero means 1s.
+	SyncInterval time.Duration
+	// SnapshotInterval is how often the stores are snapshotted and the
+	// log emptied, if it has grown. Zero means 5m.
+	SnapshotInterval time.Duration
+}
+
+var (
+	ErrInvalidSync   = errors.New("sync policy must be always, interval or never")
+	ErrUnknownMethod = errors.New("unknown method in write-ahead log")
+)
+
+const (
+	logName      = "wal.log"
+	snapshotName = "snapshot"
+)
+
+// Log is a write-ahead log of an in-memory host and service store. Every
+// write is appended to the log before it is applied; at startup the last
+// snapshot is loaded and the writes logged since are applied again, in
+// order and at the times they were first made.
+type Log struct {
+	cfg      Config
+	hosts    host.Host
+	services service.Service
+	logger   log.Logger
+
+	// hostMtx and serviceMtx keep the writes of each store in the order
+	// they are logged. A snapshot takes serviceMtx first, like
+	// transactions.
+	hostMtx    sync.Mutex
+	serviceMtx sync.Mutex
+
+	mtx     sync.Mutex
+	file    *os.File
+	seq     uint64
+	records int
+	dirty   bool
+	failed  error
+}
+
+// record is a write to one of the stores.
+type record struct {
+	Seq        uint64          `json:"seq"`
+	Method     string          `json:"method"`
+	Namespace  string          `json:"namespace"`
+	All        bool            `json:"all,omitempty"`
+	Time       time.Time       `json:"time"`
+	Actor      string          `json:"actor,omitempty"`
+	Managed    bool            `json:"managed,omitempty"`
+	ID         string          `json:"id,omitempty"`
+	InstanceID string          `json:"instanceid,omitempty"`
+	Args       json.RawMessage `json:"args,omitempty"`
+}
+
+// snapshot is the content of the stores once every write up to Seq was
+// applied.
+type snapshot struct {
+	Seq      uint64        `json:"seq"`
+	Hosts    host.State    `json:"hosts"`
+	Services service.State `json:"services"`
+}
+
+// Open recovers hosts and services, which must be empty and implement
+// host.Snapshotter and service.Snapshotter, from the log in cfg.Dir, and
+// returns the Log to write them through. A log whose tail was torn by a
+// crash is truncated to its last whole record.
+func Open(cfg Config, hosts host.Host, services service.Service, logger log.Logger) (*Log, error) {
+	switch cfg.Sync {
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return nil, ErrInvalidSync
+	}
+	if cfg.SyncInterval == 0 {
+		cfg.SyncInterval = time.Second
+	}
+	if cfg.SnapshotInterval == 0 {
+		cfg.SnapshotInterval = 5 * time.Minute
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, err
+	}
+	l := &Log{
+		cfg:      cfg,
+		hosts:    hosts,
+		services: services,
+		logger:   logger,
+	}
+	if err := l.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(cfg.Dir, logName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	end, err := scan(f, l.replay)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if fi, err := f.Stat(); err == nil && fi.Size() > end {
+		logger.Log("during", "recovery", "truncated", fi.Size()-end, "offset", end)
+		if err := f.Truncate(end); err != nil {
+			f.Close()
+			return nil, err
+		}
+		if err := f.Sync(); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	if _, err := f.Seek(end, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	l.file = f
+	logger.Log("during", "recovery", "seq", l.seq, "replayed", l.records)
+	return l, nil
+}
+
+func (l *Log) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(l.cfg.Dir, snapshotName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	payload, err := readRecord(f, 0, fi.Size())
+	if err == errTorn {
+		// Snapshots are renamed into place once complete.
+		return &CorruptError{File: f.Name()}
+	}
+	if err != nil {
+		return err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(payload, &snap); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := l.hosts.(host.Snapshotter).LoadState(ctx, snap.Hosts); err != nil {
+		return err
+	}
+	if err := l.services.(service.Snapshotter).LoadState(ctx, snap.Services); err != nil {
+		return err
+	}
+	l.seq = snap.Seq
+	return nil
+}
+
+// replay applies a logged write again. Writes that failed when first made
+// fail again, and are ignored.
+func (l *Log) replay(payload []byte) error {
+	var r record
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return err
+	}
+	if r.Seq <= l.seq {
+		// Already in the snapshot, taken before the log was emptied.
+		return nil
+	}
+	l.seq = r.Seq
+	l.records++
+	err := l.apply(r)
+	if err == ErrUnknownMethod {
+		return fmt.Errorf("record %d: %v", r.Seq, err)
+	}
+	return nil
+}
+
+func (r record) context() context.Context {
+	ctx := host.NewTimeContext(context.Background(), r.Time)
+	ctx = host.NewActorContext(ctx, r.Actor)
+	if r.Managed {
+		ctx = host.NewManagedContext(ctx)
+	}
+	if r.All {
+		return namespace.AllNamespaces(ctx)
+	}
+	return namespace.NewContext(ctx, r.Namespace)
+}
+
+// apply runs r against the stores.
+func (l *Log) apply(r record) error {
+	ctx := r.context()
+	switch r.Method {
+	case "PostHostInfo":
+		var h host.HostInfo
+		if err := json.Unmarshal(r.Args, &h); err != nil {
+			return err
+		}
+		return l.hosts.PostHostInfo(ctx, h)
+	case "PutHostInfo":
+		var h host.HostInfo
+		if err := json.Unmarshal(r.Args, &h); err != nil {
+			return err
+		}
+		return l.hosts.PutHostInfo(ctx, r.ID, h)
+	case "DeleteHostInfo":
+		return l.hosts.DeleteHostInfo(ctx, r.ID)
+	case "UndeleteHostInfo":
+		_, err := l.hosts.UndeleteHostInfo(ctx, r.ID)
+		return err
+	case "PurgeHostInfo":
+		_, err := l.hosts.PurgeHostInfo(ctx, r.ID)
+		return err
+	case "BatchHostInfo":
+		var b host.Batch
+		if err := json.Unmarshal(r.Args, &b); err != nil {
+			return err
+		}
+		_, err := l.hosts.BatchHostInfo(ctx, b)
+		return err
+	case "LoadHostState":
+		var st host.State
+		if err := json.Unmarshal(r.Args, &st); err != nil {
+			return err
+		}
+		return l.hosts.(host.Snapshotter).LoadState(ctx, st)
+	case "PostServiceInfo":
+		var s service.ServiceInfo
+		if err := json.Unmarshal(r.Args, &s); err != nil {
+			return err
+		}
+		return l.services.PostServiceInfo(ctx, s)
+	case "PutServiceInfo":
+		var s service.ServiceInfo
+		if err := json.Unmarshal(r.Args, &s); err != nil {
+			return err
+		}
+		return l.services.PutServiceInfo(ctx, r.ID, s)
+	case "DeleteServiceInfo":
+		return l.services.DeleteServiceInfo(ctx, r.ID)
+	case "UndeleteServiceInfo":
+		_, err := l.services.UndeleteServiceInfo(ctx, r.ID)
+		return err
+	case "PurgeServiceInfo":
+		_, err := l.services.PurgeServiceInfo(ctx, r.ID)
+		return err
+	case "PutServiceHealth":
+		var c service.CheckResult
+		if err := json.Unmarshal(r.Args, &c); err != nil {
+			return err
+		}
+		return l.services.PutServiceHealth(ctx, r.ID, c)
+	case "PostServiceInstance":
+		var in service.Instance
+		if err := json.Unmarshal(r.Args, &in); err != nil {
+			return err
+		}
+		return l.services.PostServiceInstance(ctx, r.ID, in)
+	case "PutServiceInstance":
+		var in service.Instance
+		if err := json.Unmarshal(r.Args, &in); err != nil {
+			return err
+		}
+		return l.services.PutServiceInstance(ctx, r.ID, r.InstanceID, in)
+	case "DeleteServiceInstance":
+		return l.services.DeleteServiceInstance(ctx, r.ID, r.InstanceID)
+	case "BatchServiceInfo":
+		var b service.Batch
+		if err := json.Unmarshal(r.Args, &b); err != nil {
+			return err
+		}
+		_, err := l.services.BatchServiceInfo(ctx, b)
+		return err
+	case "LoadServiceState":
+		var st service.State
+		if err := json.Unmarshal(r.Args, &st); err != nil {
+			return err
+		}
+		return l.services.(service.Snapshotter).LoadState(ctx, st)
+	default:
+		return ErrUnknownMethod
+	}
+}
+
+// newRecord returns the record of method called with ctx, and the context
+// to apply it in, stamped with the time and actor recorded.
+func newRecord(ctx context.Context, method, id, instanceID string, args interface{}) (record, context.Context, error) {
+	r := record{
+		Method:     method,
+		Namespace:  namespace.FromContext(ctx),
+		All:        namespace.IsAll(ctx),
+		Time:       host.TimeFromContext(ctx),
+		Actor:      host.ActorFromContext(ctx),
+		Managed:    host.ManagedFromContext(ctx),
+		ID:         id,
+		InstanceID: instanceID,
+	}
+	if args != nil {
+		var err error
+		if r.Args, err = json.Marshal(args); err != nil {
+			return record{}, nil, err
+		}
+	}
+	return r, host.NewTimeContext(ctx, r.Time), nil
+}
+
+// append writes r to the log, and flushes it under SyncAlways. Once an
+// append has failed the log refuses every write, as the stores may no
+// longer be rebuilt from it.
+func (l *Log) append(r record) error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.failed != nil {
+		return l.failed
+	}
+	r.Seq = l.seq + 1
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(frame(payload)); err != nil {
+		l.fail(err)
+		return l.failed
+	}
+	if l.cfg.Sync == SyncAlways {
+		if err := l.file.Sync(); err != nil {
+			l.fail(err)
+			return l.failed
+		}
+	}
+	l.seq = r.Seq
+	l.records++
+	l.dirty = true
+	return nil
+}
+
+func (l *Log) fail(err error) {
+	l.failed = fmt.Errorf("write-ahead log failed: %v", err)
+	l.logger.Log("during", "append", "err", err)
+}
+
+// Run flushes the log under SyncInterval and snapshots the stores
+// periodically, until ctx is done.
+func (l *Log) Run(ctx context.Context) {
+	flush := time.NewTicker(l.cfg.SyncInterval)
+	defer flush.Stop()
+	snap := time.NewTicker(l.cfg.SnapshotInterval)
+	defer snap.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flush.C:
+			if l.cfg.Sync == SyncInterval {
+				l.sync()
+			}
+		case <-snap.C:
+			if err := l.Snapshot(); err != nil {
+				l.logger.Log("during", "snapshot", "err", err)
+			}
+		}
+	}
+}
+
+func (l *Log) sync() {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if !l.dirty || l.failed != nil {
+		return
+	}
+	if err := l.file.Sync(); err != nil {
+		l.fail(err)
+		return
+	}
+	l.dirty = false
+}
+
+// Snapshot writes the content of the stores to the snapshot and empties
+// the log, if anything was logged since the last snapshot. Writes wait
+// while it runs.
+func (l *Log) Snapshot() error {
+	l.serviceMtx.Lock()
+	defer l.serviceMtx.Unlock()
+	l.hostMtx.Lock()
+	defer l.hostMtx.Unlock()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.failed != nil {
+		return l.failed
+	}
+	if l.records == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	snap := snapshot{Seq: l.seq}
+	var err error
+	if snap.Hosts, err = l.hosts.(host.Snapshotter).DumpState(ctx); err != nil {
+		return err
+	}
+	if snap.Services, err = l.services.(service.Snapshotter).DumpState(ctx); err != nil {
+		return err
+	}
+	payload, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(l.cfg.Dir, snapshotName), frame(payload)); err != nil {
+		return err
+	}
+
+	// The snapshot holds every logged write: records left behind by a
+	// crash before the truncation are skipped at replay.
+	if err := l.file.Truncate(0); err != nil {
+		l.fail(err)
+		return l.failed
+	}
+	if _, err := l.file.Seek(0, 0); err != nil {
+		l.fail(err)
+		return l.failed
+	}
+	if err := l.file.Sync(); err != nil {
+		l.fail(err)
+		return l.failed
+	}
+	l.logger.Log("during", "snapshot", "seq", snap.Seq, "records", l.records, "bytes", len(payload))
+	l.records = 0
+	l.dirty = false
+	return nil
+}
+
+// writeFile replaces name with data, so that it is either the old or the
+// new file after a crash.
+func writeFile(name string, data []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// Close snapshots the stores, so that the next start has nothing to
+// replay, and closes the log.
+func (l *Log) Close() error {
+	err := l.Snapshot()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if serr := l.file.Sync(); err == nil && l.failed == nil {
+		err = serr
+	}
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
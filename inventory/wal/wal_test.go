@@ -0,0 +1,228 @@
+package wal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+func open(t *testing.T, dir string) (*Log, error) {
+	t.Helper()
+	return Open(Config{Dir: dir, Sync: SyncAlways}, host.NewInmemHost(), service.NewInmemService(), log.NewNopLogger())
+}
+
+// crash closes the log file as a crash would, without a snapshot.
+func crash(t *testing.T, l *Log) {
+	t.Helper()
+	if err := l.file.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// offsets returns the offset of every record of the log in dir.
+func offsets(t *testing.T, dir string) []int64 {
+	t.Helper()
+	f, err := os.Open(filepath.Join(dir, logName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var list []int64
+	var offset int64
+	if _, err := scan(f, func(payload []byte) error {
+		list = append(list, offset)
+		offset += headerSize + int64(len(payload))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return list
+}
+
+func hostIDs(t *testing.T, l *Log) []string {
+	t.Helper()
+	list, err := l.Hosts().ListHostInfo(context.Background(), host.HostFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, h := range list {
+		ids = append(ids, h.ID)
+	}
+	return ids
+}
+
+func TestRecovery(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// damage changes the log b, whose records start at offsets.
+		damage  func(b []byte, offsets []int64) []byte
+		want    []string // hosts recovered
+		corrupt int      // index of the record reported corrupt, or -1
+	}{
+		{"intact", func(b []byte, o []int64) []byte { return b }, []string{"a", "b", "c"}, -1},
+		{"torn payload", func(b []byte, o []int64) []byte { return b[:len(b)-5] }, []string{"a", "b"}, -1},
+		{"torn header", func(b []byte, o []int64) []byte { return b[:o[2]+4] }, []string{"a", "b"}, -1},
+		{"zeros after the last record", func(b []byte, o []int64) []byte { return append(b, make([]byte, 100)...) }, []string{"a", "b", "c"}, -1},
+		{"zeros over the last record", func(b []byte, o []int64) []byte {
+			copy(b[o[2]:], make([]byte, len(b)))
+			return b
+		}, []string{"a", "b"}, -1},
+		{"damaged payload of the last record", func(b []byte, o []int64) []byte { b[len(b)-2] ^= 0xff; return b }, []string{"a", "b"}, -1},
+		{"damaged payload mid-log", func(b []byte, o []int64) []byte { b[o[2]-2] ^= 0xff; return b }, nil, 1},
+		{"damaged length mid-log", func(b []byte, o []int64) []byte { b[o[1]] ^= 0x01; return b }, nil, 1},
+		{"huge length mid-log", func(b []byte, o []int64) []byte { b[o[1]+3] = 0xff; return b }, nil, 1},
+		{"damaged payload checksum mid-log", func(b []byte, o []int64) []byte { b[o[0]+4] ^= 0xff; return b }, nil, 0},
+		{"damaged length of the last record", func(b []byte, o []int64) []byte { b[o[2]] ^= 0x01; return b }, nil, 2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			l, err := open(t, dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []string{"a", "b", "c"} {
+				if err := l.Hosts().PostHostInfo(ctx, host.HostInfo{ID: id}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			crash(t, l)
+			o := offsets(t, dir)
+			if len(o) != 3 {
+				t.Fatalf("%d records logged, want 3", len(o))
+			}
+			path := filepath.Join(dir, logName)
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tc.damage(b, o), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			l, err = open(t, dir)
+			if tc.corrupt >= 0 {
+				corrupt, ok := err.(*CorruptError)
+				if !ok || corrupt.Offset != o[tc.corrupt] {
+					t.Fatalf("got %v, want a corrupt record at offset %d", err, o[tc.corrupt])
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := hostIDs(t, l); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("recovered %v, want %v", got, tc.want)
+			}
+
+			// The torn tail was cut off: the next write follows the last
+			// whole record and survives another crash.
+			if err := l.Hosts().PostHostInfo(ctx, host.HostInfo{ID: "d"}); err != nil {
+				t.Fatal(err)
+			}
+			crash(t, l)
+			if l, err = open(t, dir); err != nil {
+				t.Fatal(err)
+			}
+			if got := hostIDs(t, l); fmt.Sprint(got) != fmt.Sprint(append(tc.want, "d")) {
+				t.Fatalf("recovered %v after another write, want %v and d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	l, err := open(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Hosts().PostHostInfo(ctx, host.HostInfo{ID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Hosts().PutHostInfo(ctx, "a", host.HostInfo{ID: "a", Remark: "updated"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Services().PostServiceInfo(ctx, service.ServiceInfo{ID: "s", HostID: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := l.Hosts().GetHostInfo(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logged, err := os.ReadFile(filepath.Join(dir, logName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Snapshot(); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, logName)); err != nil || fi.Size() != 0 {
+		t.Fatalf("log %v, %v: want it emptied by the snapshot", fi, err)
+	}
+	if err := l.Hosts().PostHostInfo(ctx, host.HostInfo{ID: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	crash(t, l)
+
+	l, err = open(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hostIDs(t, l); len(got) != 2 {
+		t.Fatalf("recovered %v, want a from the snapshot and b from the log", got)
+	}
+	// Replay applies writes at the times they were first made.
+	a, err := l.Hosts().GetHostInfo(ctx, "a")
+	if err != nil || a.Version != 2 || !a.UpdatedAt.Equal(before.UpdatedAt) {
+		t.Fatalf("host %+v, %v, want %+v", a, err, before)
+	}
+	if _, err := l.Services().GetServiceInfo(ctx, "s"); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash between writing the snapshot and emptying the log leaves
+	// records the snapshot holds: they are not applied again.
+	if err := os.WriteFile(filepath.Join(dir, logName), logged, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = open(t, dir); err != nil {
+		t.Fatal(err)
+	}
+	if a, err := l.Hosts().GetHostInfo(ctx, "a"); err != nil || a.Version != 2 {
+		t.Fatalf("host %+v, %v: logged writes applied over the snapshot", a, err)
+	}
+	if l.records != 0 {
+		t.Fatalf("%d records replayed, want none", l.records)
+	}
+	crash(t, l)
+
+	// The snapshot is renamed into place whole; a damaged one stops the
+	// start.
+	path := filepath.Join(dir, snapshotName)
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)/2] ^= 0xff
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := open(t, dir); err == nil {
+		t.Fatal("opened a log with a damaged snapshot")
+	} else if _, ok := err.(*CorruptError); !ok {
+		t.Fatalf("got %v, want a corrupt snapshot", err)
+	}
+}
@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+// Headers set on every delivery. The signature is Sign of the body with
+// the subscription secret; it is omitted if the subscription has none.
+const (
+	HeaderEvent     = "X-Inventory-Event"
+	HeaderDelivery  = "X-Inventory-Delivery"
+	HeaderSignature = "X-Inventory-Signature"
+)
+
+// Dispatcher sends due deliveries to their subscribers and records the
+// outcome of every attempt through PutDeliveryAttempt.
+type Dispatcher struct {
+	webhook Webhook
+	client  *http.Client
+	logger  log.Logger
+	sem     chan struct{}
+}
+
+// NewDispatcher returns a dispatcher for the deliveries of w. At most
+// concurrency deliveries are in flight at a time, each bounded by timeout.
+func NewDispatcher(w Webhook, concurrency int, timeout time.Duration, logger log.Logger) *Dispatcher {
+	return &Dispatcher{
+		webhook: w,
+		client:  &http.Client{Timeout: timeout},
+		logger:  logger,
+		sem:     make(chan struct{}, concurrency),
+	}
+}
+
+// Run dispatches deliveries until ctx is cancelled.
+func (c *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.dispatch(ctx, now)
+		}
+	}
+}
+
+func (c *Dispatcher) dispatch(ctx context.Context, now time.Time) {
+	list, err := c.webhook.DueDeliveries(namespace.AllNamespaces(ctx), now)
+	if err != nil {
+		c.logger.Log("err", err)
+		return
+	}
+	for _, d := range list {
+		c.sem <- struct{}{}
+		go func(d Delivery) {
+			defer func() { <-c.sem }()
+			c.deliver(ctx, d)
+		}(d)
+	}
+}
+
+func (c *Dispatcher) deliver(ctx context.Context, d Delivery) {
+	a := Attempt{Time: time.Now()}
+	req, err := http.NewRequest("POST", d.URL, bytes.NewReader(d.Payload))
+	if err == nil {
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		req.Header.Set(HeaderEvent, d.Event)
+		req.Header.Set(HeaderDelivery, d.ID)
+		if d.secret != "" {
+			req.Header.Set(HeaderSignature, Sign(d.secret, d.Payload))
+		}
+		var resp *http.Response
+		resp, err = c.client.Do(req.WithContext(ctx))
+		if err == nil {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			a.StatusCode = resp.StatusCode
+		}
+	}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	a.Duration = time.Since(a.Time)
+
+	if !a.ok() {
+		c.logger.Log("namespace", d.Namespace, "delivery", d.ID, "subscription", d.SubscriptionID, "status", a.StatusCode, "err", a.Error)
+	}
+	if err := c.webhook.PutDeliveryAttempt(namespace.NewContext(ctx, d.Namespace), d.ID, a); err != nil && err != ErrNotFound {
+		c.logger.Log("namespace", d.Namespace, "delivery", d.ID, "err", err)
+	}
+}
+
+// Sign returns the signature of body for secret as sent in the
+// X-Inventory-Signature header: "sha256=" followed by the hex encoded
+// HMAC-SHA256 of body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type Endpoints struct {
+	PostSubscriptionEndpoint   endpoint.Endpoint
+	GetSubscriptionEndpoint    endpoint.Endpoint
+	PutSubscriptionEndpoint    endpoint.Endpoint
+	DeleteSubscriptionEndpoint endpoint.Endpoint
+	ListSubscriptionsEndpoint  endpoint.Endpoint
+	PingSubscriptionEndpoint   endpoint.Endpoint
+	GetDeliveryEndpoint        endpoint.Endpoint
+	ListDeliveriesEndpoint     endpoint.Endpoint
+	RedeliverEndpoint          endpoint.Endpoint
+}
+
+func MakeServerEndpoints(s Webhook) Endpoints {
+	return Endpoints{
+		PostSubscriptionEndpoint:   MakePostSubscriptionEndpoint(s),
+		GetSubscriptionEndpoint:    MakeGetSubscriptionEndpoint(s),
+		PutSubscriptionEndpoint:    MakePutSubscriptionEndpoint(s),
+		DeleteSubscriptionEndpoint: MakeDeleteSubscriptionEndpoint(s),
+		ListSubscriptionsEndpoint:  MakeListSubscriptionsEndpoint(s),
+		PingSubscriptionEndpoint:   MakePingSubscriptionEndpoint(s),
+		GetDeliveryEndpoint:        MakeGetDeliveryEndpoint(s),
+		ListDeliveriesEndpoint:     MakeListDeliveriesEndpoint(s),
+		RedeliverEndpoint:          MakeRedeliverEndpoint(s),
+	}
+}
+
+func MakePostSubscriptionEndpoint(s Webhook) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(postSubscriptionRequest)
+		e := s.PostSubscription(ctx, req.Subscription)
+		return postSubscriptionResponse{Err: e}, nil
+	}
+}
+
+func MakeGetSubscriptionEndpoint(s Webhook) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getSubscriptionRequest)
+		sub, e := s.GetSubscription(ctx, req.ID)
+		return getSubscriptionResponse{Subscription: sub, Err: e}, nil
+	}
+}
+
+func MakePutSubscriptionEndpoint(s Webhook) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(putSubscriptionRequest)
+		e := s.PutSubscription(ctx, req.ID, req.Subscription)
+		return putSubscriptionResponse{Err: e}, nil
+	}
+}
+
+func MakeDeleteSubscriptionEndpoint(s Webhook) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(deleteSubscriptionRequest)
+		e := s.DeleteSubscription(ctx, req.ID)
+		return deleteSubscriptionResponse{Err: e}, nil
+	}
+}
+
+func MakeListSubscriptionsEndpoint(s Webhook) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		list, e := s.ListSubscriptions(ctx)
+		return listSubscriptionsResponse{Subscriptions: list, Err: e}, nil
+	}
+}
+
+func MakePingSubscriptionEndpoint(s Webhook) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(pingSubscriptionRequest)
+		d, e := s.PingSubscription(ctx, req.ID)
+		return deliveryResponse{Delivery: d, Err: e}, nil
+	}
+}
+
+func MakeGetDeliveryEndpoint(s Webhook) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(getDeliveryRequest)
+		d, e := s.GetDelivery(ctx, req.ID)
+		return deliveryResponse{Delivery: d, Err: e}, nil
+	}
+}
+
+func MakeListDeliveriesEndpoint(s Webhook) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(listDeliveriesRequest)
+		list, e := s.ListDeliveries(ctx, req.Filter)
+		return listDeliveriesResponse{Deliveries: list, Err: e}, nil
+	}
+}
+
+func MakeRedeliverEndpoint(s Webhook) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(redeliverRequest)
+		d, e := s.Redeliver(ctx, req.ID)
+		return deliveryResponse{Delivery: d, Err: e}, nil
+	}
+}
+
+type postSubscriptionRequest struct {
+	Subscription Subscription
+}
+
+type postSubscriptionResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r postSubscriptionResponse) error() error { return r.Err }
+
+type getSubscriptionRequest struct {
+	ID string
+}
+
+type getSubscriptionResponse struct {
+	Subscription Subscription `json:"subscription"`
+	Err          error        `json:"err,omitempty"`
+}
+
+func (r getSubscriptionResponse) error() error { return r.Err }
+
+type putSubscriptionRequest struct {
+	ID           string
+	Subscription Subscription
+}
+
+type putSubscriptionResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r putSubscriptionResponse) error() error { return r.Err }
+
+type deleteSubscriptionRequest struct {
+	ID string
+}
+
+type deleteSubscriptionResponse struct {
+	Err error `json:"err,omitempty"`
+}
+
+func (r deleteSubscriptionResponse) error() error { return r.Err }
+
+type listSubscriptionsRequest struct{}
+
+type listSubscriptionsResponse struct {
+	Subscriptions []Subscription `json:"subscriptions"`
+	Err           error          `json:"err,omitempty"`
+}
+
+func (r listSubscriptionsResponse) error() error { return r.Err }
+
+type pingSubscriptionRequest struct {
+	ID string
+}
+
+type getDeliveryRequest struct {
+	ID string
+}
+
+type redeliverRequest struct {
+	ID string
+}
+
+type deliveryResponse struct {
+	Delivery Delivery `json:"delivery"`
+	Err      error    `json:"err,omitempty"`
+}
+
+func (r deliveryResponse) error() error { return r.Err }
+
+type listDeliveriesRequest struct {
+	Filter DeliveryFilter
+}
+
+type listDeliveriesResponse struct {
+	Deliveries []Delivery `json:"deliveries"`
+	Err        error      `json:"err,omitempty"`
+}
+
+func (r listDeliveriesResponse) error() error { return r.Err }
@@ -0,0 +1,330 @@
+package webhook
+
+import (
+	"context"
+
+	"github.com/xinyu/infra/inventory/host"
+	"github.com/xinyu/infra/inventory/service"
+)
+
+// HostMiddleware publishes an event for every successful host write. The
+// events of a batch that is part of a transaction are published once the
+// transaction commits.
+func HostMiddleware(w Webhook) host.Middleware {
+	return func(next host.Host) host.Host {
+		return &hostMiddleware{
+			Host:    next,
+			webhook: w,
+		}
+	}
+}
+
+type hostMiddleware struct {
+	host.Host
+	webhook Webhook
+}
+
+func (mw hostMiddleware) PostHostInfo(ctx context.Context, h host.HostInfo) error {
+	if err := mw.Host.PostHostInfo(ctx, h); err != nil {
+		return err
+	}
+	mw.publishWritten(ctx, OpCreate, h.ID)
+	return nil
+}
+
+func (mw hostMiddleware) PutHostInfo(ctx context.Context, id string, h host.HostInfo) error {
+	op := OpUpdate
+	if _, err := mw.Host.GetHostInfo(ctx, id); err == host.ErrNotFound {
+		op = OpCreate
+	}
+	if err := mw.Host.PutHostInfo(ctx, id, h); err != nil {
+		return err
+	}
+	mw.publishWritten(ctx, op, id)
+	return nil
+}
+
+func (mw hostMiddleware) DeleteHostInfo(ctx context.Context, id string) error {
+	last, err := mw.Host.GetHostInfo(ctx, id)
+	if err != nil {
+		return mw.Host.DeleteHostInfo(ctx, id)
+	}
+	if err := mw.Host.DeleteHostInfo(ctx, id); err != nil {
+		return err
+	}
+	mw.publish(ctx, OpDelete, last)
+	return nil
+}
+
+func (mw hostMiddleware) UndeleteHostInfo(ctx context.Context, id string) (host.HostInfo, error) {
+	h, err := mw.Host.UndeleteHostInfo(ctx, id)
+	if err == nil {
+		mw.publish(ctx, OpUndelete, h)
+	}
+	return h, err
+}
+
+func (mw hostMiddleware) PurgeHostInfo(ctx context.Context, id string) (host.HostInfo, error) {
+	h, err := mw.Host.PurgeHostInfo(ctx, id)
+	if err == nil {
+		mw.publish(ctx, OpPurge, h)
+	}
+	return h, err
+}
+
+func (mw hostMiddleware) BatchHostInfo(ctx context.Context, b host.Batch) ([]host.BatchResult, error) {
+	last := map[string]host.HostInfo{}
+	for _, op := range b.Ops {
+		if op.Op == host.OpDelete {
+			id := op.ID
+			if id == "" {
+				id = op.HostInfo.ID
+			}
+			if h, err := mw.Host.GetHostInfo(ctx, id); err == nil {
+				last[id] = h
+			}
+		}
+	}
+	var results []host.BatchResult
+	publish := func() {
+		for i, op := range b.Ops {
+			if i >= len(results) || results[i].Err != nil {
+				continue
+			}
+			switch op.Op {
+			case host.OpCreate, host.OpUpdate:
+				mw.publishWritten(ctx, op.Op, results[i].ID)
+			case host.OpDelete:
+				if h, ok := last[results[i].ID]; ok {
+					mw.publish(ctx, OpDelete, h)
+				}
+			}
+		}
+	}
+
+	forward := b
+	if b.Hold != nil {
+		forward.Hold = func(commit, rollback func()) {
+			b.Hold(func() {
+				commit()
+				publish()
+			}, rollback)
+		}
+	}
+	results, err := mw.Host.BatchHostInfo(ctx, forward)
+	if err == nil && b.Hold == nil {
+		publish()
+	}
+	return results, err
+}
+
+// publishWritten publishes the host as the store now holds it.
+func (mw hostMiddleware) publishWritten(ctx context.Context, op, id string) {
+	if h, err := mw.Host.GetHostInfo(ctx, id); err == nil {
+		mw.publish(ctx, op, h)
+	}
+}
+
+func (mw hostMiddleware) publish(ctx context.Context, op string, h host.HostInfo) {
+	mw.webhook.Publish(ctx, Event{
+		Namespace: h.Namespace,
+		Resource:  ResourceHost,
+		Operation: op,
+		ObjectID:  h.ID,
+		Labels:    h.Labels,
+		Object:    h,
+	})
+}
+
+// ServiceMiddleware publishes an event for every successful write of a
+// service or instance. Health updates are not published. Instances carry
+// the labels of their service for filtering.
+func ServiceMiddleware(w Webhook) service.MiddlewareService {
+	return func(next service.Service) service.Service {
+		return &serviceMiddleware{
+			Service: next,
+			webhook: w,
+		}
+	}
+}
+
+type serviceMiddleware struct {
+	service.Service
+	webhook Webhook
+}
+
+func (mw serviceMiddleware) PostServiceInfo(ctx context.Context, s service.ServiceInfo) error {
+	if err := mw.Service.PostServiceInfo(ctx, s); err != nil {
+		return err
+	}
+	mw.publishWritten(ctx, OpCreate, s.ID)
+	return nil
+}
+
+func (mw serviceMiddleware) PutServiceInfo(ctx context.Context, id string, s service.ServiceInfo) error {
+	op := OpUpdate
+	if _, err := mw.Service.GetServiceInfo(ctx, id); err == service.ErrNotFound {
+		op = OpCreate
+	}
+	if err := mw.Service.PutServiceInfo(ctx, id, s); err != nil {
+		return err
+	}
+	mw.publishWritten(ctx, op, id)
+	return nil
+}
+
+func (mw serviceMiddleware) DeleteServiceInfo(ctx context.Context, id string) error {
+	last, err := mw.Service.GetServiceInfo(ctx, id)
+	if err != nil {
+		return mw.Service.DeleteServiceInfo(ctx, id)
+	}
+	if err := mw.Service.DeleteServiceInfo(ctx, id); err != nil {
+		return err
+	}
+	mw.publish(ctx, OpDelete, last)
+	return nil
+}
+
+func (mw serviceMiddleware) UndeleteServiceInfo(ctx context.Context, id string) (service.ServiceInfo, error) {
+	s, err := mw.Service.UndeleteServiceInfo(ctx, id)
+	if err == nil {
+		mw.publish(ctx, OpUndelete, s)
+	}
+	return s, err
+}
+
+func (mw serviceMiddleware) PurgeServiceInfo(ctx context.Context, id string) (service.ServiceInfo, error) {
+	s, err := mw.Service.PurgeServiceInfo(ctx, id)
+	if err == nil {
+		mw.publish(ctx, OpPurge, s)
+	}
+	return s, err
+}
+
+func (mw serviceMiddleware) BatchServiceInfo(ctx context.Context, b service.Batch) ([]service.BatchResult, error) {
+	last := map[string]service.ServiceInfo{}
+	for _, op := range b.Ops {
+		if op.Op == service.OpDelete {
+			id := op.ID
+			if id == "" {
+				id = op.ServiceInfo.ID
+			}
+			if s, err := mw.Service.GetServiceInfo(ctx, id); err == nil {
+				last[id] = s
+			}
+		}
+	}
+	var results []service.BatchResult
+	publish := func() {
+		for i, op := range b.Ops {
+			if i >= len(results) || results[i].Err != nil {
+				continue
+			}
+			switch op.Op {
+			case service.OpCreate, service.OpUpdate:
+				mw.publishWritten(ctx, op.Op, results[i].ID)
+			case service.OpDelete:
+				if s, ok := last[results[i].ID]; ok {
+					mw.publish(ctx, OpDelete, s)
+				}
+			}
+		}
+	}
+
+	forward := b
+	if b.Hold != nil {
+		forward.Hold = func(commit, rollback func()) {
+			b.Hold(func() {
+				commit()
+				publish()
+			}, rollback)
+		}
+	}
+	results, err := mw.Service.BatchServiceInfo(ctx, forward)
+	if err == nil && b.Hold == nil {
+		publish()
+	}
+	return results, err
+}
+
+func (mw serviceMiddleware) PostServiceInstance(ctx context.Context, serviceID string, in service.Instance) error {
+	if err := mw.Service.PostServiceInstance(ctx, serviceID, in); err != nil {
+		return err
+	}
+	mw.publishInstance(ctx, OpCreate, serviceID, in.ID, nil)
+	return nil
+}
+
+func (mw serviceMiddleware) PutServiceInstance(ctx context.Context, serviceID, instanceID string, in service.Instance) error {
+	if err := mw.Service.PutServiceInstance(ctx, serviceID, instanceID, in); err != nil {
+		return err
+	}
+	mw.publishInstance(ctx, OpUpdate, serviceID, instanceID, nil)
+	return nil
+}
+
+func (mw serviceMiddleware) DeleteServiceInstance(ctx context.Context, serviceID, instanceID string) error {
+	last, ok := mw.instance(ctx, serviceID, instanceID)
+	if err := mw.Service.DeleteServiceInstance(ctx, serviceID, instanceID); err != nil {
+		return err
+	}
+	if ok {
+		mw.publishInstance(ctx, OpDelete, serviceID, instanceID, &last)
+	}
+	return nil
+}
+
+// publishWritten publishes the service as the store now holds it.
+func (mw serviceMiddleware) publishWritten(ctx context.Context, op, id string) {
+	if s, err := mw.Service.GetServiceInfo(ctx, id); err == nil {
+		mw.publish(ctx, op, s)
+	}
+}
+
+func (mw serviceMiddleware) publish(ctx context.Context, op string, s service.ServiceInfo) {
+	mw.webhook.Publish(ctx, Event{
+		Namespace: s.Namespace,
+		Resource:  ResourceService,
+		Operation: op,
+		ObjectID:  s.ID,
+		Labels:    s.Labels,
+		Object:    s,
+	})
+}
+
+// publishInstance publishes instance instanceID of serviceID: in if set,
+// else the instance as the store now holds it.
+func (mw serviceMiddleware) publishInstance(ctx context.Context, op, serviceID, instanceID string, in *service.Instance) {
+	if in == nil {
+		found, ok := mw.instance(ctx, serviceID, instanceID)
+		if !ok {
+			return
+		}
+		in = &found
+	}
+	var labels map[string]string
+	if s, err := mw.Service.GetServiceInfo(ctx, serviceID); err == nil {
+		labels = s.Labels
+	}
+	mw.webhook.Publish(ctx, Event{
+		Namespace: in.Namespace,
+		Resource:  ResourceInstance,
+		Operation: op,
+		ObjectID:  serviceID + "/" + instanceID,
+		Labels:    labels,
+		Object:    *in,
+	})
+}
+
+func (mw serviceMiddleware) instance(ctx context.Context, serviceID, instanceID string) (service.Instance, bool) {
+	list, err := mw.Service.ListServiceInstances(ctx, serviceID)
+	if err != nil {
+		return service.Instance{}, false
+	}
+	for _, in := range list {
+		if in.ID == instanceID {
+			return in, true
+		}
+	}
+	return service.Instance{}, false
+}
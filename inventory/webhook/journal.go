@@ -0,0 +1,256 @@
+package webhook
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// journal keeps subscriptions and deliveries in a file of JSON lines, each
+// the content of one subscription or delivery as last written, or its
+// removal. Later lines override earlier ones; the file is compacted to one
+// line per live record when it is opened and once it has grown to twice
+// that.
+type journal struct {
+	path  string
+	f     *os.File
+	lines int
+	// failed is the error of the last failed write. The journal refuses
+	// further writes once one failed, as the file may hold a partial line.
+	failed error
+}
+
+// entry is a line of the journal. Exactly one field is set.
+type entry struct {
+	Subscription *Subscription   `json:"subscription,omitempty"`
+	Delivery     *storedDelivery `json:"delivery,omitempty"`
+	Removed      *removed        `json:"removed,omitempty"`
+}
+
+// storedDelivery is a Delivery with the fields the API does not return.
+type storedDelivery struct {
+	Delivery
+	Secret string `json:"secret,omitempty"`
+	Base   int    `json:"base,omitempty"`
+}
+
+// removed names a subscription or delivery that was deleted. Removing a
+// subscription removes its deliveries too.
+type removed struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	ID        string `json:"id"`
+}
+
+const (
+	kindSubscription = "subscription"
+	kindDelivery     = "delivery"
+)
+
+// CorruptError is returned when a line of the journal other than the last
+// cannot be read: the file was damaged, not torn by a crash.
+type CorruptError struct {
+	File string
+	Line int
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("corrupt webhook journal %s at line %d", e.File, e.Line)
+}
+
+// NewFileWebhook returns a Webhook that keeps its subscriptions and
+// deliveries in the journal at path, created if missing, so that pending
+// and dead-lettered deliveries survive a restart. Deliveries that were in
+// flight when the server stopped are attempted again.
+func NewFileWebhook(path string) (Webhook, error) {
+	s := newInmemWebhook()
+	if err := s.replay(path); err != nil {
+		return nil, err
+	}
+	for _, d := range s.deliveries {
+		if d.Status == DeliveryDelivering {
+			d.Status = DeliveryPending
+		}
+	}
+	s.journal = &journal{path: path}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// replay applies the lines of the journal at path to s. A last line cut
+// short by a crash is ignored.
+func (s *inmemWebhook) replay(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// A line without its newline is torn, whatever it holds.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var e entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			if _, err := r.Peek(1); err == io.EOF {
+				return nil
+			}
+			return &CorruptError{File: path, Line: n}
+		}
+		s.apply(e)
+	}
+}
+
+func (s *inmemWebhook) apply(e entry) {
+	switch {
+	case e.Subscription != nil:
+		sub := *e.Subscription
+		s.subs[key{namespace: sub.Namespace, id: sub.ID}] = sub
+	case e.Delivery != nil:
+		d := e.Delivery.Delivery
+		d.secret, d.base = e.Delivery.Secret, e.Delivery.Base
+		s.deliveries[key{namespace: d.Namespace, id: d.ID}] = &d
+	case e.Removed != nil:
+		k := key{namespace: e.Removed.Namespace, id: e.Removed.ID}
+		switch e.Removed.Kind {
+		case kindSubscription:
+			s.removeSubscription(k)
+		case kindDelivery:
+			delete(s.deliveries, k)
+		}
+	}
+}
+
+// compact rewrites the journal with one line per subscription and
+// delivery of s, and reopens it for appending.
+func (s *inmemWebhook) compact() error {
+	j := s.journal
+	var buf bytes.Buffer
+	subs := make([]Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		subs = append(subs, sub)
+	}
+	sort.Slice(subs, func(i, k int) bool { return subs[i].CreatedAt.Before(subs[k].CreatedAt) })
+	for i := range subs {
+		if err := writeEntry(&buf, entry{Subscription: &subs[i]}); err != nil {
+			return err
+		}
+	}
+	deliveries := make([]*Delivery, 0, len(s.deliveries))
+	for _, d := range s.deliveries {
+		deliveries = append(deliveries, d)
+	}
+	sort.Slice(deliveries, func(i, k int) bool { return deliveries[i].CreatedAt.Before(deliveries[k].CreatedAt) })
+	for _, d := range deliveries {
+		if err := writeEntry(&buf, entry{Delivery: stored(d)}); err != nil {
+			return err
+		}
+	}
+
+	tmp := j.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, j.path); err != nil {
+		return err
+	}
+	if dir, err := os.Open(filepath.Dir(j.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	f, err = os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if j.f != nil {
+		j.f.Close()
+	}
+	j.f, j.lines = f, len(subs)+len(deliveries)
+	return nil
+}
+
+// record appends entries to the journal and flushes it, then compacts it
+// if it has grown enough. It is called with s.mtx held, after the change
+// was made in memory. Without a journal it does nothing.
+func (s *inmemWebhook) record(entries ...entry) error {
+	j := s.journal
+	if j == nil || len(entries) == 0 {
+		return nil
+	}
+	if j.failed != nil {
+		return j.failed
+	}
+	var buf bytes.Buffer
+	for _, e := range entries {
+		if err := writeEntry(&buf, e); err != nil {
+			return err
+		}
+	}
+	if _, err := j.f.Write(buf.Bytes()); err != nil {
+		j.failed = err
+		return err
+	}
+	if err := j.f.Sync(); err != nil {
+		j.failed = err
+		return err
+	}
+	j.lines += len(entries)
+	if live := len(s.subs) + len(s.deliveries); j.lines > 2*live+1024 {
+		return s.compact()
+	}
+	return nil
+}
+
+func writeEntry(w *bytes.Buffer, e entry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	w.Write(b)
+	w.WriteByte('\n')
+	return nil
+}
+
+func subscriptionEntry(sub Subscription) entry {
+	return entry{Subscription: &sub}
+}
+
+func deliveryEntry(d *Delivery) entry {
+	return entry{Delivery: stored(d)}
+}
+
+func removedEntry(kind string, k key) entry {
+	return entry{Removed: &removed{Kind: kind, Namespace: k.namespace, ID: k.id}}
+}
+
+func stored(d *Delivery) *storedDelivery {
+	return &storedDelivery{Delivery: d.copy(), Secret: d.secret, Base: d.base}
+}
@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fill subscribes to every event, publishes two and lets the first
+// delivery fail until it is dead-lettered.
+func fill(t *testing.T, s Webhook) (dead, pending Delivery) {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.PostSubscription(ctx, Subscription{ID: "s1", URL: "https://example.com/hook", Secret: "key"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := s.Publish(ctx, Event{Resource: "host", Operation: "create", ObjectID: id}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	list, err := s.ListDeliveries(ctx, DeliveryFilter{})
+	if err != nil || len(list) != 2 {
+		t.Fatalf("deliveries %v, %v", list, err)
+	}
+	dead, pending = list[1], list[0]
+	for i := 0; i < maxAttempts; i++ {
+		if err := s.PutDeliveryAttempt(ctx, dead.ID, Attempt{Time: time.Now(), StatusCode: 500}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dead, err = s.GetDelivery(ctx, dead.ID); err != nil || dead.Status != DeliveryDead {
+		t.Fatalf("delivery %+v, %v: want it dead-lettered", dead, err)
+	}
+	return dead, pending
+}
+
+func TestJournalReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "webhook.log")
+	s, err := NewFileWebhook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, pending := fill(t, s)
+	// The pending delivery is handed to the dispatcher when the server
+	// stops.
+	if _, err := s.DueDeliveries(ctx, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewFileWebhook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetSubscription(ctx, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetDelivery(ctx, dead.ID)
+	if err != nil || got.Status != DeliveryDead || len(got.Attempts) != maxAttempts {
+		t.Fatalf("dead delivery %+v, %v", got, err)
+	}
+	got, err = s.GetDelivery(ctx, pending.ID)
+	if err != nil || got.Status != DeliveryPending {
+		t.Fatalf("in-flight delivery %+v, %v: want it pending again", got, err)
+	}
+	if string(got.Payload) != string(pending.Payload) {
+		t.Fatalf("payload %s, want %s", got.Payload, pending.Payload)
+	}
+	due, err := s.DueDeliveries(ctx, time.Now())
+	if err != nil || len(due) != 1 || due[0].secret != "key" {
+		t.Fatalf("due %+v, %v: want the pending delivery with its secret", due, err)
+	}
+
+	// A redelivered dead letter starts a fresh set of attempts after a
+	// restart too.
+	if _, err := s.Redeliver(ctx, dead.ID); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewFileWebhook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PutDeliveryAttempt(ctx, dead.ID, Attempt{Time: time.Now(), StatusCode: 500}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.GetDelivery(ctx, dead.ID); got.Status != DeliveryPending {
+		t.Fatalf("redelivered delivery %+v: want it pending", got)
+	}
+
+	if err := s.DeleteSubscription(ctx, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewFileWebhook(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list, _ := s.ListDeliveries(ctx, DeliveryFilter{}); len(list) != 0 {
+		t.Fatalf("deliveries %+v of a deleted subscription", list)
+	}
+}
+
+func TestJournalDamage(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name    string
+		damage  func(b []byte) []byte
+		corrupt bool
+	}{
+		{"torn last line", func(b []byte) []byte { return append(b, `{"delivery":{"id":`...) }, false},
+		{"garbled last line", func(b []byte) []byte { return append(b, "}}\n"...) }, false},
+		{"garbled line mid-file", func(b []byte) []byte { b[0] = '#'; return b }, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "webhook.log")
+			s, err := NewFileWebhook(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fill(t, s)
+			b, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tc.damage(b), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err = NewFileWebhook(path)
+			if tc.corrupt {
+				if _, ok := err.(*CorruptError); !ok {
+					t.Fatalf("got %v, want a corrupt journal", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if list, _ := s.ListDeliveries(ctx, DeliveryFilter{}); len(list) != 2 {
+				t.Fatalf("deliveries %+v, want both", list)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Middleware func(Webhook) Webhook
+
+func LoggingMiddleware(logger log.Logger) Middleware {
+	return func(next Webhook) Webhook {
+		return &loggingMiddleware{
+			next:   next,
+			logger: logger,
+		}
+	}
+}
+
+type loggingMiddleware struct {
+	next   Webhook
+	logger log.Logger
+}
+
+func (mw loggingMiddleware) PostSubscription(ctx context.Context, s Subscription) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PostSubscription", "namespace", namespace.FromContext(ctx), "id", s.ID, "url", s.URL, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PostSubscription(ctx, s)
+}
+
+func (mw loggingMiddleware) GetSubscription(ctx context.Context, id string) (s Subscription, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetSubscription", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetSubscription(ctx, id)
+}
+
+func (mw loggingMiddleware) PutSubscription(ctx context.Context, id string, s Subscription) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutSubscription", "namespace", namespace.FromContext(ctx), "id", id, "url", s.URL, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutSubscription(ctx, id, s)
+}
+
+func (mw loggingMiddleware) DeleteSubscription(ctx context.Context, id string) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "DeleteSubscription", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.DeleteSubscription(ctx, id)
+}
+
+func (mw loggingMiddleware) ListSubscriptions(ctx context.Context) (list []Subscription, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListSubscriptions", "namespace", namespace.FromContext(ctx), "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListSubscriptions(ctx)
+}
+
+func (mw loggingMiddleware) PingSubscription(ctx context.Context, id string) (d Delivery, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PingSubscription", "namespace", namespace.FromContext(ctx), "id", id, "delivery", d.ID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PingSubscription(ctx, id)
+}
+
+func (mw loggingMiddleware) Publish(ctx context.Context, e Event) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Publish", "namespace", e.Namespace, "event", e.Resource+"."+e.Operation, "objectid", e.ObjectID, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Publish(ctx, e)
+}
+
+func (mw loggingMiddleware) GetDelivery(ctx context.Context, id string) (d Delivery, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "GetDelivery", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.GetDelivery(ctx, id)
+}
+
+func (mw loggingMiddleware) ListDeliveries(ctx context.Context, f DeliveryFilter) (list []Delivery, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "ListDeliveries", "namespace", namespace.FromContext(ctx), "subscription", f.SubscriptionID, "status", f.Status, "count", len(list), "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.ListDeliveries(ctx, f)
+}
+
+func (mw loggingMiddleware) Redeliver(ctx context.Context, id string) (d Delivery, err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "Redeliver", "namespace", namespace.FromContext(ctx), "id", id, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.Redeliver(ctx, id)
+}
+
+// DueDeliveries is polled continuously and only logged when it hands out
+// deliveries or fails.
+func (mw loggingMiddleware) DueDeliveries(ctx context.Context, now time.Time) (list []Delivery, err error) {
+	defer func(begin time.Time) {
+		if len(list) > 0 || err != nil {
+			mw.logger.Log("method", "DueDeliveries", "count", len(list), "took", time.Since(begin), "err", err)
+		}
+	}(time.Now())
+	return mw.next.DueDeliveries(ctx, now)
+}
+
+func (mw loggingMiddleware) PutDeliveryAttempt(ctx context.Context, id string, a Attempt) (err error) {
+	defer func(begin time.Time) {
+		mw.logger.Log("method", "PutDeliveryAttempt", "namespace", namespace.FromContext(ctx), "id", id, "statuscode", a.StatusCode, "took", time.Since(begin), "err", err)
+	}(time.Now())
+	return mw.next.PutDeliveryAttempt(ctx, id, a)
+}
@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+var (
+	ErrBadRouting = errors.New("inconsistent mapping between route and handler (programmer error)")
+)
+
+func MakeHTTPHandler(s Webhook, logger log.Logger) http.Handler {
+	r := mux.NewRouter()
+	e := MakeServerEndpoints(s)
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerErrorEncoder(encodeError),
+		httptransport.ServerBefore(namespace.HTTPToContext),
+	}
+
+	for _, prefix := range []string{"/webhook/v1", "/webhook/v1/namespaces/{ns}"} {
+		r.Methods("POST").Path(prefix + "/subscriptions/").Handler(httptransport.NewServer(
+			e.PostSubscriptionEndpoint,
+			decodePostSubscriptionRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/subscriptions/").Handler(httptransport.NewServer(
+			e.ListSubscriptionsEndpoint,
+			decodeListSubscriptionsRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/subscriptions/{id}").Handler(httptransport.NewServer(
+			e.GetSubscriptionEndpoint,
+			decodeGetSubscriptionRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("PUT").Path(prefix + "/subscriptions/{id}").Handler(httptransport.NewServer(
+			e.PutSubscriptionEndpoint,
+			decodePutSubscriptionRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("DELETE").Path(prefix + "/subscriptions/{id}").Handler(httptransport.NewServer(
+			e.DeleteSubscriptionEndpoint,
+			decodeDeleteSubscriptionRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("POST").Path(prefix + "/subscriptions/{id}/ping").Handler(httptransport.NewServer(
+			e.PingSubscriptionEndpoint,
+			decodePingSubscriptionRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/deliveries/").Handler(httptransport.NewServer(
+			e.ListDeliveriesEndpoint,
+			decodeListDeliveriesRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("GET").Path(prefix + "/deliveries/{id}").Handler(httptransport.NewServer(
+			e.GetDeliveryEndpoint,
+			decodeGetDeliveryRequest,
+			encodeResponse,
+			options...,
+		))
+		r.Methods("POST").Path(prefix + "/deliveries/{id}/redeliver").Handler(httptransport.NewServer(
+			e.RedeliverEndpoint,
+			decodeRedeliverRequest,
+			encodeResponse,
+			options...,
+		))
+	}
+	return r
+}
+
+func decodePostSubscriptionRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req postSubscriptionRequest
+	if e := json.NewDecoder(r.Body).Decode(&req.Subscription); e != nil {
+		return nil, e
+	}
+	return req, nil
+}
+
+func decodeGetSubscriptionRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getSubscriptionRequest{ID: id}, nil
+}
+
+func decodePutSubscriptionRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	var sub Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		return nil, err
+	}
+	return putSubscriptionRequest{
+		ID:           id,
+		Subscription: sub,
+	}, nil
+}
+
+func decodeDeleteSubscriptionRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return deleteSubscriptionRequest{ID: id}, nil
+}
+
+func decodeListSubscriptionsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	return listSubscriptionsRequest{}, nil
+}
+
+func decodePingSubscriptionRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return pingSubscriptionRequest{ID: id}, nil
+}
+
+func decodeGetDeliveryRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return getDeliveryRequest{ID: id}, nil
+}
+
+func decodeListDeliveriesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	q := r.URL.Query()
+	return listDeliveriesRequest{Filter: DeliveryFilter{
+		SubscriptionID: q.Get("subscription"),
+		Status:         DeliveryStatus(q.Get("status")),
+	}}, nil
+}
+
+func decodeRedeliverRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, ok := mux.Vars(r)["id"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return redeliverRequest{ID: id}, nil
+}
+
+type errorer interface {
+	error() error
+}
+
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	if e, ok := response.(errorer); ok && e.error() != nil {
+		encodeError(ctx, e.error(), w)
+		return nil
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	return json.NewEncoder(w).Encode(response)
+}
+
+func encodeError(_ context.Context, err error, w http.ResponseWriter) {
+	if err == nil {
+		panic("encodeError with nil error")
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(codeFrom(err))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+func codeFrom(err error) int {
+	switch err {
+	case ErrNotFound:
+		return http.StatusNotFound
+	case ErrAlreadyExists, ErrInconsistentIDs, ErrInvalidSubscription, ErrInvalidURL, ErrInvalidFilter:
+		return http.StatusBadRequest
+	case ErrNotDeadLettered:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,551 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xinyu/infra/inventory/namespace"
+)
+
+type Webhook interface {
+	PostSubscription(ctx context.Context, s Subscription) error
+	GetSubscription(ctx context.Context, id string) (Subscription, error)
+	PutSubscription(ctx context.Context, id string, s Subscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+	ListSubscriptions(ctx context.Context) ([]Subscription, error)
+	PingSubscription(ctx context.Context, id string) (Delivery, error)
+	Publish(ctx context.Context, e Event) error
+	GetDelivery(ctx context.Context, id string) (Delivery, error)
+	ListDeliveries(ctx context.Context, f DeliveryFilter) ([]Delivery, error)
+	Redeliver(ctx context.Context, id string) (Delivery, error)
+	DueDeliveries(ctx context.Context, now time.Time) ([]Delivery, error)
+	PutDeliveryAttempt(ctx context.Context, id string, a Attempt) error
+}
+
+// Resources and operations events are published for. A ping event is only
+// sent by PingSubscription.
+const (
+	ResourceHost     = "host"
+	ResourceService  = "service"
+	ResourceInstance = "instance"
+
+	OpCreate   = "create"
+	OpUpdate   = "update"
+	OpDelete   = "delete"
+	OpUndelete = "undelete"
+	OpPurge    = "purge"
+	OpPing     = "ping"
+)
+
+// Subscription sends the events of its namespace that match Filter to URL.
+// Payloads are signed with Secret, which is never returned.
+type Subscription struct {
+	ID        string    `json:"id"`
+	Namespace string    `json:"namespace"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Filter    Filter    `json:"filter"`
+	CreatedAt time.Time `json:"createtime"`
+	UpdatedAt time.Time `json:"updatetime"`
+	Remark    string    `json:"remark"`
+}
+
+// Filter selects events by resource and operation, and by the labels of
+// the object. Empty fields match every event.
+type Filter struct {
+	Resources  []string          `json:"resources,omitempty"`
+	Operations []string          `json:"operations,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+func (f Filter) match(e Event) bool {
+	if e.Operation == OpPing {
+		return false
+	}
+	if len(f.Resources) > 0 && !contains(f.Resources, e.Resource) {
+		return false
+	}
+	if len(f.Operations) > 0 && !contains(f.Operations, e.Operation) {
+		return false
+	}
+	for k, v := range f.Labels {
+		if e.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a change to a host, service or instance. Object is the record
+// as written or, for deletes, as it was before.
+type Event struct {
+	ID        string            `json:"id"`
+	Time      time.Time         `json:"time"`
+	Namespace string            `json:"namespace"`
+	Resource  string            `json:"resource"`
+	Operation string            `json:"operation"`
+	ObjectID  string            `json:"objectid"`
+	Labels    map[string]string `json:"-"`
+	Object    interface{}       `json:"object,omitempty"`
+}
+
+type DeliveryStatus string
+
+// A delivery is pending until it succeeds or runs out of attempts, when it
+// is dead-lettered. It is delivering while an attempt is in flight.
+const (
+	DeliveryPending    DeliveryStatus = "pending"
+	DeliveryDelivering DeliveryStatus = "delivering"
+	DeliverySucceeded  DeliveryStatus = "succeeded"
+	DeliveryDead       DeliveryStatus = "dead"
+)
+
+// Delivery is the delivery of one event to one subscription, with the log
+// of its attempts.
+type Delivery struct {
+	ID             string          `json:"id"`
+	Namespace      string          `json:"namespace"`
+	SubscriptionID string          `json:"subscriptionid"`
+	EventID        string          `json:"eventid"`
+	Event          string          `json:"event"`
+	URL            string          `json:"url"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         DeliveryStatus  `json:"status"`
+	Attempts       []Attempt       `json:"attempts"`
+	NextAttempt    time.Time       `json:"nextattempt,omitempty"`
+	CreatedAt      time.Time       `json:"createtime"`
+	UpdatedAt      time.Time       `json:"updatetime"`
+	secret         string
+	// base is the number of attempts made before the delivery was last
+	// queued, which do not count towards maxAttempts.
+	base int
+}
+
+// Attempt is one try at a delivery. StatusCode is zero if no response was
+// received.
+type Attempt struct {
+	Time       time.Time     `json:"time"`
+	StatusCode int           `json:"statuscode,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+func (a Attempt) ok() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+// DeliveryFilter selects deliveries in ListDeliveries. Empty fields match
+// every delivery.
+type DeliveryFilter struct {
+	SubscriptionID string
+	Status         DeliveryStatus
+}
+
+func (f DeliveryFilter) match(d Delivery) bool {
+	if f.SubscriptionID != "" && f.SubscriptionID != d.SubscriptionID {
+		return false
+	}
+	if f.Status != "" && f.Status != d.Status {
+		return false
+	}
+	return true
+}
+
+// Retry policy. The delay before attempt n+1 is baseBackoff doubled n-1
+// times, capped at maxBackoff; a delivery is dead-lettered after
+// maxAttempts failed attempts.
+const (
+	maxAttempts = 8
+	baseBackoff = 2 * time.Second
+	maxBackoff  = 10 * time.Minute
+	// keepFinished is the number of finished deliveries kept per
+	// subscription for the delivery log.
+	keepFinished = 500
+)
+
+var (
+	ErrInconsistentIDs     = errors.New("inconsistent IDs")
+	ErrAlreadyExists       = errors.New("already exists")
+	ErrNotFound            = errors.New("not found")
+	ErrInvalidSubscription = errors.New("invalid subscription")
+	ErrInvalidURL          = errors.New("invalid webhook URL")
+	ErrInvalidFilter       = errors.New("invalid event filter")
+	ErrNotDeadLettered     = errors.New("delivery is not dead-lettered")
+)
+
+// key identifies a subscription or delivery across namespaces.
+type key struct {
+	namespace string
+	id        string
+}
+
+type inmemWebhook struct {
+	mtx        sync.RWMutex
+	subs       map[key]Subscription
+	deliveries map[key]*Delivery
+	// journal, if set, records every change; see NewFileWebhook.
+	journal *journal
+}
+
+// NewInmemWebhook returns a Webhook that queues deliveries in memory; they
+// are lost when the server stops.
+func NewInmemWebhook() Webhook {
+	return newInmemWebhook()
+}
+
+func newInmemWebhook() *inmemWebhook {
+	return &inmemWebhook{
+		subs:       map[key]Subscription{},
+		deliveries: map[key]*Delivery{},
+	}
+}
+
+func (s *inmemWebhook) PostSubscription(ctx context.Context, sub Subscription) error {
+	sub.Namespace = namespace.FromContext(ctx)
+	if err := sub.validate(); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: sub.Namespace, id: sub.ID}
+	if _, ok := s.subs[k]; ok {
+		return ErrAlreadyExists
+	}
+
+	currentTime := time.Now()
+	sub.CreatedAt = currentTime
+	sub.UpdatedAt = currentTime
+
+	s.subs[k] = sub
+	return s.record(subscriptionEntry(sub))
+}
+
+func (s *inmemWebhook) GetSubscription(ctx context.Context, id string) (Subscription, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	sub, ok := s.subs[key{namespace: namespace.FromContext(ctx), id: id}]
+	if !ok {
+		return Subscription{}, ErrNotFound
+	}
+	sub.Secret = ""
+	return sub, nil
+}
+
+// PutSubscription replaces a subscription. An empty secret keeps the
+// current one. Deliveries already queued keep their URL and secret.
+func (s *inmemWebhook) PutSubscription(ctx context.Context, id string, sub Subscription) error {
+	if id != sub.ID {
+		return ErrInconsistentIDs
+	}
+	sub.Namespace = namespace.FromContext(ctx)
+	if err := sub.validate(); err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: sub.Namespace, id: id}
+	sub.UpdatedAt = time.Now()
+	sub.CreatedAt = sub.UpdatedAt
+	if last, ok := s.subs[k]; ok {
+		sub.CreatedAt = last.CreatedAt
+		if sub.Secret == "" {
+			sub.Secret = last.Secret
+		}
+	}
+
+	s.subs[k] = sub
+	return s.record(subscriptionEntry(sub))
+}
+
+// DeleteSubscription removes a subscription along with its deliveries.
+func (s *inmemWebhook) DeleteSubscription(ctx context.Context, id string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	k := key{namespace: namespace.FromContext(ctx), id: id}
+	if _, ok := s.subs[k]; !ok {
+		return ErrNotFound
+	}
+	s.removeSubscription(k)
+	return s.record(removedEntry(kindSubscription, k))
+}
+
+func (s *inmemWebhook) removeSubscription(k key) {
+	delete(s.subs, k)
+	for dk, d := range s.deliveries {
+		if dk.namespace == k.namespace && d.SubscriptionID == k.id {
+			delete(s.deliveries, dk)
+		}
+	}
+}
+
+func (s *inmemWebhook) ListSubscriptions(ctx context.Context) ([]Subscription, error) {
+	ns := namespace.FromContext(ctx)
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []Subscription{}
+	for _, sub := range s.subs {
+		if sub.Namespace == ns {
+			sub.Secret = ""
+			list = append(list, sub)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// PingSubscription queues a ping event for subscription id only, to test
+// a receiver.
+func (s *inmemWebhook) PingSubscription(ctx context.Context, id string) (Delivery, error) {
+	e := Event{
+		ID:        newID(),
+		Time:      time.Now(),
+		Namespace: namespace.FromContext(ctx),
+		Operation: OpPing,
+		ObjectID:  id,
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return Delivery{}, err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	sub, ok := s.subs[key{namespace: e.Namespace, id: id}]
+	if !ok {
+		return Delivery{}, ErrNotFound
+	}
+	d := s.enqueue(sub, e, payload)
+	if err := s.record(deliveryEntry(d)); err != nil {
+		return Delivery{}, err
+	}
+	return d.copy(), nil
+}
+
+// Publish queues a delivery of e for every subscription of its namespace
+// whose filter matches.
+func (s *inmemWebhook) Publish(ctx context.Context, e Event) error {
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Namespace == "" {
+		e.Namespace = namespace.FromContext(ctx)
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var entries []entry
+	for _, sub := range s.subs {
+		if sub.Namespace == e.Namespace && sub.Filter.match(e) {
+			entries = append(entries, deliveryEntry(s.enqueue(sub, e, payload)))
+		}
+	}
+	return s.record(entries...)
+}
+
+func (s *inmemWebhook) enqueue(sub Subscription, e Event, payload []byte) *Delivery {
+	currentTime := time.Now()
+	d := &Delivery{
+		ID:             newID(),
+		Namespace:      sub.Namespace,
+		SubscriptionID: sub.ID,
+		EventID:        e.ID,
+		Event:          e.Resource + "." + e.Operation,
+		URL:            sub.URL,
+		Payload:        payload,
+		Status:         DeliveryPending,
+		Attempts:       []Attempt{},
+		NextAttempt:    currentTime,
+		CreatedAt:      currentTime,
+		UpdatedAt:      currentTime,
+		secret:         sub.Secret,
+	}
+	if e.Operation == OpPing {
+		d.Event = OpPing
+	}
+	s.deliveries[key{namespace: d.Namespace, id: d.ID}] = d
+	return d
+}
+
+func (s *inmemWebhook) GetDelivery(ctx context.Context, id string) (Delivery, error) {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	d, ok := s.deliveries[key{namespace: namespace.FromContext(ctx), id: id}]
+	if !ok {
+		return Delivery{}, ErrNotFound
+	}
+	return d.copy(), nil
+}
+
+// ListDeliveries returns the deliveries of the namespace of ctx, newest
+// first.
+func (s *inmemWebhook) ListDeliveries(ctx context.Context, f DeliveryFilter) ([]Delivery, error) {
+	ns := namespace.FromContext(ctx)
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	list := []Delivery{}
+	for _, d := range s.deliveries {
+		if d.Namespace == ns && f.match(*d) {
+			list = append(list, d.copy())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list, nil
+}
+
+// Redeliver queues a dead-lettered delivery again with a fresh set of
+// attempts. Its attempt log is kept.
+func (s *inmemWebhook) Redeliver(ctx context.Context, id string) (Delivery, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	d, ok := s.deliveries[key{namespace: namespace.FromContext(ctx), id: id}]
+	if !ok {
+		return Delivery{}, ErrNotFound
+	}
+	if d.Status != DeliveryDead {
+		return Delivery{}, ErrNotDeadLettered
+	}
+	d.Status = DeliveryPending
+	d.base = len(d.Attempts)
+	d.NextAttempt = time.Now()
+	d.UpdatedAt = d.NextAttempt
+	if err := s.record(deliveryEntry(d)); err != nil {
+		return Delivery{}, err
+	}
+	return d.copy(), nil
+}
+
+// DueDeliveries returns the pending deliveries of every namespace whose
+// next attempt is due and marks them as delivering, so that each is
+// handed out once. The change is not journaled: deliveries in flight when
+// the server stops are pending again when it starts.
+func (s *inmemWebhook) DueDeliveries(ctx context.Context, now time.Time) ([]Delivery, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	list := []Delivery{}
+	for _, d := range s.deliveries {
+		if d.Status == DeliveryPending && !now.Before(d.NextAttempt) {
+			d.Status = DeliveryDelivering
+			list = append(list, d.copy())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+// PutDeliveryAttempt records an attempt at delivery id and schedules the
+// next one, or dead-letters the delivery once it has failed maxAttempts
+// times since it was queued.
+func (s *inmemWebhook) PutDeliveryAttempt(ctx context.Context, id string, a Attempt) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	d, ok := s.deliveries[key{namespace: namespace.FromContext(ctx), id: id}]
+	if !ok {
+		return ErrNotFound
+	}
+	d.Attempts = append(d.Attempts, a)
+	d.UpdatedAt = time.Now()
+	if a.ok() {
+		d.Status = DeliverySucceeded
+		d.NextAttempt = time.Time{}
+		return s.record(append([]entry{deliveryEntry(d)}, s.prune(d.Namespace, d.SubscriptionID)...)...)
+	}
+
+	failures := len(d.Attempts) - d.base
+	if failures >= maxAttempts {
+		d.Status = DeliveryDead
+		d.NextAttempt = time.Time{}
+		return s.record(append([]entry{deliveryEntry(d)}, s.prune(d.Namespace, d.SubscriptionID)...)...)
+	}
+	d.Status = DeliveryPending
+	d.NextAttempt = a.Time.Add(backoff(failures))
+	return s.record(deliveryEntry(d))
+}
+
+func backoff(failures int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < failures && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// prune drops the oldest finished deliveries of a subscription beyond
+// keepFinished, and returns the journal entries of their removal.
+func (s *inmemWebhook) prune(ns, subID string) []entry {
+	var finished []*Delivery
+	for _, d := range s.deliveries {
+		if d.Namespace == ns && d.SubscriptionID == subID && (d.Status == DeliverySucceeded || d.Status == DeliveryDead) {
+			finished = append(finished, d)
+		}
+	}
+	if len(finished) <= keepFinished {
+		return nil
+	}
+	sort.Slice(finished, func(i, j int) bool { return finished[i].UpdatedAt.Before(finished[j].UpdatedAt) })
+	var entries []entry
+	for _, d := range finished[:len(finished)-keepFinished] {
+		k := key{namespace: ns, id: d.ID}
+		delete(s.deliveries, k)
+		entries = append(entries, removedEntry(kindDelivery, k))
+	}
+	return entries
+}
+
+func (d *Delivery) copy() Delivery {
+	c := *d
+	c.Attempts = append([]Attempt{}, d.Attempts...)
+	return c
+}
+
+func (sub Subscription) validate() error {
+	if sub.ID == "" {
+		return ErrInvalidSubscription
+	}
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	for _, r := range sub.Filter.Resources {
+		if r != ResourceHost && r != ResourceService && r != ResourceInstance {
+			return ErrInvalidFilter
+		}
+	}
+	for _, op := range sub.Filter.Operations {
+		switch op {
+		case OpCreate, OpUpdate, OpDelete, OpUndelete, OpPurge:
+		default:
+			return ErrInvalidFilter
+		}
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}